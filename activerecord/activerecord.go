@@ -18,6 +18,7 @@ type Alias interface {
 type ActiveRecord[T Alias] struct {
     client  *elasticsearch.TypedClient
     refresh bool
+    routing string
     entity  T
 }
 
@@ -34,10 +35,20 @@ func (r *ActiveRecord[T]) Refresh(refresh bool) *ActiveRecord[T] {
     return r
 }
 
+// 设置 routing,用于按 _id 读写 join 子文档等需要路由的文档,子文档实体自带的父文档 _id 优先 20261018
+func (r *ActiveRecord[T]) Routing(routing string) *ActiveRecord[T] {
+    r.routing = routing
+    return r
+}
+
 // 查询 _id 20250514
 func (r *ActiveRecord[T]) FindPK(c context.Context, id string) (T, error) {
     var result T
-    response, err := r.client.Get(r.GetAlias(), id).Do(c)
+    h := r.client.Get(r.GetAlias(), id)
+    if r.routing != "" {
+        h.Routing(r.routing)
+    }
+    response, err := h.Do(c)
     if err != nil {
         return result, err
     }
@@ -87,15 +98,26 @@ func (r *ActiveRecord[T]) FindOneByField(c context.Context, field string, value
 
 // 查询id是否存在 20250514
 func (r *ActiveRecord[T]) Exist(c context.Context, id string) (bool, error) {
-    return r.client.Exists(r.GetAlias(), id).Do(c)
+    h := r.client.Exists(r.GetAlias(), id)
+    if r.routing != "" {
+        h.Routing(r.routing)
+    }
+    return h.Do(c)
 }
 
-// 索引数据,完全覆盖
+// 索引数据,完全覆盖,实体实现 Join/JoinChild 时自动写入 join 字段与 routing
 func (r *ActiveRecord[T]) Index(c context.Context, entity T, id string) (_id string, _err error) {
-    h := r.client.Index(r.GetAlias()).Id(id).Document(entity)
+    doc, err := joinDocument(entity)
+    if err != nil {
+        return "", err
+    }
+    h := r.client.Index(r.GetAlias()).Id(id).Document(doc)
     if r.refresh {
         h.Refresh(refresh.True)
     }
+    if routing := r.routingFor(entity); routing != "" {
+        h.Routing(routing)
+    }
     response, err := h.Do(c)
     if err != nil {
         return "", err
@@ -109,6 +131,9 @@ func (r *ActiveRecord[T]) UpdateEntity(c context.Context, entity T, id string) e
     if r.refresh {
         h.Refresh(refresh.True)
     }
+    if routing := r.routingFor(entity); routing != "" {
+        h.Routing(routing)
+    }
     _, err := h.Do(c)
     return err
 }
@@ -120,6 +145,9 @@ func (r *ActiveRecord[T]) UpdatePartial(c context.Context, id string, fields map
     if r.refresh {
         h.Refresh(refresh.True)
     }
+    if r.routing != "" {
+        h.Routing(r.routing)
+    }
     _, err := h.Do(c)
     return err
 }
@@ -130,17 +158,27 @@ func (r *ActiveRecord[T]) UpdateField(c context.Context, id, field string, value
     if r.refresh {
         h.Refresh(refresh.True)
     }
+    if r.routing != "" {
+        h.Routing(r.routing)
+    }
     _, err := h.Do(c)
     return err
 }
 
-//  更新或创建数据
+//  更新或创建数据,实体实现 Join/JoinChild 时自动写入 join 字段与 routing
 func (r *ActiveRecord[T]) Upsert(c context.Context, id string, entities T) error {
-    h := r.client.Update(r.GetAlias(), id).Doc(entities).DocAsUpsert(true)
+    doc, err := joinDocument(entities)
+    if err != nil {
+        return err
+    }
+    h := r.client.Update(r.GetAlias(), id).Doc(doc).DocAsUpsert(true)
     if r.refresh {
         h.Refresh(refresh.True)
     }
-    _, err := h.Do(c)
+    if routing := r.routingFor(entities); routing != "" {
+        h.Routing(routing)
+    }
+    _, err = h.Do(c)
     return err
 }
 
@@ -150,6 +188,9 @@ func (r *ActiveRecord[T]) Delete(c context.Context, id string) error {
     if r.refresh {
         h.Refresh(refresh.True)
     }
+    if r.routing != "" {
+        h.Routing(r.routing)
+    }
     _, err := h.Do(c)
     return err
 }
@@ -0,0 +1,69 @@
+package activerecord
+
+import (
+    "encoding/json"
+)
+
+// Join 由使用 join 字段的实体实现,索引时自动写入 join 字段 20261018
+type Join interface {
+    // join 字段名,例如 "relation"
+    GetJoinField() string
+    // 当前文档的关系名称,例如 "question"、"answer"
+    GetJoinRelation() string
+}
+
+// JoinChild 由子文档实体实现,索引时 join 字段带上 parent,并使用父文档 _id 作为 routing 20261018
+type JoinChild interface {
+    Join
+    GetParentID() string
+}
+
+// JoinDescendant 由多层 join 中第二层及更深的子文档实现,同一棵关系树的文档必须位于同一分片,
+// 因此使用根文档 _id 而不是直接父文档 _id 作为 routing 20261018
+type JoinDescendant interface {
+    JoinChild
+    GetRootID() string
+}
+
+// JoinField 子文档 join 字段的值,父文档的 join 字段只是关系名称字符串 20261018
+type JoinField struct {
+    Name   string `json:"name"`
+    Parent string `json:"parent,omitempty"`
+}
+
+// 多层 join 的子文档返回根文档 _id,子文档返回父文档 _id 作为 routing,否则使用 Routing 设置的值 20261018
+func (r *ActiveRecord[T]) routingFor(entity T) string {
+    if descendant, ok := any(entity).(JoinDescendant); ok && descendant.GetRootID() != "" {
+        return descendant.GetRootID()
+    }
+    if child, ok := any(entity).(JoinChild); ok && child.GetParentID() != "" {
+        return child.GetParentID()
+    }
+    return r.routing
+}
+
+// 实现了 Join 的实体转换为带 join 字段的文档,其他实体原样返回 20261018
+func joinDocument(entity any) (any, error) {
+    join, ok := entity.(Join)
+    if !ok || join.GetJoinField() == "" {
+        return entity, nil
+    }
+    raw, err := json.Marshal(entity)
+    if err != nil {
+        return nil, err
+    }
+    doc := map[string]json.RawMessage{}
+    err = json.Unmarshal(raw, &doc)
+    if err != nil {
+        return nil, err
+    }
+    var value any = join.GetJoinRelation()
+    if child, ok := entity.(JoinChild); ok && child.GetParentID() != "" {
+        value = JoinField{Name: join.GetJoinRelation(), Parent: child.GetParentID()}
+    }
+    doc[join.GetJoinField()], err = json.Marshal(value)
+    if err != nil {
+        return nil, err
+    }
+    return doc, nil
+}
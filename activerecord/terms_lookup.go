@@ -0,0 +1,121 @@
+package activerecord
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "strings"
+
+    "github.com/elastic/go-elasticsearch/v8/typedapi/types"
+    "github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/refresh"
+    "github.com/qwenode/esb"
+)
+
+// 脚本更新遇到版本冲突时的重试次数 20261018
+const termsLookupRetryOnConflict = 3
+
+// ErrInvalidTermsLookupPath terms lookup 的 path 为空或包含 ".",脚本与 upsert 只能按顶层字段名写入 20261018
+var ErrInvalidTermsLookupPath = errors.New("invalid terms lookup path")
+
+// 追加不存在的值,没有变化时 noop,避免无意义的版本号增长 20261018
+const termsLookupAddScript = `def values = ctx._source[params.path];
+if (values == null) { values = new ArrayList(); ctx._source[params.path] = values; }
+else if (!(values instanceof List)) { values = new ArrayList([values]); ctx._source[params.path] = values; }
+boolean changed = false;
+for (def v : params.values) { if (!values.contains(v)) { values.add(v); changed = true; } }
+if (!changed) { ctx.op = 'noop'; }`
+
+// 删除指定的值,没有变化时 noop 20261018
+const termsLookupRemoveScript = `def values = ctx._source[params.path];
+if (values == null) { ctx.op = 'noop'; return; }
+if (!(values instanceof List)) { values = new ArrayList([values]); ctx._source[params.path] = values; }
+def removed = params.values;
+if (!values.removeIf(v -> removed.contains(v))) { ctx.op = 'noop'; }`
+
+// 向 terms lookup 文档的 path 字段追加值,使用脚本原子更新,文档不存在时创建;
+// path 只能是顶层字段,包含 "." 时返回 ErrInvalidTermsLookupPath 20261018
+func (r *ActiveRecord[T]) TermsLookupAdd(c context.Context, id, path string, values ...types.FieldValue) error {
+    return r.updateTermsLookup(c, id, path, termsLookupAddScript, values, dedupeFieldValues(values))
+}
+
+// 从 terms lookup 文档的 path 字段删除值,使用脚本原子更新,文档不存在时不做任何操作;
+// path 只能是顶层字段,包含 "." 时返回 ErrInvalidTermsLookupPath 20261018
+func (r *ActiveRecord[T]) TermsLookupRemove(c context.Context, id, path string, values ...types.FieldValue) error {
+    err := r.updateTermsLookup(c, id, path, termsLookupRemoveScript, values, nil)
+    if isDocumentMissing(err) {
+        return nil
+    }
+    return err
+}
+
+// 使用当前模型的索引作为 lookup 索引创建 terms lookup 查询,带上 Routing 设置的值 20261018
+func (r *ActiveRecord[T]) TermsLookupQuery(field, id, path string) esb.QueryOption {
+    var opts []esb.TermsLookupOption
+    if r.routing != "" {
+        opts = append(opts, esb.TermsLookupRouting(r.routing))
+    }
+    return esb.TermsLookup(field, r.GetAlias(), id, path, opts...)
+}
+
+// upsert 为 nil 时不写入 upsert,文档不存在时 Elasticsearch 返回 document_missing_exception 20261018
+func (r *ActiveRecord[T]) updateTermsLookup(c context.Context, id, path, source string, values, upsert []types.FieldValue) error {
+    if path == "" || strings.Contains(path, ".") {
+        return fmt.Errorf("%w: %q", ErrInvalidTermsLookupPath, path)
+    }
+    if len(values) == 0 {
+        return nil
+    }
+    params, err := termsLookupParams(path, values)
+    if err != nil {
+        return err
+    }
+    h := r.client.Update(r.GetAlias(), id).
+        Script(&types.Script{Source: &source, Params: params}).
+        RetryOnConflict(termsLookupRetryOnConflict)
+    if upsert != nil {
+        h.Upsert(map[string]any{path: upsert})
+    }
+    if r.refresh {
+        h.Refresh(refresh.True)
+    }
+    if r.routing != "" {
+        h.Routing(r.routing)
+    }
+    _, err = h.Do(c)
+    return err
+}
+
+func isDocumentMissing(err error) bool {
+    var esErr *types.ElasticsearchError
+    return errors.As(err, &esErr) && esErr.ErrorCause.Type == "document_missing_exception"
+}
+
+func termsLookupParams(path string, values []types.FieldValue) (map[string]json.RawMessage, error) {
+    rawPath, err := json.Marshal(path)
+    if err != nil {
+        return nil, err
+    }
+    rawValues, err := json.Marshal(values)
+    if err != nil {
+        return nil, err
+    }
+    return map[string]json.RawMessage{"path": rawPath, "values": rawValues}, nil
+}
+
+// 新建文档时写入的值需要去重,与脚本追加的结果保持一致 20261018
+func dedupeFieldValues(values []types.FieldValue) []types.FieldValue {
+    unique := make([]types.FieldValue, 0, len(values))
+    seen := make(map[string]struct{}, len(values))
+    for _, v := range values {
+        key, err := json.Marshal(v)
+        if err == nil {
+            if _, ok := seen[string(key)]; ok {
+                continue
+            }
+            seen[string(key)] = struct{}{}
+        }
+        unique = append(unique, v)
+    }
+    return unique
+}
@@ -0,0 +1,230 @@
+package esb
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+// aggBucket 是从任意桶聚合结果中读取出的桶。
+type aggBucket struct {
+	key      string
+	rawKey   any
+	docCount int64
+	aggs     map[string]types.Aggregate
+}
+
+// metricEntry 是度量聚合中的一个值，单值度量聚合的 name 为空字符串。
+type metricEntry struct {
+	name  string
+	value float64
+}
+
+// aggregateBuckets 通过反射读取桶聚合的桶。multi 为 false 时表示单桶聚合（filter、nested、global 等），
+// 此时返回 key 为空的一个桶；ok 为 false 表示不是桶聚合。
+func aggregateBuckets(aggregate types.Aggregate) (buckets []aggBucket, multi bool, ok bool) {
+	rv := reflect.ValueOf(aggregate)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil, false, false
+	}
+	rv = rv.Elem()
+	if field := rv.FieldByName("Buckets"); field.IsValid() {
+		value := field
+		if value.Kind() == reflect.Interface {
+			value = value.Elem()
+		}
+		switch value.Kind() {
+		case reflect.Slice:
+			for i := 0; i < value.Len(); i++ {
+				if bucket, ok := bucketOf(value.Index(i), ""); ok {
+					buckets = append(buckets, bucket)
+				}
+			}
+		case reflect.Map:
+			keys := make([]string, 0, value.Len())
+			for _, key := range value.MapKeys() {
+				keys = append(keys, key.String())
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				if bucket, ok := bucketOf(value.MapIndex(reflect.ValueOf(key)), key); ok {
+					buckets = append(buckets, bucket)
+				}
+			}
+		}
+		return buckets, true, true
+	}
+	if bucket, ok := bucketOf(rv, ""); ok {
+		return []aggBucket{bucket}, false, true
+	}
+	return nil, false, false
+}
+
+// bucketOf 读取桶结构体的 key、doc_count 和子聚合，mapKey 为 keyed 桶的 map key。
+func bucketOf(rv reflect.Value, mapKey string) (aggBucket, bool) {
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return aggBucket{}, false
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return aggBucket{}, false
+	}
+	docCount := rv.FieldByName("DocCount")
+	aggs := rv.FieldByName("Aggregations")
+	if !docCount.IsValid() || docCount.Kind() != reflect.Int64 || !aggs.IsValid() {
+		return aggBucket{}, false
+	}
+	bucket := aggBucket{key: mapKey, docCount: docCount.Int()}
+	bucket.aggs, _ = aggs.Interface().(map[string]types.Aggregate)
+	if key := rv.FieldByName("Key"); key.IsValid() {
+		bucket.rawKey = key.Interface()
+		if mapKey == "" {
+			bucket.key = formatBucketKey(bucket.rawKey)
+		}
+	}
+	if keyAsString := rv.FieldByName("KeyAsString"); keyAsString.IsValid() && mapKey == "" {
+		if s, ok := keyAsString.Interface().(*string); ok && s != nil && *s != "" {
+			bucket.key = *s
+		}
+	}
+	return bucket, true
+}
+
+// formatBucketKey 将桶的 key 转换为字符串，多个值（multi_terms、composite）使用 | 连接。
+func formatBucketKey(key any) string {
+	switch k := key.(type) {
+	case nil:
+		return ""
+	case string:
+		return k
+	case *string:
+		if k == nil {
+			return ""
+		}
+		return *k
+	case int64:
+		return strconv.FormatInt(k, 10)
+	case float64:
+		return strconv.FormatFloat(k, 'f', -1, 64)
+	case types.Float64:
+		return strconv.FormatFloat(float64(k), 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(k)
+	case []types.FieldValue:
+		parts := make([]string, len(k))
+		for i, v := range k {
+			parts[i] = formatBucketKey(v)
+		}
+		return strings.Join(parts, "|")
+	case types.CompositeAggregateKey:
+		names := make([]string, 0, len(k))
+		for name := range k {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		parts := make([]string, len(names))
+		for i, name := range names {
+			parts[i] = formatBucketKey(k[name])
+		}
+		return strings.Join(parts, "|")
+	}
+	return fmt.Sprint(key)
+}
+
+// metricValues 读取度量聚合的值：单值度量聚合返回名称为空的一个值，
+// stats、extended_stats、boxplot 等多值度量聚合返回各个数值字段，percentiles 返回各个百分位。
+// 值为 null 的字段会被忽略，ok 为 false 表示不是可以转换为数值的度量聚合。
+func metricValues(aggregate types.Aggregate) (values []metricEntry, ok bool) {
+	if value, ok := metricValue(aggregate); ok {
+		if f, ok := toFloat(value); ok {
+			values = append(values, metricEntry{value: f})
+		}
+		return values, true
+	}
+	rv := reflect.ValueOf(aggregate)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil, false
+	}
+	rv = rv.Elem()
+	if rv.FieldByName("DocCount").IsValid() || rv.FieldByName("Buckets").IsValid() {
+		return nil, false
+	}
+	if percentiles := rv.FieldByName("Values"); percentiles.IsValid() {
+		switch p := percentiles.Interface().(type) {
+		case map[string]any:
+			for _, key := range sortedPercentileKeys(p) {
+				if f, ok := toFloat(p[key]); ok {
+					values = append(values, metricEntry{name: key, value: f})
+				}
+			}
+			return values, true
+		case types.KeyedPercentiles:
+			for _, key := range sortedPercentileKeys(p) {
+				if f, err := strconv.ParseFloat(p[key], 64); err == nil {
+					values = append(values, metricEntry{name: key, value: f})
+				}
+			}
+			return values, true
+		case []types.ArrayPercentilesItem:
+			for _, item := range p {
+				if item.Value != nil {
+					values = append(values, metricEntry{name: item.Key, value: float64(*item.Value)})
+				}
+			}
+			return values, true
+		}
+	}
+	rt := rv.Type()
+	for i := 0; i < rv.NumField(); i++ {
+		name, _, _ := strings.Cut(rt.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		if f, ok := toFloat(rv.Field(i).Interface()); ok {
+			values = append(values, metricEntry{name: name, value: f})
+		}
+	}
+	return values, len(values) > 0
+}
+
+// sortedPercentileKeys 按百分位的数值大小排序 key。
+func sortedPercentileKeys[V any](percentiles map[string]V) []string {
+	keys := make([]string, 0, len(percentiles))
+	for key := range percentiles {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, errA := strconv.ParseFloat(keys[i], 64)
+		b, errB := strconv.ParseFloat(keys[j], 64)
+		if errA != nil || errB != nil {
+			return keys[i] < keys[j]
+		}
+		return a < b
+	})
+	return keys
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case types.Float64:
+		return float64(n), true
+	case *types.Float64:
+		if n == nil {
+			return 0, false
+		}
+		return float64(*n), true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
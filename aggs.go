@@ -1,10 +1,19 @@
 package esb
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+
 	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
 	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/calendarinterval"
 )
 
+var (
+	// ErrMissingParentAgg 添加子聚合时父聚合不存在
+	ErrMissingParentAgg = errors.New("parent aggregation not found")
+)
+
 // AggregationOption 表示一个修改 types.Aggregations 的函数。
 // 它遵循函数式选项模式来构建 Elasticsearch 聚合。
 type AggregationOption func(*types.Aggregations)
@@ -28,6 +37,20 @@ func NewAggregations(opts ...AggregationOption) map[string]types.Aggregations {
 	return aggs.Aggregations
 }
 
+// withSubAggs 将子聚合应用到桶聚合上，没有子聚合时不创建 Aggregations。
+func withSubAggs(agg types.Aggregations, subAggs []AggregationOption) types.Aggregations {
+	if len(subAggs) == 0 {
+		return agg
+	}
+	if agg.Aggregations == nil {
+		agg.Aggregations = make(map[string]types.Aggregations)
+	}
+	for _, subAgg := range subAggs {
+		subAgg(&agg)
+	}
+	return agg
+}
+
 // TermsAgg 创建一个词项聚合，用于统计字段的不同值及其文档数量。
 // Terms 聚合是最常用的桶聚合之一。
 //
@@ -224,7 +247,7 @@ func DateHistogramAgg(name, field, interval string, subAggs ...AggregationOption
 //       format := "yyyy-MM-dd"
 //       opts.Format = &format
 //   })
-func DateHistogramAggWithOptions(name, field, interval string, setOpts func(opts *types.DateHistogramAggregation)) AggregationOption {
+func DateHistogramAggWithOptions(name, field, interval string, setOpts func(opts *types.DateHistogramAggregation), subAggs ...AggregationOption) AggregationOption {
 	return func(aggs *types.Aggregations) {
 		calInterval := calendarinterval.CalendarInterval{Name: interval}
 		dateHistAgg := &types.DateHistogramAggregation{
@@ -236,9 +259,9 @@ func DateHistogramAggWithOptions(name, field, interval string, setOpts func(opts
 			setOpts(dateHistAgg)
 		}
 		
-		aggs.Aggregations[name] = types.Aggregations{
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
 			DateHistogram: dateHistAgg,
-		}
+		}, subAggs)
 	}
 }
 
@@ -246,15 +269,16 @@ func DateHistogramAggWithOptions(name, field, interval string, setOpts func(opts
 //
 // 示例：
 //   esb.HistogramAgg("price_ranges", "price", 100)
-func HistogramAgg(name, field string, interval float64) AggregationOption {
+//   esb.HistogramAgg("price_ranges", "price", 100, esb.CardinalityAgg("brands", "brand"))
+func HistogramAgg(name, field string, interval float64, subAggs ...AggregationOption) AggregationOption {
 	return func(aggs *types.Aggregations) {
 		intervalFloat := types.Float64(interval)
-		aggs.Aggregations[name] = types.Aggregations{
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
 			Histogram: &types.HistogramAggregation{
 				Field:    &field,
 				Interval: &intervalFloat,
 			},
-		}
+		}, subAggs)
 	}
 }
 
@@ -266,14 +290,14 @@ func HistogramAgg(name, field string, interval float64) AggregationOption {
 //       {From: types.Float64(100), To: types.Float64(500)},
 //       {From: types.Float64(500)},
 //   })
-func RangeAgg(name, field string, ranges []types.AggregationRange) AggregationOption {
+func RangeAgg(name, field string, ranges []types.AggregationRange, subAggs ...AggregationOption) AggregationOption {
 	return func(aggs *types.Aggregations) {
-		aggs.Aggregations[name] = types.Aggregations{
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
 			Range: &types.RangeAggregation{
 				Field:  &field,
 				Ranges: ranges,
 			},
-		}
+		}, subAggs)
 	}
 }
 
@@ -281,16 +305,17 @@ func RangeAgg(name, field string, ranges []types.AggregationRange) AggregationOp
 //
 // 示例：
 //   esb.FilterAgg("expensive_products", esb.Range("price", 1000, nil))
-func FilterAgg(name string, query QueryOption) AggregationOption {
+//   esb.FilterAgg("t_shirts", esb.Term("type", "t-shirt"), esb.AvgAgg("avg_price", "price"))
+func FilterAgg(name string, query QueryOption, subAggs ...AggregationOption) AggregationOption {
 	return func(aggs *types.Aggregations) {
 		filterQuery := &types.Query{}
 		if query != nil {
 			query(filterQuery)
 		}
 		
-		aggs.Aggregations[name] = types.Aggregations{
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
 			Filter: filterQuery,
-		}
+		}, subAggs)
 	}
 }
 
@@ -301,7 +326,7 @@ func FilterAgg(name string, query QueryOption) AggregationOption {
 //       "electronics": esb.Term("category", "electronics"),
 //       "books": esb.Term("category", "books"),
 //   })
-func FiltersAgg(name string, filters map[string]QueryOption) AggregationOption {
+func FiltersAgg(name string, filters map[string]QueryOption, subAggs ...AggregationOption) AggregationOption {
 	return func(aggs *types.Aggregations) {
 		namedFilters := make(map[string]*types.Query)
 		for key, queryOpt := range filters {
@@ -312,11 +337,11 @@ func FiltersAgg(name string, filters map[string]QueryOption) AggregationOption {
 			namedFilters[key] = query
 		}
 		
-		aggs.Aggregations[name] = types.Aggregations{
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
 			Filters: &types.FiltersAggregation{
 				Filters: types.BucketsQuery(namedFilters),
 			},
-		}
+		}, subAggs)
 	}
 }
 
@@ -324,13 +349,14 @@ func FiltersAgg(name string, filters map[string]QueryOption) AggregationOption {
 //
 // 示例：
 //   esb.NestedAgg("nested_products", "products")
-func NestedAgg(name, path string) AggregationOption {
+//   esb.NestedAgg("nested_products", "products", esb.AvgAgg("avg_price", "products.price"))
+func NestedAgg(name, path string, subAggs ...AggregationOption) AggregationOption {
 	return func(aggs *types.Aggregations) {
-		aggs.Aggregations[name] = types.Aggregations{
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
 			Nested: &types.NestedAggregation{
 				Path: &path,
 			},
-		}
+		}, subAggs)
 	}
 }
 
@@ -338,19 +364,23 @@ func NestedAgg(name, path string) AggregationOption {
 //
 // 示例：
 //   esb.GlobalAgg("all_docs")
-func GlobalAgg(name string) AggregationOption {
+func GlobalAgg(name string, subAggs ...AggregationOption) AggregationOption {
 	return func(aggs *types.Aggregations) {
-		aggs.Aggregations[name] = types.Aggregations{
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
 			Global: &types.GlobalAggregation{},
-		}
+		}, subAggs)
 	}
 }
 
-// SubAgg 为聚合添加子聚合。
+// SubAgg 为聚合添加子聚合。父聚合不存在时会创建一个没有类型的空容器，Elasticsearch 会拒绝该请求。
+//
+// Deprecated: 父聚合名称写错时不会报错。直接在桶聚合的 subAggs 参数中传入子聚合，
+// 或者使用 MustSubAgg（父聚合不存在时 panic）、AddSubAggs（父聚合不存在时返回错误）。
 //
 // 示例：
-//   esb.TermsAgg("categories", "category").SubAgg(
-//       esb.AvgAgg("avg_price", "price"),
+//   esb.NewAggregations(
+//       esb.TermsAgg("categories", "category"),
+//       esb.SubAgg("categories", esb.AvgAgg("avg_price", "price")),
 //   )
 func SubAgg(parentName string, subAggs ...AggregationOption) AggregationOption {
 	return func(aggs *types.Aggregations) {
@@ -376,6 +406,47 @@ func SubAgg(parentName string, subAggs ...AggregationOption) AggregationOption {
 	}
 }
 
+// MustSubAgg 为同一层中已经添加的聚合添加子聚合，父聚合不存在时 panic ErrMissingParentAgg，
+// 用于替代 SubAgg，使父聚合名称写错时立即暴露。父聚合需要在 MustSubAgg 之前添加。
+//
+// 示例：
+//   esb.NewAggregations(
+//       esb.FilterAgg("hats", esb.Term("type", "hat")),
+//       esb.MustSubAgg("hats", esb.SumAgg("sales", "price")),
+//   )
+func MustSubAgg(parentName string, subAggs ...AggregationOption) AggregationOption {
+	return func(aggs *types.Aggregations) {
+		if !addSubAggs(aggs.Aggregations, []string{parentName}, subAggs) {
+			panic(fmt.Errorf("%w: %s", ErrMissingParentAgg, parentName))
+		}
+	}
+}
+
+// AddSubAggs 向 aggs 中已存在的聚合添加子聚合，parentPath 使用 > 分隔表示逐层进入子聚合。
+// 与 SubAgg 不同，父聚合不存在时返回 ErrMissingParentAgg，而不是创建空容器。
+//
+// 示例：
+//   aggs := esb.NewAggregations(esb.TermsAgg("categories", "category", esb.TermsAgg("brands", "brand")))
+//   err := esb.AddSubAggs(aggs, "categories>brands", esb.AvgAgg("avg_price", "price"))
+func AddSubAggs(aggs map[string]types.Aggregations, parentPath string, subAggs ...AggregationOption) error {
+	if !addSubAggs(aggs, strings.Split(parentPath, ">"), subAggs) {
+		return fmt.Errorf("%w: %s", ErrMissingParentAgg, parentPath)
+	}
+	return nil
+}
+
+func addSubAggs(aggs map[string]types.Aggregations, path []string, subAggs []AggregationOption) bool {
+	parent, exists := aggs[path[0]]
+	if !exists {
+		return false
+	}
+	if len(path) > 1 {
+		return addSubAggs(parent.Aggregations, path[1:], subAggs)
+	}
+	aggs[path[0]] = withSubAggs(parent, subAggs)
+	return true
+}
+
 // 便捷函数：常用聚合组合
 
 // TopTermsAgg 创建一个获取前N个词项的聚合，这是最常用的场景。
@@ -410,7 +481,7 @@ func MonthlyHistogramAgg(name, field string, subAggs ...AggregationOption) Aggre
 //
 // 示例：
 //   esb.PriceRangeAgg("price_segments", "price", []float64{0, 100, 500, 1000})
-func PriceRangeAgg(name, field string, boundaries []float64) AggregationOption {
+func PriceRangeAgg(name, field string, boundaries []float64, subAggs ...AggregationOption) AggregationOption {
 	ranges := make([]types.AggregationRange, 0, len(boundaries))
 	
 	for i := 0; i < len(boundaries); i++ {
@@ -435,7 +506,7 @@ func PriceRangeAgg(name, field string, boundaries []float64) AggregationOption {
 		ranges = append(ranges, aggRange)
 	}
 	
-	return RangeAgg(name, field, ranges)
+	return RangeAgg(name, field, ranges, subAggs...)
 }
 
 // 补充重要的聚合类型
@@ -498,13 +569,13 @@ func TopHitsAgg(name string, size int) AggregationOption {
 //
 // 示例：
 //   esb.SignificantTermsAgg("significant_tags", "tags")
-func SignificantTermsAgg(name, field string) AggregationOption {
+func SignificantTermsAgg(name, field string, subAggs ...AggregationOption) AggregationOption {
 	return func(aggs *types.Aggregations) {
-		aggs.Aggregations[name] = types.Aggregations{
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
 			SignificantTerms: &types.SignificantTermsAggregation{
 				Field: &field,
 			},
-		}
+		}, subAggs)
 	}
 }
 
@@ -544,7 +615,7 @@ func GeoCentroidAgg(name, field string) AggregationOption {
 //   esb.GeoDistanceAgg("distance_ranges", "location", "40.7128,-74.0060", 
 //       []string{"0-1km", "1-5km", "5-10km", "10km+"}, 
 //       []float64{1000, 5000, 10000})
-func GeoDistanceAgg(name, field, origin string, rangeKeys []string, distances []float64) AggregationOption {
+func GeoDistanceAgg(name, field, origin string, rangeKeys []string, distances []float64, subAggs ...AggregationOption) AggregationOption {
 	return func(aggs *types.Aggregations) {
 		ranges := make([]types.AggregationRange, len(distances)+1)
 		
@@ -583,13 +654,13 @@ func GeoDistanceAgg(name, field, origin string, rangeKeys []string, distances []
 			}
 		}
 		
-		aggs.Aggregations[name] = types.Aggregations{
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
 			GeoDistance: &types.GeoDistanceAggregation{
 				Field:  &field,
 				Origin: origin,
 				Ranges: ranges,
 			},
-		}
+		}, subAggs)
 	}
 }
 
@@ -603,14 +674,14 @@ func GeoDistanceAgg(name, field, origin string, rangeKeys []string, distances []
 //       {From: "2023-01-01", To: "2023-12-31"},
 //       {From: "2023-12-31"},
 //   })
-func DateRangeAgg(name, field string, ranges []types.DateRangeExpression) AggregationOption {
+func DateRangeAgg(name, field string, ranges []types.DateRangeExpression, subAggs ...AggregationOption) AggregationOption {
 	return func(aggs *types.Aggregations) {
-		aggs.Aggregations[name] = types.Aggregations{
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
 			DateRange: &types.DateRangeAggregation{
 				Field:  &field,
 				Ranges: ranges,
 			},
-		}
+		}, subAggs)
 	}
 }
 
@@ -623,14 +694,14 @@ func DateRangeAgg(name, field string, ranges []types.DateRangeExpression) Aggreg
 //       {To: &to1},
 //       {From: &from2},
 //   })
-func IpRangeAgg(name, field string, ranges []types.IpRangeAggregationRange) AggregationOption {
+func IpRangeAgg(name, field string, ranges []types.IpRangeAggregationRange, subAggs ...AggregationOption) AggregationOption {
 	return func(aggs *types.Aggregations) {
-		aggs.Aggregations[name] = types.Aggregations{
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
 			IpRange: &types.IpRangeAggregation{
 				Field:  &field,
 				Ranges: ranges,
 			},
-		}
+		}, subAggs)
 	}
 }
 
@@ -638,13 +709,13 @@ func IpRangeAgg(name, field string, ranges []types.IpRangeAggregationRange) Aggr
 //
 // 示例：
 //   esb.MissingAgg("missing_emails", "email")
-func MissingAgg(name, field string) AggregationOption {
+func MissingAgg(name, field string, subAggs ...AggregationOption) AggregationOption {
 	return func(aggs *types.Aggregations) {
-		aggs.Aggregations[name] = types.Aggregations{
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
 			Missing: &types.MissingAggregation{
 				Field: &field,
 			},
-		}
+		}, subAggs)
 	}
 }
 
@@ -652,13 +723,13 @@ func MissingAgg(name, field string) AggregationOption {
 //
 // 示例：
 //   esb.RareTermsAgg("rare_categories", "category")
-func RareTermsAgg(name, field string) AggregationOption {
+func RareTermsAgg(name, field string, subAggs ...AggregationOption) AggregationOption {
 	return func(aggs *types.Aggregations) {
-		aggs.Aggregations[name] = types.Aggregations{
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
 			RareTerms: &types.RareTermsAggregation{
 				Field: &field,
 			},
-		}
+		}, subAggs)
 	}
 }
 
@@ -666,13 +737,13 @@ func RareTermsAgg(name, field string) AggregationOption {
 //
 // 示例：
 //   esb.SamplerAgg("sample", 1000)
-func SamplerAgg(name string, shardSize int) AggregationOption {
+func SamplerAgg(name string, shardSize int, subAggs ...AggregationOption) AggregationOption {
 	return func(aggs *types.Aggregations) {
-		aggs.Aggregations[name] = types.Aggregations{
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
 			Sampler: &types.SamplerAggregation{
 				ShardSize: &shardSize,
 			},
-		}
+		}, subAggs)
 	}
 }
 
@@ -680,18 +751,19 @@ func SamplerAgg(name string, shardSize int) AggregationOption {
 //
 // 示例：
 //   esb.DiversifiedSamplerAgg("diversified_sample", "category", 1000)
-func DiversifiedSamplerAgg(name, field string, shardSize int) AggregationOption {
+func DiversifiedSamplerAgg(name, field string, shardSize int, subAggs ...AggregationOption) AggregationOption {
 	return func(aggs *types.Aggregations) {
-		aggs.Aggregations[name] = types.Aggregations{
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
 			DiversifiedSampler: &types.DiversifiedSamplerAggregation{
 				Field:     &field,
 				ShardSize: &shardSize,
 			},
-		}
+		}, subAggs)
 	}
 }
 
 // ReverseNestedAgg 创建反向嵌套聚合，从嵌套文档聚合回到父文档。
+// 可变参数是 path，不接受子聚合；需要子聚合时使用 ReverseNestedAggWithOptions(name, nil, subAggs...)。
 //
 // 示例：
 //   esb.ReverseNestedAgg("back_to_parent")
@@ -708,17 +780,37 @@ func ReverseNestedAgg(name string, path ...string) AggregationOption {
 	}
 }
 
+// ReverseNestedAggWithOptions 提供回调函数式的反向嵌套聚合配置，可以设置 path 并添加子聚合。
+//
+// 示例：
+//   esb.NestedAgg("comments", "comments",
+//       esb.TermsAgg("authors", "comments.author",
+//           esb.ReverseNestedAggWithOptions("posts", nil, esb.TermsAgg("tags", "tags")),
+//       ),
+//   )
+func ReverseNestedAggWithOptions(name string, setOpts func(opts *types.ReverseNestedAggregation), subAggs ...AggregationOption) AggregationOption {
+	return func(aggs *types.Aggregations) {
+		reverseNested := &types.ReverseNestedAggregation{}
+		if setOpts != nil {
+			setOpts(reverseNested)
+		}
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
+			ReverseNested: reverseNested,
+		}, subAggs)
+	}
+}
+
 // ChildrenAgg 创建子文档聚合，聚合指定类型的子文档。
 //
 // 示例：
 //   esb.ChildrenAgg("child_products", "product")
-func ChildrenAgg(name, childType string) AggregationOption {
+func ChildrenAgg(name, childType string, subAggs ...AggregationOption) AggregationOption {
 	return func(aggs *types.Aggregations) {
-		aggs.Aggregations[name] = types.Aggregations{
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
 			Children: &types.ChildrenAggregation{
 				Type: &childType,
 			},
-		}
+		}, subAggs)
 	}
 }
 
@@ -726,13 +818,13 @@ func ChildrenAgg(name, childType string) AggregationOption {
 //
 // 示例：
 //   esb.ParentAgg("parent_categories", "category")
-func ParentAgg(name, parentType string) AggregationOption {
+func ParentAgg(name, parentType string, subAggs ...AggregationOption) AggregationOption {
 	return func(aggs *types.Aggregations) {
-		aggs.Aggregations[name] = types.Aggregations{
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
 			Parent: &types.ParentAggregation{
 				Type: &parentType,
 			},
-		}
+		}, subAggs)
 	}
 }
 
@@ -740,14 +832,14 @@ func ParentAgg(name, parentType string) AggregationOption {
 //
 // 示例：
 //   esb.AutoDateHistogramAgg("auto_dates", "timestamp", 10)
-func AutoDateHistogramAgg(name, field string, buckets int) AggregationOption {
+func AutoDateHistogramAgg(name, field string, buckets int, subAggs ...AggregationOption) AggregationOption {
 	return func(aggs *types.Aggregations) {
-		aggs.Aggregations[name] = types.Aggregations{
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
 			AutoDateHistogram: &types.AutoDateHistogramAggregation{
 				Field:   &field,
 				Buckets: &buckets,
 			},
-		}
+		}, subAggs)
 	}
 }
 
@@ -755,14 +847,14 @@ func AutoDateHistogramAgg(name, field string, buckets int) AggregationOption {
 //
 // 示例：
 //   esb.VariableWidthHistogramAgg("variable_histogram", "price", 10)
-func VariableWidthHistogramAgg(name, field string, buckets int) AggregationOption {
+func VariableWidthHistogramAgg(name, field string, buckets int, subAggs ...AggregationOption) AggregationOption {
 	return func(aggs *types.Aggregations) {
-		aggs.Aggregations[name] = types.Aggregations{
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
 			VariableWidthHistogram: &types.VariableWidthHistogramAggregation{
 				Field:   &field,
 				Buckets: &buckets,
 			},
-		}
+		}, subAggs)
 	}
 }
 
@@ -773,13 +865,15 @@ func VariableWidthHistogramAgg(name, field string, buckets int) AggregationOptio
 //       {"category": {Terms: &types.CompositeTermsAggregation{Field: "category"}}},
 //   }
 //   esb.CompositeAgg("composite", sources)
-func CompositeAgg(name string, sources []map[string]types.CompositeAggregationSource) AggregationOption {
+//
+// 使用 CompositeSourcesAgg 可以通过类型化的值源构建，NewCompositeIterator 可以遍历所有桶。
+func CompositeAgg(name string, sources []map[string]types.CompositeAggregationSource, subAggs ...AggregationOption) AggregationOption {
 	return func(aggs *types.Aggregations) {
-		aggs.Aggregations[name] = types.Aggregations{
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
 			Composite: &types.CompositeAggregation{
 				Sources: sources,
 			},
-		}
+		}, subAggs)
 	}
 }
 
@@ -790,13 +884,13 @@ func CompositeAgg(name string, sources []map[string]types.CompositeAggregationSo
 //       {Field: "category"},
 //       {Field: "brand"},
 //   })
-func MultiTermsAgg(name string, terms []types.MultiTermLookup) AggregationOption {
+func MultiTermsAgg(name string, terms []types.MultiTermLookup, subAggs ...AggregationOption) AggregationOption {
 	return func(aggs *types.Aggregations) {
-		aggs.Aggregations[name] = types.Aggregations{
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
 			MultiTerms: &types.MultiTermsAggregation{
 				Terms: terms,
 			},
-		}
+		}, subAggs)
 	}
 }
 
@@ -804,13 +898,13 @@ func MultiTermsAgg(name string, terms []types.MultiTermLookup) AggregationOption
 //
 // 示例：
 //   esb.SignificantTextAgg("significant_text", "description")
-func SignificantTextAgg(name, field string) AggregationOption {
+func SignificantTextAgg(name, field string, subAggs ...AggregationOption) AggregationOption {
 	return func(aggs *types.Aggregations) {
-		aggs.Aggregations[name] = types.Aggregations{
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
 			SignificantText: &types.SignificantTextAggregation{
 				Field: &field,
 			},
-		}
+		}, subAggs)
 	}
 }
 
@@ -961,14 +1055,14 @@ func CumulativeSumAgg(name, bucketsPath string) AggregationOption {
 //
 // 示例：
 //   esb.GeohashGridAgg("location_grid", "location", 5)
-func GeohashGridAgg(name, field string, precision int) AggregationOption {
+func GeohashGridAgg(name, field string, precision int, subAggs ...AggregationOption) AggregationOption {
 	return func(aggs *types.Aggregations) {
-		aggs.Aggregations[name] = types.Aggregations{
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
 			GeohashGrid: &types.GeoHashGridAggregation{
 				Field:     &field,
 				Precision: &precision,
 			},
-		}
+		}, subAggs)
 	}
 }
 
@@ -976,14 +1070,14 @@ func GeohashGridAgg(name, field string, precision int) AggregationOption {
 //
 // 示例：
 //   esb.GeotileGridAgg("tile_grid", "location", 8)
-func GeotileGridAgg(name, field string, precision int) AggregationOption {
+func GeotileGridAgg(name, field string, precision int, subAggs ...AggregationOption) AggregationOption {
 	return func(aggs *types.Aggregations) {
-		aggs.Aggregations[name] = types.Aggregations{
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
 			GeotileGrid: &types.GeoTileGridAggregation{
 				Field:     &field,
 				Precision: &precision,
 			},
-		}
+		}, subAggs)
 	}
 }
 
@@ -1,6 +1,8 @@
 package esb
 
 import (
+	"errors"
+	"strings"
 	"testing"
 )
 
@@ -137,4 +139,96 @@ func TestMetricAggregations(t *testing.T) {
 			t.Errorf("Expected field to be 'sales', got '%s'", *sumAgg.Sum.Field)
 		}
 	})
-}
\ No newline at end of file
+}
+
+func TestBucketAggregationSubAggs(t *testing.T) {
+	sub := AvgAgg("avg_price", "price")
+	builders := map[string]AggregationOption{
+		"histogram":        HistogramAgg("agg", "price", 100, sub),
+		"range":            RangeAgg("agg", "price", nil, sub),
+		"price_range":      PriceRangeAgg("agg", "price", []float64{0, 100}, sub),
+		"filter":           FilterAgg("agg", Term("type", "hat"), sub),
+		"filters":          FiltersAgg("agg", map[string]QueryOption{"hats": Term("type", "hat")}, sub),
+		"nested":           NestedAgg("agg", "products", sub),
+		"reverse_nested":   ReverseNestedAggWithOptions("agg", nil, sub),
+		"global":           GlobalAgg("agg", sub),
+		"date_histogram":   DateHistogramAggWithOptions("agg", "date", "1d", nil, sub),
+		"date_range":       DateRangeAgg("agg", "date", nil, sub),
+		"ip_range":         IpRangeAgg("agg", "ip", nil, sub),
+		"geo_distance":     GeoDistanceAgg("agg", "location", "0,0", nil, []float64{1000}, sub),
+		"missing":          MissingAgg("agg", "email", sub),
+		"rare_terms":       RareTermsAgg("agg", "category", sub),
+		"significant":      SignificantTermsAgg("agg", "tags", sub),
+		"sampler":          SamplerAgg("agg", 100, sub),
+		"children":         ChildrenAgg("agg", "answer", sub),
+		"auto_date":        AutoDateHistogramAgg("agg", "date", 10, sub),
+		"multi_terms":      MultiTermsAgg("agg", nil, sub),
+		"geohash_grid":     GeohashGridAgg("agg", "location", 5, sub),
+		"geotile_grid":     GeotileGridAgg("agg", "location", 5, sub),
+		"geohex_grid":      GeohexGridAgg("agg", "location", 5, sub),
+		"composite":        CompositeAgg("agg", nil, sub),
+		"variable_width":   VariableWidthHistogramAgg("agg", "price", 10, sub),
+		"diversified":      DiversifiedSamplerAgg("agg", "author", 100, sub),
+		"significant_text": SignificantTextAgg("agg", "body", sub),
+	}
+	for name, builder := range builders {
+		t.Run(name, func(t *testing.T) {
+			aggs := NewAggregations(builder)
+			if _, exists := aggs["agg"].Aggregations["avg_price"]; !exists {
+				t.Errorf("Expected 'avg_price' sub-aggregation to exist, got %+v", aggs["agg"])
+			}
+		})
+	}
+
+	t.Run("no sub-aggregations", func(t *testing.T) {
+		aggs := NewAggregations(FilterAgg("agg", Term("type", "hat")))
+		if aggs["agg"].Aggregations != nil {
+			t.Errorf("Expected sub-aggregations to be nil, got %v", aggs["agg"].Aggregations)
+		}
+	})
+}
+
+func TestAddSubAggs(t *testing.T) {
+	aggs := NewAggregations(TermsAgg("categories", "category", TermsAgg("brands", "brand")))
+	if err := AddSubAggs(aggs, "categories>brands", AvgAgg("avg_price", "price")); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, exists := aggs["categories"].Aggregations["brands"].Aggregations["avg_price"]; !exists {
+		t.Error("Expected 'avg_price' sub-aggregation to exist")
+	}
+	for _, path := range []string{"category", "categories>brand", "categories>brands>avg"} {
+		if err := AddSubAggs(aggs, path, AvgAgg("x", "x")); !errors.Is(err, ErrMissingParentAgg) {
+			t.Errorf("%s: Expected ErrMissingParentAgg, got %v", path, err)
+		}
+	}
+
+	t.Run("MustSubAgg", func(t *testing.T) {
+		aggs := NewAggregations(
+			FilterAgg("hats", Term("type", "hat")),
+			MustSubAgg("hats", SumAgg("sales", "price")),
+		)
+		if _, exists := aggs["hats"].Aggregations["sales"]; !exists || aggs["hats"].Filter == nil {
+			t.Errorf("Expected 'sales' sub-aggregation under the filter, got %+v", aggs["hats"])
+		}
+		defer func() {
+			if err, _ := recover().(error); !errors.Is(err, ErrMissingParentAgg) || !strings.Contains(err.Error(), "hat") {
+				t.Errorf("Expected panic with ErrMissingParentAgg, got %v", err)
+			}
+		}()
+		NewAggregations(
+			FilterAgg("hats", Term("type", "hat")),
+			MustSubAgg("hat", SumAgg("sales", "price")),
+		)
+	})
+
+	t.Run("validate silent SubAgg container", func(t *testing.T) {
+		aggs := NewAggregations(
+			TermsAgg("categories", "category"),
+			SubAgg("categorie", AvgAgg("avg_price", "price")),
+		)
+		err := ValidateAggregations(aggs)
+		if !errors.Is(err, ErrMissingParentAgg) || !strings.Contains(err.Error(), `"categorie"`) {
+			t.Errorf("Expected ErrMissingParentAgg for 'categorie', got %v", err)
+		}
+	})
+}
@@ -1,5 +1,140 @@
 package main
 
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+
+    "github.com/elastic/go-elasticsearch/v8"
+    "github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+    "github.com/qwenode/esb"
+)
+
+const usage = `用法:
+  esb export [选项]    将聚合结果导出为 CSV 或 NDJSON
+
+export 选项:
+`
+
 func main() {
-    
+    if err := run(context.Background(), os.Args[1:], os.Stdin, os.Stdout); err != nil {
+        fmt.Fprintln(os.Stderr, "esb:", err)
+        os.Exit(1)
+    }
+}
+
+func run(c context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+    if len(args) == 0 || args[0] != "export" {
+        fmt.Fprint(os.Stderr, usage)
+        newExportFlags(&exportOptions{}).PrintDefaults()
+        return errors.New("unknown command")
+    }
+    return runExport(c, args[1:], stdin, stdout)
+}
+
+// exportOptions export 子命令的参数
+type exportOptions struct {
+    url      string
+    username string
+    password string
+    index    string
+    body     string
+    response string
+    format   string
+    aggs     string
+    output   string
+}
+
+func newExportFlags(opts *exportOptions) *flag.FlagSet {
+    fs := flag.NewFlagSet("export", flag.ContinueOnError)
+    url := os.Getenv("ELASTICSEARCH_URL")
+    if url == "" {
+        url = "http://localhost:9200"
+    }
+    fs.StringVar(&opts.url, "url", url, "Elasticsearch 地址，默认读取 ELASTICSEARCH_URL")
+    fs.StringVar(&opts.username, "user", os.Getenv("ELASTICSEARCH_USERNAME"), "用户名，默认读取 ELASTICSEARCH_USERNAME")
+    fs.StringVar(&opts.password, "password", os.Getenv("ELASTICSEARCH_PASSWORD"), "密码，默认读取 ELASTICSEARCH_PASSWORD")
+    fs.StringVar(&opts.index, "index", "", "搜索的索引或别名")
+    fs.StringVar(&opts.body, "body", "", "包含 query 和 aggs 的搜索请求体文件，- 表示标准输入")
+    fs.StringVar(&opts.response, "response", "", "已保存的搜索响应文件（需要 typed_keys），设置后不再请求 Elasticsearch，- 表示标准输入")
+    fs.StringVar(&opts.format, "format", string(esb.ExportCSV), "导出格式：csv 或 ndjson")
+    fs.StringVar(&opts.aggs, "aggs", "", "要导出的顶层聚合名称，多个使用逗号分隔，默认导出全部")
+    fs.StringVar(&opts.output, "out", "", "输出文件，默认为标准输出")
+    return fs
+}
+
+// runExport 执行搜索（或读取已保存的响应），展开聚合结果并写入输出
+func runExport(c context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+    var opts exportOptions
+    if err := newExportFlags(&opts).Parse(args); err != nil {
+        return err
+    }
+    // 在搜索和创建输出文件之前检查格式，避免格式错误时清空已有的输出文件
+    format := esb.ExportFormat(opts.format)
+    if err := format.Validate(); err != nil {
+        return err
+    }
+    response, err := loadResponse(c, &opts, stdin)
+    if err != nil {
+        return err
+    }
+    var names []string
+    if opts.aggs != "" {
+        for _, name := range strings.Split(opts.aggs, ",") {
+            names = append(names, strings.TrimSpace(name))
+        }
+    }
+    w := stdout
+    if opts.output != "" {
+        f, err := os.Create(opts.output)
+        if err != nil {
+            return err
+        }
+        defer f.Close()
+        w = f
+    }
+    return esb.ExportAggregations(w, format, response.Aggregations, names...)
+}
+
+func loadResponse(c context.Context, opts *exportOptions, stdin io.Reader) (*search.Response, error) {
+    if opts.response != "" {
+        data, err := readInput(opts.response, stdin)
+        if err != nil {
+            return nil, err
+        }
+        response := search.NewResponse()
+        if err := json.Unmarshal(data, response); err != nil {
+            return nil, fmt.Errorf("decode response: %w", err)
+        }
+        return response, nil
+    }
+    if opts.index == "" || opts.body == "" {
+        return nil, errors.New("-index and -body are required unless -response is set")
+    }
+    body, err := readInput(opts.body, stdin)
+    if err != nil {
+        return nil, err
+    }
+    client, err := elasticsearch.NewTypedClient(elasticsearch.Config{
+        Addresses: []string{opts.url},
+        Username:  opts.username,
+        Password:  opts.password,
+    })
+    if err != nil {
+        return nil, err
+    }
+    return client.Search().Index(opts.index).Raw(bytes.NewReader(body)).Do(c)
+}
+
+func readInput(path string, stdin io.Reader) ([]byte, error) {
+    if path == "-" {
+        return io.ReadAll(stdin)
+    }
+    return os.ReadFile(path)
 }
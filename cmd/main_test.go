@@ -0,0 +1,94 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/qwenode/esb"
+)
+
+const testResponse = `{"took":1,"timed_out":false,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},
+"hits":{"total":{"value":3,"relation":"eq"},"hits":[]},
+"aggregations":{
+    "sterms#category":{"buckets":[
+        {"key":"books","doc_count":2,"sum#revenue":{"value":20.5}},
+        {"key":"toys","doc_count":1,"sum#revenue":{"value":5}}
+    ]},
+    "avg#overall":{"value":7}
+}}`
+
+func writeTestFile(t *testing.T, name, content string) string {
+    t.Helper()
+    path := filepath.Join(t.TempDir(), name)
+    if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+func TestRunExport(t *testing.T) {
+    response := writeTestFile(t, "response.json", testResponse)
+
+    t.Run("CSV输出到标准输出", func(t *testing.T) {
+        var stdout bytes.Buffer
+        if err := run(context.Background(), []string{"export", "-response", response}, nil, &stdout); err != nil {
+            t.Fatal(err)
+        }
+        want := "category,doc_count,overall,revenue\n" +
+            "books,2,7,20.5\n" +
+            "toys,1,7,5\n"
+        if stdout.String() != want {
+            t.Errorf("期望:\n%s实际得到:\n%s", want, stdout.String())
+        }
+    })
+
+    t.Run("从标准输入读取并写入文件", func(t *testing.T) {
+        out := filepath.Join(t.TempDir(), "out.ndjson")
+        args := []string{"export", "-response", "-", "-format", "ndjson", "-aggs", "category", "-out", out}
+        if err := run(context.Background(), args, strings.NewReader(testResponse), &bytes.Buffer{}); err != nil {
+            t.Fatal(err)
+        }
+        data, err := os.ReadFile(out)
+        if err != nil {
+            t.Fatal(err)
+        }
+        want := `{"category":"books","doc_count":2,"revenue":20.5}` + "\n" +
+            `{"category":"toys","doc_count":1,"revenue":5}` + "\n"
+        if string(data) != want {
+            t.Errorf("期望:\n%s实际得到:\n%s", want, data)
+        }
+    })
+
+    t.Run("格式错误时不清空输出文件", func(t *testing.T) {
+        out := writeTestFile(t, "out.csv", "previous export\n")
+        args := []string{"export", "-response", response, "-format", "xlsx", "-out", out}
+        if err := run(context.Background(), args, nil, &bytes.Buffer{}); !errors.Is(err, esb.ErrUnsupportedExportFormat) {
+            t.Errorf("期望ErrUnsupportedExportFormat, 实际得到: %v", err)
+        }
+        data, err := os.ReadFile(out)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if string(data) != "previous export\n" {
+            t.Errorf("期望保留原有内容, 实际得到 %q", data)
+        }
+    })
+
+    t.Run("格式错误时不请求Elasticsearch", func(t *testing.T) {
+        args := []string{"export", "-url", "http://127.0.0.1:1", "-index", "orders", "-body", "-", "-format", "xlsx"}
+        if err := run(context.Background(), args, strings.NewReader(`{}`), &bytes.Buffer{}); !errors.Is(err, esb.ErrUnsupportedExportFormat) {
+            t.Errorf("期望ErrUnsupportedExportFormat, 实际得到: %v", err)
+        }
+    })
+
+    t.Run("缺少参数", func(t *testing.T) {
+        if err := run(context.Background(), []string{"export"}, nil, &bytes.Buffer{}); err == nil {
+            t.Error("期望缺少-index和-body时返回错误")
+        }
+    })
+}
@@ -0,0 +1,110 @@
+package esb
+
+import (
+	"encoding/json"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+// CollapseOption 表示一个修改 types.FieldCollapse 的函数。
+type CollapseOption func(*types.FieldCollapse)
+
+// Collapse 创建字段折叠配置，每个 field 值只返回评分最高（或排序最前）的一个文档。
+//
+// 示例：
+//   client.Search().Index("products").
+//       Query(query).
+//       Collapse(esb.Collapse("sku_group",
+//           esb.CollapseInnerHits(esb.InnerHitsName("variants"), esb.InnerHitsSize(5)),
+//           esb.CollapseInnerHits(esb.InnerHitsName("cheapest"), esb.InnerHitsSize(1),
+//               esb.InnerHitsSort(esb.SortFieldAsc("price"))),
+//           esb.CollapseMaxConcurrentGroupSearches(4),
+//       ))
+func Collapse(field string, opts ...CollapseOption) *types.FieldCollapse {
+	collapse := &types.FieldCollapse{
+		Field: field,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(collapse)
+		}
+	}
+	return collapse
+}
+
+// CollapseInnerHits 为折叠结果添加一个 inner_hits 定义，用于展开每组中的其他文档。
+// 可以多次调用以添加多个不同名称、排序的 inner_hits。
+func CollapseInnerHits(opts ...InnerHitsOption) CollapseOption {
+	return func(c *types.FieldCollapse) {
+		c.InnerHits = append(c.InnerHits, *InnerHits(opts...))
+	}
+}
+
+// CollapseMaxConcurrentGroupSearches 设置每个请求展开 inner_hits 时允许的最大并发组查询数。
+func CollapseMaxConcurrentGroupSearches(max int) CollapseOption {
+	return func(c *types.FieldCollapse) {
+		c.MaxConcurrentGroupSearches = &max
+	}
+}
+
+// InnerHitsCollapse 对 inner_hits 进行第二级折叠，常用于每组内再按另一个字段去重。
+//
+// 示例：
+//   esb.Collapse("sku_group",
+//       esb.CollapseInnerHits(
+//           esb.InnerHitsName("by_color"),
+//           esb.InnerHitsSize(3),
+//           esb.InnerHitsCollapse("color"),
+//       ),
+//   )
+func InnerHitsCollapse(field string, opts ...CollapseOption) InnerHitsOption {
+	return func(i *types.InnerHits) {
+		i.Collapse = Collapse(field, opts...)
+	}
+}
+
+// CollapseGroup 表示折叠后的一组文档。
+type CollapseGroup[T any] struct {
+	// Key 折叠字段的值
+	Key any
+	// Representative 代表该组返回的文档
+	Representative T
+	// Members 按 inner_hits 名称分组展开的组内文档
+	Members map[string][]T
+	// Hit 代表文档的原始命中
+	Hit types.Hit
+}
+
+// FormatCollapse 解析字段折叠的搜索结果，返回每组的代表文档及其展开的组内文档。
+// 折叠字段的值从命中的 fields 中读取，对应字段不存在时 Key 为 nil。
+//
+// 示例：
+//   groups, err := esb.FormatCollapse[Product](response.Hits, "sku_group")
+//   for _, group := range groups {
+//       fmt.Println(group.Key, group.Representative.Name, len(group.Members["variants"]))
+//   }
+func FormatCollapse[T any](response types.HitsMetadata, field string) ([]CollapseGroup[T], error) {
+	docs, err := FormatSearchWithInnerHits[T, T](response)
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]CollapseGroup[T], 0, len(docs))
+	for _, doc := range docs {
+		group := CollapseGroup[T]{
+			Representative: doc.Source,
+			Members:        doc.InnerHits,
+			Hit:            doc.Hit,
+		}
+		if raw, ok := doc.Hit.Fields[field]; ok {
+			var values []any
+			if err := json.Unmarshal(raw, &values); err != nil {
+				return nil, err
+			}
+			if len(values) > 0 {
+				group.Key = values[0]
+			}
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
@@ -0,0 +1,104 @@
+package esb
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+func TestCollapse(t *testing.T) {
+	tests := []struct {
+		name     string
+		collapse *types.FieldCollapse
+		want     string
+	}{
+		{
+			"只折叠",
+			Collapse("sku_group"),
+			`{"field":"sku_group"}`,
+		},
+		{
+			"多个inner_hits",
+			Collapse("sku_group",
+				CollapseInnerHits(InnerHitsName("variants"), InnerHitsSize(5)),
+				CollapseInnerHits(InnerHitsName("cheapest"), InnerHitsSize(1), InnerHitsSort(SortFieldAsc("price"))),
+				CollapseMaxConcurrentGroupSearches(4),
+			),
+			`{"field":"sku_group","inner_hits":[{"name":"variants","size":5},{"name":"cheapest","size":1,"sort":[{"price":{"order":"asc"}}]}],"max_concurrent_group_searches":4}`,
+		},
+		{
+			"第二级折叠",
+			Collapse("sku_group",
+				CollapseInnerHits(InnerHitsName("by_color"), InnerHitsSize(3), InnerHitsCollapse("color")),
+			),
+			`{"field":"sku_group","inner_hits":[{"collapse":{"field":"color"},"name":"by_color","size":3}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.collapse)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("期望 %s, 实际得到 %s", tt.want, data)
+			}
+		})
+	}
+}
+
+type collapseProduct struct {
+	Name  string  `json:"name"`
+	Price float64 `json:"price"`
+}
+
+func TestFormatCollapse(t *testing.T) {
+	response := `{
+		"hits": [
+			{
+				"_index": "products", "_id": "1",
+				"_source": {"name": "T-shirt red M", "price": 20},
+				"fields": {"sku_group": ["tshirt"]},
+				"inner_hits": {
+					"variants": {"hits": {"hits": [
+						{"_index": "products", "_id": "1", "_source": {"name": "T-shirt red M", "price": 20}},
+						{"_index": "products", "_id": "2", "_source": {"name": "T-shirt blue L", "price": 22}}
+					]}}
+				}
+			},
+			{
+				"_index": "products", "_id": "3",
+				"_source": {"name": "Mug", "price": 8},
+				"fields": {"sku_group": [42]}
+			},
+			{
+				"_index": "products", "_id": "4",
+				"_source": {"name": "Unknown", "price": 1}
+			}
+		]
+	}`
+	var hits types.HitsMetadata
+	if err := json.Unmarshal([]byte(response), &hits); err != nil {
+		t.Fatal(err)
+	}
+	groups, err := FormatCollapse[collapseProduct](hits, "sku_group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 3 {
+		t.Fatalf("期望3组, 实际得到: %d", len(groups))
+	}
+	if groups[0].Key != "tshirt" || groups[0].Representative.Name != "T-shirt red M" {
+		t.Errorf("期望第一组为tshirt, 实际得到: %v, %+v", groups[0].Key, groups[0].Representative)
+	}
+	if variants := groups[0].Members["variants"]; len(variants) != 2 || variants[1].Price != 22 {
+		t.Errorf("期望展开2个组内文档, 实际得到: %+v", variants)
+	}
+	if groups[1].Key != float64(42) || len(groups[1].Members) != 0 {
+		t.Errorf("期望第二组的Key为42且没有展开文档, 实际得到: %v, %+v", groups[1].Key, groups[1].Members)
+	}
+	if groups[2].Key != nil {
+		t.Errorf("期望缺少折叠字段时Key为nil, 实际得到: %v", groups[2].Key)
+	}
+}
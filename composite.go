@@ -0,0 +1,326 @@
+package esb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/missingorder"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
+)
+
+// CompositeSource 表示 composite 聚合中的一个值源，名称即为桶 key 中的字段名。
+type CompositeSource struct {
+	Name   string
+	Source types.CompositeAggregationSource
+}
+
+// CompositeSourceOption 用于配置 composite 值源，对 terms、histogram、date_histogram、geotile_grid 值源通用。
+type CompositeSourceOption func(source *types.CompositeAggregationSource)
+
+// CompositeTerms 创建 terms 值源。
+//
+// 示例：
+//   esb.CompositeTerms("category", "category.keyword", esb.CompositeMissingBucket())
+func CompositeTerms(name, field string, opts ...CompositeSourceOption) CompositeSource {
+	return newCompositeSource(name, types.CompositeAggregationSource{
+		Terms: &types.CompositeTermsAggregation{Field: &field},
+	}, opts)
+}
+
+// CompositeHistogram 创建 histogram 值源，按 interval 对数值分桶。
+//
+// 示例：
+//   esb.CompositeHistogram("price", "price", 100)
+func CompositeHistogram(name, field string, interval float64, opts ...CompositeSourceOption) CompositeSource {
+	return newCompositeSource(name, types.CompositeAggregationSource{
+		Histogram: &types.CompositeHistogramAggregation{Field: &field, Interval: types.Float64(interval)},
+	}, opts)
+}
+
+// CompositeDateHistogram 创建 date_histogram 值源，calendarInterval 为日历间隔，例如 1d、1M。
+//
+// 示例：
+//   esb.CompositeDateHistogram("day", "timestamp", "1d", esb.CompositeTimeZone("Asia/Shanghai"), esb.CompositeOrder(sortorder.Desc))
+func CompositeDateHistogram(name, field, calendarInterval string, opts ...CompositeSourceOption) CompositeSource {
+	return newCompositeSource(name, types.CompositeAggregationSource{
+		DateHistogram: &types.CompositeDateHistogramAggregation{Field: &field, CalendarInterval: &calendarInterval},
+	}, opts)
+}
+
+// CompositeGeotileGrid 创建 geotile_grid 值源，桶 key 为 "zoom/x/y"，可以使用 GeotileDecode 解析。
+//
+// 示例：
+//   esb.CompositeGeotileGrid("tile", "location", 8)
+func CompositeGeotileGrid(name, field string, precision int, opts ...CompositeSourceOption) CompositeSource {
+	return newCompositeSource(name, types.CompositeAggregationSource{
+		GeotileGrid: &types.CompositeGeoTileGridAggregation{Field: &field, Precision: &precision},
+	}, opts)
+}
+
+func newCompositeSource(name string, source types.CompositeAggregationSource, opts []CompositeSourceOption) CompositeSource {
+	for _, opt := range opts {
+		opt(&source)
+	}
+	return CompositeSource{Name: name, Source: source}
+}
+
+// CompositeMissingBucket 为缺少该字段的文档创建 key 为 null 的桶，默认这些文档会被忽略。
+func CompositeMissingBucket() CompositeSourceOption {
+	return func(source *types.CompositeAggregationSource) {
+		missingBucket := true
+		setCompositeSource(source, func(missing **bool, _ **missingorder.MissingOrder, _ **sortorder.SortOrder) {
+			*missing = &missingBucket
+		})
+	}
+}
+
+// CompositeMissingOrder 设置 null 桶的位置，同时开启 missing_bucket。
+func CompositeMissingOrder(order missingorder.MissingOrder) CompositeSourceOption {
+	return func(source *types.CompositeAggregationSource) {
+		missingBucket := true
+		setCompositeSource(source, func(missing **bool, missingOrder **missingorder.MissingOrder, _ **sortorder.SortOrder) {
+			*missing = &missingBucket
+			*missingOrder = &order
+		})
+	}
+}
+
+// CompositeOrder 设置值源的排序方向，默认为升序。
+func CompositeOrder(order sortorder.SortOrder) CompositeSourceOption {
+	return func(source *types.CompositeAggregationSource) {
+		setCompositeSource(source, func(_ **bool, _ **missingorder.MissingOrder, sortOrder **sortorder.SortOrder) {
+			*sortOrder = &order
+		})
+	}
+}
+
+// CompositeTimeZone 设置 date_histogram 值源的时区，对其他值源无效。
+func CompositeTimeZone(timeZone string) CompositeSourceOption {
+	return func(source *types.CompositeAggregationSource) {
+		if source.DateHistogram != nil {
+			source.DateHistogram.TimeZone = &timeZone
+		}
+	}
+}
+
+// CompositeFormat 设置 date_histogram 值源 key 的日期格式，设置后 key 为字符串，对其他值源无效。
+func CompositeFormat(format string) CompositeSourceOption {
+	return func(source *types.CompositeAggregationSource) {
+		if source.DateHistogram != nil {
+			source.DateHistogram.Format = &format
+		}
+	}
+}
+
+// setCompositeSource 将 missing_bucket、missing_order、order 的设置应用到值源中实际使用的类型。
+func setCompositeSource(source *types.CompositeAggregationSource, set func(missingBucket **bool, missingOrder **missingorder.MissingOrder, order **sortorder.SortOrder)) {
+	switch {
+	case source.Terms != nil:
+		set(&source.Terms.MissingBucket, &source.Terms.MissingOrder, &source.Terms.Order)
+	case source.Histogram != nil:
+		set(&source.Histogram.MissingBucket, &source.Histogram.MissingOrder, &source.Histogram.Order)
+	case source.DateHistogram != nil:
+		set(&source.DateHistogram.MissingBucket, &source.DateHistogram.MissingOrder, &source.DateHistogram.Order)
+	case source.GeotileGrid != nil:
+		set(&source.GeotileGrid.MissingBucket, &source.GeotileGrid.MissingOrder, &source.GeotileGrid.Order)
+	}
+}
+
+// CompositeSourcesAgg 使用类型化的值源创建 composite 聚合，size 小于等于 0 时使用服务端默认值 10。
+//
+// 示例：
+//   esb.CompositeSourcesAgg("by_day_category", 1000, []esb.CompositeSource{
+//       esb.CompositeDateHistogram("day", "timestamp", "1d"),
+//       esb.CompositeTerms("category", "category"),
+//   }, esb.SumAgg("revenue", "price"))
+func CompositeSourcesAgg(name string, size int, sources []CompositeSource, subAggs ...AggregationOption) AggregationOption {
+	return compositeAgg(name, size, sources, nil, subAggs)
+}
+
+func compositeAgg(name string, size int, sources []CompositeSource, after types.CompositeAggregateKey, subAggs []AggregationOption) AggregationOption {
+	return func(aggs *types.Aggregations) {
+		composite := &types.CompositeAggregation{After: after}
+		if size > 0 {
+			composite.Size = &size
+		}
+		for _, source := range sources {
+			composite.Sources = append(composite.Sources, map[string]types.CompositeAggregationSource{source.Name: source.Source})
+		}
+		agg := types.Aggregations{Composite: composite}
+		if len(subAggs) > 0 {
+			agg.Aggregations = make(map[string]types.Aggregations)
+			for _, subAgg := range subAggs {
+				subAgg(&agg)
+			}
+		}
+		aggs.Aggregations[name] = agg
+	}
+}
+
+// CompositeFetch 执行一次只包含 aggs 的搜索并返回聚合结果，用于 CompositeIterator 翻页。
+type CompositeFetch func(ctx context.Context, aggs map[string]types.Aggregations) (map[string]types.Aggregate, error)
+
+// SearchCompositeFetch 使用搜索请求执行翻页，每次请求会覆盖 aggregations 并将 size 设置为 0，
+// 请求中的 index、query 等设置保持不变。
+//
+// 示例：
+//   fetch := esb.SearchCompositeFetch(client.Search().Index("orders").Query(esb.NewQuery(esb.Term("status", "paid"))))
+func SearchCompositeFetch(request *search.Search) CompositeFetch {
+	return func(ctx context.Context, aggs map[string]types.Aggregations) (map[string]types.Aggregate, error) {
+		response, err := request.Size(0).Aggregations(aggs).Do(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return response.Aggregations, nil
+	}
+}
+
+// CompositeBucket 表示 composite 聚合的一个桶，Key 为解码后的桶 key。
+type CompositeBucket[K any] struct {
+	Key          K
+	DocCount     int64
+	Aggregations map[string]types.Aggregate
+}
+
+// CompositeIterator 通过 after_key 遍历 composite 聚合的所有桶，适用于精确去重计数和全量分组导出。
+type CompositeIterator[K any] struct {
+	fetch    CompositeFetch
+	name     string
+	size     int
+	sources  []CompositeSource
+	subAggs  []AggregationOption
+	afterKey types.CompositeAggregateKey
+	done     bool
+}
+
+// NewCompositeIterator 创建 composite 聚合迭代器，K 为桶 key 解码的目标类型，字段的 json 名称与值源名称对应，
+// 也可以使用 map[string]any。size 为每页的桶数量。
+//
+// 示例：
+//   type DayCategory struct {
+//       Day      int64  `json:"day"`
+//       Category string `json:"category"`
+//   }
+//   it := esb.NewCompositeIterator[DayCategory](esb.SearchCompositeFetch(client.Search().Index("orders")),
+//       "groups", 1000, []esb.CompositeSource{
+//           esb.CompositeDateHistogram("day", "timestamp", "1d"),
+//           esb.CompositeTerms("category", "category"),
+//       }, esb.SumAgg("revenue", "price"))
+//   for bucket, err := range it.All(ctx) {
+//       if err != nil {
+//           return err
+//       }
+//       fmt.Println(bucket.Key.Day, bucket.Key.Category, bucket.DocCount)
+//   }
+func NewCompositeIterator[K any](fetch CompositeFetch, name string, size int, sources []CompositeSource, subAggs ...AggregationOption) *CompositeIterator[K] {
+	return &CompositeIterator[K]{
+		fetch:   fetch,
+		name:    name,
+		size:    size,
+		sources: sources,
+		subAggs: subAggs,
+	}
+}
+
+// After 从指定的 after_key 之后继续遍历，用于断点续传。
+func (it *CompositeIterator[K]) After(afterKey types.CompositeAggregateKey) *CompositeIterator[K] {
+	it.afterKey = afterKey
+	it.done = false
+	return it
+}
+
+// AfterKey 返回最近一页的 after_key，可以保存后通过 After 继续遍历。
+func (it *CompositeIterator[K]) AfterKey() types.CompositeAggregateKey {
+	return it.afterKey
+}
+
+// Next 获取下一页桶，全部遍历完成后返回 ErrNoData。
+func (it *CompositeIterator[K]) Next(ctx context.Context) ([]CompositeBucket[K], error) {
+	if it.done {
+		return nil, ErrNoData
+	}
+	aggs := NewAggregations(compositeAgg(it.name, it.size, it.sources, it.afterKey, it.subAggs))
+	results, err := it.fetch(ctx, aggs)
+	if err != nil {
+		return nil, err
+	}
+	aggregate, err := AggregateAs[*types.CompositeAggregate](results, it.name)
+	if err != nil {
+		return nil, err
+	}
+	var rawBuckets []types.CompositeBucket
+	switch b := aggregate.Buckets.(type) {
+	case []types.CompositeBucket:
+		rawBuckets = b
+	case map[string]types.CompositeBucket:
+		for _, bucket := range b {
+			rawBuckets = append(rawBuckets, bucket)
+		}
+	}
+	if len(rawBuckets) == 0 || len(aggregate.AfterKey) == 0 {
+		it.done = true
+	}
+	if len(aggregate.AfterKey) > 0 {
+		it.afterKey = aggregate.AfterKey
+	}
+	if len(rawBuckets) == 0 {
+		return nil, ErrNoData
+	}
+	buckets := make([]CompositeBucket[K], 0, len(rawBuckets))
+	for _, raw := range rawBuckets {
+		bucket := CompositeBucket[K]{DocCount: raw.DocCount, Aggregations: raw.Aggregations}
+		if err := decodeCompositeKey(raw.Key, &bucket.Key); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
+
+// All 返回遍历所有桶的迭代器，出错时产出错误并停止。
+func (it *CompositeIterator[K]) All(ctx context.Context) iter.Seq2[CompositeBucket[K], error] {
+	return func(yield func(CompositeBucket[K], error) bool) {
+		for {
+			buckets, err := it.Next(ctx)
+			if IsNoData(err) {
+				return
+			}
+			if err != nil {
+				yield(CompositeBucket[K]{}, err)
+				return
+			}
+			for _, bucket := range buckets {
+				if !yield(bucket, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Collect 遍历所有桶并返回。
+func (it *CompositeIterator[K]) Collect(ctx context.Context) ([]CompositeBucket[K], error) {
+	var buckets []CompositeBucket[K]
+	for bucket, err := range it.All(ctx) {
+		if err != nil {
+			return buckets, err
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
+
+func decodeCompositeKey(key types.CompositeAggregateKey, v any) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("decode composite key %s: %w", data, err)
+	}
+	return nil
+}
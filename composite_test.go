@@ -0,0 +1,89 @@
+package esb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/missingorder"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
+)
+
+func TestCompositeSourcesAgg(t *testing.T) {
+	aggs := NewAggregations(CompositeSourcesAgg("groups", 100, []CompositeSource{
+		CompositeDateHistogram("day", "timestamp", "1d", CompositeTimeZone("Asia/Shanghai"), CompositeOrder(sortorder.Desc)),
+		CompositeTerms("category", "category", CompositeMissingOrder(missingorder.Last)),
+		CompositeHistogram("price", "price", 50, CompositeMissingBucket()),
+		CompositeGeotileGrid("tile", "location", 8),
+	}, SumAgg("revenue", "price")))
+	data, err := json.Marshal(aggs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"groups":{"aggregations":{"revenue":{"sum":{"field":"price"}}},"composite":{"size":100,"sources":[` +
+		`{"day":{"date_histogram":{"calendar_interval":"1d","field":"timestamp","order":"desc","time_zone":"Asia/Shanghai"}}},` +
+		`{"category":{"terms":{"field":"category","missing_bucket":true,"missing_order":"last"}}},` +
+		`{"price":{"histogram":{"field":"price","interval":50,"missing_bucket":true}}},` +
+		`{"tile":{"geotile_grid":{"field":"location","precision":8}}}]}}}`
+	if string(data) != want {
+		t.Errorf("期望 %s, 实际得到 %s", want, data)
+	}
+}
+
+func TestCompositeIterator(t *testing.T) {
+	pages := []string{
+		`{"aggregations":{"composite#groups":{"after_key":{"day":1704153600000,"category":"b"},"buckets":[
+			{"key":{"day":1704067200000,"category":"a"},"doc_count":2,"sum#revenue":{"value":10}},
+			{"key":{"day":1704153600000,"category":"b"},"doc_count":1,"sum#revenue":{"value":5}}
+		]}}}`,
+		`{"aggregations":{"composite#groups":{"after_key":{"day":1704240000000,"category":null},"buckets":[
+			{"key":{"day":1704240000000,"category":null},"doc_count":3}
+		]}}}`,
+		`{"aggregations":{"composite#groups":{"buckets":[]}}}`,
+	}
+	var afters []types.CompositeAggregateKey
+	fetch := func(ctx context.Context, aggs map[string]types.Aggregations) (map[string]types.Aggregate, error) {
+		composite := aggs["groups"].Composite
+		afters = append(afters, composite.After)
+		if len(afters) > len(pages) {
+			t.Fatal("期望在空页后停止请求")
+		}
+		return decodeTestAggregations(t, pages[len(afters)-1]).Aggregations, nil
+	}
+	type key struct {
+		Day      int64   `json:"day"`
+		Category *string `json:"category"`
+	}
+	it := NewCompositeIterator[key](fetch, "groups", 2, []CompositeSource{
+		CompositeDateHistogram("day", "timestamp", "1d"),
+		CompositeTerms("category", "category", CompositeMissingBucket()),
+	}, SumAgg("revenue", "price"))
+	buckets, err := it.Collect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 3 || buckets[0].Key.Day != 1704067200000 || *buckets[1].Key.Category != "b" || buckets[2].Key.Category != nil || buckets[2].DocCount != 3 {
+		t.Errorf("解析桶错误: %+v", buckets)
+	}
+	if revenue, ok := metricValue(buckets[0].Aggregations["revenue"]); !ok || revenue != 10.0 {
+		t.Errorf("期望子聚合revenue为10, 实际得到 %v", revenue)
+	}
+	if len(afters) != 3 || afters[0] != nil || afters[1]["category"] != "b" || afters[2]["day"] == nil {
+		t.Errorf("after_key 传递错误: %v", afters)
+	}
+	if _, err := it.Next(context.Background()); !IsNoData(err) {
+		t.Errorf("期望遍历完成后返回ErrNoData, 实际得到: %v", err)
+	}
+
+	t.Run("请求错误", func(t *testing.T) {
+		fail := errors.New("boom")
+		it := NewCompositeIterator[map[string]any](func(context.Context, map[string]types.Aggregations) (map[string]types.Aggregate, error) {
+			return nil, fail
+		}, "groups", 10, []CompositeSource{CompositeTerms("category", "category")})
+		if _, err := it.Collect(context.Background()); !errors.Is(err, fail) {
+			t.Errorf("期望返回请求错误, 实际得到: %v", err)
+		}
+	})
+}
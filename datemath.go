@@ -0,0 +1,302 @@
+package esb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidDateMath 日期数学表达式格式错误
+	ErrInvalidDateMath = errors.New("invalid date math")
+)
+
+// DateUnit 表示日期数学表达式中的时间单位。
+type DateUnit byte
+
+const (
+	Year   DateUnit = 'y'
+	Month  DateUnit = 'M'
+	Week   DateUnit = 'w'
+	Day    DateUnit = 'd'
+	Hour   DateUnit = 'h'
+	Minute DateUnit = 'm'
+	Second DateUnit = 's'
+)
+
+func (u DateUnit) valid() bool {
+	switch u {
+	case Year, Month, Week, Day, Hour, 'H', Minute, Second:
+		return true
+	}
+	return false
+}
+
+// dateMathOp 表示一次加减或舍入运算，op 为 '+'、'-' 或 '/'。
+type dateMathOp struct {
+	op     byte
+	amount int
+	unit   DateUnit
+}
+
+// DateMath 表示 Elasticsearch 的日期数学表达式，例如 now-7d/d、2025-01-01||+1M/M。
+// DateMath 是不可变的，每次运算都返回新的表达式。
+type DateMath struct {
+	anchor string
+	ops    []dateMathOp
+}
+
+// Now 创建以当前时间为锚点的日期数学表达式。
+//
+// 示例：
+//   esb.Now().Minus(7, esb.Day).RoundTo(esb.Day) // now-7d/d
+func Now() DateMath {
+	return DateMath{anchor: "now"}
+}
+
+// DateAnchor 创建以指定时间为锚点的日期数学表达式，时间按 RFC3339 序列化。
+//
+// 示例：
+//   esb.DateAnchor(t).Plus(1, esb.Month).RoundTo(esb.Month) // 2025-01-01T00:00:00Z||+1M/M
+func DateAnchor(t time.Time) DateMath {
+	return DateMath{anchor: t.Format(time.RFC3339Nano)}
+}
+
+func (m DateMath) with(op dateMathOp) DateMath {
+	ops := make([]dateMathOp, len(m.ops), len(m.ops)+1)
+	copy(ops, m.ops)
+	return DateMath{anchor: m.anchor, ops: append(ops, op)}
+}
+
+// Plus 加上 amount 个时间单位。
+func (m DateMath) Plus(amount int, unit DateUnit) DateMath {
+	if amount < 0 {
+		return m.Minus(-amount, unit)
+	}
+	return m.with(dateMathOp{op: '+', amount: amount, unit: unit})
+}
+
+// Minus 减去 amount 个时间单位。
+func (m DateMath) Minus(amount int, unit DateUnit) DateMath {
+	if amount < 0 {
+		return m.Plus(-amount, unit)
+	}
+	return m.with(dateMathOp{op: '-', amount: amount, unit: unit})
+}
+
+// RoundTo 舍入到指定时间单位。在 gte、lt 中向下舍入，在 gt、lte 中向上舍入到周期末尾。
+func (m DateMath) RoundTo(unit DateUnit) DateMath {
+	return m.with(dateMathOp{op: '/', unit: unit})
+}
+
+// Anchor 返回表达式的锚点，"now" 或日期字符串。
+func (m DateMath) Anchor() string {
+	return m.anchor
+}
+
+// IsNow 表示锚点是否为 now。
+func (m DateMath) IsNow() bool {
+	return m.anchor == "now"
+}
+
+// String 返回日期数学表达式，可直接用于 DateRange、日期直方图的 extended_bounds 等接受日期字符串的地方。
+//
+// 示例：
+//   esb.DateRange("created_at").Gte(esb.Now().Minus(7, esb.Day).RoundTo(esb.Day).String()).Build()
+func (m DateMath) String() string {
+	var b strings.Builder
+	b.WriteString(m.anchor)
+	if !m.IsNow() && len(m.ops) > 0 {
+		b.WriteString("||")
+	}
+	for _, op := range m.ops {
+		b.WriteByte(op.op)
+		if op.op != '/' {
+			b.WriteString(strconv.Itoa(op.amount))
+		}
+		b.WriteByte(byte(op.unit))
+	}
+	return b.String()
+}
+
+// MarshalJSON 将表达式序列化为 JSON 字符串。
+func (m DateMath) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// Validate 检查表达式中的时间单位是否有效。
+func (m DateMath) Validate() error {
+	if m.anchor == "" {
+		return fmt.Errorf("%w: missing anchor", ErrInvalidDateMath)
+	}
+	for _, op := range m.ops {
+		if !op.unit.valid() {
+			return fmt.Errorf("%w: %q: unknown unit %q", ErrInvalidDateMath, m.String(), byte(op.unit))
+		}
+	}
+	return nil
+}
+
+// dateMathAnchorLayouts 是锚点日期可以使用的格式，与 Elasticsearch 默认的 strict_date_optional_time 一致，
+// 此外锚点也可以是 epoch_millis 毫秒时间戳。
+var dateMathAnchorLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02T15",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// validDateMathAnchor 判断锚点是否为默认格式的日期或毫秒时间戳。
+func validDateMathAnchor(anchor string) bool {
+	if _, err := strconv.ParseInt(anchor, 10, 64); err == nil {
+		return true
+	}
+	for _, layout := range dateMathAnchorLayouts {
+		if _, err := time.Parse(layout, anchor); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseDateMath 解析并校验日期数学表达式。支持 now 开头的表达式、"日期||运算" 形式的表达式以及不带运算的日期字符串。
+// 运算由 +N单位、-N单位、/单位 组成，单位为 y、M、w、d、h、H、m、s。
+// 日期需要是 strict_date_optional_time 格式或毫秒时间戳，使用自定义 format 的日期不能通过校验。
+//
+// 示例：
+//   m, err := esb.ParseDateMath("now-7d/d")
+//   if errors.Is(err, esb.ErrInvalidDateMath) {
+//       return err
+//   }
+func ParseDateMath(expression string) (DateMath, error) {
+	var m DateMath
+	var rest string
+	switch {
+	case strings.HasPrefix(expression, "now"):
+		m.anchor, rest = "now", expression[len("now"):]
+	case strings.Contains(expression, "||"):
+		parts := strings.SplitN(expression, "||", 2)
+		m.anchor, rest = parts[0], parts[1]
+		if m.anchor == "" {
+			return DateMath{}, fmt.Errorf("%w: %q: missing anchor date", ErrInvalidDateMath, expression)
+		}
+		if !validDateMathAnchor(m.anchor) {
+			return DateMath{}, fmt.Errorf("%w: %q: invalid anchor date %q", ErrInvalidDateMath, expression, m.anchor)
+		}
+	case expression == "":
+		return DateMath{}, fmt.Errorf("%w: empty expression", ErrInvalidDateMath)
+	default:
+		if !validDateMathAnchor(expression) {
+			return DateMath{}, fmt.Errorf("%w: %q: invalid date", ErrInvalidDateMath, expression)
+		}
+		return DateMath{anchor: expression}, nil
+	}
+	for len(rest) > 0 {
+		op := dateMathOp{op: rest[0]}
+		rest = rest[1:]
+		switch op.op {
+		case '+', '-':
+			i := 0
+			for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+				i++
+			}
+			op.amount = 1
+			if i > 0 {
+				amount, err := strconv.Atoi(rest[:i])
+				if err != nil {
+					return DateMath{}, fmt.Errorf("%w: %q: %v", ErrInvalidDateMath, expression, err)
+				}
+				op.amount = amount
+			}
+			rest = rest[i:]
+		case '/':
+		default:
+			return DateMath{}, fmt.Errorf("%w: %q: unexpected %q", ErrInvalidDateMath, expression, op.op)
+		}
+		if len(rest) == 0 {
+			return DateMath{}, fmt.Errorf("%w: %q: missing unit", ErrInvalidDateMath, expression)
+		}
+		op.unit = DateUnit(rest[0])
+		if !op.unit.valid() {
+			return DateMath{}, fmt.Errorf("%w: %q: unknown unit %q", ErrInvalidDateMath, expression, rest[0])
+		}
+		rest = rest[1:]
+		m.ops = append(m.ops, op)
+	}
+	return m, nil
+}
+
+// Apply 以 anchor 为锚点依次执行表达式中的运算。
+// roundUp 为 true 时（gt、lte）舍入到周期末尾，与 Elasticsearch 范围查询的舍入规则一致。
+//
+// 示例：
+//   m, _ := esb.ParseDateMath("now-1d/d")
+//   start, _ := m.Apply(time.Now(), false)
+func (m DateMath) Apply(anchor time.Time, roundUp bool) (time.Time, error) {
+	if err := m.Validate(); err != nil {
+		return time.Time{}, err
+	}
+	t := anchor
+	for _, op := range m.ops {
+		switch op.op {
+		case '+':
+			t = addDateUnit(t, op.unit, op.amount)
+		case '-':
+			t = addDateUnit(t, op.unit, -op.amount)
+		case '/':
+			floor := roundDate(t, op.unit)
+			t = floor
+			if roundUp {
+				t = addDateUnit(floor, op.unit, 1).Add(-time.Nanosecond)
+			}
+		}
+	}
+	return t, nil
+}
+
+func addDateUnit(t time.Time, unit DateUnit, amount int) time.Time {
+	switch unit {
+	case Year:
+		return t.AddDate(amount, 0, 0)
+	case Month:
+		return t.AddDate(0, amount, 0)
+	case Week:
+		return t.AddDate(0, 0, 7*amount)
+	case Day:
+		return t.AddDate(0, 0, amount)
+	case Hour, 'H':
+		return t.Add(time.Duration(amount) * time.Hour)
+	case Minute:
+		return t.Add(time.Duration(amount) * time.Minute)
+	}
+	return t.Add(time.Duration(amount) * time.Second)
+}
+
+// roundDate 向下舍入到时间单位的开始，周从周一开始。
+func roundDate(t time.Time, unit DateUnit) time.Time {
+	y, m, d := t.Date()
+	loc := t.Location()
+	switch unit {
+	case Year:
+		return time.Date(y, 1, 1, 0, 0, 0, 0, loc)
+	case Month:
+		return time.Date(y, m, 1, 0, 0, 0, 0, loc)
+	case Week:
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, loc)
+	case Day:
+		return time.Date(y, m, d, 0, 0, 0, 0, loc)
+	case Hour, 'H':
+		return time.Date(y, m, d, t.Hour(), 0, 0, 0, loc)
+	case Minute:
+		return time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, loc)
+	}
+	return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), 0, loc)
+}
@@ -0,0 +1,124 @@
+package esb
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDateMath(t *testing.T) {
+	anchor := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		math DateMath
+		want string
+	}{
+		{"now", Now(), "now"},
+		{"减去并舍入", Now().Minus(7, Day).RoundTo(Day), "now-7d/d"},
+		{"多个运算", Now().Plus(1, Hour).Minus(30, Minute).RoundTo(Minute), "now+1h-30m/m"},
+		{"负数取反", Now().Plus(-2, Week), "now-2w"},
+		{"指定锚点", DateAnchor(anchor).Plus(1, Month).RoundTo(Month), "2025-01-01T00:00:00Z||+1M/M"},
+		{"只有锚点", DateAnchor(anchor), "2025-01-01T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.math.String(); got != tt.want {
+				t.Errorf("期望 %s, 实际得到 %s", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("不可变", func(t *testing.T) {
+		base := Now().Minus(1, Day)
+		a := base.RoundTo(Day)
+		b := base.RoundTo(Month)
+		if a.String() != "now-1d/d" || b.String() != "now-1d/M" || base.String() != "now-1d" {
+			t.Errorf("期望每次运算返回新的表达式, 实际得到: %s, %s, %s", a, b, base)
+		}
+	})
+
+	t.Run("序列化为JSON字符串", func(t *testing.T) {
+		data, err := json.Marshal(map[string]DateMath{"gte": Now().Minus(1, Year)})
+		if err != nil || string(data) != `{"gte":"now-1y"}` {
+			t.Errorf("期望序列化为字符串, 实际得到: %s, %v", data, err)
+		}
+	})
+
+	t.Run("用于DateRange", func(t *testing.T) {
+		query := NewQuery(DateRange("created_at").Gte(Now().Minus(7, Day).RoundTo(Day).String()).Build())
+		want := `{"range":{"created_at":{"gte":"now-7d/d"}}}`
+		if got := mustJSON(t, query); got != want {
+			t.Errorf("期望 %s, 实际得到 %s", want, got)
+		}
+	})
+}
+
+func TestParseDateMath(t *testing.T) {
+	t.Run("合法表达式原样输出", func(t *testing.T) {
+		for _, expression := range []string{"now", "now-7d/d", "now/M", "2025-01-01||+1M/M", "2025-01-01", "now+1H", "now-1y-2M+3w/s", "2025-01-01T08:00:00+08:00", "1735689600000||/d"} {
+			m, err := ParseDateMath(expression)
+			if err != nil {
+				t.Errorf("%q: 期望解析成功, 实际得到: %v", expression, err)
+				continue
+			}
+			if m.String() != expression {
+				t.Errorf("期望 %s, 实际得到 %s", expression, m)
+			}
+		}
+	})
+
+	t.Run("省略数量默认为1", func(t *testing.T) {
+		m, err := ParseDateMath("now-d")
+		if err != nil || m.String() != "now-1d" {
+			t.Errorf("期望now-1d, 实际得到: %s, %v", m, err)
+		}
+	})
+
+	t.Run("非法表达式", func(t *testing.T) {
+		for _, expression := range []string{"", "now-7", "now-7x", "now*2d", "now/", "||+1d", "2025-01-01||1d", "now-99999999999999999999d", "2025-01-01|+1M", "2025-01-01+1M", "2025-13-01", "yesterday||+1d"} {
+			if _, err := ParseDateMath(expression); !errors.Is(err, ErrInvalidDateMath) {
+				t.Errorf("%q: 期望ErrInvalidDateMath, 实际得到: %v", expression, err)
+			}
+		}
+	})
+
+	t.Run("无效单位", func(t *testing.T) {
+		if err := Now().Plus(1, DateUnit('x')).Validate(); !errors.Is(err, ErrInvalidDateMath) {
+			t.Errorf("期望ErrInvalidDateMath, 实际得到: %v", err)
+		}
+	})
+}
+
+func TestDateMathApply(t *testing.T) {
+	// 2025-01-15 是周三
+	now := time.Date(2025, 1, 15, 13, 45, 30, 0, time.UTC)
+	tests := []struct {
+		expression string
+		roundUp    bool
+		want       time.Time
+	}{
+		{"now-7d/d", false, time.Date(2025, 1, 8, 0, 0, 0, 0, time.UTC)},
+		{"now-7d/d", true, time.Date(2025, 1, 8, 23, 59, 59, 999999999, time.UTC)},
+		{"now/w", false, time.Date(2025, 1, 13, 0, 0, 0, 0, time.UTC)},
+		{"now+1M/M", false, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"now-1y/y", false, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"now+2h-15m/m", false, time.Date(2025, 1, 15, 15, 30, 0, 0, time.UTC)},
+		{"now-30s", false, time.Date(2025, 1, 15, 13, 45, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			m, err := ParseDateMath(tt.expression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := m.Apply(now, tt.roundUp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("期望 %v, 实际得到 %v", tt.want, got)
+			}
+		})
+	}
+}
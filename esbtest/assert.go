@@ -0,0 +1,418 @@
+package esbtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/qwenode/esb"
+)
+
+// 下面的断言函数都返回 error，查询满足预期时返回 nil；
+// 否则错误信息中包含整棵查询树，并标记出与预期相关的子句，可以直接交给 t.Error 输出。
+//
+// 示例：
+//   esbtest.Assert(t,
+//       esbtest.HasFilter(query, esb.Term("status", "published")),
+//       esbtest.ReferencesField(query, "price"),
+//       esbtest.NoScoringClauses(query),
+//   )
+
+// ClausePredicate 判断一个子句是否满足条件。
+type ClausePredicate func(q types.Query) bool
+
+// EqualTo 返回判断子句与 opt 构建的查询完全相同的条件。
+func EqualTo(opt esb.QueryOption) ClausePredicate {
+	expected := clauseJSON(*esb.NewQuery(opt))
+	return func(q types.Query) bool {
+		return clauseJSON(q) == expected
+	}
+}
+
+// OfKind 返回判断子句类型的条件，kind 为 term、range、bool 等 JSON 中的查询名称。
+func OfKind(kind string) ClausePredicate {
+	return func(q types.Query) bool {
+		kinds := queryKinds(q)
+		return len(kinds) == 1 && kinds[0] == kind
+	}
+}
+
+// Assert 对每个非 nil 的错误调用 t.Error。
+func Assert(t testing.TB, errs ...error) {
+	t.Helper()
+	for _, err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// HasFilter 断言 opt 构建的查询是 q 的过滤子句：它必须出现在 filter 上下文中，
+// 并且从根节点经过的都是 must、filter 或 constant_score 这类必须满足的子句。
+//
+// 示例：
+//   err := esbtest.HasFilter(query, esb.Term("status", "published"))
+func HasFilter(q *types.Query, opt esb.QueryOption) error {
+	expected := *esb.NewQuery(opt)
+	expectedJSON := clauseJSON(expected)
+	clauses := walkClauses(q)
+	marks := make(map[string]string)
+	for _, c := range clauses {
+		if clauseJSON(c.query) != expectedJSON {
+			continue
+		}
+		switch {
+		case !c.scoring && c.required:
+			return nil
+		case c.scoring:
+			marks[c.path] = "found here, but in scoring context"
+		default:
+			marks[c.path] = "found here, but not required"
+		}
+	}
+	return assertionError(q, marks, "expected filter clause %s", describeClause(expected))
+}
+
+// HasClause 断言 q 中位于 clausePath 的子句至少有一个满足 predicate。
+// clausePath 使用点号分隔，例如 "bool.filter"、"bool.must[0].bool.should"、"nested.query"，
+// 不带下标时匹配该位置上的所有子句，"*" 匹配任意一段，空字符串表示根查询。
+//
+// 示例：
+//   err := esbtest.HasClause(query, "bool.should", esbtest.OfKind("match"))
+func HasClause(q *types.Query, clausePath string, predicate ClausePredicate) error {
+	pattern := splitClausePath(clausePath)
+	marks := make(map[string]string)
+	candidates := 0
+	for _, c := range walkClauses(q) {
+		if !matchClausePath(pattern, splitClausePath(c.path)) {
+			continue
+		}
+		candidates++
+		if predicate(c.query) {
+			return nil
+		}
+		marks[c.path] = "does not satisfy predicate"
+	}
+	if candidates == 0 {
+		return assertionError(q, marks, "no clause at path %q", clausePath)
+	}
+	return assertionError(q, marks, "none of %d clauses at path %q satisfies predicate", candidates, clausePath)
+}
+
+// ReferencesField 断言 q 中有子句引用了字段 field，
+// 包括 term、range、match 等以字段为键的查询，以及 field、fields、path 参数中的字段，fields 中的通配符也会参与匹配。
+//
+// 示例：
+//   err := esbtest.ReferencesField(query, "price")
+func ReferencesField(q *types.Query, field string) error {
+	referenced := make(map[string]bool)
+	for _, c := range walkClauses(q) {
+		for _, f := range clauseFields(c.query) {
+			referenced[f] = true
+			if fieldMatches(f, field) {
+				return nil
+			}
+		}
+	}
+	fields := make([]string, 0, len(referenced))
+	for f := range referenced {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return assertionError(q, nil, "expected a clause referencing field %q, referenced fields: [%s]", field, strings.Join(fields, ", "))
+}
+
+// NoScoringClauses 断言 q 中没有参与算分的子句，即所有叶子查询都位于 filter、must_not 或 constant_score 中。
+// match_all 与 match_none 的分数是常量，不视为算分子句。
+//
+// 示例：
+//   err := esbtest.NoScoringClauses(query)
+func NoScoringClauses(q *types.Query) error {
+	marks := make(map[string]string)
+	for _, c := range walkClauses(q) {
+		if !c.scoring || len(c.children) > 0 || c.query.MatchAll != nil || c.query.MatchNone != nil {
+			continue
+		}
+		marks[c.path] = "scoring clause"
+	}
+	if len(marks) == 0 {
+		return nil
+	}
+	return assertionError(q, marks, "expected no scoring clauses, found %d", len(marks))
+}
+
+// clause 是查询树中的一个节点。
+type clause struct {
+	path     string
+	depth    int
+	query    types.Query
+	scoring  bool
+	required bool
+	children []childClause
+}
+
+type childClause struct {
+	name    string
+	query   types.Query
+	scoring bool
+	// required 表示该子句必须匹配，父节点匹配才可能成立
+	required bool
+}
+
+// children 返回复合查询的直接子句，scoring 为父节点所在的算分上下文。
+func children(q types.Query, scoring bool) []childClause {
+	var result []childClause
+	add := func(name string, queries []types.Query, scoring, required bool) {
+		for i, child := range queries {
+			result = append(result, childClause{name: name + "[" + strconv.Itoa(i) + "]", query: child, scoring: scoring, required: required})
+		}
+	}
+	switch {
+	case q.Bool != nil:
+		add("bool.must", q.Bool.Must, scoring, true)
+		add("bool.filter", q.Bool.Filter, false, true)
+		add("bool.should", q.Bool.Should, scoring, false)
+		add("bool.must_not", q.Bool.MustNot, false, false)
+	case q.ConstantScore != nil:
+		result = append(result, childClause{name: "constant_score.filter", query: q.ConstantScore.Filter, required: true})
+	case q.Nested != nil:
+		result = append(result, childClause{name: "nested.query", query: q.Nested.Query, scoring: scoring})
+	case q.HasChild != nil:
+		result = append(result, childClause{name: "has_child.query", query: q.HasChild.Query, scoring: scoring})
+	case q.HasParent != nil:
+		result = append(result, childClause{name: "has_parent.query", query: q.HasParent.Query, scoring: scoring})
+	case q.DisMax != nil:
+		add("dis_max.queries", q.DisMax.Queries, scoring, false)
+	case q.Boosting != nil:
+		result = append(result,
+			childClause{name: "boosting.positive", query: q.Boosting.Positive, scoring: scoring, required: true},
+			childClause{name: "boosting.negative", query: q.Boosting.Negative, scoring: scoring},
+		)
+	case q.FunctionScore != nil && q.FunctionScore.Query != nil:
+		result = append(result, childClause{name: "function_score.query", query: *q.FunctionScore.Query, scoring: scoring, required: true})
+	}
+	return result
+}
+
+// walkClauses 按深度优先顺序返回查询树中的所有节点，根节点位于算分上下文。
+func walkClauses(q *types.Query) []clause {
+	if q == nil {
+		return nil
+	}
+	var result []clause
+	var walk func(query types.Query, clausePath string, depth int, scoring, required bool)
+	walk = func(query types.Query, clausePath string, depth int, scoring, required bool) {
+		c := clause{path: clausePath, depth: depth, query: query, scoring: scoring, required: required, children: children(query, scoring)}
+		result = append(result, c)
+		for _, child := range c.children {
+			childPath := child.name
+			if clausePath != "" {
+				childPath = clausePath + "." + child.name
+			}
+			walk(child.query, childPath, depth+1, child.scoring, required && child.required)
+		}
+	}
+	walk(*q, "", 0, true, true)
+	return result
+}
+
+func splitClausePath(clausePath string) []string {
+	if clausePath == "" {
+		return nil
+	}
+	return strings.Split(clausePath, ".")
+}
+
+func matchClausePath(pattern, actual []string) bool {
+	if len(pattern) != len(actual) {
+		return false
+	}
+	for i, segment := range pattern {
+		if segment == "*" || segment == actual[i] {
+			continue
+		}
+		// 模式中不带下标时匹配任意下标
+		if name, _, ok := strings.Cut(actual[i], "["); ok && !strings.Contains(segment, "[") && name == segment {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// fieldKeyedQueries 记录以字段名作为键的查询，值为其中不是字段名的参数。
+var fieldKeyedQueries = map[string][]string{
+	"term":                {},
+	"terms":               {"boost", "_name"},
+	"range":               {},
+	"match":               {},
+	"match_phrase":        {},
+	"match_phrase_prefix": {},
+	"match_bool_prefix":   {},
+	"prefix":              {},
+	"wildcard":            {},
+	"regexp":              {},
+	"fuzzy":               {},
+	"intervals":           {},
+	"span_term":           {},
+	"geo_distance":        {"distance", "distance_type", "validation_method", "ignore_unmapped", "boost", "_name"},
+	"geo_bounding_box":    {"type", "validation_method", "ignore_unmapped", "boost", "_name"},
+	"geo_polygon":         {"validation_method", "ignore_unmapped", "boost", "_name"},
+	"geo_shape":           {"ignore_unmapped", "boost", "_name"},
+	"shape":               {"ignore_unmapped", "boost", "_name"},
+}
+
+// clauseFields 返回子句本身（不含子查询）引用的字段。
+func clauseFields(q types.Query) []string {
+	// 复合查询的字段由其子句各自报告，这里只处理 nested 自身的 path 参数
+	if q.Nested != nil {
+		return []string{q.Nested.Path}
+	}
+	if len(children(q, false)) > 0 {
+		return nil
+	}
+	tree, err := queryTree(q)
+	if err != nil {
+		return nil
+	}
+	var fields []string
+	for kind, body := range tree {
+		object, ok := body.(map[string]any)
+		if !ok {
+			continue
+		}
+		if excluded, ok := fieldKeyedQueries[kind]; ok {
+			for key := range object {
+				if !containsString(excluded, key) {
+					fields = append(fields, key)
+				}
+			}
+			continue
+		}
+		fields = append(fields, parameterFields(object)...)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// parameterFields 返回 field、fields、path 参数中的字段，fields 中的权重后缀会被去掉。
+func parameterFields(object map[string]any) []string {
+	var fields []string
+	for _, key := range []string{"field", "path"} {
+		if value, ok := object[key].(string); ok {
+			fields = append(fields, value)
+		}
+	}
+	if values, ok := object["fields"].([]any); ok {
+		for _, value := range values {
+			if s, ok := value.(string); ok {
+				name, _, _ := strings.Cut(s, "^")
+				fields = append(fields, name)
+			}
+		}
+	}
+	return fields
+}
+
+// fieldMatches 判断查询中引用的字段（可能包含通配符）是否覆盖 field。
+func fieldMatches(referenced, field string) bool {
+	if referenced == field {
+		return true
+	}
+	ok, _ := path.Match(referenced, field)
+	return ok
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func queryTree(q types.Query) (map[string]any, error) {
+	data, err := json.Marshal(q)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var tree map[string]any
+	err = decoder.Decode(&tree)
+	return tree, err
+}
+
+func clauseJSON(q types.Query) string {
+	data, err := json.Marshal(q)
+	if err != nil {
+		return fmt.Sprintf("<invalid query: %v>", err)
+	}
+	return string(data)
+}
+
+// describeClause 返回节点的单行描述：叶子查询显示完整 JSON，复合查询只显示自身的参数。
+func describeClause(q types.Query) string {
+	tree, err := queryTree(q)
+	if err != nil {
+		return fmt.Sprintf("<invalid query: %v>", err)
+	}
+	if len(children(q, false)) == 0 && q.Bool == nil {
+		data, _ := json.Marshal(tree)
+		return string(data)
+	}
+	for kind, body := range tree {
+		object, ok := body.(map[string]any)
+		if !ok {
+			break
+		}
+		params := make(map[string]any)
+		for key, value := range object {
+			switch key {
+			case "must", "filter", "should", "must_not", "query", "queries", "positive", "negative":
+				continue
+			}
+			params[key] = value
+		}
+		if len(params) == 0 {
+			return kind
+		}
+		data, _ := json.Marshal(params)
+		return kind + " " + string(data)
+	}
+	data, _ := json.Marshal(tree)
+	return string(data)
+}
+
+// formatTree 将查询树格式化为多行文本，marks 中的路径会在行尾附加说明。
+func formatTree(q *types.Query, marks map[string]string) string {
+	if q == nil {
+		return "  <nil>\n"
+	}
+	var b strings.Builder
+	for _, c := range walkClauses(q) {
+		name := "query"
+		if c.path != "" {
+			segments := splitClausePath(c.path)
+			name = segments[len(segments)-1]
+		}
+		b.WriteString(strings.Repeat("  ", c.depth+1))
+		b.WriteString(name + ": " + describeClause(c.query))
+		if mark, ok := marks[c.path]; ok {
+			b.WriteString("  <-- " + mark)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func assertionError(q *types.Query, marks map[string]string, format string, args ...any) error {
+	return fmt.Errorf("esbtest: "+format+"\nquery tree:\n%s", append(args, strings.TrimSuffix(formatTree(q, marks), "\n"))...)
+}
@@ -0,0 +1,116 @@
+package esbtest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/qwenode/esb"
+)
+
+func assertQuery() *types.Query {
+	return esb.NewQuery(esb.Bool(
+		esb.Must(esb.Match("title", "elasticsearch")),
+		esb.Filter(
+			esb.Term("status", "published"),
+			esb.NumberRange("price").Gte(10).Build(),
+			esb.Bool(esb.Should(esb.Term("tags", "go"), esb.Term("tags", "es"))),
+		),
+		esb.MustNot(esb.Exists("deleted_at")),
+	))
+}
+
+func TestHasFilter(t *testing.T) {
+	query := assertQuery()
+
+	t.Run("匹配过滤子句", func(t *testing.T) {
+		Assert(t,
+			HasFilter(query, esb.Term("status", "published")),
+			HasFilter(esb.NewQuery(esb.ConstantScore(esb.Bool(esb.Must(esb.Term("status", "a"))))), esb.Term("status", "a")),
+		)
+	})
+
+	t.Run("位于算分上下文", func(t *testing.T) {
+		err := HasFilter(query, esb.Match("title", "elasticsearch"))
+		if err == nil {
+			t.Fatal("期望must中的子句不被视为过滤子句")
+		}
+		if !strings.Contains(err.Error(), `must[0]: {"match":{"title":{"query":"elasticsearch"}}}  <-- found here, but in scoring context`) {
+			t.Errorf("期望错误中标记子句位置, 实际得到:\n%v", err)
+		}
+	})
+
+	t.Run("不是必须满足的子句", func(t *testing.T) {
+		err := HasFilter(query, esb.Term("tags", "go"))
+		if err == nil || !strings.Contains(err.Error(), "found here, but not required") {
+			t.Errorf("期望should中的子句不被视为过滤子句, 实际得到: %v", err)
+		}
+	})
+
+	t.Run("不存在的子句", func(t *testing.T) {
+		err := HasFilter(query, esb.Term("status", "draft"))
+		if err == nil {
+			t.Fatal("期望返回错误")
+		}
+		message := err.Error()
+		for _, want := range []string{
+			`expected filter clause {"term":{"status":{"value":"draft"}}}`,
+			"query tree:\n  query: bool\n",
+			`    filter[0]: {"term":{"status":{"value":"published"}}}`,
+			"      should[1]: ",
+		} {
+			if !strings.Contains(message, want) {
+				t.Errorf("期望错误中包含 %q, 实际得到:\n%s", want, message)
+			}
+		}
+	})
+}
+
+func TestHasClause(t *testing.T) {
+	query := assertQuery()
+	Assert(t,
+		HasClause(query, "bool.filter", OfKind("range")),
+		HasClause(query, "bool.filter[2].bool.should", EqualTo(esb.Term("tags", "es"))),
+		HasClause(query, "*.filter.*.should", OfKind("term")),
+		HasClause(query, "", OfKind("bool")),
+	)
+
+	if err := HasClause(query, "bool.should", OfKind("match")); err == nil || !strings.Contains(err.Error(), `no clause at path "bool.should"`) {
+		t.Errorf("期望路径不存在时返回错误, 实际得到: %v", err)
+	}
+	err := HasClause(query, "bool.must_not", OfKind("term"))
+	if err == nil || !strings.Contains(err.Error(), `must_not[0]: {"exists":{"field":"deleted_at"}}  <-- does not satisfy predicate`) {
+		t.Errorf("期望标记不满足条件的子句, 实际得到: %v", err)
+	}
+}
+
+func TestReferencesField(t *testing.T) {
+	query := assertQuery()
+	Assert(t,
+		ReferencesField(query, "price"),
+		ReferencesField(query, "deleted_at"),
+		ReferencesField(esb.NewQuery(esb.MultiMatch("go", "title^2", "content")), "title"),
+		ReferencesField(esb.NewQuery(esb.Nested("comments", esb.Term("comments.user", "a"))), "comments"),
+	)
+
+	err := ReferencesField(query, "category")
+	if err == nil || !strings.Contains(err.Error(), "referenced fields: [deleted_at, price, status, tags, title]") {
+		t.Errorf("期望列出已引用的字段, 实际得到: %v", err)
+	}
+}
+
+func TestNoScoringClauses(t *testing.T) {
+	Assert(t,
+		NoScoringClauses(esb.NewQuery(esb.BoolFilter(esb.Term("status", "a"), esb.Bool(esb.Should(esb.Term("tags", "go")))))),
+		NoScoringClauses(esb.NewQuery(esb.ConstantScore(esb.Match("title", "go")))),
+		NoScoringClauses(esb.NewQuery(esb.MatchAll())),
+	)
+
+	err := NoScoringClauses(assertQuery())
+	if err == nil {
+		t.Fatal("期望must中的match被视为算分子句")
+	}
+	if !strings.Contains(err.Error(), "found 1") || !strings.Contains(err.Error(), "must[0]: ") {
+		t.Errorf("期望错误中标记算分子句, 实际得到:\n%v", err)
+	}
+}
@@ -0,0 +1,440 @@
+package esbtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+var (
+	// ErrNoInteraction 表示回放时在录像中找不到与请求匹配的记录。
+	ErrNoInteraction = errors.New("esbtest: no recorded interaction")
+)
+
+// Mode 表示录像的工作模式。
+type Mode int
+
+const (
+	// ModeReplay 只从录像中回放，找不到匹配的记录时返回 ErrNoInteraction。
+	ModeReplay Mode = iota
+	// ModeRecord 将请求转发给真实集群，并在 Stop 时覆盖写入录像文件。
+	ModeRecord
+	// ModeAuto 在录像文件存在时回放，否则录制。
+	ModeAuto
+)
+
+// Interaction 是录像中的一次请求与响应，录像文件每行保存一个 Interaction。
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest 是录制的请求，不包含请求头，避免把认证信息写入录像。
+type RecordedRequest struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query,omitempty"`
+	Body   string `json:"body,omitempty"`
+}
+
+// RecordedResponse 是录制的响应。
+type RecordedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// RecorderOption 用于配置 Recorder。
+type RecorderOption func(*Recorder)
+
+// WithTransport 设置录制时转发请求使用的 http.RoundTripper，默认为 http.DefaultTransport。
+func WithTransport(transport http.RoundTripper) RecorderOption {
+	return func(r *Recorder) {
+		r.transport = transport
+	}
+}
+
+// WithBodyNormalizer 在默认的 JSON 规范化之后对请求体做额外处理，
+// 用于去掉时间戳、随机 ID 等每次运行都会变化的内容。
+//
+// 示例：
+//   esbtest.WithBodyNormalizer(func(body []byte) []byte {
+//       return timestampPattern.ReplaceAll(body, []byte(`"<now>"`))
+//   })
+func WithBodyNormalizer(normalize func(body []byte) []byte) RecorderOption {
+	return func(r *Recorder) {
+		r.normalizers = append(r.normalizers, normalize)
+	}
+}
+
+// Recorder 是录制与回放 Elasticsearch 请求的 http.RoundTripper。
+// 请求按方法、路径、查询参数以及规范化后的请求体匹配：JSON 与 NDJSON 请求体会忽略对象键顺序和空白。
+// 相同的请求按录制顺序依次回放，超出录制次数后重复回放最后一次的响应。
+type Recorder struct {
+	path        string
+	mode        Mode
+	transport   http.RoundTripper
+	normalizers []func([]byte) []byte
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// NewRecorder 创建录像，回放模式下会立即读取录像文件。
+//
+// 示例：
+//   recorder, err := esbtest.NewRecorder("testdata/search.ndjson", esbtest.ModeAuto)
+//   client, err := recorder.TypedClient(elasticsearch.Config{Addresses: []string{stagingURL}})
+//   defer recorder.Stop()
+func NewRecorder(path string, mode Mode, opts ...RecorderOption) (*Recorder, error) {
+	r := &Recorder{path: path, mode: mode, transport: http.DefaultTransport}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.mode == ModeAuto {
+		r.mode = ModeRecord
+		if _, err := os.Stat(path); err == nil {
+			r.mode = ModeReplay
+		}
+	}
+	if r.mode == ModeReplay {
+		interactions, err := LoadCassette(path)
+		if err != nil {
+			return nil, err
+		}
+		r.interactions = interactions
+		r.used = make([]bool, len(interactions))
+	}
+	return r, nil
+}
+
+// NewRecordingClient 创建录像并返回使用它的 TypedClient，录制模式下测试结束时自动写入录像文件。
+//
+// 示例：
+//   client := esbtest.NewRecordingClient(t, "testdata/articles.ndjson", esbtest.ModeAuto,
+//       elasticsearch.Config{Addresses: []string{os.Getenv("ES_URL")}})
+func NewRecordingClient(t testing.TB, path string, mode Mode, cfg elasticsearch.Config, opts ...RecorderOption) *elasticsearch.TypedClient {
+	t.Helper()
+	recorder, err := NewRecorder(path, mode, opts...)
+	if err != nil {
+		t.Fatalf("esbtest: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := recorder.Stop(); err != nil {
+			t.Errorf("esbtest: %v", err)
+		}
+	})
+	client, err := recorder.TypedClient(cfg)
+	if err != nil {
+		t.Fatalf("esbtest: create typed client: %v", err)
+	}
+	return client
+}
+
+// Mode 返回实际使用的模式，ModeAuto 会被解析为 ModeRecord 或 ModeReplay。
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// TypedClient 返回通过录像收发请求的 TypedClient。
+// 原有的 cfg.Transport 会被替换，录制时如需自定义传输请使用 WithTransport。
+// 客户端关闭了重试，避免回放失败时重复匹配。
+func (r *Recorder) TypedClient(cfg elasticsearch.Config) (*elasticsearch.TypedClient, error) {
+	cfg.Transport = r
+	cfg.DisableRetry = true
+	return elasticsearch.NewTypedClient(cfg)
+}
+
+// Interactions 返回已录制或已加载的所有记录。
+func (r *Recorder) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Interaction(nil), r.interactions...)
+}
+
+// RoundTrip 实现 http.RoundTripper。
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		_ = req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	recorded := RecordedRequest{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  sortedQuery(req.URL.RawQuery),
+		Body:   string(body),
+	}
+	if r.mode == ModeRecord {
+		return r.record(req, recorded)
+	}
+	return r.replay(req, recorded)
+}
+
+func (r *Recorder) record(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interactions = append(r.interactions, Interaction{
+		Request: recorded,
+		Response: RecordedResponse{
+			Status: resp.StatusCode,
+			Header: resp.Header.Clone(),
+			Body:   string(data),
+		},
+	})
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	body := r.normalize([]byte(recorded.Body))
+	found, fallback := -1, -1
+	for i, interaction := range r.interactions {
+		if !r.matches(interaction.Request, recorded, body) {
+			continue
+		}
+		if !r.used[i] {
+			found = i
+			break
+		}
+		fallback = i
+	}
+	if found < 0 {
+		found = fallback
+	}
+	if found < 0 {
+		return nil, r.mismatch(recorded, body)
+	}
+	r.used[found] = true
+	interaction := r.interactions[found]
+	header := interaction.Response.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.Response.Status, http.StatusText(interaction.Response.Status)),
+		StatusCode:    interaction.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(interaction.Response.Body)),
+		ContentLength: int64(len(interaction.Response.Body)),
+		Request:       req,
+	}, nil
+}
+
+func (r *Recorder) matches(recorded, req RecordedRequest, body []byte) bool {
+	return recorded.Method == req.Method &&
+		recorded.Path == req.Path &&
+		sortedQuery(recorded.Query) == req.Query &&
+		bytes.Equal(r.normalize([]byte(recorded.Body)), body)
+}
+
+// mismatch 返回找不到匹配记录的错误，并附上与最接近的记录之间的差异。
+func (r *Recorder) mismatch(req RecordedRequest, body []byte) error {
+	want := describeRequest(req, body)
+	// 优先选择方法、路径与查询参数相同的记录，其次选择请求体差异最少的记录
+	closest, closestScore, closestChanges := -1, -1, 0
+	for i, interaction := range r.interactions {
+		score := 0
+		if interaction.Request.Method == req.Method {
+			score += 2
+		}
+		if interaction.Request.Path == req.Path {
+			score += 4
+		}
+		if sortedQuery(interaction.Request.Query) == req.Query {
+			score++
+		}
+		candidate := interaction.Request
+		changes := 0
+		for _, line := range strings.Split(lineDiff(describeRequest(candidate, r.normalize([]byte(candidate.Body))), want), "\n") {
+			if strings.HasPrefix(line, "+ ") || strings.HasPrefix(line, "- ") {
+				changes++
+			}
+		}
+		if score > closestScore || (score == closestScore && changes < closestChanges) {
+			closest, closestScore, closestChanges = i, score, changes
+		}
+	}
+	if closest < 0 {
+		return fmt.Errorf("%w for %s %s in %s (cassette is empty)\n%s", ErrNoInteraction, req.Method, req.Path, r.path, want)
+	}
+	candidate := r.interactions[closest].Request
+	got := describeRequest(candidate, r.normalize([]byte(candidate.Body)))
+	return fmt.Errorf("%w for %s %s in %s, diff against closest recording #%d (- recorded, + actual):\n%s",
+		ErrNoInteraction, req.Method, req.Path, r.path, closest+1, lineDiff(got, want))
+}
+
+// normalize 规范化请求体：JSON 以及 NDJSON 的每一行都会按键排序重新编码。
+func (r *Recorder) normalize(body []byte) []byte {
+	result, ok := canonicalJSON(body)
+	if !ok {
+		lines := bytes.Split(bytes.TrimSpace(body), []byte("\n"))
+		for i, line := range lines {
+			lines[i], _ = canonicalJSON(line)
+		}
+		result = bytes.Join(lines, []byte("\n"))
+	}
+	for _, normalize := range r.normalizers {
+		result = normalize(result)
+	}
+	return result
+}
+
+// canonicalJSON 将单个 JSON 值按键排序重新编码，data 不是单个 JSON 值时原样返回去掉首尾空白的内容。
+func canonicalJSON(data []byte) ([]byte, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var tree any
+	if err := decoder.Decode(&tree); err != nil || decoder.More() {
+		return bytes.TrimSpace(data), false
+	}
+	canonical, err := json.Marshal(tree)
+	if err != nil {
+		return bytes.TrimSpace(data), false
+	}
+	return canonical, true
+}
+
+func sortedQuery(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	parts := strings.Split(raw, "&")
+	sort.Strings(parts)
+	return strings.Join(parts, "&")
+}
+
+// describeRequest 将请求展开为便于比较的多行文本，JSON 请求体会被格式化。
+func describeRequest(req RecordedRequest, body []byte) string {
+	var b strings.Builder
+	b.WriteString(req.Method + " " + req.Path)
+	if query := sortedQuery(req.Query); query != "" {
+		b.WriteString("?" + query)
+	}
+	b.WriteString("\n")
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		var pretty bytes.Buffer
+		if json.Indent(&pretty, line, "", "  ") == nil {
+			line = pretty.Bytes()
+		}
+		if len(line) > 0 {
+			b.Write(line)
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// lineDiff 基于最长公共子序列逐行比较两段文本。
+func lineDiff(a, b string) string {
+	x := strings.Split(strings.TrimSuffix(a, "\n"), "\n")
+	y := strings.Split(strings.TrimSuffix(b, "\n"), "\n")
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			out.WriteString("  " + x[i] + "\n")
+			i++
+			j++
+		case j < len(y) && (i == len(x) || lcs[i][j+1] >= lcs[i+1][j]):
+			out.WriteString("+ " + y[j] + "\n")
+			j++
+		default:
+			out.WriteString("- " + x[i] + "\n")
+			i++
+		}
+	}
+	return out.String()
+}
+
+// Stop 结束录像，录制模式下将所有记录写入录像文件。
+func (r *Recorder) Stop() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+	return SaveCassette(r.path, r.Interactions())
+}
+
+// LoadCassette 读取 NDJSON 格式的录像文件。
+func LoadCassette(path string) ([]Interaction, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var interactions []Interaction
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var interaction Interaction
+		if err := json.Unmarshal(scanner.Bytes(), &interaction); err != nil {
+			return nil, fmt.Errorf("esbtest: %s:%d: %w", path, line, err)
+		}
+		interactions = append(interactions, interaction)
+	}
+	return interactions, scanner.Err()
+}
+
+// SaveCassette 将记录写入 NDJSON 格式的录像文件，目录不存在时会自动创建。
+func SaveCassette(path string, interactions []Interaction) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	for _, interaction := range interactions {
+		if err := encoder.Encode(interaction); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
@@ -0,0 +1,99 @@
+package esbtest
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/qwenode/esb"
+	"github.com/qwenode/esb/activerecord"
+)
+
+func TestRecorder(t *testing.T) {
+	ctx := context.Background()
+	cassette := filepath.Join(t.TempDir(), "testdata", "products.ndjson")
+	search := func(client *elasticsearch.TypedClient, category string) (int64, error) {
+		response, err := client.Search().Index("products").
+			Query(esb.NewQuery(esb.BoolFilter(esb.Term("category", category)))).
+			Do(ctx)
+		if err != nil {
+			return 0, err
+		}
+		return response.Hits.Total.Value, nil
+	}
+
+	t.Run("录制", func(t *testing.T) {
+		server := NewServer()
+		defer server.Close()
+		_ = server.Put("products", "1", product{Name: "Go", Category: "book"})
+
+		recorder, err := NewRecorder(cassette, ModeAuto)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if recorder.Mode() != ModeRecord {
+			t.Fatalf("期望录像不存在时使用录制模式")
+		}
+		client, err := recorder.TypedClient(elasticsearch.Config{Addresses: []string{server.URL()}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total, err := search(client, "book"); err != nil || total != 1 {
+			t.Fatalf("期望1条结果, 实际得到: %v, %v", total, err)
+		}
+		if _, err := activerecord.New(client, product{}).FindPK(ctx, "1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := recorder.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("回放", func(t *testing.T) {
+		client := NewRecordingClient(t, cassette, ModeAuto, elasticsearch.Config{})
+		if total, err := search(client, "book"); err != nil || total != 1 {
+			t.Fatalf("期望回放1条结果, 实际得到: %v, %v", total, err)
+		}
+		got, err := activerecord.New(client, product{}).FindPK(ctx, "1")
+		if err != nil || got.Name != "Go" {
+			t.Errorf("期望回放文档, 实际得到: %+v, %v", got, err)
+		}
+	})
+
+	t.Run("请求体忽略键顺序与空白", func(t *testing.T) {
+		recorder, err := NewRecorder(cassette, ModeReplay)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorded := recorder.Interactions()[0].Request
+		if got := recorder.normalize([]byte(" {\"b\": 1,\n \"a\": [1, 2]}\n")); string(got) != `{"a":[1,2],"b":1}` {
+			t.Errorf("规范化结果不正确: %s", got)
+		}
+		if !recorder.matches(recorded, recorded, recorder.normalize([]byte(recorded.Body))) {
+			t.Error("期望请求与自身匹配")
+		}
+	})
+
+	t.Run("找不到匹配时返回差异", func(t *testing.T) {
+		client := NewRecordingClient(t, cassette, ModeReplay, elasticsearch.Config{})
+		_, err := search(client, "music")
+		if !errors.Is(err, ErrNoInteraction) {
+			t.Fatalf("期望ErrNoInteraction, 实际得到: %v", err)
+		}
+		message := err.Error()
+		if !strings.Contains(message, `-               "value": "book"`) || !strings.Contains(message, `+               "value": "music"`) {
+			t.Errorf("期望错误中包含请求体差异, 实际得到:\n%s", message)
+		}
+	})
+}
+
+func TestLineDiff(t *testing.T) {
+	got := lineDiff("a\nb\nc\n", "a\nx\nc\n")
+	want := "  a\n+ x\n- b\n  c\n"
+	if got != want {
+		t.Errorf("期望:\n%s实际得到:\n%s", want, got)
+	}
+}
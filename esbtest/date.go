@@ -0,0 +1,168 @@
+package esbtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qwenode/esb"
+)
+
+// defaultDateLayout 是 strict_date_optional_time 可以识别的一种写法，
+// fill 为向上舍入（gt、lte）时需要补齐的时间，与 Elasticsearch 用最大值补齐缺失时间分量的规则一致。
+type defaultDateLayout struct {
+	layout string
+	fill   time.Duration
+}
+
+var defaultDateLayouts = []defaultDateLayout{
+	{time.RFC3339Nano, time.Second - 1},
+	{"2006-01-02T15:04:05.999999999", time.Second - 1},
+	{"2006-01-02T15:04Z07:00", time.Minute - 1},
+	{"2006-01-02T15:04", time.Minute - 1},
+	{"2006-01-02T15", time.Hour - 1},
+	{"2006-01-02", 24*time.Hour - 1},
+	{"2006-01", 24*time.Hour - 1},
+	{"2006", 24*time.Hour - 1},
+}
+
+// parseDateBound 解析范围查询的端点，支持 now 与 "日期||" 开头的日期数学表达式。
+// roundUp 为 true 时（gt、lte）缺失的时间分量与舍入结果都取周期末尾。
+func (e *evaluator) parseDateBound(value string, format *string, loc *time.Location, roundUp bool) (time.Time, error) {
+	anchor, expression := e.now.In(loc), value
+	switch {
+	case strings.HasPrefix(value, "now"):
+	case strings.Contains(value, "||"):
+		// 锚点按查询的 format 解析，运算部分交给 esb.ParseDateMath 校验
+		parts := strings.SplitN(value, "||", 2)
+		t, err := parseDateString(parts[0], format, loc, false)
+		if err != nil {
+			return time.Time{}, err
+		}
+		anchor, expression = t, "now"+parts[1]
+	default:
+		return parseDateString(value, format, loc, roundUp)
+	}
+	m, err := esb.ParseDateMath(expression)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %w", ErrUnsupportedQuery, err)
+	}
+	return m.Apply(anchor, roundUp)
+}
+
+// parseDateValue 解析文档中的日期值，数字按 epoch_millis 处理。
+func parseDateValue(v any, format *string, loc *time.Location) (time.Time, error) {
+	switch v := v.(type) {
+	case json.Number:
+		return parseDateString(v.String(), format, loc, false)
+	case string:
+		return parseDateString(v, format, loc, false)
+	}
+	return time.Time{}, fmt.Errorf("esbtest: %v is not a date", v)
+}
+
+// parseDateString 按 format 解析日期字符串，未指定 format 时使用 strict_date_optional_time||epoch_millis。
+func parseDateString(value string, format *string, loc *time.Location, roundUp bool) (time.Time, error) {
+	formats := []string{"strict_date_optional_time", "epoch_millis"}
+	if format != nil {
+		formats = strings.Split(*format, "||")
+	}
+	for _, f := range formats {
+		switch f {
+		case "strict_date_optional_time", "date_optional_time", "strict_date_time", "date_time":
+			for _, l := range defaultDateLayouts {
+				if t, err := time.ParseInLocation(l.layout, value, loc); err == nil {
+					return fillDate(t, value, l.fill, roundUp), nil
+				}
+			}
+		case "epoch_millis", "epoch_second":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			if f == "epoch_second" {
+				return time.Unix(n, 0).UTC(), nil
+			}
+			return time.UnixMilli(n).UTC(), nil
+		default:
+			layout, fill, err := javaDateLayout(f)
+			if err != nil {
+				return time.Time{}, err
+			}
+			if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+				return fillDate(t, value, fill, roundUp), nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("esbtest: cannot parse date %q", value)
+}
+
+func fillDate(t time.Time, value string, fill time.Duration, roundUp bool) time.Time {
+	if !roundUp {
+		return t
+	}
+	// 带有小数秒的时间已经是完整精度，不需要补齐
+	if fill == time.Second-1 && strings.Contains(value, ".") {
+		return t
+	}
+	return t.Add(fill)
+}
+
+// javaDateLayout 将常见的 Java 日期格式转换为 Go 的时间布局。
+func javaDateLayout(pattern string) (string, time.Duration, error) {
+	replacements := []struct{ java, golang string }{
+		{"yyyy", "2006"}, {"uuuu", "2006"}, {"yy", "06"},
+		{"MM", "01"}, {"dd", "02"}, {"HH", "15"}, {"mm", "04"}, {"ss", "05"},
+		{"SSS", "000"}, {"XXX", "Z07:00"}, {"Z", "-0700"}, {"'T'", "T"},
+	}
+	var b strings.Builder
+	for i := 0; i < len(pattern); {
+		matched := false
+		for _, r := range replacements {
+			if strings.HasPrefix(pattern[i:], r.java) {
+				b.WriteString(r.golang)
+				i += len(r.java)
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+		c := pattern[i]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+			return "", 0, unsupported("date format %q", pattern)
+		}
+		b.WriteByte(c)
+		i++
+	}
+	layout := b.String()
+	fill := time.Duration(0)
+	switch {
+	case !strings.Contains(layout, "15"):
+		fill = 24*time.Hour - 1
+	case !strings.Contains(layout, "04"):
+		fill = time.Hour - 1
+	case !strings.Contains(layout, "05"):
+		fill = time.Minute - 1
+	case !strings.Contains(layout, "000"):
+		fill = time.Second - 1
+	}
+	return layout, fill, nil
+}
+
+// loadLocation 支持 "+08:00" 形式的偏移量以及 IANA 时区名称。
+func loadLocation(name string) (*time.Location, error) {
+	if strings.HasPrefix(name, "+") || strings.HasPrefix(name, "-") {
+		for _, layout := range []string{"-07:00", "-0700", "-07"} {
+			if t, err := time.Parse(layout, name); err == nil {
+				_, offset := t.Zone()
+				return time.FixedZone(name, offset), nil
+			}
+		}
+		return nil, fmt.Errorf("esbtest: invalid time zone offset %q", name)
+	}
+	return time.LoadLocation(name)
+}
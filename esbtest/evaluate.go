@@ -0,0 +1,868 @@
+// Package esbtest 提供了在不依赖 Elasticsearch 集群的情况下测试 esb 查询的工具。
+//
+// 它可以在内存中针对 Go 值或 JSON 文档执行 *types.Query，用于快速地表格化测试过滤逻辑。
+// 所有字段都按 keyword 语义精确匹配，只有 Match 查询使用近似 standard 分析器的分词规则。
+// 未支持的查询类型会返回包装了 ErrUnsupportedQuery 的错误，而不是静默地给出错误结果。
+package esbtest
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+var (
+	// ErrUnsupportedQuery 表示查询中包含内存执行器不支持的查询类型或参数。
+	ErrUnsupportedQuery = errors.New("esbtest: unsupported query")
+)
+
+// IsUnsupportedQuery 判断错误是否由不支持的查询引起。
+func IsUnsupportedQuery(err error) bool {
+	return errors.Is(err, ErrUnsupportedQuery)
+}
+
+// Doc 表示一个带有 _id 的待匹配文档，Source 可以是结构体、map 或 JSON 字节。
+// IDs 查询只能匹配 Doc 类型的文档。
+type Doc struct {
+	ID     string
+	Source any
+}
+
+// Option 用于配置内存执行器。
+type Option func(*evaluator)
+
+// WithNow 固定日期数学表达式中 now 的取值，使包含 now 的范围查询结果可以重复。
+//
+// 示例：
+//   esbtest.Matches(query, doc, esbtest.WithNow(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)))
+func WithNow(now time.Time) Option {
+	return func(e *evaluator) {
+		e.now = now
+	}
+}
+
+// Matches 判断文档是否匹配查询。
+// doc 可以是结构体、map、[]byte、json.RawMessage 或 Doc。
+//
+// 示例：
+//   ok, err := esbtest.Matches(
+//       esb.NewQuery(esb.Term("status", "published")),
+//       Article{Status: "published"},
+//   )
+func Matches(q *types.Query, doc any, opts ...Option) (bool, error) {
+	e := newEvaluator(opts)
+	d, err := loadDocument(doc)
+	if err != nil {
+		return false, err
+	}
+	if q == nil {
+		return true, nil
+	}
+	return e.eval(*q, &scope{doc: d})
+}
+
+// Select 返回 docs 中匹配查询的文档，保持原有顺序。
+//
+// 示例：
+//   published, err := esbtest.Select(esb.NewQuery(esb.Term("status", "published")), articles)
+func Select[T any](q *types.Query, docs []T, opts ...Option) ([]T, error) {
+	e := newEvaluator(opts)
+	var result []T
+	for i, doc := range docs {
+		d, err := loadDocument(doc)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		matched := true
+		if q != nil {
+			matched, err = e.eval(*q, &scope{doc: d})
+			if err != nil {
+				return nil, err
+			}
+		}
+		if matched {
+			result = append(result, doc)
+		}
+	}
+	return result, nil
+}
+
+type evaluator struct {
+	now time.Time
+}
+
+func newEvaluator(opts []Option) *evaluator {
+	e := &evaluator{now: time.Now()}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// document 是规范化为 JSON 树之后的文档。
+type document struct {
+	id     string
+	hasID  bool
+	source map[string]any
+}
+
+// scope 表示查询执行时的文档范围，nested 查询会把某个路径绑定到单个嵌套对象上。
+type scope struct {
+	doc    *document
+	nested map[string]any
+}
+
+func (s *scope) with(path string, obj any) *scope {
+	nested := make(map[string]any, len(s.nested)+1)
+	for k, v := range s.nested {
+		nested[k] = v
+	}
+	nested[path] = obj
+	return &scope{doc: s.doc, nested: nested}
+}
+
+// values 返回字段的所有标量值，对象数组会被展开。
+func (s *scope) values(field string) []any {
+	bound := ""
+	for path := range s.nested {
+		if (field == path || strings.HasPrefix(field, path+".")) && len(path) > len(bound) {
+			bound = path
+		}
+	}
+	if bound != "" {
+		rest := strings.TrimPrefix(strings.TrimPrefix(field, bound), ".")
+		return resolve(s.nested[bound], splitPath(rest))
+	}
+	return resolve(s.doc.source, splitPath(field))
+}
+
+func splitPath(field string) []string {
+	if field == "" {
+		return nil
+	}
+	return strings.Split(field, ".")
+}
+
+func resolve(node any, parts []string) []any {
+	switch v := node.(type) {
+	case nil:
+		return nil
+	case []any:
+		var result []any
+		for _, item := range v {
+			result = append(result, resolve(item, parts)...)
+		}
+		return result
+	case map[string]any:
+		if len(parts) == 0 {
+			return []any{v}
+		}
+		var result []any
+		// 同时支持 {"a": {"b": 1}} 与 {"a.b": 1} 两种写法
+		for i := 1; i <= len(parts); i++ {
+			if child, ok := v[strings.Join(parts[:i], ".")]; ok {
+				result = append(result, resolve(child, parts[i:])...)
+			}
+		}
+		return result
+	default:
+		if len(parts) > 0 {
+			return nil
+		}
+		return []any{v}
+	}
+}
+
+func loadDocument(doc any) (*document, error) {
+	d := &document{}
+	switch v := doc.(type) {
+	case Doc:
+		d.id, d.hasID = v.ID, true
+		doc = v.Source
+	case *Doc:
+		d.id, d.hasID = v.ID, true
+		doc = v.Source
+	}
+	var data []byte
+	switch v := doc.(type) {
+	case json.RawMessage:
+		data = v
+	case []byte:
+		data = v
+	default:
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var tree any
+	if err := decoder.Decode(&tree); err != nil {
+		return nil, err
+	}
+	source, ok := tree.(map[string]any)
+	if !ok && tree != nil {
+		return nil, fmt.Errorf("esbtest: document must be a JSON object, got %T", tree)
+	}
+	d.source = source
+	return d, nil
+}
+
+// unsupported 返回一个包装了 ErrUnsupportedQuery 的错误。
+func unsupported(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrUnsupportedQuery, fmt.Sprintf(format, args...))
+}
+
+// queryKinds 返回 types.Query 中已设置的查询类型名称。
+func queryKinds(q types.Query) []string {
+	var kinds []string
+	v := reflect.ValueOf(q)
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).IsZero() {
+			continue
+		}
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "-" {
+			for key := range q.AdditionalQueryProperty {
+				kinds = append(kinds, key)
+			}
+			continue
+		}
+		kinds = append(kinds, name)
+	}
+	return kinds
+}
+
+func (e *evaluator) eval(q types.Query, s *scope) (bool, error) {
+	kinds := queryKinds(q)
+	if len(kinds) != 1 {
+		return false, unsupported("query must contain exactly one query type, got %v", kinds)
+	}
+	switch {
+	case q.Bool != nil:
+		return e.evalBool(q.Bool, s)
+	case q.ConstantScore != nil:
+		return e.eval(q.ConstantScore.Filter, s)
+	case q.MatchAll != nil:
+		return true, nil
+	case q.MatchNone != nil:
+		return false, nil
+	case q.Nested != nil:
+		return e.evalNested(q.Nested, s)
+	case q.Ids != nil:
+		if !s.doc.hasID {
+			return false, unsupported("ids query requires documents wrapped in esbtest.Doc")
+		}
+		for _, id := range q.Ids.Values {
+			if id == s.doc.id {
+				return true, nil
+			}
+		}
+		return false, nil
+	case q.Exists != nil:
+		return len(s.values(q.Exists.Field)) > 0, nil
+	case len(q.Term) > 0:
+		return eachField(q.Term, func(field string, term types.TermQuery) (bool, error) {
+			return anyValue(s.values(field), func(v any) bool {
+				return equalValues(v, term.Value, isTrue(term.CaseInsensitive))
+			}), nil
+		})
+	case q.Terms != nil:
+		return e.evalTerms(q.Terms, s)
+	case len(q.Range) > 0:
+		return eachField(q.Range, func(field string, r types.RangeQuery) (bool, error) {
+			return e.evalRange(s.values(field), r)
+		})
+	case len(q.Prefix) > 0:
+		return eachField(q.Prefix, func(field string, prefix types.PrefixQuery) (bool, error) {
+			return anyString(s.values(field), func(v string) bool {
+				if isTrue(prefix.CaseInsensitive) {
+					return strings.HasPrefix(strings.ToLower(v), strings.ToLower(prefix.Value))
+				}
+				return strings.HasPrefix(v, prefix.Value)
+			}), nil
+		})
+	case len(q.Wildcard) > 0:
+		return eachField(q.Wildcard, func(field string, wildcard types.WildcardQuery) (bool, error) {
+			pattern := wildcard.Value
+			if pattern == nil {
+				pattern = wildcard.Wildcard
+			}
+			if pattern == nil {
+				return false, unsupported("wildcard query on %q has no value", field)
+			}
+			re, err := compilePattern(wildcardToRegexp(*pattern), isTrue(wildcard.CaseInsensitive))
+			if err != nil {
+				return false, err
+			}
+			return anyString(s.values(field), re.MatchString), nil
+		})
+	case len(q.Regexp) > 0:
+		return eachField(q.Regexp, func(field string, r types.RegexpQuery) (bool, error) {
+			re, err := compilePattern(r.Value, isTrue(r.CaseInsensitive))
+			if err != nil {
+				return false, unsupported("regexp %q: %v", r.Value, err)
+			}
+			return anyString(s.values(field), re.MatchString), nil
+		})
+	case len(q.Match) > 0:
+		return eachField(q.Match, func(field string, match types.MatchQuery) (bool, error) {
+			return evalMatch(s.values(field), match)
+		})
+	}
+	return false, unsupported("%s query is not supported", kinds[0])
+}
+
+// eachField 对只包含一个字段的字段级查询执行 fn。
+func eachField[T any](fields map[string]T, fn func(field string, query T) (bool, error)) (bool, error) {
+	if len(fields) != 1 {
+		return false, unsupported("field level query must target exactly one field, got %d", len(fields))
+	}
+	for field, query := range fields {
+		return fn(field, query)
+	}
+	return false, nil
+}
+
+func (e *evaluator) evalBool(b *types.BoolQuery, s *scope) (bool, error) {
+	for _, clause := range b.Must {
+		if ok, err := e.eval(clause, s); err != nil || !ok {
+			return false, err
+		}
+	}
+	for _, clause := range b.Filter {
+		if ok, err := e.eval(clause, s); err != nil || !ok {
+			return false, err
+		}
+	}
+	for _, clause := range b.MustNot {
+		if ok, err := e.eval(clause, s); err != nil || ok {
+			return false, err
+		}
+	}
+	matched := 0
+	for _, clause := range b.Should {
+		ok, err := e.eval(clause, s)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			matched++
+		}
+	}
+	minimum := 0
+	if len(b.Should) > 0 && len(b.Must)+len(b.Filter) == 0 {
+		minimum = 1
+	}
+	if b.MinimumShouldMatch != nil {
+		var err error
+		if minimum, err = minimumShouldMatch(b.MinimumShouldMatch, len(b.Should)); err != nil {
+			return false, err
+		}
+	}
+	return matched >= minimum, nil
+}
+
+// minimumShouldMatch 计算 minimum_should_match 对应的子句数量，支持整数与百分比写法。
+func minimumShouldMatch(value types.MinimumShouldMatch, optional int) (int, error) {
+	var text string
+	switch v := value.(type) {
+	case int:
+		text = strconv.Itoa(v)
+	case string:
+		text = strings.TrimSpace(v)
+	default:
+		text = fmt.Sprint(v)
+	}
+	if strings.HasSuffix(text, "%") {
+		percent, err := strconv.Atoi(strings.TrimSuffix(text, "%"))
+		if err != nil {
+			return 0, unsupported("minimum_should_match %q", text)
+		}
+		count := optional * abs(percent) / 100
+		if percent < 0 {
+			return optional - count, nil
+		}
+		return count, nil
+	}
+	count, err := strconv.Atoi(text)
+	if err != nil {
+		return 0, unsupported("minimum_should_match %q", text)
+	}
+	if count < 0 {
+		count = optional + count
+	}
+	return max(count, 0), nil
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func (e *evaluator) evalNested(n *types.NestedQuery, s *scope) (bool, error) {
+	for _, obj := range s.values(n.Path) {
+		if _, ok := obj.(map[string]any); !ok {
+			continue
+		}
+		ok, err := e.eval(n.Query, s.with(n.Path, obj))
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func (e *evaluator) evalTerms(t *types.TermsQuery, s *scope) (bool, error) {
+	return eachField(t.TermsQuery, func(field string, raw types.TermsQueryField) (bool, error) {
+		rv := reflect.ValueOf(raw)
+		if rv.Kind() != reflect.Slice {
+			return false, unsupported("terms query on %q must use a list of values", field)
+		}
+		docValues := s.values(field)
+		for i := 0; i < rv.Len(); i++ {
+			want := rv.Index(i).Interface()
+			if anyValue(docValues, func(v any) bool { return equalValues(v, want, false) }) {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+}
+
+func isTrue(b *bool) bool {
+	return b != nil && *b
+}
+
+func anyValue(values []any, fn func(v any) bool) bool {
+	for _, v := range values {
+		if fn(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func anyString(values []any, fn func(v string) bool) bool {
+	return anyValue(values, func(v any) bool {
+		s, ok := scalarString(v)
+		return ok && fn(s)
+	})
+}
+
+// scalarString 将标量值转换为它在倒排索引中的字符串形式。
+func scalarString(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// equalValues 按 keyword/数值/布尔语义比较文档值与查询值。
+func equalValues(docValue, queryValue any, caseInsensitive bool) bool {
+	if docNumber, ok := docValue.(json.Number); ok {
+		return equalNumbers(docNumber.String(), queryValue)
+	}
+	if docBool, ok := docValue.(bool); ok {
+		switch q := queryValue.(type) {
+		case bool:
+			return docBool == q
+		case string:
+			return strconv.FormatBool(docBool) == q
+		}
+		return false
+	}
+	docString, ok := docValue.(string)
+	if !ok {
+		return false
+	}
+	switch q := queryValue.(type) {
+	case string:
+		if caseInsensitive {
+			return strings.EqualFold(docString, q)
+		}
+		return docString == q
+	case bool:
+		return docString == strconv.FormatBool(q)
+	case nil:
+		return false
+	}
+	// 数值类型的查询值与字符串文档值按数值比较，与 Elasticsearch 的类型转换一致
+	return equalNumbers(docString, queryValue)
+}
+
+func equalNumbers(doc string, queryValue any) bool {
+	query, ok := numberText(queryValue)
+	if !ok {
+		return false
+	}
+	if a, err := strconv.ParseInt(doc, 10, 64); err == nil {
+		if b, err := strconv.ParseInt(query, 10, 64); err == nil {
+			return a == b
+		}
+	}
+	a, errA := strconv.ParseFloat(doc, 64)
+	b, errB := strconv.ParseFloat(query, 64)
+	return errA == nil && errB == nil && a == b
+}
+
+// numberText 返回数值的文本表示，避免 int64 经过 float64 时丢失精度。
+func numberText(v any) (string, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		return v.String(), true
+	case string:
+		return v, true
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v), true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), true
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), true
+	case types.Float64:
+		return strconv.FormatFloat(float64(v), 'g', -1, 64), true
+	}
+	return "", false
+}
+
+func toFloat(v any) (float64, bool) {
+	text, ok := numberText(v)
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	return f, err == nil && !math.IsNaN(f)
+}
+
+// wildcardToRegexp 将通配符模式转换为正则表达式。
+func wildcardToRegexp(pattern string) string {
+	var b strings.Builder
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return b.String()
+}
+
+// compilePattern 编译一个需要完整匹配词项的正则表达式，与 Lucene 的语义一致。
+func compilePattern(pattern string, caseInsensitive bool) (*regexp.Regexp, error) {
+	prefix := "(?s)"
+	if caseInsensitive {
+		prefix = "(?is)"
+	}
+	return regexp.Compile(prefix + "^(?:" + pattern + ")$")
+}
+
+// analyze 近似 standard 分析器：按 Unicode 字母和数字切分并转换为小写。
+func analyze(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+}
+
+func evalMatch(values []any, match types.MatchQuery) (bool, error) {
+	if match.Fuzziness != nil {
+		return false, unsupported("match query fuzziness")
+	}
+	if match.Analyzer != nil && *match.Analyzer != "standard" {
+		return false, unsupported("match query analyzer %q", *match.Analyzer)
+	}
+	tokens := analyze(match.Query)
+	if len(tokens) == 0 {
+		// zero_terms_query 默认为 none
+		return match.ZeroTermsQuery != nil && match.ZeroTermsQuery.Name == "all", nil
+	}
+	indexed := make(map[string]bool)
+	for _, v := range values {
+		text, ok := scalarString(v)
+		if !ok {
+			continue
+		}
+		for _, token := range analyze(text) {
+			indexed[token] = true
+		}
+	}
+	matched := 0
+	for _, token := range tokens {
+		if indexed[token] {
+			matched++
+		}
+	}
+	minimum := 1
+	if match.Operator != nil && strings.EqualFold(match.Operator.Name, "and") {
+		minimum = len(tokens)
+	}
+	if match.MinimumShouldMatch != nil {
+		var err error
+		if minimum, err = minimumShouldMatch(match.MinimumShouldMatch, len(tokens)); err != nil {
+			return false, err
+		}
+		minimum = max(minimum, 1)
+	}
+	return matched >= minimum, nil
+}
+
+// rangeBound 表示范围查询的一个端点。
+type rangeBound struct {
+	value     any
+	inclusive bool
+	upper     bool
+}
+
+func (e *evaluator) evalRange(values []any, r types.RangeQuery) (bool, error) {
+	switch r := r.(type) {
+	case *types.NumberRangeQuery:
+		return e.evalRange(values, *r)
+	case *types.DateRangeQuery:
+		return e.evalRange(values, *r)
+	case *types.TermRangeQuery:
+		return e.evalRange(values, *r)
+	case types.NumberRangeQuery:
+		if r.Relation != nil {
+			return false, unsupported("range relation")
+		}
+		bounds := numberBounds(r)
+		return anyValue(values, func(v any) bool {
+			f, ok := toFloat(v)
+			return ok && within(bounds, func(b any) int { return compareFloat(f, float64(b.(types.Float64))) })
+		}), nil
+	case types.DateRangeQuery:
+		if r.Relation != nil {
+			return false, unsupported("range relation")
+		}
+		return e.evalDateRange(values, stringBounds(r.Gt, r.Gte, r.Lt, r.Lte, r.From, r.To), r.Format, r.TimeZone)
+	case types.TermRangeQuery:
+		if r.Relation != nil {
+			return false, unsupported("range relation")
+		}
+		bounds := stringBounds(r.Gt, r.Gte, r.Lt, r.Lte, r.From, r.To)
+		return anyString(values, func(v string) bool {
+			return within(bounds, func(b any) int { return strings.Compare(v, b.(string)) })
+		}), nil
+	case *types.UntypedRangeQuery:
+		return e.evalUntypedRange(values, r)
+	}
+	return false, unsupported("range query of type %T", r)
+}
+
+func numberBounds(r types.NumberRangeQuery) []rangeBound {
+	var bounds []rangeBound
+	add := func(v *types.Float64, inclusive, upper bool) {
+		if v != nil {
+			bounds = append(bounds, rangeBound{value: *v, inclusive: inclusive, upper: upper})
+		}
+	}
+	add(r.Gt, false, false)
+	add(r.Gte, true, false)
+	add(r.From, true, false)
+	add(r.Lt, false, true)
+	add(r.Lte, true, true)
+	add(r.To, true, true)
+	return bounds
+}
+
+func stringBounds(gt, gte, lt, lte, from, to *string) []rangeBound {
+	var bounds []rangeBound
+	add := func(v *string, inclusive, upper bool) {
+		if v != nil {
+			bounds = append(bounds, rangeBound{value: *v, inclusive: inclusive, upper: upper})
+		}
+	}
+	add(gt, false, false)
+	add(gte, true, false)
+	add(from, true, false)
+	add(lt, false, true)
+	add(lte, true, true)
+	add(to, true, true)
+	return bounds
+}
+
+// within 判断值是否满足所有端点，compare 返回值与端点的比较结果。
+func within(bounds []rangeBound, compare func(bound any) int) bool {
+	for _, b := range bounds {
+		c := compare(b.value)
+		switch {
+		case b.upper && (c > 0 || (c == 0 && !b.inclusive)):
+			return false
+		case !b.upper && (c < 0 || (c == 0 && !b.inclusive)):
+			return false
+		}
+	}
+	return true
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (e *evaluator) evalDateRange(values []any, bounds []rangeBound, format, timeZone *string) (bool, error) {
+	loc := time.UTC
+	if timeZone != nil {
+		var err error
+		if loc, err = loadLocation(*timeZone); err != nil {
+			return false, unsupported("time_zone %q", *timeZone)
+		}
+	}
+	resolved := make([]rangeBound, len(bounds))
+	for i, b := range bounds {
+		// gt 与 lte 的舍入结果取周期末尾，gte 与 lt 取周期开头
+		roundUp := b.upper == b.inclusive
+		t, err := e.parseDateBound(b.value.(string), format, loc, roundUp)
+		if err != nil {
+			return false, err
+		}
+		resolved[i] = rangeBound{value: t, inclusive: b.inclusive, upper: b.upper}
+	}
+	return anyValue(values, func(v any) bool {
+		// 文档中的日期按映射的默认格式解析，无法解析时再尝试查询指定的格式
+		t, err := parseDateValue(v, nil, time.UTC)
+		if err != nil && format != nil {
+			t, err = parseDateValue(v, format, time.UTC)
+		}
+		return err == nil && within(resolved, func(b any) int { return t.Compare(b.(time.Time)) })
+	}), nil
+}
+
+// intBounds 在所有端点都是整数（JSON 数字或 esb.IntRange 使用的数字字符串）时返回 int64 端点。
+func intBounds(raw map[string]json.RawMessage) ([]rangeBound, bool) {
+	var bounds []rangeBound
+	for _, key := range []string{"gt", "gte", "from", "lt", "lte", "to"} {
+		message := raw[key]
+		if len(message) == 0 || string(message) == "null" {
+			continue
+		}
+		text := string(message)
+		if unquoted, err := strconv.Unquote(text); err == nil {
+			text = unquoted
+		}
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		inclusive := key != "gt" && key != "lt"
+		upper := key == "lt" || key == "lte" || key == "to"
+		bounds = append(bounds, rangeBound{value: n, inclusive: inclusive, upper: upper})
+	}
+	return bounds, len(bounds) > 0
+}
+
+// allNumbers 判断字段的所有值是否都是数值，日期等其他值仍按原有规则比较。
+func allNumbers(values []any) bool {
+	for _, v := range values {
+		if _, ok := toFloat(v); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// compareIntBound 比较数值文本与整数端点，整数按 int64 精确比较。
+func compareIntBound(text string, bound int64) int {
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return cmp.Compare(n, bound)
+	}
+	f, _ := strconv.ParseFloat(text, 64)
+	return compareFloat(f, float64(bound))
+}
+
+func (e *evaluator) evalUntypedRange(values []any, r *types.UntypedRangeQuery) (bool, error) {
+	if r.Relation != nil {
+		return false, unsupported("range relation")
+	}
+	raw := map[string]json.RawMessage{"gt": r.Gt, "gte": r.Gte, "lt": r.Lt, "lte": r.Lte}
+	if r.From != nil {
+		raw["from"] = *r.From
+	}
+	if r.To != nil {
+		raw["to"] = *r.To
+	}
+	if bounds, ok := intBounds(raw); ok && r.Format == nil && r.TimeZone == nil && allNumbers(values) {
+		// 整数端点按 int64 比较，esb.IntRange 中超过 2^53 的 long 不会因转换为 float64 而丢失精度
+		return anyValue(values, func(v any) bool {
+			text, _ := numberText(v)
+			return within(bounds, func(b any) int { return compareIntBound(text, b.(int64)) })
+		}), nil
+	}
+	var numbers types.NumberRangeQuery
+	var strs types.DateRangeQuery
+	numeric := true
+	for key, message := range raw {
+		if len(message) == 0 || string(message) == "null" {
+			continue
+		}
+		var f types.Float64
+		var s string
+		if err := json.Unmarshal(message, &f); err == nil {
+			s = string(message)
+		} else if err := json.Unmarshal(message, &s); err != nil {
+			return false, unsupported("range bound %s", message)
+		} else {
+			numeric = false
+		}
+		fp, sp := &f, &s
+		switch key {
+		case "gt":
+			numbers.Gt, strs.Gt = fp, sp
+		case "gte":
+			numbers.Gte, strs.Gte = fp, sp
+		case "lt":
+			numbers.Lt, strs.Lt = fp, sp
+		case "lte":
+			numbers.Lte, strs.Lte = fp, sp
+		case "from":
+			numbers.From, strs.From = fp, sp
+		case "to":
+			numbers.To, strs.To = fp, sp
+		}
+	}
+	if numeric && r.Format == nil && r.TimeZone == nil {
+		return e.evalRange(values, numbers)
+	}
+	if r.Format == nil && r.TimeZone == nil {
+		// 无法解析为日期的字符串端点按词项范围比较
+		for _, bound := range []*string{strs.Gt, strs.Gte, strs.Lt, strs.Lte, strs.From, strs.To} {
+			if bound == nil {
+				continue
+			}
+			if _, err := e.parseDateBound(*bound, nil, time.UTC, false); err != nil {
+				return e.evalRange(values, types.TermRangeQuery{
+					Gt: strs.Gt, Gte: strs.Gte, Lt: strs.Lt, Lte: strs.Lte, From: strs.From, To: strs.To,
+				})
+			}
+		}
+	}
+	strs.Format, strs.TimeZone = r.Format, r.TimeZone
+	return e.evalRange(values, strs)
+}
@@ -0,0 +1,207 @@
+package esbtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/operator"
+	"github.com/qwenode/esb"
+)
+
+type article struct {
+	Title     string    `json:"title"`
+	Status    string    `json:"status"`
+	Tags      []string  `json:"tags,omitempty"`
+	Price     float64   `json:"price"`
+	Views     int64     `json:"views"`
+	CreatedAt string    `json:"created_at"`
+	Author    *author   `json:"author,omitempty"`
+	Comments  []comment `json:"comments,omitempty"`
+}
+
+type author struct {
+	Name string `json:"name"`
+}
+
+type comment struct {
+	User  string `json:"user"`
+	Stars int    `json:"stars"`
+}
+
+var testArticle = article{
+	Title:     "Elasticsearch: The Definitive Guide",
+	Status:    "published",
+	Tags:      []string{"search", "go"},
+	Price:     29.9,
+	Views:     9007199254740993,
+	CreatedAt: "2025-01-05T10:30:00Z",
+	Author:    &author{Name: "Clinton"},
+	Comments: []comment{
+		{User: "alice", Stars: 5},
+		{User: "bob", Stars: 2},
+	},
+}
+
+func TestMatches(t *testing.T) {
+	now := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		query esb.QueryOption
+		want  bool
+	}{
+		{"Term匹配", esb.Term("status", "published"), true},
+		{"Term区分大小写", esb.Term("status", "Published"), false},
+		{"Term忽略大小写", func(q *types.Query) {
+			caseInsensitive := true
+			q.Term = map[string]types.TermQuery{"status": {Value: "Published", CaseInsensitive: &caseInsensitive}}
+		}, true},
+		{"Term匹配数组元素", esb.Term("tags", "go"), true},
+		{"Term精确匹配大整数", esb.Term("views", int64(9007199254740993)), true},
+		{"Term不匹配相邻大整数", esb.Term("views", int64(9007199254740992)), false},
+		{"Term匹配对象字段", esb.Term("author.name", "Clinton"), true},
+		{"Terms匹配任意值", esb.Terms("tags", "java", "go"), true},
+		{"Terms不匹配", esb.Terms("tags", "java", "rust"), false},
+		{"NumberRange匹配", esb.NumberRange("price").Gte(10).Lt(30).Build(), true},
+		{"NumberRange不包含边界", esb.NumberRange("price").Gt(29.9).Build(), false},
+		{"DateRange匹配", esb.DateRange("created_at").Gte("2025-01-01").Lt("2025-02-01").Build(), true},
+		{"DateRange的lte包含整天", esb.DateRange("created_at").Lte("2025-01-05").Build(), true},
+		{"DateRange的lt不包含当天", esb.DateRange("created_at").Lt("2025-01-05").Build(), false},
+		{"DateRange支持日期数学", esb.DateRange("created_at").Gte("now-1d/d").Build(), true},
+		{"DateRange日期数学向上舍入", esb.DateRange("created_at").Gt("now-1d/d").Build(), false},
+		{"DateRange支持时区", esb.DateRange("created_at").Lt("2025-01-05T12:00:00").TimeZone("+08:00").Build(), false},
+		{"TermRange匹配", esb.TermRange("status").Gte("p").Lt("q").Build(), true},
+		{"IntRange精确比较大整数", esb.IntRange("views").Gte(9007199254740993).Build(), true},
+		{"IntRange不包含相邻大整数", esb.IntRange("views").Gt(9007199254740993).Build(), false},
+		{"IntRange上界精确比较", esb.IntRange("views").Lt(9007199254740993).Build(), false},
+		{"IntRange区分相邻大整数", esb.IntRange("views").Gt(9007199254740992).Build(), true},
+		{"IntRange按数值而不是字符串比较", esb.IntRange("views").Lt(10000000000000000).Build(), true},
+		{"IntRange比较小数", esb.IntRange("price").Gte(29).Lt(30).Build(), true},
+		{"Exists匹配", esb.Exists("author"), true},
+		{"Exists不匹配", esb.Exists("missing"), false},
+		{"Prefix匹配", esb.Prefix("status", "pub"), true},
+		{"Wildcard匹配", esb.Wildcard("status", "p*sh?d"), true},
+		{"Wildcard需要完整匹配", esb.Wildcard("status", "pub"), false},
+		{"Regexp匹配", esb.Regexp("status", "pu.*d"), true},
+		{"Regexp需要完整匹配", esb.Regexp("status", "pub"), false},
+		{"Match任意词项", esb.Match("title", "definitive kibana"), true},
+		{"Match使用and操作符", esb.MatchWithOptions("title", "definitive kibana", func(q *types.MatchQuery) {
+			q.Operator = &operator.And
+		}), false},
+		{"Match不匹配", esb.Match("title", "kibana"), false},
+		{"Nested在同一对象中匹配", esb.Nested("comments", esb.BoolFilter(
+			esb.Term("comments.user", "alice"),
+			esb.NumberRange("comments.stars").Gte(4).Build(),
+		)), true},
+		{"Nested不跨对象匹配", esb.Nested("comments", esb.BoolFilter(
+			esb.Term("comments.user", "bob"),
+			esb.NumberRange("comments.stars").Gte(4).Build(),
+		)), false},
+		{"Bool组合", esb.Bool(
+			esb.Must(esb.Match("title", "guide")),
+			esb.Filter(esb.Term("status", "published")),
+			esb.MustNot(esb.Term("tags", "java")),
+		), true},
+		{"Bool的should至少匹配一个", esb.Bool(esb.Should(esb.Term("tags", "java"), esb.Term("tags", "rust"))), false},
+		{"Bool的minimum_should_match", func(q *types.Query) {
+			esb.Bool(esb.Should(esb.Term("tags", "go"), esb.Term("tags", "search"), esb.Term("tags", "java")))(q)
+			q.Bool.MinimumShouldMatch = "-30%"
+		}, false},
+		{"ConstantScore", esb.ConstantScore(esb.Term("status", "published")), true},
+		{"MatchAll", esb.MatchAll(), true},
+		{"MatchNone", esb.MatchNone(), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Matches(esb.NewQuery(tt.query), testArticle, WithNow(now))
+			if err != nil {
+				t.Fatalf("Matches失败: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("期望 %v, 实际得到 %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMatchesJSON(t *testing.T) {
+	t.Run("JSON文档", func(t *testing.T) {
+		doc := []byte(`{"status":"published","price":"12.5","meta.lang":"zh"}`)
+		ok, err := Matches(esb.NewQuery(esb.BoolFilter(
+			esb.Term("status", "published"),
+			esb.NumberRange("price").Lte(20).Build(),
+			esb.Term("meta.lang", "zh"),
+		)), doc)
+		if err != nil || !ok {
+			t.Errorf("期望匹配, 实际得到: %v, %v", ok, err)
+		}
+	})
+
+	t.Run("从JSON解码的查询", func(t *testing.T) {
+		var query types.Query
+		if err := query.UnmarshalJSON([]byte(`{"bool":{"filter":[{"range":{"created_at":{"gte":"2025-01-01"}}},{"range":{"price":{"lt":30}}},{"range":{"status":{"gte":"p"}}}]}}`)); err != nil {
+			t.Fatal(err)
+		}
+		ok, err := Matches(&query, testArticle)
+		if err != nil || !ok {
+			t.Errorf("期望匹配, 实际得到: %v, %v", ok, err)
+		}
+	})
+}
+
+func TestSelect(t *testing.T) {
+	docs := []Doc{
+		{ID: "1", Source: map[string]any{"status": "published"}},
+		{ID: "2", Source: map[string]any{"status": "draft"}},
+		{ID: "3", Source: map[string]any{"status": "published"}},
+	}
+
+	t.Run("按查询过滤并保持顺序", func(t *testing.T) {
+		got, err := Select(esb.NewQuery(esb.Term("status", "published")), docs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 2 || got[0].ID != "1" || got[1].ID != "3" {
+			t.Errorf("期望文档1和3, 实际得到: %v", got)
+		}
+	})
+
+	t.Run("IDs查询", func(t *testing.T) {
+		got, err := Select(esb.NewQuery(esb.IDs("2", "3")), docs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 2 || got[0].ID != "2" {
+			t.Errorf("期望文档2和3, 实际得到: %v", got)
+		}
+	})
+
+	t.Run("IDs查询需要Doc", func(t *testing.T) {
+		_, err := Matches(esb.NewQuery(esb.IDs("1")), map[string]any{})
+		if !IsUnsupportedQuery(err) {
+			t.Errorf("期望ErrUnsupportedQuery, 实际得到: %v", err)
+		}
+	})
+}
+
+func TestUnsupportedQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query esb.QueryOption
+	}{
+		{"Fuzzy", esb.Fuzzy("title", "elasticsearh")},
+		{"MatchPhrase", esb.MatchPhrase("title", "definitive guide")},
+		{"Script", esb.Script("doc['price'].value > 10")},
+		{"嵌套在Bool中", esb.BoolFilter(esb.Term("status", "published"), esb.GeoDistance("location", 1, 2, "1km"))},
+		{"Match使用模糊匹配", esb.MatchWithOptions("title", "guide", func(q *types.MatchQuery) { q.Fuzziness = "AUTO" })},
+		{"无效的日期数学", esb.DateRange("created_at").Gte("now-7x").Build()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Matches(esb.NewQuery(tt.query), testArticle)
+			if !IsUnsupportedQuery(err) {
+				t.Errorf("期望ErrUnsupportedQuery, 实际得到: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,457 @@
+package esbtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+// searchRequest 是假服务端支持的 _search 请求体字段，未列出的字段会被忽略。
+type searchRequest struct {
+	Query        *types.Query    `json:"query"`
+	PostFilter   *types.Query    `json:"post_filter"`
+	From         *int            `json:"from"`
+	Size         *int            `json:"size"`
+	Sort         json.RawMessage `json:"sort"`
+	Source       json.RawMessage `json:"_source"`
+	Aggregations json.RawMessage `json:"aggregations"`
+	Aggs         json.RawMessage `json:"aggs"`
+}
+
+type searchHit struct {
+	index string
+	doc   *storedDoc
+	sort  []any
+}
+
+// search 执行 _search 请求，调用方需要持有锁。
+func (s *Server) search(index string, body searchRequest, params url.Values) response {
+	if body.Aggregations != nil || body.Aggs != nil {
+		return unsupportedResponse("esbtest: aggregations are not supported")
+	}
+	from, err := paramInt(params, "from")
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, "illegal_argument_exception", err.Error())
+	}
+	size, err := paramInt(params, "size")
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, "illegal_argument_exception", err.Error())
+	}
+	if from == nil {
+		from = body.From
+	}
+	if size == nil {
+		size = body.Size
+	}
+	sorts, err := parseSort(body.Sort, params.Get("sort"))
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, "parsing_exception", err.Error())
+	}
+	filter, err := parseSourceFilter(body.Source, params)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, "parsing_exception", err.Error())
+	}
+
+	hits, failure := s.match(index, body.Query, params)
+	if failure != nil {
+		return *failure
+	}
+	if body.PostFilter != nil {
+		e := newEvaluator(s.queryOptions)
+		filtered := hits[:0]
+		for _, hit := range hits {
+			ok, err := e.eval(*body.PostFilter, hitScope(hit))
+			if err != nil {
+				return errorResponse(http.StatusBadRequest, "esbtest_unsupported_exception", err.Error())
+			}
+			if ok {
+				filtered = append(filtered, hit)
+			}
+		}
+		hits = filtered
+	}
+	total := len(hits)
+	if len(sorts) > 0 {
+		sortHits(hits, sorts)
+	}
+
+	start, count := 0, 10
+	if from != nil {
+		start = *from
+	}
+	if size != nil {
+		count = *size
+	}
+	if start > len(hits) {
+		start = len(hits)
+	}
+	end := start + count
+	if end > len(hits) || count < 0 {
+		end = len(hits)
+	}
+
+	var maxScore any
+	if len(sorts) == 0 && end > start {
+		maxScore = 1.0
+	}
+	items := make([]any, 0, end-start)
+	for _, hit := range hits[start:end] {
+		item := map[string]any{
+			"_index": hit.index,
+			"_id":    hit.doc.id,
+			"_score": maxScore,
+		}
+		if source, ok := filter.apply(hit.doc.source); ok {
+			item["_source"] = source
+		}
+		if len(sorts) > 0 {
+			item["sort"] = hit.sort
+		}
+		items = append(items, item)
+	}
+	return response{status: http.StatusOK, body: map[string]any{
+		"took":      1,
+		"timed_out": false,
+		"_shards":   map[string]any{"total": 1, "successful": 1, "skipped": 0, "failed": 0},
+		"hits": map[string]any{
+			"total":     map[string]any{"value": total, "relation": "eq"},
+			"max_score": maxScore,
+			"hits":      items,
+		},
+	}}
+}
+
+// match 返回 index 中匹配查询的文档，调用方需要持有锁。
+func (s *Server) match(index string, query *types.Query, params url.Values) ([]searchHit, *response) {
+	names, failure := s.readIndices(index, params.Get("ignore_unavailable") == "true")
+	if failure != nil {
+		return nil, failure
+	}
+	hits := s.collect(names)
+	if query == nil {
+		return hits, nil
+	}
+	e := newEvaluator(s.queryOptions)
+	// 先针对空文档执行一次，使索引为空时也能和 Elasticsearch 一样拒绝不支持的查询
+	if _, err := e.eval(*query, &scope{doc: &document{hasID: true, source: map[string]any{}}}); err != nil {
+		failure := errorResponse(http.StatusBadRequest, "esbtest_unsupported_exception", err.Error())
+		return nil, &failure
+	}
+	matched := hits[:0]
+	for _, hit := range hits {
+		ok, err := e.eval(*query, hitScope(hit))
+		if err != nil {
+			failure := errorResponse(http.StatusBadRequest, "esbtest_unsupported_exception", err.Error())
+			return nil, &failure
+		}
+		if ok {
+			matched = append(matched, hit)
+		}
+	}
+	return matched, nil
+}
+
+// collect 按写入顺序返回索引中的所有文档。
+func (s *Server) collect(names []string) []searchHit {
+	var hits []searchHit
+	for _, name := range names {
+		for _, doc := range s.indices[name] {
+			hits = append(hits, searchHit{index: name, doc: doc})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].doc.order < hits[j].doc.order
+	})
+	return hits
+}
+
+func hitScope(hit searchHit) *scope {
+	return &scope{doc: &document{id: hit.doc.id, hasID: true, source: hit.doc.source}}
+}
+
+type sortField struct {
+	field        string
+	desc         bool
+	missingFirst bool
+	// max 表示多值字段取最大值，未指定 mode 时升序取最小值、降序取最大值
+	max bool
+}
+
+// parseSort 解析请求体中的 sort 与 URL 中 "field:desc" 形式的 sort 参数。
+func parseSort(raw json.RawMessage, param string) ([]sortField, error) {
+	var fields []sortField
+	if param != "" {
+		for _, part := range strings.Split(param, ",") {
+			field, order, _ := strings.Cut(part, ":")
+			fields = append(fields, newSortField(field, order, "", ""))
+		}
+		return fields, nil
+	}
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var items []json.RawMessage
+	if raw[0] == '[' {
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil, err
+		}
+	} else {
+		items = []json.RawMessage{raw}
+	}
+	for _, item := range items {
+		var name string
+		if err := json.Unmarshal(item, &name); err == nil {
+			fields = append(fields, newSortField(name, "", "", ""))
+			continue
+		}
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(item, &object); err != nil {
+			return nil, err
+		}
+		for field, options := range object {
+			var order string
+			if err := json.Unmarshal(options, &order); err == nil {
+				fields = append(fields, newSortField(field, order, "", ""))
+				continue
+			}
+			var detail struct {
+				Order   string `json:"order"`
+				Missing any    `json:"missing"`
+				Nested  any    `json:"nested"`
+				Mode    string `json:"mode"`
+			}
+			if err := json.Unmarshal(options, &detail); err != nil {
+				return nil, err
+			}
+			if detail.Nested != nil || (detail.Mode != "" && detail.Mode != "min" && detail.Mode != "max") {
+				return nil, fmt.Errorf("esbtest: unsupported sort options for [%s]", field)
+			}
+			missing, _ := detail.Missing.(string)
+			fields = append(fields, newSortField(field, detail.Order, missing, detail.Mode))
+		}
+	}
+	return fields, nil
+}
+
+func newSortField(field, order, missing, mode string) sortField {
+	desc := order == "desc" || (order == "" && field == "_score")
+	return sortField{field: field, desc: desc, missingFirst: missing == "_first", max: mode == "max" || (mode == "" && desc)}
+}
+
+// sortHits 按排序字段对结果稳定排序，并记录每个结果的 sort 值。
+func sortHits(hits []searchHit, fields []sortField) {
+	for i := range hits {
+		hits[i].sort = make([]any, len(fields))
+		for j, field := range fields {
+			switch field.field {
+			case "_score":
+				hits[i].sort[j] = 1.0
+			case "_doc":
+				hits[i].sort[j] = hits[i].doc.order
+			case "_id":
+				hits[i].sort[j] = hits[i].doc.id
+			default:
+				hits[i].sort[j] = sortValue(hitScope(hits[i]).values(field.field), field.max)
+			}
+		}
+	}
+	sort.SliceStable(hits, func(a, b int) bool {
+		for j, field := range fields {
+			x, y := hits[a].sort[j], hits[b].sort[j]
+			if x == nil || y == nil {
+				if (x == nil) == (y == nil) {
+					continue
+				}
+				return (x == nil) == field.missingFirst
+			}
+			c := compareSortValues(x, y)
+			if c == 0 {
+				continue
+			}
+			if field.desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+func sortValue(values []any, max bool) any {
+	var result any
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		if result == nil {
+			result = v
+			continue
+		}
+		c := compareSortValues(v, result)
+		if (max && c > 0) || (!max && c < 0) {
+			result = v
+		}
+	}
+	return result
+}
+
+// compareSortValues 比较两个排序值，数字按数值比较，字符串按字典序比较，数字排在字符串之前。
+func compareSortValues(a, b any) int {
+	x, xNumber := toFloat(a)
+	y, yNumber := toFloat(b)
+	switch {
+	case xNumber && yNumber:
+		return compareFloat(x, y)
+	case xNumber:
+		return -1
+	case yNumber:
+		return 1
+	}
+	xs, _ := scalarString(a)
+	ys, _ := scalarString(b)
+	return strings.Compare(xs, ys)
+}
+
+// sourceFilter 是 _source 过滤规则，enabled 为 false 时不返回 _source。
+type sourceFilter struct {
+	enabled  bool
+	includes []string
+	excludes []string
+}
+
+// parseSourceFilter 解析请求体中的 _source 以及 _source、_source_includes、_source_excludes 参数。
+func parseSourceFilter(raw json.RawMessage, params url.Values) (sourceFilter, error) {
+	filter := sourceFilter{enabled: true}
+	if len(raw) > 0 && string(raw) != "null" {
+		var enabled bool
+		var single string
+		var list []string
+		var object struct {
+			Includes []string `json:"includes"`
+			Include  []string `json:"include"`
+			Excludes []string `json:"excludes"`
+			Exclude  []string `json:"exclude"`
+		}
+		switch {
+		case json.Unmarshal(raw, &enabled) == nil:
+			filter.enabled = enabled
+		case json.Unmarshal(raw, &single) == nil:
+			filter.includes = []string{single}
+		case json.Unmarshal(raw, &list) == nil:
+			filter.includes = list
+		case json.Unmarshal(raw, &object) == nil:
+			filter.includes = append(object.Includes, object.Include...)
+			filter.excludes = append(object.Excludes, object.Exclude...)
+		default:
+			return filter, fmt.Errorf("esbtest: invalid _source %s", raw)
+		}
+	}
+	if value := params.Get("_source"); value != "" {
+		switch value {
+		case "true":
+			filter.enabled = true
+		case "false":
+			filter.enabled = false
+		default:
+			filter.includes = strings.Split(value, ",")
+		}
+	}
+	if value := params.Get("_source_includes"); value != "" {
+		filter.includes = strings.Split(value, ",")
+	}
+	if value := params.Get("_source_excludes"); value != "" {
+		filter.excludes = strings.Split(value, ",")
+	}
+	return filter, nil
+}
+
+func (f sourceFilter) apply(source map[string]any) (map[string]any, bool) {
+	if !f.enabled {
+		return nil, false
+	}
+	if len(f.includes) == 0 && len(f.excludes) == 0 {
+		return source, true
+	}
+	return filterObject(source, "", f.includes, f.excludes), true
+}
+
+// filterObject 按照点号路径过滤对象，includes 为空表示保留全部字段。
+func filterObject(object map[string]any, prefix string, includes, excludes []string) map[string]any {
+	result := make(map[string]any)
+	for key, value := range object {
+		fieldPath := key
+		if prefix != "" {
+			fieldPath = prefix + "." + key
+		}
+		if matchAnyPath(excludes, fieldPath) {
+			continue
+		}
+		if len(includes) == 0 || matchAnyPath(includes, fieldPath) {
+			result[key] = filterValue(value, fieldPath, nil, excludes)
+			continue
+		}
+		if !mayContain(includes, fieldPath) {
+			continue
+		}
+		switch value.(type) {
+		case map[string]any, []any:
+			if filtered := filterValue(value, fieldPath, includes, excludes); !isEmptyJSON(filtered) {
+				result[key] = filtered
+			}
+		}
+	}
+	return result
+}
+
+func filterValue(value any, fieldPath string, includes, excludes []string) any {
+	switch v := value.(type) {
+	case map[string]any:
+		return filterObject(v, fieldPath, includes, excludes)
+	case []any:
+		result := make([]any, 0, len(v))
+		for _, item := range v {
+			filtered := filterValue(item, fieldPath, includes, excludes)
+			if _, isObject := item.(map[string]any); isObject && isEmptyJSON(filtered) && len(includes) > 0 {
+				continue
+			}
+			result = append(result, filtered)
+		}
+		return result
+	}
+	return value
+}
+
+func isEmptyJSON(value any) bool {
+	switch v := value.(type) {
+	case map[string]any:
+		return len(v) == 0
+	case []any:
+		return len(v) == 0
+	}
+	return false
+}
+
+func matchAnyPath(patterns []string, fieldPath string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, fieldPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// mayContain 判断 fieldPath 下是否可能存在被 includes 选中的字段。
+func mayContain(includes []string, fieldPath string) bool {
+	for _, pattern := range includes {
+		if strings.HasPrefix(pattern, fieldPath+".") || strings.Contains(pattern, "*") {
+			return true
+		}
+	}
+	return false
+}
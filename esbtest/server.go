@@ -0,0 +1,1098 @@
+package esbtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+// Operation 表示假服务端识别出的 Elasticsearch 接口。
+type Operation string
+
+const (
+	OperationInfo          Operation = "info"
+	OperationGet           Operation = "get"
+	OperationExists        Operation = "exists"
+	OperationIndex         Operation = "index"
+	OperationCreate        Operation = "create"
+	OperationUpdate        Operation = "update"
+	OperationDelete        Operation = "delete"
+	OperationSearch        Operation = "search"
+	OperationMultiSearch   Operation = "msearch"
+	OperationCount         Operation = "count"
+	OperationDeleteByQuery Operation = "delete_by_query"
+	OperationBulk          Operation = "bulk"
+	OperationRefresh       Operation = "refresh"
+	OperationCreateIndex   Operation = "indices.create"
+	OperationDeleteIndex   Operation = "indices.delete"
+	OperationIndexExists   Operation = "indices.exists"
+)
+
+// Request 是假服务端收到的一次请求。
+// _msearch 中的每个子查询也会以 OperationSearch 的形式交给 Hook，此时 Body 为该子查询的请求体。
+type Request struct {
+	Method    string
+	Path      string
+	Params    url.Values
+	Header    http.Header
+	Body      []byte
+	Operation Operation
+	Index     string
+	ID        string
+}
+
+// Decode 将请求体解码到 v 中。
+func (r Request) Decode(v any) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// Query 返回 _search、_count、_delete_by_query 请求体中的查询，没有查询时返回 nil。
+func (r Request) Query() (*types.Query, error) {
+	if len(bytes.TrimSpace(r.Body)) == 0 {
+		return nil, nil
+	}
+	var body struct {
+		Query *types.Query `json:"query"`
+	}
+	if err := json.Unmarshal(r.Body, &body); err != nil {
+		return nil, err
+	}
+	return body.Query, nil
+}
+
+// Fault 描述一个注入的错误响应。
+type Fault struct {
+	// Status 为 HTTP 状态码，默认为 500
+	Status int
+	// Type 为错误类型，默认为 esbtest_injected_exception
+	Type string
+	// Reason 为错误原因，默认为 injected fault
+	Reason string
+}
+
+// Hook 在服务端处理请求之前调用，返回非 nil 的 *Fault 时直接以该错误响应请求。
+// Hook 也可以只用于记录或断言请求，此时返回 nil 即可。
+type Hook func(req *Request) *Fault
+
+// ServerOption 用于配置假服务端。
+type ServerOption func(*Server)
+
+// WithLatency 为每个请求增加固定延迟，请求的 context 取消时延迟会提前结束。
+func WithLatency(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.latency = d
+	}
+}
+
+// WithHook 注册一个请求钩子。
+func WithHook(hook Hook) ServerOption {
+	return func(s *Server) {
+		s.hooks = append(s.hooks, hook)
+	}
+}
+
+// WithQueryOptions 设置执行查询时使用的内存执行器选项，例如 WithNow。
+func WithQueryOptions(opts ...Option) ServerOption {
+	return func(s *Server) {
+		s.queryOptions = append(s.queryOptions, opts...)
+	}
+}
+
+// Server 是基于 httptest 的 Elasticsearch 假服务端，数据保存在内存中，
+// 实现了 activerecord 与 multisearch 用到的接口：
+// _doc 的读取、索引、更新与删除，_search、_msearch、_count、_delete_by_query、_bulk 以及文档是否存在。
+//
+// 查询通过内存执行器执行，因此只支持 Matches 支持的查询类型，其余查询会返回 400 错误。
+// 所有写入立即可见，refresh 参数会被忽略；请求聚合同样会返回 400 错误。
+type Server struct {
+	server       *httptest.Server
+	latency      time.Duration
+	queryOptions []Option
+
+	mu       sync.Mutex
+	hooks    []Hook
+	requests []Request
+	indices  map[string]map[string]*storedDoc
+	aliases  map[string][]string
+	sequence int64
+	autoID   int64
+}
+
+type storedDoc struct {
+	id      string
+	order   int64
+	version int64
+	seqNo   int64
+	source  map[string]any
+}
+
+// NewServer 启动一个假服务端，使用完毕后需要调用 Close。
+//
+// 示例：
+//   server := esbtest.NewServer()
+//   defer server.Close()
+//   client, err := server.TypedClient()
+func NewServer(opts ...ServerOption) *Server {
+	s := &Server{
+		indices: make(map[string]map[string]*storedDoc),
+		aliases: make(map[string][]string),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// NewTypedClient 启动一个假服务端并返回连接到它的 TypedClient，测试结束时自动关闭服务端。
+//
+// 示例：
+//   client, server := esbtest.NewTypedClient(t)
+//   record := activerecord.New(client, Article{})
+func NewTypedClient(t testing.TB, opts ...ServerOption) (*elasticsearch.TypedClient, *Server) {
+	t.Helper()
+	s := NewServer(opts...)
+	t.Cleanup(s.Close)
+	client, err := s.TypedClient()
+	if err != nil {
+		t.Fatalf("esbtest: create typed client: %v", err)
+	}
+	return client, s
+}
+
+// TypedClient 返回连接到假服务端的 TypedClient。
+// 客户端关闭了重试，注入的 502、503、504 错误会直接返回给调用方。
+func (s *Server) TypedClient() (*elasticsearch.TypedClient, error) {
+	return elasticsearch.NewTypedClient(elasticsearch.Config{
+		Addresses:    []string{s.URL()},
+		DisableRetry: true,
+	})
+}
+
+// URL 返回假服务端的地址。
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// Close 关闭假服务端。
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// OnRequest 注册一个请求钩子。
+func (s *Server) OnRequest(hook Hook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, hook)
+}
+
+// FailNext 让下一次 op 类型的请求返回 fault，op 为空时匹配任意请求。
+//
+// 示例：
+//   server.FailNext(esbtest.OperationSearch, esbtest.Fault{Status: 503, Type: "search_phase_execution_exception"})
+func (s *Server) FailNext(op Operation, fault Fault) {
+	var once sync.Once
+	s.OnRequest(func(req *Request) *Fault {
+		if op != "" && req.Operation != op {
+			return nil
+		}
+		var result *Fault
+		once.Do(func() {
+			result = &fault
+		})
+		return result
+	})
+}
+
+// SetLatency 修改每个请求的固定延迟。
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// Requests 返回按顺序收到的所有 HTTP 请求。
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// RequestsFor 返回指定类型的 HTTP 请求。
+func (s *Server) RequestsFor(op Operation) []Request {
+	var result []Request
+	for _, req := range s.Requests() {
+		if req.Operation == op {
+			result = append(result, req)
+		}
+	}
+	return result
+}
+
+// ResetRequests 清空已记录的请求。
+func (s *Server) ResetRequests() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+}
+
+// CreateIndex 创建空索引，已存在时不做任何处理。
+// 与 Elasticsearch 一致，读取不存在的索引会返回 index_not_found_exception，写入时会自动创建索引。
+func (s *Server) CreateIndex(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.createIndex(name)
+}
+
+// Alias 为一个或多个索引设置别名，读取别名时会查询所有目标索引，写入时别名必须只指向一个索引。
+//
+// 示例：
+//   server.Alias("articles", "articles_20250101")
+func (s *Server) Alias(alias string, indices ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, index := range indices {
+		s.createIndex(index)
+	}
+	s.aliases[alias] = append([]string(nil), indices...)
+}
+
+// Put 直接写入一个文档，用于准备测试数据。
+func (s *Server) Put(index, id string, doc any) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	target, failure := s.writeIndex(index)
+	if failure != nil {
+		return fmt.Errorf("esbtest: %v", failure.body)
+	}
+	if resp := s.indexDoc(target, id, data, false); resp.status >= 300 {
+		return fmt.Errorf("esbtest: %v", resp.body)
+	}
+	return nil
+}
+
+// Source 返回文档的 _source。
+func (s *Server) Source(index, id string) (json.RawMessage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	target, failure := s.writeIndex(index)
+	if failure != nil {
+		return nil, false
+	}
+	doc, ok := s.indices[target][id]
+	if !ok {
+		return nil, false
+	}
+	data, _ := json.Marshal(doc.source)
+	return data, true
+}
+
+// Docs 按写入顺序返回索引中的所有文档，Source 为 json.RawMessage，可以直接交给 Select 使用。
+func (s *Server) Docs(index string) []Doc {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names, failure := s.readIndices(index, true)
+	if failure != nil {
+		return nil
+	}
+	var docs []Doc
+	for _, hit := range s.collect(names) {
+		data, _ := json.Marshal(hit.doc.source)
+		docs = append(docs, Doc{ID: hit.doc.id, Source: json.RawMessage(data)})
+	}
+	return docs
+}
+
+// response 是一次请求的处理结果，body 为 nil 时不返回响应体。
+type response struct {
+	status int
+	body   map[string]any
+}
+
+func errorResponse(status int, errType, reason string) response {
+	cause := map[string]any{"type": errType, "reason": reason}
+	return response{status: status, body: map[string]any{
+		"error": map[string]any{
+			"root_cause": []any{cause},
+			"type":       errType,
+			"reason":     reason,
+		},
+		"status": status,
+	}}
+}
+
+func faultResponse(fault Fault) response {
+	if fault.Status == 0 {
+		fault.Status = http.StatusInternalServerError
+	}
+	if fault.Type == "" {
+		fault.Type = "esbtest_injected_exception"
+	}
+	if fault.Reason == "" {
+		fault.Reason = "injected fault"
+	}
+	return errorResponse(fault.Status, fault.Type, fault.Reason)
+}
+
+func unsupportedResponse(format string, args ...any) response {
+	return errorResponse(http.StatusBadRequest, "esbtest_unsupported_exception", fmt.Sprintf(format, args...))
+}
+
+var shards = map[string]any{"total": 1, "successful": 1, "failed": 0}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	req := &Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Params: r.URL.Query(),
+		Header: r.Header.Clone(),
+		Body:   body,
+	}
+	handle := s.route(req, r.URL.EscapedPath())
+
+	s.mu.Lock()
+	s.requests = append(s.requests, *req)
+	latency := s.latency
+	s.mu.Unlock()
+
+	if latency > 0 && !sleepContext(r.Context(), latency) {
+		return
+	}
+
+	var resp response
+	if fault := s.runHooks(req); fault != nil {
+		resp = faultResponse(*fault)
+	} else {
+		resp = handle(req)
+	}
+
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+	if resp.body == nil || r.Method == http.MethodHead {
+		w.WriteHeader(resp.status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.status)
+	_ = json.NewEncoder(w).Encode(resp.body)
+}
+
+func (s *Server) runHooks(req *Request) *Fault {
+	s.mu.Lock()
+	hooks := append([]Hook(nil), s.hooks...)
+	s.mu.Unlock()
+	for _, hook := range hooks {
+		if fault := hook(req); fault != nil {
+			return fault
+		}
+	}
+	return nil
+}
+
+// route 根据方法与路径识别接口，填充 req 的 Operation、Index、ID 并返回处理函数。
+func (s *Server) route(req *Request, escapedPath string) func(*Request) response {
+	var parts []string
+	for _, part := range strings.Split(strings.Trim(escapedPath, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		unescaped, err := url.PathUnescape(part)
+		if err != nil {
+			unescaped = part
+		}
+		parts = append(parts, unescaped)
+	}
+	method := req.Method
+	notSupported := func(*Request) response {
+		return unsupportedResponse("esbtest: unsupported endpoint %s %s", method, req.Path)
+	}
+	if len(parts) > 0 && !strings.HasPrefix(parts[0], "_") {
+		req.Index = parts[0]
+		parts = parts[1:]
+	}
+	if len(parts) >= 2 {
+		req.ID = parts[1]
+	}
+
+	switch {
+	case len(parts) == 0 && req.Index == "":
+		req.Operation = OperationInfo
+		return s.handleInfo
+	case len(parts) == 0:
+		switch method {
+		case http.MethodPut:
+			req.Operation = OperationCreateIndex
+			return s.handleCreateIndex
+		case http.MethodDelete:
+			req.Operation = OperationDeleteIndex
+			return s.handleDeleteIndex
+		case http.MethodHead:
+			req.Operation = OperationIndexExists
+			return s.handleIndexExists
+		}
+	case len(parts) == 1:
+		switch parts[0] {
+		case "_search":
+			req.Operation = OperationSearch
+			return s.handleSearch
+		case "_msearch":
+			req.Operation = OperationMultiSearch
+			return s.handleMultiSearch
+		case "_count":
+			req.Operation = OperationCount
+			return s.handleCount
+		case "_delete_by_query":
+			req.Operation = OperationDeleteByQuery
+			return s.handleDeleteByQuery
+		case "_bulk":
+			req.Operation = OperationBulk
+			return s.handleBulk
+		case "_refresh":
+			req.Operation = OperationRefresh
+			return s.handleRefresh
+		case "_doc":
+			if method == http.MethodPost && req.Index != "" {
+				req.Operation = OperationIndex
+				return s.handleIndex
+			}
+		}
+	case len(parts) == 2 && req.Index != "":
+		switch parts[0] {
+		case "_doc":
+			switch method {
+			case http.MethodGet:
+				req.Operation = OperationGet
+				return s.handleGet
+			case http.MethodHead:
+				req.Operation = OperationExists
+				return s.handleExists
+			case http.MethodPut, http.MethodPost:
+				req.Operation = OperationIndex
+				if req.Params.Get("op_type") == "create" {
+					req.Operation = OperationCreate
+				}
+				return s.handleIndex
+			case http.MethodDelete:
+				req.Operation = OperationDelete
+				return s.handleDelete
+			}
+		case "_create":
+			if method == http.MethodPut || method == http.MethodPost {
+				req.Operation = OperationCreate
+				return s.handleIndex
+			}
+		case "_update":
+			if method == http.MethodPost {
+				req.Operation = OperationUpdate
+				return s.handleUpdate
+			}
+		}
+	}
+	return notSupported
+}
+
+func (s *Server) handleInfo(*Request) response {
+	return response{status: http.StatusOK, body: map[string]any{
+		"name":         "esbtest",
+		"cluster_name": "esbtest",
+		"cluster_uuid": "esbtest",
+		"version": map[string]any{
+			"number":                              "8.19.0",
+			"build_flavor":                        "default",
+			"build_type":                          "docker",
+			"build_hash":                          "esbtest",
+			"build_date":                          "2025-01-01T00:00:00.000Z",
+			"build_snapshot":                      false,
+			"lucene_version":                      "9.12.0",
+			"minimum_wire_compatibility_version":  "7.17.0",
+			"minimum_index_compatibility_version": "7.0.0",
+		},
+		"tagline": "You Know, for Search",
+	}}
+}
+
+func (s *Server) handleCreateIndex(req *Request) response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.indices[req.Index]; ok {
+		return errorResponse(http.StatusBadRequest, "resource_already_exists_exception",
+			fmt.Sprintf("index [%s] already exists", req.Index))
+	}
+	s.createIndex(req.Index)
+	return response{status: http.StatusOK, body: map[string]any{
+		"acknowledged": true, "shards_acknowledged": true, "index": req.Index,
+	}}
+}
+
+func (s *Server) handleDeleteIndex(req *Request) response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names, failure := s.readIndices(req.Index, req.Params.Get("ignore_unavailable") == "true")
+	if failure != nil {
+		return *failure
+	}
+	for _, name := range names {
+		delete(s.indices, name)
+	}
+	return response{status: http.StatusOK, body: map[string]any{"acknowledged": true}}
+}
+
+func (s *Server) handleIndexExists(req *Request) response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, failure := s.readIndices(req.Index, false); failure != nil {
+		return response{status: http.StatusNotFound}
+	}
+	return response{status: http.StatusOK}
+}
+
+func (s *Server) handleRefresh(*Request) response {
+	return response{status: http.StatusOK, body: map[string]any{"_shards": shards}}
+}
+
+func (s *Server) handleGet(req *Request) response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index, failure := s.singleIndex(req.Index)
+	if failure != nil {
+		return *failure
+	}
+	doc, ok := s.indices[index][req.ID]
+	if !ok {
+		return response{status: http.StatusNotFound, body: map[string]any{
+			"_index": index, "_id": req.ID, "found": false,
+		}}
+	}
+	body := map[string]any{
+		"_index":        index,
+		"_id":           doc.id,
+		"_version":      doc.version,
+		"_seq_no":       doc.seqNo,
+		"_primary_term": 1,
+		"found":         true,
+	}
+	filter, err := parseSourceFilter(nil, req.Params)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, "parsing_exception", err.Error())
+	}
+	if source, ok := filter.apply(doc.source); ok {
+		body["_source"] = source
+	}
+	return response{status: http.StatusOK, body: body}
+}
+
+func (s *Server) handleExists(req *Request) response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index, failure := s.singleIndex(req.Index)
+	if failure != nil {
+		return response{status: http.StatusNotFound}
+	}
+	if _, ok := s.indices[index][req.ID]; !ok {
+		return response{status: http.StatusNotFound}
+	}
+	return response{status: http.StatusOK}
+}
+
+func (s *Server) handleIndex(req *Request) response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index, failure := s.writeIndex(req.Index)
+	if failure != nil {
+		return *failure
+	}
+	return s.indexDoc(index, req.ID, req.Body, req.Operation == OperationCreate)
+}
+
+func (s *Server) handleUpdate(req *Request) response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index, failure := s.writeIndex(req.Index)
+	if failure != nil {
+		return *failure
+	}
+	return s.updateDoc(index, req.ID, req.Body)
+}
+
+func (s *Server) handleDelete(req *Request) response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index, failure := s.writeIndex(req.Index)
+	if failure != nil {
+		return *failure
+	}
+	return s.deleteDoc(index, req.ID)
+}
+
+func (s *Server) handleSearch(req *Request) response {
+	var body searchRequest
+	if err := decodeOptional(req.Body, &body); err != nil {
+		return errorResponse(http.StatusBadRequest, "parsing_exception", err.Error())
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.search(req.Index, body, req.Params)
+}
+
+func (s *Server) handleMultiSearch(req *Request) response {
+	lines := splitLines(req.Body)
+	if len(lines)%2 != 0 {
+		return errorResponse(http.StatusBadRequest, "illegal_argument_exception",
+			"The msearch request must be terminated by a newline [\\n]")
+	}
+	responses := make([]any, 0, len(lines)/2)
+	for i := 0; i < len(lines); i += 2 {
+		var header struct {
+			Index any `json:"index"`
+		}
+		if err := json.Unmarshal(lines[i], &header); err != nil {
+			return errorResponse(http.StatusBadRequest, "parsing_exception", err.Error())
+		}
+		index := req.Index
+		switch v := header.Index.(type) {
+		case string:
+			index = v
+		case []any:
+			names := make([]string, 0, len(v))
+			for _, name := range v {
+				names = append(names, fmt.Sprint(name))
+			}
+			index = strings.Join(names, ",")
+		}
+		sub := &Request{
+			Method:    req.Method,
+			Path:      req.Path,
+			Params:    req.Params,
+			Header:    req.Header,
+			Body:      lines[i+1],
+			Operation: OperationSearch,
+			Index:     index,
+		}
+		var item response
+		if fault := s.runHooks(sub); fault != nil {
+			item = faultResponse(*fault)
+		} else {
+			item = s.handleSearch(sub)
+		}
+		item.body["status"] = item.status
+		responses = append(responses, item.body)
+	}
+	return response{status: http.StatusOK, body: map[string]any{"took": 1, "responses": responses}}
+}
+
+func (s *Server) handleCount(req *Request) response {
+	var body searchRequest
+	if err := decodeOptional(req.Body, &body); err != nil {
+		return errorResponse(http.StatusBadRequest, "parsing_exception", err.Error())
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hits, failure := s.match(req.Index, body.Query, req.Params)
+	if failure != nil {
+		return *failure
+	}
+	return response{status: http.StatusOK, body: map[string]any{"count": len(hits), "_shards": shards}}
+}
+
+func (s *Server) handleDeleteByQuery(req *Request) response {
+	var body searchRequest
+	if err := decodeOptional(req.Body, &body); err != nil {
+		return errorResponse(http.StatusBadRequest, "parsing_exception", err.Error())
+	}
+	if body.Query == nil {
+		return errorResponse(http.StatusBadRequest, "action_request_validation_exception",
+			"Validation Failed: 1: query is missing;")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hits, failure := s.match(req.Index, body.Query, req.Params)
+	if failure != nil {
+		return *failure
+	}
+	for _, hit := range hits {
+		delete(s.indices[hit.index], hit.doc.id)
+	}
+	return response{status: http.StatusOK, body: map[string]any{
+		"took":                   1,
+		"timed_out":              false,
+		"total":                  len(hits),
+		"deleted":                len(hits),
+		"batches":                1,
+		"version_conflicts":      0,
+		"noops":                  0,
+		"retries":                map[string]any{"bulk": 0, "search": 0},
+		"throttled_millis":       0,
+		"requests_per_second":    -1,
+		"throttled_until_millis": 0,
+		"failures":               []any{},
+	}}
+}
+
+func (s *Server) handleBulk(req *Request) response {
+	lines := splitLines(req.Body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items := make([]any, 0, len(lines)/2)
+	hasErrors := false
+	for i := 0; i < len(lines); i++ {
+		var action map[string]struct {
+			Index *string `json:"_index"`
+			ID    *string `json:"_id"`
+		}
+		if err := json.Unmarshal(lines[i], &action); err != nil || len(action) != 1 {
+			return errorResponse(http.StatusBadRequest, "illegal_argument_exception",
+				fmt.Sprintf("Malformed action/metadata line [%d]", i+1))
+		}
+		for name, meta := range action {
+			index, id := req.Index, ""
+			if meta.Index != nil {
+				index = *meta.Index
+			}
+			if meta.ID != nil {
+				id = *meta.ID
+			}
+			var source []byte
+			if name != "delete" {
+				i++
+				if i >= len(lines) {
+					return errorResponse(http.StatusBadRequest, "illegal_argument_exception",
+						"The bulk request must be terminated by a newline [\\n]")
+				}
+				source = lines[i]
+			}
+			target, failure := s.writeIndex(index)
+			var result response
+			switch {
+			case failure != nil:
+				result = *failure
+			case name == "index":
+				result = s.indexDoc(target, id, source, false)
+			case name == "create":
+				result = s.indexDoc(target, id, source, true)
+			case name == "update":
+				result = s.updateDoc(target, id, source)
+			case name == "delete":
+				result = s.deleteDoc(target, id)
+			default:
+				return errorResponse(http.StatusBadRequest, "illegal_argument_exception",
+					fmt.Sprintf("Malformed action/metadata line [%d], expected one of [create, delete, index, update] but found [%s]", i+1, name))
+			}
+			item := map[string]any{"_index": target, "_id": id, "status": result.status}
+			for k, v := range result.body {
+				item[k] = v
+			}
+			if cause, ok := result.body["error"].(map[string]any); ok {
+				hasErrors = true
+				item["error"] = map[string]any{"type": cause["type"], "reason": cause["reason"]}
+			}
+			items = append(items, map[string]any{name: item})
+		}
+	}
+	return response{status: http.StatusOK, body: map[string]any{"took": 1, "errors": hasErrors, "items": items}}
+}
+
+// indexDoc 写入完整文档，调用方需要持有锁。
+func (s *Server) indexDoc(index, id string, data []byte, create bool) response {
+	source, err := decodeObject(data)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, "mapper_parsing_exception", "failed to parse: "+err.Error())
+	}
+	if id == "" {
+		s.autoID++
+		id = fmt.Sprintf("esbtest-%d", s.autoID)
+	}
+	docs := s.indices[index]
+	if existing, ok := docs[id]; ok {
+		if create {
+			return errorResponse(http.StatusConflict, "version_conflict_engine_exception",
+				fmt.Sprintf("[%s]: version conflict, document already exists (current version [%d])", id, existing.version))
+		}
+		existing.source = source
+		return s.written(index, existing, "updated", http.StatusOK)
+	}
+	s.sequence++
+	doc := &storedDoc{id: id, order: s.sequence, source: source}
+	docs[id] = doc
+	return s.written(index, doc, "created", http.StatusCreated)
+}
+
+// updateDoc 按照 _update 接口的语义合并文档，调用方需要持有锁。
+func (s *Server) updateDoc(index, id string, data []byte) response {
+	var body struct {
+		Doc            json.RawMessage `json:"doc"`
+		DocAsUpsert    bool            `json:"doc_as_upsert"`
+		Upsert         json.RawMessage `json:"upsert"`
+		Script         json.RawMessage `json:"script"`
+		ScriptedUpsert bool            `json:"scripted_upsert"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return errorResponse(http.StatusBadRequest, "x_content_parse_exception", err.Error())
+	}
+	if body.Script != nil {
+		// 文档不存在时直接写入 upsert，不会执行脚本，因此无需解释脚本
+		if _, ok := s.indices[index][id]; !ok && !body.ScriptedUpsert {
+			if body.Upsert == nil {
+				return errorResponse(http.StatusNotFound, "document_missing_exception",
+					fmt.Sprintf("[%s]: document missing", id))
+			}
+			return s.indexDoc(index, id, body.Upsert, true)
+		}
+		return unsupportedResponse("esbtest: scripted updates are not supported")
+	}
+	if body.Doc == nil {
+		return errorResponse(http.StatusBadRequest, "action_request_validation_exception",
+			"Validation Failed: 1: script or doc is missing;")
+	}
+	partial, err := decodeObject(body.Doc)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, "mapper_parsing_exception", "failed to parse: "+err.Error())
+	}
+	existing, ok := s.indices[index][id]
+	if !ok {
+		switch {
+		case body.DocAsUpsert:
+			return s.indexDoc(index, id, body.Doc, true)
+		case body.Upsert != nil:
+			return s.indexDoc(index, id, body.Upsert, true)
+		}
+		return errorResponse(http.StatusNotFound, "document_missing_exception",
+			fmt.Sprintf("[%s]: document missing", id))
+	}
+	merged := cloneObject(existing.source)
+	mergeObject(merged, partial)
+	if reflect.DeepEqual(merged, existing.source) {
+		return response{status: http.StatusOK, body: map[string]any{
+			"_index":        index,
+			"_id":           id,
+			"_version":      existing.version,
+			"result":        "noop",
+			"_shards":       map[string]any{"total": 0, "successful": 0, "failed": 0},
+			"_seq_no":       existing.seqNo,
+			"_primary_term": 1,
+		}}
+	}
+	existing.source = merged
+	return s.written(index, existing, "updated", http.StatusOK)
+}
+
+// deleteDoc 删除文档，调用方需要持有锁。
+func (s *Server) deleteDoc(index, id string) response {
+	doc, ok := s.indices[index][id]
+	if !ok {
+		return response{status: http.StatusNotFound, body: map[string]any{
+			"_index":        index,
+			"_id":           id,
+			"_version":      1,
+			"result":        "not_found",
+			"_shards":       shards,
+			"_seq_no":       s.nextSeqNo(),
+			"_primary_term": 1,
+		}}
+	}
+	delete(s.indices[index], id)
+	return s.written(index, doc, "deleted", http.StatusOK)
+}
+
+func (s *Server) written(index string, doc *storedDoc, result string, status int) response {
+	doc.version++
+	doc.seqNo = s.nextSeqNo()
+	return response{status: status, body: map[string]any{
+		"_index":        index,
+		"_id":           doc.id,
+		"_version":      doc.version,
+		"result":        result,
+		"_shards":       shards,
+		"_seq_no":       doc.seqNo,
+		"_primary_term": 1,
+	}}
+}
+
+func (s *Server) nextSeqNo() int64 {
+	s.sequence++
+	return s.sequence
+}
+
+func (s *Server) createIndex(name string) {
+	if _, ok := s.indices[name]; !ok {
+		s.indices[name] = make(map[string]*storedDoc)
+	}
+}
+
+// writeIndex 解析写入目标，别名必须只指向一个索引，不存在的索引会被自动创建。
+func (s *Server) writeIndex(name string) (string, *response) {
+	if targets, ok := s.aliases[name]; ok {
+		if len(targets) != 1 {
+			failure := errorResponse(http.StatusBadRequest, "illegal_argument_exception",
+				fmt.Sprintf("no write index is defined for alias [%s]. The write index may be explicitly disabled using is_write_index=false or the alias points to multiple indices without one being designated as a write index", name))
+			return "", &failure
+		}
+		name = targets[0]
+	}
+	if name == "" || strings.ContainsAny(name, "*,") {
+		failure := errorResponse(http.StatusBadRequest, "invalid_index_name_exception",
+			fmt.Sprintf("Invalid index name [%s]", name))
+		return "", &failure
+	}
+	s.createIndex(name)
+	return name, nil
+}
+
+// singleIndex 解析读取单个文档时的索引。
+func (s *Server) singleIndex(name string) (string, *response) {
+	names, failure := s.readIndices(name, false)
+	if failure != nil {
+		return "", failure
+	}
+	if len(names) != 1 {
+		failure := errorResponse(http.StatusBadRequest, "illegal_argument_exception",
+			fmt.Sprintf("alias [%s] has more than one index associated with it, can't execute a single index op", name))
+		return "", &failure
+	}
+	return names[0], nil
+}
+
+// readIndices 将逗号分隔的索引、别名与通配符表达式展开为索引列表。
+func (s *Server) readIndices(expression string, ignoreUnavailable bool) ([]string, *response) {
+	all := make([]string, 0, len(s.indices))
+	for name := range s.indices {
+		all = append(all, name)
+	}
+	sort.Strings(all)
+	if expression == "" || expression == "_all" {
+		return all, nil
+	}
+	seen := make(map[string]bool)
+	var result []string
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	for _, part := range strings.Split(expression, ",") {
+		if targets, ok := s.aliases[part]; ok {
+			for _, target := range targets {
+				add(target)
+			}
+			continue
+		}
+		if strings.Contains(part, "*") {
+			for _, name := range all {
+				if ok, _ := path.Match(part, name); ok {
+					add(name)
+				}
+			}
+			for alias, targets := range s.aliases {
+				if ok, _ := path.Match(part, alias); ok {
+					for _, target := range targets {
+						add(target)
+					}
+				}
+			}
+			continue
+		}
+		if _, ok := s.indices[part]; !ok {
+			if ignoreUnavailable {
+				continue
+			}
+			failure := errorResponse(http.StatusNotFound, "index_not_found_exception",
+				fmt.Sprintf("no such index [%s]", part))
+			return nil, &failure
+		}
+		add(part)
+	}
+	return result, nil
+}
+
+func decodeOptional(data []byte, v any) error {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+func decodeObject(data []byte) (map[string]any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var source map[string]any
+	if err := decoder.Decode(&source); err != nil {
+		return nil, err
+	}
+	if source == nil {
+		return nil, fmt.Errorf("document must be a JSON object")
+	}
+	return source, nil
+}
+
+func cloneObject(source map[string]any) map[string]any {
+	data, _ := json.Marshal(source)
+	clone, _ := decodeObject(data)
+	return clone
+}
+
+// mergeObject 按照 _update 的规则递归合并对象，其余类型直接覆盖。
+func mergeObject(dst, src map[string]any) {
+	for k, v := range src {
+		if child, ok := v.(map[string]any); ok {
+			if existing, ok := dst[k].(map[string]any); ok {
+				mergeObject(existing, child)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
+
+func splitLines(data []byte) [][]byte {
+	var lines [][]byte
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// sleepContext 等待 d 或 ctx 结束。
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func paramInt(params url.Values, name string) (*int, error) {
+	value := params.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse [%s] with value [%s]", name, value)
+	}
+	return &n, nil
+}
@@ -0,0 +1,457 @@
+package esbtest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/operationtype"
+	"github.com/qwenode/esb"
+	"github.com/qwenode/esb/activerecord"
+	"github.com/qwenode/esb/multisearch"
+)
+
+type product struct {
+	Name     string  `json:"name"`
+	Category string  `json:"category"`
+	Price    float64 `json:"price"`
+}
+
+func (product) GetIndexAlias() string {
+	return "products"
+}
+
+func TestServerActiveRecord(t *testing.T) {
+	ctx := context.Background()
+	client, server := NewTypedClient(t)
+	record := activerecord.New(client, product{})
+
+	t.Run("索引与读取", func(t *testing.T) {
+		id, err := record.Index(ctx, product{Name: "Go", Category: "book", Price: 30}, "1")
+		if err != nil || id != "1" {
+			t.Fatalf("Index失败: %v, %v", id, err)
+		}
+		got, err := record.FindPK(ctx, "1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Name != "Go" || got.Price != 30 {
+			t.Errorf("期望读取到写入的文档, 实际得到: %+v", got)
+		}
+		if _, err := record.FindPK(ctx, "missing"); !errors.Is(err, esb.ErrNoData) {
+			t.Errorf("期望ErrNoData, 实际得到: %v", err)
+		}
+	})
+
+	t.Run("是否存在", func(t *testing.T) {
+		if ok, err := record.Exist(ctx, "1"); err != nil || !ok {
+			t.Errorf("期望文档存在, 实际得到: %v, %v", ok, err)
+		}
+		if ok, err := record.Exist(ctx, "missing"); err != nil || ok {
+			t.Errorf("期望文档不存在, 实际得到: %v, %v", ok, err)
+		}
+	})
+
+	t.Run("局部更新与Upsert", func(t *testing.T) {
+		if err := record.UpdateField(ctx, "1", "price", 25); err != nil {
+			t.Fatal(err)
+		}
+		if err := record.Upsert(ctx, "2", product{Name: "Rust", Category: "book", Price: 40}); err != nil {
+			t.Fatal(err)
+		}
+		if err := record.UpdatePartial(ctx, "missing", map[string]any{"price": 1}); err == nil {
+			t.Error("期望更新不存在的文档返回错误")
+		}
+		got, _ := record.FindPK(ctx, "1")
+		if got.Price != 25 || got.Name != "Go" {
+			t.Errorf("期望只更新price, 实际得到: %+v", got)
+		}
+	})
+
+	t.Run("搜索与统计", func(t *testing.T) {
+		got, err := record.FindOne(ctx, "name", "Rust")
+		if err != nil || got.Price != 40 {
+			t.Fatalf("FindOne失败: %+v, %v", got, err)
+		}
+		count, err := record.Count(ctx)
+		if err != nil || count != 2 {
+			t.Errorf("期望2条文档, 实际得到: %v, %v", count, err)
+		}
+		var names []string
+		err = record.Search(ctx, func(s *search.Search) {
+			s.Query(esb.NewQuery(esb.NumberRange("price").Gte(20).Build())).Sort(esb.SortFieldDesc("price"))
+		}, func(response *search.Response) error {
+			for _, hit := range response.Hits.Hits {
+				names = append(names, *hit.Id_)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(names, ",") != "2,1" {
+			t.Errorf("期望按price降序返回2,1, 实际得到: %v", names)
+		}
+	})
+
+	t.Run("删除", func(t *testing.T) {
+		if err := record.Delete(ctx, "1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := record.BatchDeleteByField(ctx, "category", []types.TermsQueryField{"book"}); err != nil {
+			t.Fatal(err)
+		}
+		if docs := server.Docs("products"); len(docs) != 0 {
+			t.Errorf("期望文档全部被删除, 实际得到: %v", docs)
+		}
+	})
+
+	t.Run("记录请求", func(t *testing.T) {
+		requests := server.RequestsFor(OperationDeleteByQuery)
+		if len(requests) != 1 || requests[0].Index != "products" {
+			t.Fatalf("期望记录一次delete_by_query请求, 实际得到: %+v", requests)
+		}
+		query, err := requests[0].Query()
+		if err != nil || query == nil || query.Bool == nil {
+			t.Errorf("期望请求中包含bool查询, 实际得到: %+v, %v", query, err)
+		}
+	})
+}
+
+type question struct {
+	Title string `json:"title"`
+}
+
+func (question) GetIndexAlias() string   { return "qa" }
+func (question) GetJoinField() string    { return "relation" }
+func (question) GetJoinRelation() string { return "question" }
+
+type answer struct {
+	Body     string `json:"body"`
+	Question string `json:"-"`
+}
+
+func (answer) GetIndexAlias() string   { return "qa" }
+func (answer) GetJoinField() string    { return "relation" }
+func (answer) GetJoinRelation() string { return "answer" }
+func (a answer) GetParentID() string   { return a.Question }
+
+func TestServerActiveRecordJoin(t *testing.T) {
+	ctx := context.Background()
+	client, server := NewTypedClient(t)
+
+	if _, err := activerecord.New(client, question{}).Index(ctx, question{Title: "How?"}, "q1"); err != nil {
+		t.Fatal(err)
+	}
+	answers := activerecord.New(client, answer{})
+	if _, err := answers.Index(ctx, answer{Body: "Like this", Question: "q1"}, "a1"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("写入join字段", func(t *testing.T) {
+		source, _ := server.Source("qa", "q1")
+		if string(source) != `{"relation":"question","title":"How?"}` {
+			t.Errorf("期望父文档的join字段为关系名称, 实际得到: %s", source)
+		}
+		source, _ = server.Source("qa", "a1")
+		if string(source) != `{"body":"Like this","relation":{"name":"answer","parent":"q1"}}` {
+			t.Errorf("期望子文档的join字段包含parent, 实际得到: %s", source)
+		}
+	})
+
+	t.Run("子文档使用父文档routing", func(t *testing.T) {
+		requests := server.RequestsFor(OperationIndex)
+		if len(requests) != 2 {
+			t.Fatalf("期望2次索引请求, 实际得到: %d", len(requests))
+		}
+		if routing := requests[0].Params.Get("routing"); routing != "" {
+			t.Errorf("期望父文档不带routing, 实际得到: %s", routing)
+		}
+		if routing := requests[1].Params.Get("routing"); routing != "q1" {
+			t.Errorf("期望子文档routing为q1, 实际得到: %s", routing)
+		}
+	})
+
+	t.Run("按_id读取子文档", func(t *testing.T) {
+		server.ResetRequests()
+		if _, err := answers.Routing("q1").FindPK(ctx, "a1"); err != nil {
+			t.Fatal(err)
+		}
+		requests := server.RequestsFor(OperationGet)
+		if len(requests) != 1 || requests[0].Params.Get("routing") != "q1" {
+			t.Errorf("期望读取请求带routing=q1, 实际得到: %+v", requests)
+		}
+	})
+}
+
+type answerComment struct {
+	Text     string `json:"text"`
+	Answer   string `json:"-"`
+	Question string `json:"-"`
+}
+
+func (answerComment) GetIndexAlias() string   { return "qa" }
+func (answerComment) GetJoinField() string    { return "relation" }
+func (answerComment) GetJoinRelation() string { return "comment" }
+func (c answerComment) GetParentID() string   { return c.Answer }
+func (c answerComment) GetRootID() string     { return c.Question }
+
+func TestServerActiveRecordJoinDescendant(t *testing.T) {
+	ctx := context.Background()
+	client, server := NewTypedClient(t)
+
+	if _, err := activerecord.New(client, question{}).Index(ctx, question{Title: "How?"}, "q1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := activerecord.New(client, answer{}).Index(ctx, answer{Body: "Like this", Question: "q1"}, "a1"); err != nil {
+		t.Fatal(err)
+	}
+	comments := activerecord.New(client, answerComment{})
+	if _, err := comments.Index(ctx, answerComment{Text: "Thanks", Answer: "a1", Question: "q1"}, "c1"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("孙文档使用根文档routing", func(t *testing.T) {
+		source, _ := server.Source("qa", "c1")
+		if string(source) != `{"relation":{"name":"comment","parent":"a1"},"text":"Thanks"}` {
+			t.Errorf("期望join字段的parent为直接父文档, 实际得到: %s", source)
+		}
+		requests := server.RequestsFor(OperationIndex)
+		if len(requests) != 3 {
+			t.Fatalf("期望3次索引请求, 实际得到: %d", len(requests))
+		}
+		if routing := requests[2].Params.Get("routing"); routing != "q1" {
+			t.Errorf("期望孙文档routing为根文档q1, 实际得到: %s", routing)
+		}
+	})
+
+	t.Run("按根文档routing读取孙文档", func(t *testing.T) {
+		server.ResetRequests()
+		found, err := comments.Routing("q1").FindPK(ctx, "c1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found.Text != "Thanks" {
+			t.Errorf("期望读取到孙文档, 实际得到: %+v", found)
+		}
+		requests := server.RequestsFor(OperationGet)
+		if len(requests) != 1 || requests[0].Params.Get("routing") != "q1" {
+			t.Errorf("期望读取请求带routing=q1, 实际得到: %+v", requests)
+		}
+	})
+}
+
+type userList struct {
+	IDs []int `json:"ids"`
+}
+
+func (userList) GetIndexAlias() string { return "user_lists" }
+
+func TestServerActiveRecordTermsLookup(t *testing.T) {
+	ctx := context.Background()
+	client, server := NewTypedClient(t)
+	lists := activerecord.New(client, userList{}).Routing("42")
+
+	t.Run("文档不存在时写入upsert", func(t *testing.T) {
+		if err := lists.TermsLookupAdd(ctx, "blocked", "ids", 1, 2, 2); err != nil {
+			t.Fatal(err)
+		}
+		source, _ := server.Source("user_lists", "blocked")
+		if string(source) != `{"ids":[1,2]}` {
+			t.Errorf("期望写入去重后的值, 实际得到: %s", source)
+		}
+	})
+
+	t.Run("脚本更新请求", func(t *testing.T) {
+		requests := server.RequestsFor(OperationUpdate)
+		if len(requests) != 1 {
+			t.Fatalf("期望1次更新请求, 实际得到: %d", len(requests))
+		}
+		if routing := requests[0].Params.Get("routing"); routing != "42" {
+			t.Errorf("期望routing为42, 实际得到: %s", routing)
+		}
+		if retry := requests[0].Params.Get("retry_on_conflict"); retry == "" {
+			t.Error("期望设置retry_on_conflict")
+		}
+		var body struct {
+			Script types.Script `json:"script"`
+		}
+		if err := requests[0].Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if string(body.Script.Params["path"]) != `"ids"` || string(body.Script.Params["values"]) != `[1,2,2]` {
+			t.Errorf("期望脚本参数包含path与values, 实际得到: %s", requests[0].Body)
+		}
+	})
+
+	t.Run("删除时文档不存在不创建文档", func(t *testing.T) {
+		server.ResetRequests()
+		if err := lists.TermsLookupRemove(ctx, "allowed", "ids", 3); err != nil {
+			t.Fatal(err)
+		}
+		if source, ok := server.Source("user_lists", "allowed"); ok {
+			t.Errorf("期望不创建文档, 实际得到: %s", source)
+		}
+		requests := server.RequestsFor(OperationUpdate)
+		if len(requests) != 1 || strings.Contains(string(requests[0].Body), "upsert") {
+			t.Errorf("期望删除请求不带upsert, 实际得到: %+v", requests)
+		}
+	})
+
+	t.Run("拒绝包含点号的path", func(t *testing.T) {
+		server.ResetRequests()
+		if err := lists.TermsLookupAdd(ctx, "blocked", "user.ids", 1); !errors.Is(err, activerecord.ErrInvalidTermsLookupPath) {
+			t.Errorf("期望ErrInvalidTermsLookupPath, 实际得到: %v", err)
+		}
+		if err := lists.TermsLookupRemove(ctx, "blocked", "user.ids", 1); !errors.Is(err, activerecord.ErrInvalidTermsLookupPath) {
+			t.Errorf("期望ErrInvalidTermsLookupPath, 实际得到: %v", err)
+		}
+		if requests := server.Requests(); len(requests) != 0 {
+			t.Errorf("期望不发送请求, 实际得到: %d", len(requests))
+		}
+	})
+
+	t.Run("查询带routing", func(t *testing.T) {
+		query := esb.NewQuery(lists.TermsLookupQuery("user_id", "blocked", "ids"))
+		lookup, ok := query.Terms.TermsQuery["user_id"].(types.TermsLookup)
+		if !ok || lookup.Index != "user_lists" || lookup.Id != "blocked" || lookup.Path != "ids" || lookup.Routing == nil || *lookup.Routing != "42" {
+			t.Errorf("期望terms lookup指向blocked文档, 实际得到: %+v", query.Terms.TermsQuery["user_id"])
+		}
+	})
+}
+
+func TestServerMultiSearch(t *testing.T) {
+	ctx := context.Background()
+	client, server := NewTypedClient(t)
+	server.Alias("articles", "articles_20250101")
+	server.Alias("users", "users_20250101")
+	if err := server.Put("articles", "a1", map[string]any{"title": "hello", "status": "published"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Put("users", "u1", map[string]any{"name": "alice", "password": "secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("按别名分发结果", func(t *testing.T) {
+		var articles, users int
+		var source string
+		err := multisearch.NewBuilder(client).
+			AddSearch("articles", esb.NewQuery(esb.Term("status", "published")), 10, func(msi *types.MultiSearchItem, resultLength int, index string) {
+				articles = resultLength
+			}).
+			AddSearch("users", esb.NewQuery(esb.MatchAll()), 10, func(msi *types.MultiSearchItem, resultLength int, index string) {
+				users = resultLength
+				source = string(msi.Hits.Hits[0].Source_)
+			}, multisearch.WithExcludeSourceFields("password")).
+			Do(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if articles != 1 || users != 1 {
+			t.Errorf("期望每个别名各1条结果, 实际得到: %d, %d", articles, users)
+		}
+		if strings.Contains(source, "password") {
+			t.Errorf("期望_source排除password, 实际得到: %s", source)
+		}
+	})
+
+	t.Run("子查询注入错误", func(t *testing.T) {
+		server.OnRequest(func(req *Request) *Fault {
+			if req.Operation == OperationSearch && req.Index == "users" {
+				return &Fault{Status: 400, Type: "query_shard_exception", Reason: "failed to create query"}
+			}
+			return nil
+		})
+		err := multisearch.NewBuilder(client).
+			AddSearch("users", esb.NewQuery(esb.MatchAll()), 10, func(*types.MultiSearchItem, int, string) {}).
+			Do(ctx)
+		if err == nil || err.Error() != "failed to create query" {
+			t.Errorf("期望返回子查询的错误, 实际得到: %v", err)
+		}
+	})
+}
+
+func TestServerFaults(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("注入一次错误", func(t *testing.T) {
+		client, server := NewTypedClient(t)
+		server.CreateIndex("products")
+		server.FailNext(OperationCount, Fault{Status: 503, Type: "cluster_block_exception", Reason: "blocked"})
+		record := activerecord.New(client, product{})
+
+		_, err := record.Count(ctx)
+		var esErr *types.ElasticsearchError
+		if !errors.As(err, &esErr) || esErr.Status != 503 || esErr.ErrorCause.Type != "cluster_block_exception" {
+			t.Fatalf("期望注入的503错误, 实际得到: %v", err)
+		}
+		if _, err := record.Count(ctx); err != nil {
+			t.Errorf("期望错误只注入一次, 实际得到: %v", err)
+		}
+	})
+
+	t.Run("不存在的索引", func(t *testing.T) {
+		client, _ := NewTypedClient(t)
+		_, err := activerecord.New(client, product{}).Count(ctx)
+		var esErr *types.ElasticsearchError
+		if !errors.As(err, &esErr) || esErr.Status != 404 || esErr.ErrorCause.Type != "index_not_found_exception" {
+			t.Errorf("期望index_not_found_exception, 实际得到: %v", err)
+		}
+	})
+
+	t.Run("延迟与超时", func(t *testing.T) {
+		client, server := NewTypedClient(t, WithLatency(200*time.Millisecond))
+		server.CreateIndex("products")
+		timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		if _, err := activerecord.New(client, product{}).Count(timeout); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("期望超时错误, 实际得到: %v", err)
+		}
+	})
+
+	t.Run("不支持的查询", func(t *testing.T) {
+		client, server := NewTypedClient(t)
+		server.CreateIndex("products")
+		_, err := client.Search().Index("products").Query(esb.NewQuery(esb.Fuzzy("name", "go"))).Do(ctx)
+		var esErr *types.ElasticsearchError
+		if !errors.As(err, &esErr) || esErr.ErrorCause.Type != "esbtest_unsupported_exception" {
+			t.Errorf("期望不支持的查询返回400错误, 实际得到: %v", err)
+		}
+	})
+}
+
+func TestServerBulk(t *testing.T) {
+	ctx := context.Background()
+	client, server := NewTypedClient(t)
+	body := strings.Join([]string{
+		`{"index":{"_index":"products","_id":"1"}}`,
+		`{"name":"Go","price":30}`,
+		`{"create":{"_index":"products","_id":"1"}}`,
+		`{"name":"Duplicate"}`,
+		`{"update":{"_index":"products","_id":"1"}}`,
+		`{"doc":{"price":20}}`,
+		`{"delete":{"_index":"products","_id":"2"}}`,
+	}, "\n") + "\n"
+
+	response, err := client.Bulk().Raw(strings.NewReader(body)).Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !response.Errors || len(response.Items) != 4 {
+		t.Fatalf("期望4个结果且包含错误, 实际得到: %+v", response)
+	}
+	if status := response.Items[1][operationtype.Create].Status; status != 409 {
+		t.Errorf("期望重复create返回409, 实际得到: %d", status)
+	}
+	if status := response.Items[3][operationtype.Delete].Status; status != 404 {
+		t.Errorf("期望删除不存在的文档返回404, 实际得到: %d", status)
+	}
+	source, ok := server.Source("products", "1")
+	if !ok || string(source) != `{"name":"Go","price":20}` {
+		t.Errorf("期望文档被更新, 实际得到: %s", source)
+	}
+}
@@ -0,0 +1,243 @@
+package esb
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+var (
+	// ErrUnsupportedExportFormat 不支持的导出格式
+	ErrUnsupportedExportFormat = errors.New("unsupported export format")
+)
+
+// ExportFormat 聚合结果的导出格式。
+type ExportFormat string
+
+const (
+	// ExportCSV 导出为带表头的 CSV
+	ExportCSV ExportFormat = "csv"
+	// ExportNDJSON 导出为每行一个 JSON 对象
+	ExportNDJSON ExportFormat = "ndjson"
+)
+
+// DocCountColumn 导出表格中桶文档数量的列名。
+const DocCountColumn = "doc_count"
+
+// AggregationTable 是展开后的聚合结果，每行对应一个最内层的桶。
+// 列依次为每一层桶聚合的 key（列名为聚合名称）、doc_count 以及度量值
+// （列名为聚合名称，多值度量聚合为 name.avg、name[99.0]），上层的度量值会填充到其下的每一行。
+type AggregationTable struct {
+	Columns []string
+	Rows    []map[string]any
+}
+
+// FlattenAggregations 将聚合结果展开为表格，names 为要展开的顶层聚合，为空时展开所有顶层聚合。
+// 桶聚合（terms、date_histogram、filters、range 等）的每一层增加一个 key 列，
+// filter、nested、global 等单桶聚合不增加 key 列；同一层有多个桶聚合时，各分支的行只填充自己的列。
+// 与桶聚合同一层的度量聚合（包括顶层的度量聚合）会填充到该层之下的每一行，
+// 子桶聚合没有返回桶时（如 doc_count 为 0 的桶）该桶本身输出为一行。
+// 结构由响应中的 typed_keys 决定，因此适用于任意使用 esb 构建的聚合树。
+//
+// 示例：
+//   table := esb.FlattenAggregations(response.Aggregations, "per_day")
+//   err := table.WriteCSV(os.Stdout)
+func FlattenAggregations(aggs map[string]types.Aggregate, names ...string) AggregationTable {
+	if len(names) > 0 {
+		selected := make(map[string]types.Aggregate, len(names))
+		for _, name := range names {
+			if aggregate, ok := aggs[name]; ok {
+				selected[name] = aggregate
+			}
+		}
+		aggs = selected
+	}
+	f := &aggregationFlattener{keyIndex: make(map[string]bool), metricIndex: make(map[string]bool)}
+	f.flatten(aggs, nil, -1, nil)
+	sort.Strings(f.metricColumns)
+	columns := append([]string{}, f.keyColumns...)
+	columns = append(columns, DocCountColumn)
+	columns = append(columns, f.metricColumns...)
+	return AggregationTable{Columns: columns, Rows: f.rows}
+}
+
+type aggregationFlattener struct {
+	keyColumns    []string
+	keyIndex      map[string]bool
+	metricColumns []string
+	metricIndex   map[string]bool
+	rows          []map[string]any
+}
+
+type flattenKey struct {
+	column string
+	value  string
+}
+
+// flatten 展开一个桶的子聚合，metrics 为上层的度量值。子桶聚合没有产生行时该桶即为一行，docCount 小于 0 表示顶层。
+func (f *aggregationFlattener) flatten(aggs map[string]types.Aggregate, keys []flattenKey, docCount int64, metrics map[string]float64) {
+	names := sortedAggregateNames(aggs)
+	levelMetrics := make(map[string]float64, len(metrics))
+	for column, value := range metrics {
+		levelMetrics[column] = value
+	}
+	for _, name := range names {
+		values, ok := metricValues(aggs[name])
+		if !ok {
+			continue
+		}
+		for _, v := range values {
+			column := metricColumn(name, v.name)
+			if !f.metricIndex[column] {
+				f.metricIndex[column] = true
+				f.metricColumns = append(f.metricColumns, column)
+			}
+			levelMetrics[column] = v.value
+		}
+	}
+	rows := len(f.rows)
+	for _, name := range names {
+		buckets, multi, ok := aggregateBuckets(aggs[name])
+		if !ok {
+			continue
+		}
+		for _, bucket := range buckets {
+			bucketKeys := keys
+			if multi {
+				if !f.keyIndex[name] {
+					f.keyIndex[name] = true
+					f.keyColumns = append(f.keyColumns, name)
+				}
+				bucketKeys = append(append([]flattenKey{}, keys...), flattenKey{column: name, value: bucket.key})
+			}
+			f.flatten(bucket.aggs, bucketKeys, bucket.docCount, levelMetrics)
+		}
+	}
+	if len(f.rows) > rows || (docCount < 0 && len(levelMetrics) == 0) {
+		return
+	}
+	row := make(map[string]any, len(keys)+len(levelMetrics)+1)
+	for _, key := range keys {
+		row[key.column] = key.value
+	}
+	if docCount >= 0 {
+		row[DocCountColumn] = docCount
+	}
+	for column, value := range levelMetrics {
+		row[column] = value
+	}
+	f.rows = append(f.rows, row)
+}
+
+// WriteCSV 以 CSV 格式写入表格，第一行为表头，缺失的值为空字符串。
+func (t AggregationTable) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(t.Columns); err != nil {
+		return err
+	}
+	record := make([]string, len(t.Columns))
+	for _, row := range t.Rows {
+		for i, column := range t.Columns {
+			record[i] = formatExportValue(row[column])
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteNDJSON 以 NDJSON 格式写入表格，每行一个按列顺序输出的 JSON 对象，缺失的值不输出。
+func (t AggregationTable) WriteNDJSON(w io.Writer) error {
+	writer := bufio.NewWriter(w)
+	for _, row := range t.Rows {
+		writer.WriteByte('{')
+		first := true
+		for _, column := range t.Columns {
+			value, ok := row[column]
+			if !ok {
+				continue
+			}
+			if !first {
+				writer.WriteByte(',')
+			}
+			first = false
+			name, err := json.Marshal(column)
+			if err != nil {
+				return err
+			}
+			data, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			writer.Write(name)
+			writer.WriteByte(':')
+			writer.Write(data)
+		}
+		writer.WriteString("}\n")
+	}
+	return writer.Flush()
+}
+
+// Validate 检查导出格式是否受支持，不支持时返回 ErrUnsupportedExportFormat。
+func (f ExportFormat) Validate() error {
+	switch f {
+	case ExportCSV, ExportNDJSON:
+		return nil
+	}
+	return fmt.Errorf("%w: %q", ErrUnsupportedExportFormat, f)
+}
+
+// Write 按 format 写入表格。
+func (t AggregationTable) Write(w io.Writer, format ExportFormat) error {
+	if err := format.Validate(); err != nil {
+		return err
+	}
+	if format == ExportNDJSON {
+		return t.WriteNDJSON(w)
+	}
+	return t.WriteCSV(w)
+}
+
+// ExportAggregations 展开聚合结果并按 format 写入 w，names 的含义与 FlattenAggregations 相同。
+//
+// 示例：
+//   aggs := esb.NewAggregations(
+//       esb.FiltersAgg("channel", map[string]esb.QueryOption{
+//           "web": esb.Term("channel", "web"),
+//           "app": esb.Term("channel", "app"),
+//       },
+//           esb.DateHistogramAgg("per_month", "timestamp", "1M",
+//               esb.TermsAgg("category", "category", esb.SumAgg("revenue", "price")),
+//           ),
+//       ),
+//   )
+//   response, err := client.Search().Index("orders").Aggregations(aggs).Size(0).Do(ctx)
+//   err = esb.ExportAggregations(file, esb.ExportCSV, response.Aggregations)
+//   // channel,per_month,category,doc_count,revenue
+//   // app,2024-01-01T00:00:00.000Z,books,12,340.5
+func ExportAggregations(w io.Writer, format ExportFormat, aggs map[string]types.Aggregate, names ...string) error {
+	return FlattenAggregations(aggs, names...).Write(w, format)
+}
+
+func formatExportValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,110 @@
+package esb
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const exportTestResponse = `{"aggregations":{
+	"filters#channel":{"buckets":{
+		"app":{"doc_count":3,"date_histogram#per_month":{"buckets":[
+			{"key":1704067200000,"key_as_string":"2024-01","doc_count":3,"sterms#category":{"buckets":[
+				{"key":"books","doc_count":2,"sum#revenue":{"value":20.5},"tdigest_percentiles#price":{"values":{"50.0":8,"99.0":12}}},
+				{"key":"toys, games","doc_count":1,"sum#revenue":{"value":5}}
+			]}}
+		]}},
+		"web":{"doc_count":0,"date_histogram#per_month":{"buckets":[]}}
+	}},
+	"filter#paid":{"doc_count":4,"lterms#year":{"buckets":[{"key":2024,"doc_count":4,"avg#avg_price":{"value":null}}]}},
+	"avg#overall":{"value":7}
+}}`
+
+func TestFlattenAggregations(t *testing.T) {
+	response := decodeTestAggregations(t, exportTestResponse)
+
+	table := FlattenAggregations(response.Aggregations, "channel")
+	columns := []string{"channel", "per_month", "category", "doc_count", "price[50.0]", "price[99.0]", "revenue"}
+	if !reflect.DeepEqual(table.Columns, columns) {
+		t.Errorf("期望列 %v, 实际得到 %v", columns, table.Columns)
+	}
+	if len(table.Rows) != 3 {
+		t.Fatalf("期望3行, 实际得到 %d: %v", len(table.Rows), table.Rows)
+	}
+	want := map[string]any{"channel": "app", "per_month": "2024-01", "category": "books", "doc_count": int64(2), "revenue": 20.5, "price[50.0]": 8.0, "price[99.0]": 12.0}
+	if !reflect.DeepEqual(table.Rows[0], want) {
+		t.Errorf("期望 %v, 实际得到 %v", want, table.Rows[0])
+	}
+
+	var csv bytes.Buffer
+	if err := table.WriteCSV(&csv); err != nil {
+		t.Fatal(err)
+	}
+	wantCSV := "channel,per_month,category,doc_count,price[50.0],price[99.0],revenue\n" +
+		"app,2024-01,books,2,8,12,20.5\n" +
+		"app,2024-01,\"toys, games\",1,,,5\n" +
+		"web,,,0,,,\n"
+	if csv.String() != wantCSV {
+		t.Errorf("期望 CSV:\n%s实际得到:\n%s", wantCSV, csv.String())
+	}
+
+	t.Run("所有顶层聚合", func(t *testing.T) {
+		table := FlattenAggregations(response.Aggregations)
+		var ndjson bytes.Buffer
+		if err := ExportAggregations(&ndjson, ExportNDJSON, response.Aggregations); err != nil {
+			t.Fatal(err)
+		}
+		want := `{"channel":"app","per_month":"2024-01","category":"books","doc_count":2,"overall":7,"price[50.0]":8,"price[99.0]":12,"revenue":20.5}` + "\n" +
+			`{"channel":"app","per_month":"2024-01","category":"toys, games","doc_count":1,"overall":7,"revenue":5}` + "\n" +
+			`{"channel":"web","doc_count":0,"overall":7}` + "\n" +
+			`{"year":"2024","doc_count":4,"overall":7}` + "\n"
+		if ndjson.String() != want {
+			t.Errorf("期望 NDJSON:\n%s实际得到:\n%s", want, ndjson.String())
+		}
+		if len(table.Rows) != 4 {
+			t.Errorf("期望4行, 实际得到 %d", len(table.Rows))
+		}
+	})
+
+	t.Run("同一层的度量值填充到子桶的行", func(t *testing.T) {
+		response := decodeTestAggregations(t, `{"aggregations":{"sterms#category":{"buckets":[
+			{"key":"books","doc_count":3,"sum#revenue":{"value":30},"sterms#brand":{"buckets":[
+				{"key":"acme","doc_count":2,"max#max_price":{"value":9}},
+				{"key":"globex","doc_count":1,"max#max_price":{"value":6}}
+			]}},
+			{"key":"toys","doc_count":1,"sum#revenue":{"value":4},"sterms#brand":{"buckets":[]}}
+		]}}}`)
+		table := FlattenAggregations(response.Aggregations)
+		columns := []string{"category", "brand", "doc_count", "max_price", "revenue"}
+		if !reflect.DeepEqual(table.Columns, columns) {
+			t.Errorf("期望列 %v, 实际得到 %v", columns, table.Columns)
+		}
+		want := []map[string]any{
+			{"category": "books", "brand": "acme", "doc_count": int64(2), "max_price": 9.0, "revenue": 30.0},
+			{"category": "books", "brand": "globex", "doc_count": int64(1), "max_price": 6.0, "revenue": 30.0},
+			{"category": "toys", "doc_count": int64(1), "revenue": 4.0},
+		}
+		if !reflect.DeepEqual(table.Rows, want) {
+			t.Errorf("期望 %v, 实际得到 %v", want, table.Rows)
+		}
+	})
+
+	t.Run("没有桶时不输出行", func(t *testing.T) {
+		response := decodeTestAggregations(t, `{"aggregations":{"sterms#category":{"buckets":[]}}}`)
+		if table := FlattenAggregations(response.Aggregations); len(table.Rows) != 0 {
+			t.Errorf("期望没有行, 实际得到 %v", table.Rows)
+		}
+	})
+
+	t.Run("只有度量聚合", func(t *testing.T) {
+		table := FlattenAggregations(response.Aggregations, "overall")
+		if len(table.Rows) != 1 || table.Rows[0]["overall"] != 7.0 {
+			t.Errorf("期望一行 overall=7, 实际得到 %v", table.Rows)
+		}
+	})
+
+	if err := ExportAggregations(&bytes.Buffer{}, "xlsx", response.Aggregations); !errors.Is(err, ErrUnsupportedExportFormat) {
+		t.Errorf("期望ErrUnsupportedExportFormat, 实际得到: %v", err)
+	}
+}
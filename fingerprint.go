@@ -0,0 +1,173 @@
+package esb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+// fingerprintPlaceholder 是 Fingerprint 中用来替换字面值的占位符。
+const fingerprintPlaceholder = "?"
+
+// fingerprintStructuralKeys 中的键决定查询的“形状”，Fingerprint 会保留它们的值，
+// 其余位置上的字符串、数字和布尔值都视为字面值并被替换为占位符。
+var fingerprintStructuralKeys = map[string]bool{
+	"analyzer":             true,
+	"calendar_interval":    true,
+	"default_operator":     true,
+	"distance_type":        true,
+	"field":                true,
+	"fields":               true,
+	"fixed_interval":       true,
+	"format":               true,
+	"interval":             true,
+	"lang":                 true,
+	"minimum_should_match": true,
+	"mode":                 true,
+	"operator":             true,
+	"path":                 true,
+	"relation":             true,
+	"score_mode":           true,
+	"source":               true,
+	"time_zone":            true,
+	"type":                 true,
+	"unit":                 true,
+}
+
+// unorderedArrays 记录语义上与顺序无关的数组，键为“父级键/数组键”，"*" 表示任意数组键。
+// "*" 只匹配标量数组：terms 查询的值数组与顺序无关，而 terms 聚合的 order 是对象数组且与顺序有关。
+var unorderedArrays = map[string]bool{
+	"bool/must":       true,
+	"bool/filter":     true,
+	"bool/should":     true,
+	"bool/must_not":   true,
+	"dis_max/queries": true,
+	"ids/values":      true,
+	"terms/*":         true,
+}
+
+// Fingerprint 返回查询“形状”的稳定哈希：先展开嵌套的 Bool，再去掉所有字面值，
+// 与 map 遍历顺序以及 Bool 子句、Terms 值等语义上无序的顺序无关。
+// 与 Hash 不同，Fingerprint 不会像 Simplify 那样根据字面值去重或合并子句，因此形状相同的查询指纹总是相同。
+// 只有字段值不同的查询会得到相同的结果，适合用于慢查询分组。
+//
+// 示例：
+//   a, _ := esb.Fingerprint(esb.NewQuery(esb.Term("status", "published")))
+//   b, _ := esb.Fingerprint(esb.NewQuery(esb.Term("status", "draft")))
+//   // a == b
+func Fingerprint(q *types.Query) (string, error) {
+	return hashCanonical(simplifyStructure(q), true)
+}
+
+// Hash 返回包含字面值的查询稳定哈希，规范化规则与 Fingerprint 相同，适合用作结果缓存的键。
+//
+// 示例：
+//   key, err := esb.Hash(query)
+func Hash(q *types.Query) (string, error) {
+	return hashCanonical(Simplify(q), false)
+}
+
+// FingerprintAggregations 返回聚合定义“形状”的稳定哈希，与聚合的添加顺序无关。
+//
+// 示例：
+//   aggs := esb.NewAggregations(esb.TermsAgg("categories", "category"))
+//   fingerprint, err := esb.FingerprintAggregations(aggs)
+func FingerprintAggregations(aggs map[string]types.Aggregations) (string, error) {
+	return hashCanonical(aggs, true)
+}
+
+// HashAggregations 返回包含字面值的聚合定义稳定哈希。
+//
+// 示例：
+//   key, err := esb.HashAggregations(aggs)
+func HashAggregations(aggs map[string]types.Aggregations) (string, error) {
+	return hashCanonical(aggs, false)
+}
+
+// hashCanonical 将 v 序列化为规范化的 JSON 后计算 SHA-256。
+func hashCanonical(v any, stripLiterals bool) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var tree any
+	if err := decoder.Decode(&tree); err != nil {
+		return "", err
+	}
+	// json.Marshal 会对 map 的键排序，因此这里只需要处理数组顺序和字面值
+	data, err = json.Marshal(canonicalizeJSON(tree, "", "", stripLiterals))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// canonicalizeJSON 递归地规范化 JSON 树，key 为当前值的键，parent 为上一级的键。
+func canonicalizeJSON(node any, key, parent string, stripLiterals bool) any {
+	switch v := node.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for k, child := range v {
+			result[k] = canonicalizeJSON(child, k, key, stripLiterals)
+		}
+		return result
+	case []any:
+		if stripLiterals && !fingerprintStructuralKeys[key] && isScalarArray(v) {
+			return fingerprintPlaceholder
+		}
+		result := make([]any, len(v))
+		for i, child := range v {
+			result[i] = canonicalizeJSON(child, key, parent, stripLiterals)
+		}
+		if unorderedArrays[parent+"/"+key] || (unorderedArrays[parent+"/*"] && isScalarArray(v)) {
+			sortJSONValues(result)
+		}
+		return result
+	case nil:
+		return nil
+	default:
+		if !stripLiterals || fingerprintStructuralKeys[key] || v == "asc" || v == "desc" {
+			return v
+		}
+		return fingerprintPlaceholder
+	}
+}
+
+func isScalarArray(values []any) bool {
+	for _, value := range values {
+		switch value.(type) {
+		case map[string]any, []any:
+			return false
+		}
+	}
+	return true
+}
+
+// sortJSONValues 按照序列化结果对 JSON 值排序。
+func sortJSONValues(values []any) {
+	keys := make([]string, len(values))
+	for i, value := range values {
+		data, _ := json.Marshal(value)
+		keys[i] = string(data)
+	}
+	sort.Sort(jsonValuesByKey{values: values, keys: keys})
+}
+
+type jsonValuesByKey struct {
+	values []any
+	keys   []string
+}
+
+func (s jsonValuesByKey) Len() int           { return len(s.values) }
+func (s jsonValuesByKey) Less(i, j int) bool { return s.keys[i] < s.keys[j] }
+func (s jsonValuesByKey) Swap(i, j int) {
+	s.values[i], s.values[j] = s.values[j], s.values[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
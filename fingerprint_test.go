@@ -0,0 +1,186 @@
+package esb
+
+import (
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
+)
+
+func mustFingerprint(t *testing.T, q *types.Query) string {
+	t.Helper()
+	fingerprint, err := Fingerprint(q)
+	if err != nil {
+		t.Fatalf("Fingerprint失败: %v", err)
+	}
+	return fingerprint
+}
+
+func mustHash(t *testing.T, q *types.Query) string {
+	t.Helper()
+	hash, err := Hash(q)
+	if err != nil {
+		t.Fatalf("Hash失败: %v", err)
+	}
+	return hash
+}
+
+func TestFingerprint(t *testing.T) {
+	build := func(status string, minPrice float64, tags ...types.FieldValue) *types.Query {
+		return NewQuery(Bool(
+			Must(Match("title", "elasticsearch")),
+			Filter(
+				Term("status", status),
+				NumberRange("price").Gte(minPrice).Build(),
+				Terms("tags", tags...),
+			),
+		))
+	}
+
+	t.Run("只有字面值不同的查询指纹相同", func(t *testing.T) {
+		a := mustFingerprint(t, build("published", 10, "go", "es"))
+		b := mustFingerprint(t, build("draft", 99, "rust"))
+		if a != b {
+			t.Errorf("期望指纹相同, 实际得到: %s != %s", a, b)
+		}
+	})
+
+	t.Run("字段不同的查询指纹不同", func(t *testing.T) {
+		a := mustFingerprint(t, NewQuery(Term("status", "published")))
+		b := mustFingerprint(t, NewQuery(Term("category", "published")))
+		if a == b {
+			t.Error("期望指纹不同")
+		}
+	})
+
+	t.Run("子句位置不同的查询指纹不同", func(t *testing.T) {
+		a := mustFingerprint(t, NewQuery(Bool(Must(Term("status", "a")), Filter(Exists("title")))))
+		b := mustFingerprint(t, NewQuery(Bool(Filter(Term("status", "a")), Must(Exists("title")))))
+		if a == b {
+			t.Error("期望must与filter的指纹不同")
+		}
+	})
+
+	t.Run("与子句顺序无关", func(t *testing.T) {
+		a := mustFingerprint(t, NewQuery(BoolFilter(Term("status", "a"), Exists("title"))))
+		b := mustFingerprint(t, NewQuery(BoolFilter(Exists("title"), Term("status", "b"))))
+		if a != b {
+			t.Errorf("期望指纹相同, 实际得到: %s != %s", a, b)
+		}
+	})
+
+	t.Run("等价的嵌套写法指纹相同", func(t *testing.T) {
+		a := mustFingerprint(t, NewQuery(BoolFilter(Bool(Filter(Term("status", "a"))), Exists("title"))))
+		b := mustFingerprint(t, NewQuery(BoolFilter(Term("status", "b"), Exists("title"))))
+		if a != b {
+			t.Errorf("期望指纹相同, 实际得到: %s != %s", a, b)
+		}
+	})
+
+	t.Run("不根据字面值合并子句", func(t *testing.T) {
+		a := mustFingerprint(t, NewQuery(BoolFilter(
+			NumberRange("price").Gte(1).Lte(5).Build(),
+			NumberRange("price").Gte(2).Lte(3).Build(),
+		)))
+		b := mustFingerprint(t, NewQuery(BoolFilter(
+			NumberRange("price").Gte(1).Lte(3).Build(),
+			NumberRange("price").Gte(2).Lte(5).Build(),
+		)))
+		c := mustFingerprint(t, NewQuery(BoolFilter(Term("status", "a"), Term("status", "a"))))
+		d := mustFingerprint(t, NewQuery(BoolFilter(Term("status", "a"), Term("status", "b"))))
+		if a != b || c != d {
+			t.Error("期望形状相同的查询指纹相同")
+		}
+	})
+}
+
+func TestHash(t *testing.T) {
+	t.Run("字面值不同的查询哈希不同", func(t *testing.T) {
+		a := mustHash(t, NewQuery(Term("status", "published")))
+		b := mustHash(t, NewQuery(Term("status", "draft")))
+		if a == b {
+			t.Error("期望哈希不同")
+		}
+	})
+
+	t.Run("与子句和Terms值的顺序无关", func(t *testing.T) {
+		a := mustHash(t, NewQuery(BoolFilter(Term("status", "a"), Terms("tags", "go", "es"))))
+		b := mustHash(t, NewQuery(BoolFilter(Terms("tags", "es", "go"), Term("status", "a"))))
+		if a != b {
+			t.Errorf("期望哈希相同, 实际得到: %s != %s", a, b)
+		}
+	})
+
+	t.Run("相同查询多次计算结果稳定", func(t *testing.T) {
+		query := NewQuery(Bool(
+			Should(Match("title", "go"), Match("content", "go")),
+			Filter(Terms("tags", "a", "b", "c")),
+		))
+		first := mustHash(t, query)
+		for i := 0; i < 20; i++ {
+			if got := mustHash(t, query); got != first {
+				t.Fatalf("哈希不稳定: %s != %s", got, first)
+			}
+		}
+	})
+
+	t.Run("nil查询", func(t *testing.T) {
+		if mustHash(t, nil) == "" {
+			t.Error("期望返回非空哈希")
+		}
+	})
+}
+
+func TestAggregationsFingerprint(t *testing.T) {
+	t.Run("与聚合的添加顺序无关", func(t *testing.T) {
+		a, err := HashAggregations(NewAggregations(
+			TermsAgg("categories", "category", AvgAgg("avg_price", "price")),
+			SumAgg("total", "amount"),
+		))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := HashAggregations(NewAggregations(
+			SumAgg("total", "amount"),
+			TermsAgg("categories", "category", AvgAgg("avg_price", "price")),
+		))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a != b {
+			t.Errorf("期望哈希相同, 实际得到: %s != %s", a, b)
+		}
+	})
+
+	t.Run("terms聚合的order与顺序有关", func(t *testing.T) {
+		build := func(orders ...map[string]sortorder.SortOrder) map[string]types.Aggregations {
+			return NewAggregations(TermsAggWithOptions("categories", "category", func(opts *types.TermsAggregation) {
+				opts.Order = orders
+			}))
+		}
+		count := map[string]sortorder.SortOrder{"_count": sortorder.Desc}
+		key := map[string]sortorder.SortOrder{"_key": sortorder.Asc}
+		a, _ := HashAggregations(build(count, key))
+		b, _ := HashAggregations(build(key, count))
+		if a == b {
+			t.Error("期望order顺序不同的聚合哈希不同")
+		}
+	})
+
+	t.Run("指纹忽略字面值但保留字段", func(t *testing.T) {
+		a, _ := FingerprintAggregations(NewAggregations(TopTermsAgg("top", "category", 10)))
+		b, _ := FingerprintAggregations(NewAggregations(TopTermsAgg("top", "category", 50)))
+		c, _ := FingerprintAggregations(NewAggregations(TopTermsAgg("top", "brand", 10)))
+		if a != b {
+			t.Error("期望size不同的聚合指纹相同")
+		}
+		if a == c {
+			t.Error("期望字段不同的聚合指纹不同")
+		}
+		ha, _ := HashAggregations(NewAggregations(TopTermsAgg("top", "category", 10)))
+		hb, _ := HashAggregations(NewAggregations(TopTermsAgg("top", "category", 50)))
+		if ha == hb {
+			t.Error("期望size不同的聚合哈希不同")
+		}
+	})
+}
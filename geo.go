@@ -2,7 +2,10 @@
 package esb
 
 import (
+	"encoding/json"
+
 	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/geoshaperelation"
 )
 
 // GeoBoundingBox 创建一个地理边界框查询，用于查找位于指定矩形区域内的地理点。
@@ -79,4 +82,74 @@ func GeoShape(field string, shape string) QueryOption {
 		}
 		q.GeoShape = query
 	}
-} 
\ No newline at end of file
+}
+
+// GeoShapeOf 使用结构化的几何形状创建地理形状查询，形状序列化为 GeoJSON，避免手写字符串时搞错经纬度顺序。
+// 不会校验 shape，调用方需要先调用 shape.Validate()（多边形可先 Normalize），否则非法形状会在 Elasticsearch 端报错。
+//
+// 示例：
+//   area := esb.Polygon{Shell: shell}.Normalize()
+//   esb.GeoShapeOf("location", area)
+//   esb.GeoShapeOf("location", esb.Envelope{TopLeft: esb.Point{Lat: 40.8, Lon: -74.1}, BottomRight: esb.Point{Lat: 40.7, Lon: -73.9}})
+func GeoShapeOf(field string, shape Geometry) QueryOption {
+	return func(q *types.Query) {
+		query := types.NewGeoShapeQuery()
+		query.GeoShapeQuery[field] = types.GeoShapeFieldQuery{
+			Shape: geometryJSON(shape),
+		}
+		q.GeoShape = query
+	}
+}
+
+// GeoShapeOfWithRelation 创建一个带有空间关系的地理形状查询。与 GeoShapeOf 相同，不会校验 shape，调用方需要先调用 shape.Validate()。
+//
+// 示例：
+//   esb.GeoShapeOfWithRelation("area", point, geoshaperelation.Contains)
+func GeoShapeOfWithRelation(field string, shape Geometry, relation geoshaperelation.GeoShapeRelation) QueryOption {
+	return func(q *types.Query) {
+		query := types.NewGeoShapeQuery()
+		query.GeoShapeQuery[field] = types.GeoShapeFieldQuery{
+			Shape:    geometryJSON(shape),
+			Relation: &relation,
+		}
+		q.GeoShape = query
+	}
+}
+
+// GeoBoundingBoxOf 使用 Envelope 创建地理边界框查询。
+//
+// 示例：
+//   esb.GeoBoundingBoxOf("location", esb.Envelope{TopLeft: esb.Point{Lat: 40.73, Lon: -74.1}, BottomRight: esb.Point{Lat: 40.01, Lon: -71.12}})
+func GeoBoundingBoxOf(field string, envelope Envelope) QueryOption {
+	return GeoBoundingBox(field, envelope.TopLeft.Lat, envelope.TopLeft.Lon, envelope.BottomRight.Lat, envelope.BottomRight.Lon)
+}
+
+// GeoDistanceOf 使用 Circle 创建地理距离查询，查找圆内的地理点。
+//
+// 示例：
+//   esb.GeoDistanceOf("location", esb.Circle{Center: esb.Point{Lat: 40, Lon: -70}, Radius: 200000})
+func GeoDistanceOf(field string, circle Circle) QueryOption {
+	return GeoDistance(field, circle.Center.Lat, circle.Center.Lon, circle.Distance())
+}
+
+// GeoPolygonOf 使用 Polygon 的外环创建地理多边形查询，内环会被忽略，需要排除内环时使用 GeoShapeOf。
+// 不会校验 polygon，调用方需要先调用 polygon.Validate()。
+//
+// 示例：
+//   esb.GeoPolygonOf("location", esb.Polygon{Shell: shell})
+func GeoPolygonOf(field string, polygon Polygon) QueryOption {
+	points := make([][]float64, 0, len(polygon.Shell))
+	for _, p := range polygon.Shell {
+		points = append(points, []float64{p.Lat, p.Lon})
+	}
+	return GeoPolygon(field, points)
+}
+
+// geometryJSON 将几何形状序列化为 GeoJSON，本包的实现不会返回错误。
+func geometryJSON(shape Geometry) json.RawMessage {
+	data, err := shape.MarshalJSON()
+	if err != nil {
+		return nil
+	}
+	return data
+}
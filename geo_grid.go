@@ -0,0 +1,473 @@
+package esb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+var (
+	// ErrInvalidGridKey 网格 key 格式错误
+	ErrInvalidGridKey = errors.New("invalid geo grid key")
+)
+
+// GeoGridType 表示地理网格的类型，与 geo_grid 查询和对应的网格聚合一致。
+type GeoGridType string
+
+const (
+	GeoGridGeohash GeoGridType = "geohash"
+	GeoGridGeotile GeoGridType = "geotile"
+	GeoGridGeohex  GeoGridType = "geohex"
+)
+
+// geotileMaxLat 是 Web Mercator 投影能表示的最大纬度。
+const geotileMaxLat = 85.0511287798066
+
+const geohashBase32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// GeoGrid 创建一个地理网格查询，匹配与网格聚合中某个网格相交的 geo_point、geo_shape，
+// 常用于根据网格聚合的 bucket key 钻取该网格内的文档。
+//
+// 示例：
+//   esb.GeoGrid("location", esb.GeoGridGeohash, "u0")
+//   esb.GeoGrid("location", esb.GeoGridGeotile, "6/32/22")
+func GeoGrid(field string, grid GeoGridType, key string) QueryOption {
+	return GeoGridWithOptions(field, grid, key, nil)
+}
+
+// GeoGridWithOptions 提供回调函数式的地理网格查询配置。
+//
+// 示例：
+//   esb.GeoGridWithOptions("location", esb.GeoGridGeohex, "811fbffffffffff", func(opts *types.GeoGridQuery) {
+//       boost := float32(2.0)
+//       opts.Boost = &boost
+//   })
+func GeoGridWithOptions(field string, grid GeoGridType, key string, setOpts func(opts *types.GeoGridQuery)) QueryOption {
+	return func(q *types.Query) {
+		query := types.GeoGridQuery{}
+		switch grid {
+		case GeoGridGeohash:
+			query.Geohash = &key
+		case GeoGridGeotile:
+			query.Geotile = &key
+		case GeoGridGeohex:
+			query.Geohex = &key
+		}
+		if setOpts != nil {
+			setOpts(&query)
+		}
+		q.GeoGrid = map[string]types.GeoGridQuery{field: query}
+	}
+}
+
+// GeohashEncode 将地理点编码为指定精度（1-12）的 geohash。
+//
+// 示例：
+//   esb.GeohashEncode(esb.Point{Lat: 57.64911, Lon: 10.40744}, 5) // u4pru
+func GeohashEncode(p Point, precision int) string {
+	precision = min(max(precision, 1), 12)
+	minLat, maxLat, minLon, maxLon := -90.0, 90.0, -180.0, 180.0
+	var b strings.Builder
+	bit, ch, even := 0, 0, true
+	for b.Len() < precision {
+		if even {
+			mid := (minLon + maxLon) / 2
+			if p.Lon >= mid {
+				ch |= 1 << (4 - bit)
+				minLon = mid
+			} else {
+				maxLon = mid
+			}
+		} else {
+			mid := (minLat + maxLat) / 2
+			if p.Lat >= mid {
+				ch |= 1 << (4 - bit)
+				minLat = mid
+			} else {
+				maxLat = mid
+			}
+		}
+		even = !even
+		if bit++; bit == 5 {
+			b.WriteByte(geohashBase32[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return b.String()
+}
+
+// GeohashDecode 将 geohash 解码为对应网格的矩形范围。
+//
+// 示例：
+//   cell, err := esb.GeohashDecode("u4pru")
+//   center := cell.Center()
+func GeohashDecode(hash string) (Envelope, error) {
+	if hash == "" || len(hash) > 12 {
+		return Envelope{}, fmt.Errorf("%w: geohash %q", ErrInvalidGridKey, hash)
+	}
+	minLat, maxLat, minLon, maxLon := -90.0, 90.0, -180.0, 180.0
+	even := true
+	for i := 0; i < len(hash); i++ {
+		ch := strings.IndexByte(geohashBase32, hash[i])
+		if ch < 0 {
+			return Envelope{}, fmt.Errorf("%w: geohash %q: unexpected %q", ErrInvalidGridKey, hash, hash[i])
+		}
+		for bit := 4; bit >= 0; bit-- {
+			set := ch&(1<<bit) != 0
+			if even {
+				mid := (minLon + maxLon) / 2
+				if set {
+					minLon = mid
+				} else {
+					maxLon = mid
+				}
+			} else {
+				mid := (minLat + maxLat) / 2
+				if set {
+					minLat = mid
+				} else {
+					maxLat = mid
+				}
+			}
+			even = !even
+		}
+	}
+	return Envelope{
+		TopLeft:     Point{Lat: maxLat, Lon: minLon},
+		BottomRight: Point{Lat: minLat, Lon: maxLon},
+	}, nil
+}
+
+// GeotileEncode 将地理点编码为指定缩放级别（0-29）的地图瓦片 key，格式为 "zoom/x/y"。
+//
+// 示例：
+//   esb.GeotileEncode(esb.Point{Lat: 48.85, Lon: 2.35}, 6) // 6/32/22
+func GeotileEncode(p Point, zoom int) string {
+	zoom = min(max(zoom, 0), 29)
+	tiles := 1 << zoom
+	lat := radians(math.Max(-geotileMaxLat, math.Min(geotileMaxLat, p.Lat)))
+	x := int(math.Floor((p.Lon + 180) / 360 * float64(tiles)))
+	y := int(math.Floor((1 - math.Log(math.Tan(lat)+1/math.Cos(lat))/math.Pi) / 2 * float64(tiles)))
+	x = min(max(x, 0), tiles-1)
+	y = min(max(y, 0), tiles-1)
+	return fmt.Sprintf("%d/%d/%d", zoom, x, y)
+}
+
+// GeotileDecode 将 "zoom/x/y" 格式的地图瓦片 key 解码为对应瓦片的矩形范围。
+//
+// 示例：
+//   tile, err := esb.GeotileDecode("6/32/22")
+func GeotileDecode(key string) (Envelope, error) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 3 {
+		return Envelope{}, fmt.Errorf("%w: geotile %q", ErrInvalidGridKey, key)
+	}
+	var zxy [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return Envelope{}, fmt.Errorf("%w: geotile %q", ErrInvalidGridKey, key)
+		}
+		zxy[i] = n
+	}
+	zoom, x, y := zxy[0], zxy[1], zxy[2]
+	if zoom > 29 || x >= 1<<zoom || y >= 1<<zoom {
+		return Envelope{}, fmt.Errorf("%w: geotile %q out of range", ErrInvalidGridKey, key)
+	}
+	tiles := float64(int(1) << zoom)
+	tileLon := func(x int) float64 { return float64(x)/tiles*360 - 180 }
+	tileLat := func(y int) float64 { return degrees(math.Atan(math.Sinh(math.Pi * (1 - 2*float64(y)/tiles)))) }
+	return Envelope{
+		TopLeft:     Point{Lat: tileLat(y), Lon: tileLon(x)},
+		BottomRight: Point{Lat: tileLat(y + 1), Lon: tileLon(x + 1)},
+	}, nil
+}
+
+// GeohexCell 是从 geohex（H3）key 中解析出的网格信息。
+type GeohexCell struct {
+	Resolution int
+	BaseCell   int
+}
+
+// ParseGeohex 校验 geohex_grid 聚合返回的 H3 网格 key 并解析出分辨率和基础网格编号。
+// H3 网格是六边形，边界需要 H3 库计算，本包不提供；需要网格的范围或中心点时，
+// 在 geohex_grid 聚合下添加 geo_bounds、geo_centroid 子聚合，并通过 GeoGridBoundsAgg、GeoGridCentroidAgg 读取。
+//
+// 示例：
+//   cell, err := esb.ParseGeohex("811fbffffffffff") // Resolution: 1
+func ParseGeohex(key string) (GeohexCell, error) {
+	index, err := strconv.ParseUint(key, 16, 64)
+	if err != nil || len(key) > 16 {
+		return GeohexCell{}, fmt.Errorf("%w: geohex %q", ErrInvalidGridKey, key)
+	}
+	mode := (index >> 59) & 0xf
+	resolution := int((index >> 52) & 0xf)
+	baseCell := int((index >> 45) & 0x7f)
+	if index>>63 != 0 || mode != 1 || baseCell >= 122 {
+		return GeohexCell{}, fmt.Errorf("%w: geohex %q is not an H3 cell", ErrInvalidGridKey, key)
+	}
+	for r := 1; r <= 15; r++ {
+		digit := (index >> ((15 - r) * 3)) & 0x7
+		if (r <= resolution) == (digit == 7) {
+			return GeohexCell{}, fmt.Errorf("%w: geohex %q has invalid digit at resolution %d", ErrInvalidGridKey, key, r)
+		}
+	}
+	return GeohexCell{Resolution: resolution, BaseCell: baseCell}, nil
+}
+
+// GeoGridCell 将 geohash、geotile 的 key 解码为网格的矩形范围，geohex 需要通过子聚合获取，返回 ErrInvalidGridKey。
+func GeoGridCell(grid GeoGridType, key string) (Envelope, error) {
+	switch grid {
+	case GeoGridGeohash:
+		return GeohashDecode(key)
+	case GeoGridGeotile:
+		return GeotileDecode(key)
+	}
+	return Envelope{}, fmt.Errorf("%w: cannot decode %s key %q into bounds", ErrInvalidGridKey, grid, key)
+}
+
+// GeohexGridAgg 创建 H3 六边形网格聚合，将地理点按 geohex 网格分组，precision 为 0-15。
+//
+// 示例：
+//   esb.GeohexGridAgg("hex_grid", "location", 6)
+func GeohexGridAgg(name, field string, precision int, subAggs ...AggregationOption) AggregationOption {
+	return func(aggs *types.Aggregations) {
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{
+			GeohexGrid: &types.GeohexGridAggregation{
+				Field:     field,
+				Precision: &precision,
+			},
+		}, subAggs)
+	}
+}
+
+// GeoGridFeatureOption 表示 FormatGeoGridFeatures 的配置项。
+type GeoGridFeatureOption func(*geoGridFeatureOptions)
+
+type geoGridFeatureOptions struct {
+	centroid    bool
+	centroidAgg string
+	boundsAgg   string
+}
+
+// GeoGridAsCentroid 每个网格输出为中心点（Point）而不是多边形。
+func GeoGridAsCentroid() GeoGridFeatureOption {
+	return func(o *geoGridFeatureOptions) {
+		o.centroid = true
+	}
+}
+
+// GeoGridCentroidAgg 使用 bucket 下名为 name 的 geo_centroid 子聚合作为网格的点，即网格内文档的实际中心，
+// 同时会启用 GeoGridAsCentroid。
+func GeoGridCentroidAgg(name string) GeoGridFeatureOption {
+	return func(o *geoGridFeatureOptions) {
+		o.centroid = true
+		o.centroidAgg = name
+	}
+}
+
+// GeoGridBoundsAgg 使用 bucket 下名为 name 的 geo_bounds 子聚合作为网格的范围，geohex_grid 聚合需要使用。
+func GeoGridBoundsAgg(name string) GeoGridFeatureOption {
+	return func(o *geoGridFeatureOptions) {
+		o.boundsAgg = name
+	}
+}
+
+// FormatGeoGridFeatures 将 geohash_grid、geotile_grid、geohex_grid 聚合的结果转换为 GeoJSON FeatureCollection，
+// 每个 bucket 对应一个 Feature，properties 中包含 key、doc_count 以及单值度量子聚合（avg、sum、max 等）的值。
+//
+// 示例：
+//   collection, err := esb.FormatGeoGridFeatures(response.Aggregations["grid"])
+//   data, err := json.Marshal(collection) // 直接返回给地图前端
+func FormatGeoGridFeatures(aggregate types.Aggregate, opts ...GeoGridFeatureOption) (GeoFeatureCollection, error) {
+	var options geoGridFeatureOptions
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&options)
+		}
+	}
+	var grid GeoGridType
+	var buckets []geoGridBucket
+	switch agg := aggregate.(type) {
+	case *types.GeoHashGridAggregate:
+		grid = GeoGridGeohash
+		buckets = geoGridBuckets(agg.Buckets, func(b types.GeoHashGridBucket) geoGridBucket {
+			return geoGridBucket{b.Key, b.DocCount, b.Aggregations}
+		})
+	case *types.GeoTileGridAggregate:
+		grid = GeoGridGeotile
+		buckets = geoGridBuckets(agg.Buckets, func(b types.GeoTileGridBucket) geoGridBucket {
+			return geoGridBucket{b.Key, b.DocCount, b.Aggregations}
+		})
+	case *types.GeoHexGridAggregate:
+		grid = GeoGridGeohex
+		buckets = geoGridBuckets(agg.Buckets, func(b types.GeoHexGridBucket) geoGridBucket {
+			return geoGridBucket{b.Key, b.DocCount, b.Aggregations}
+		})
+	default:
+		return GeoFeatureCollection{}, fmt.Errorf("%w: unsupported aggregate %T", ErrInvalidGridKey, aggregate)
+	}
+	collection := GeoFeatureCollection{Features: make([]GeoFeature, 0, len(buckets))}
+	for _, bucket := range buckets {
+		geometry, err := bucket.geometry(grid, options)
+		if err != nil {
+			return GeoFeatureCollection{}, err
+		}
+		properties := map[string]any{"key": bucket.key, "doc_count": bucket.docCount}
+		for name, sub := range bucket.aggregations {
+			if value, ok := metricValue(sub); ok {
+				properties[name] = value
+			}
+		}
+		collection.Features = append(collection.Features, GeoFeature{
+			ID:         bucket.key,
+			Geometry:   geometry,
+			Properties: properties,
+		})
+	}
+	return collection, nil
+}
+
+type geoGridBucket struct {
+	key          string
+	docCount     int64
+	aggregations map[string]types.Aggregate
+}
+
+func geoGridBuckets[B any](buckets any, convert func(B) geoGridBucket) []geoGridBucket {
+	var result []geoGridBucket
+	switch b := buckets.(type) {
+	case []B:
+		for _, bucket := range b {
+			result = append(result, convert(bucket))
+		}
+	case map[string]B:
+		// keyed 桶按 key 排序，保证输出顺序稳定
+		keys := make([]string, 0, len(b))
+		for key := range b {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			converted := convert(b[key])
+			if converted.key == "" {
+				converted.key = key
+			}
+			result = append(result, converted)
+		}
+	}
+	return result
+}
+
+func (b geoGridBucket) geometry(grid GeoGridType, options geoGridFeatureOptions) (Geometry, error) {
+	if options.centroidAgg != "" {
+		if centroid, ok := b.aggregations[options.centroidAgg].(*types.GeoCentroidAggregate); ok {
+			if p, ok := pointFromGeoLocation(centroid.Location); ok {
+				return p, nil
+			}
+		}
+	}
+	var cell Envelope
+	var err error
+	if options.boundsAgg != "" {
+		bounds, ok := b.aggregations[options.boundsAgg].(*types.GeoBoundsAggregate)
+		if !ok {
+			return nil, fmt.Errorf("%w: bucket %q has no geo_bounds aggregation %q", ErrInvalidGridKey, b.key, options.boundsAgg)
+		}
+		if cell, ok = envelopeFromGeoBounds(bounds.Bounds); !ok {
+			return nil, fmt.Errorf("%w: bucket %q has unsupported bounds %T", ErrInvalidGridKey, b.key, bounds.Bounds)
+		}
+	} else if cell, err = GeoGridCell(grid, b.key); err != nil {
+		return nil, err
+	}
+	if options.centroid {
+		return cell.Center(), nil
+	}
+	return cell.Polygon(), nil
+}
+
+// pointFromGeoLocation 读取 types.GeoLocation 的各种表示形式，字符串只支持 "lat,lon"。
+func pointFromGeoLocation(location types.GeoLocation) (Point, bool) {
+	switch l := location.(type) {
+	case types.LatLonGeoLocation:
+		return Point{Lat: float64(l.Lat), Lon: float64(l.Lon)}, true
+	case *types.LatLonGeoLocation:
+		if l != nil {
+			return Point{Lat: float64(l.Lat), Lon: float64(l.Lon)}, true
+		}
+	case []types.Float64:
+		if len(l) >= 2 {
+			return Point{Lat: float64(l[1]), Lon: float64(l[0])}, true
+		}
+	case []float64:
+		if len(l) >= 2 {
+			return Point{Lat: l[1], Lon: l[0]}, true
+		}
+	case string:
+		parts := strings.Split(l, ",")
+		if len(parts) == 2 {
+			lat, latErr := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+			lon, lonErr := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+			return Point{Lat: lat, Lon: lon}, latErr == nil && lonErr == nil
+		}
+	case map[string]any:
+		lat, latOK := l["lat"].(float64)
+		lon, lonOK := l["lon"].(float64)
+		return Point{Lat: lat, Lon: lon}, latOK && lonOK
+	}
+	return Point{}, false
+}
+
+func envelopeFromGeoBounds(bounds types.GeoBounds) (Envelope, bool) {
+	switch b := bounds.(type) {
+	case *types.TopLeftBottomRightGeoBounds:
+		topLeft, ok1 := pointFromGeoLocation(b.TopLeft)
+		bottomRight, ok2 := pointFromGeoLocation(b.BottomRight)
+		return Envelope{TopLeft: topLeft, BottomRight: bottomRight}, ok1 && ok2
+	case *types.TopRightBottomLeftGeoBounds:
+		topRight, ok1 := pointFromGeoLocation(b.TopRight)
+		bottomLeft, ok2 := pointFromGeoLocation(b.BottomLeft)
+		return Envelope{
+			TopLeft:     Point{Lat: topRight.Lat, Lon: bottomLeft.Lon},
+			BottomRight: Point{Lat: bottomLeft.Lat, Lon: topRight.Lon},
+		}, ok1 && ok2
+	case *types.CoordsGeoBounds:
+		return Envelope{
+			TopLeft:     Point{Lat: float64(b.Top), Lon: float64(b.Left)},
+			BottomRight: Point{Lat: float64(b.Bottom), Lon: float64(b.Right)},
+		}, true
+	}
+	return Envelope{}, false
+}
+
+// metricValue 读取单值度量聚合（avg、sum、min、max、cardinality、value_count 等）的 Value 字段，值为 null 时返回 nil。
+func metricValue(aggregate types.Aggregate) (any, bool) {
+	rv := reflect.ValueOf(aggregate)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil, false
+	}
+	field := rv.Elem().FieldByName("Value")
+	if !field.IsValid() {
+		return nil, false
+	}
+	switch v := field.Interface().(type) {
+	case *types.Float64:
+		if v == nil {
+			return nil, true
+		}
+		return float64(*v), true
+	case types.Float64:
+		return float64(v), true
+	case int64:
+		return v, true
+	case float64:
+		return v, true
+	}
+	return nil, false
+}
@@ -0,0 +1,178 @@
+package esb
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+func TestGeoGrid(t *testing.T) {
+	tests := []struct {
+		name  string
+		query QueryOption
+		want  string
+	}{
+		{"geohash", GeoGrid("location", GeoGridGeohash, "u0"), `{"geo_grid":{"location":{"geohash":"u0"}}}`},
+		{"geotile", GeoGrid("location", GeoGridGeotile, "6/32/22"), `{"geo_grid":{"location":{"geotile":"6/32/22"}}}`},
+		{
+			"geohex带选项",
+			GeoGridWithOptions("location", GeoGridGeohex, "811fbffffffffff", func(opts *types.GeoGridQuery) {
+				name := "hex"
+				opts.QueryName_ = &name
+			}),
+			`{"geo_grid":{"location":{"_name":"hex","geohex":"811fbffffffffff"}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mustJSON(t, NewQuery(tt.query)); got != tt.want {
+				t.Errorf("期望 %s, 实际得到 %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestGeohash(t *testing.T) {
+	p := Point{Lat: 57.64911, Lon: 10.40744}
+	if got := GeohashEncode(p, 11); got != "u4pruydqqvj" {
+		t.Errorf("期望 u4pruydqqvj, 实际得到 %s", got)
+	}
+	cell, err := GeohashDecode("u4pruydqqvj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	center := cell.Center()
+	if math.Abs(center.Lat-p.Lat) > 1e-5 || math.Abs(center.Lon-p.Lon) > 1e-5 {
+		t.Errorf("期望中心点接近 %v, 实际得到 %v", p, center)
+	}
+	if cell.TopLeft.Lat < p.Lat || cell.BottomRight.Lat > p.Lat || cell.TopLeft.Lon > p.Lon || cell.BottomRight.Lon < p.Lon {
+		t.Errorf("期望网格包含原始点, 实际得到 %+v", cell)
+	}
+	for _, hash := range []string{"", "u4a", "u4pruydqqvjxx"} {
+		if _, err := GeohashDecode(hash); !errors.Is(err, ErrInvalidGridKey) {
+			t.Errorf("%q: 期望ErrInvalidGridKey, 实际得到: %v", hash, err)
+		}
+	}
+}
+
+func TestGeotile(t *testing.T) {
+	if got := GeotileEncode(Point{Lat: 48.85, Lon: 2.35}, 6); got != "6/32/22" {
+		t.Errorf("期望 6/32/22, 实际得到 %s", got)
+	}
+	if got := GeotileEncode(Point{Lat: 90, Lon: 180}, 2); got != "2/3/0" {
+		t.Errorf("期望超出范围时取边缘瓦片, 实际得到 %s", got)
+	}
+	tile, err := GeotileDecode("1/0/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tile.TopLeft.Lon != -180 || tile.BottomRight.Lon != 0 || tile.BottomRight.Lat != 0 || math.Abs(tile.TopLeft.Lat-geotileMaxLat) > 1e-9 {
+		t.Errorf("期望西北象限瓦片, 实际得到 %+v", tile)
+	}
+	for _, key := range []string{"1/2/0", "6/32", "a/b/c", "30/0/0"} {
+		if _, err := GeotileDecode(key); !errors.Is(err, ErrInvalidGridKey) {
+			t.Errorf("%q: 期望ErrInvalidGridKey, 实际得到: %v", key, err)
+		}
+	}
+}
+
+func TestParseGeohex(t *testing.T) {
+	cell, err := ParseGeohex("811fbffffffffff")
+	if err != nil || cell.Resolution != 1 || cell.BaseCell != 15 {
+		t.Errorf("期望分辨率1、基础网格15, 实际得到: %+v, %v", cell, err)
+	}
+	for _, key := range []string{"zz", "811ffffffffffff", "u0"} {
+		if _, err := ParseGeohex(key); !errors.Is(err, ErrInvalidGridKey) {
+			t.Errorf("%q: 期望ErrInvalidGridKey, 实际得到: %v", key, err)
+		}
+	}
+	if _, err := GeoGridCell(GeoGridGeohex, "811fbffffffffff"); !errors.Is(err, ErrInvalidGridKey) {
+		t.Errorf("期望geohex无法直接解码范围, 实际得到: %v", err)
+	}
+}
+
+func decodeTestAggregations(t *testing.T, data string) search.Response {
+	t.Helper()
+	var response search.Response
+	if err := json.Unmarshal([]byte(data), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestFormatGeoGridFeatures(t *testing.T) {
+	t.Run("geohash网格转换为多边形", func(t *testing.T) {
+		response := decodeTestAggregations(t, `{"aggregations":{"geohash_grid#grid":{"buckets":[
+			{"key":"s","doc_count":3,"avg#avg_price":{"value":12.5}}
+		]}}}`)
+		collection, err := FormatGeoGridFeatures(response.Aggregations["grid"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := json.Marshal(collection)
+		want := `{"type":"FeatureCollection","features":[{"type":"Feature","id":"s","geometry":{"type":"Polygon","coordinates":[[[0,0],[45,0],[45,45],[0,45],[0,0]]]},"properties":{"avg_price":12.5,"doc_count":3,"key":"s"}}]}`
+		if string(data) != want {
+			t.Errorf("期望 %s, 实际得到 %s", want, data)
+		}
+	})
+
+	t.Run("geotile网格转换为中心点", func(t *testing.T) {
+		response := decodeTestAggregations(t, `{"aggregations":{"geotile_grid#grid":{"buckets":[{"key":"1/1/1","doc_count":1}]}}}`)
+		collection, err := FormatGeoGridFeatures(response.Aggregations["grid"], GeoGridAsCentroid())
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, ok := collection.Features[0].Geometry.(Point)
+		if !ok || p.Lon != 90 || math.Abs(p.Lat+geotileMaxLat/2) > 1e-9 {
+			t.Errorf("期望瓦片中心点, 实际得到 %+v", collection.Features[0].Geometry)
+		}
+	})
+
+	t.Run("geohex使用子聚合", func(t *testing.T) {
+		response := decodeTestAggregations(t, `{"aggregations":{"geohex_grid#grid":{"buckets":[
+			{"key":"811fbffffffffff","doc_count":2,
+			 "geo_centroid#center":{"count":2,"location":{"lat":1.5,"lon":2.5}},
+			 "geo_bounds#bounds":{"bounds":{"top_left":{"lat":2,"lon":2},"bottom_right":{"lat":1,"lon":3}}}}
+		]}}}`)
+		collection, err := FormatGeoGridFeatures(response.Aggregations["grid"], GeoGridCentroidAgg("center"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p := collection.Features[0].Geometry; p != (Point{Lat: 1.5, Lon: 2.5}) {
+			t.Errorf("期望使用geo_centroid子聚合, 实际得到 %+v", p)
+		}
+		collection, err = FormatGeoGridFeatures(response.Aggregations["grid"], GeoGridBoundsAgg("bounds"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := collection.Features[0].Geometry.WKT(); got != "POLYGON ((2 1, 3 1, 3 2, 2 2, 2 1))" {
+			t.Errorf("期望使用geo_bounds子聚合, 实际得到 %s", got)
+		}
+		if _, err := FormatGeoGridFeatures(response.Aggregations["grid"]); !errors.Is(err, ErrInvalidGridKey) {
+			t.Errorf("期望缺少子聚合时返回ErrInvalidGridKey, 实际得到: %v", err)
+		}
+	})
+	t.Run("keyed桶按key排序", func(t *testing.T) {
+		response := decodeTestAggregations(t, `{"aggregations":{"geohash_grid#grid":{"buckets":{
+			"u":{"doc_count":1},"9":{"doc_count":2},"s":{"doc_count":3},"d":{"doc_count":4},"e":{"doc_count":5}
+		}}}}`)
+		for i := 0; i < 10; i++ {
+			collection, err := FormatGeoGridFeatures(response.Aggregations["grid"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			var keys []string
+			for _, feature := range collection.Features {
+				keys = append(keys, feature.ID.(string))
+			}
+			if got := strings.Join(keys, ","); got != "9,d,e,s,u" {
+				t.Fatalf("期望按key排序, 实际得到 %s", got)
+			}
+		}
+	})
+}
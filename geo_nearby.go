@@ -0,0 +1,157 @@
+package esb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/distanceunit"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/geodistancetype"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
+)
+
+var (
+	// ErrMissingSortDistance 命中的 sort 中没有距离排序值
+	ErrMissingSortDistance = errors.New("missing geo distance sort value")
+)
+
+// NearbyBuilder 组合“距离范围内”过滤、按距离升序排序以及带距离的结果解析，
+// 保证过滤与排序使用相同的字段、中心点和 distance_type。
+type NearbyBuilder struct {
+	field        string
+	center       Point
+	distance     string
+	unit         distanceunit.DistanceUnit
+	distanceType *geodistancetype.GeoDistanceType
+}
+
+// NearbyDocument 表示带有距离的命中文档。
+type NearbyDocument[T any] struct {
+	// Source 命中文档的 _source
+	Source T
+	// Distance 与中心点的距离，单位为 NearbyBuilder.Unit 设置的单位，默认为米；文档缺少坐标时为 +Inf
+	Distance float64
+	// Unit Distance 的单位
+	Unit distanceunit.DistanceUnit
+	// Hit 原始命中
+	Hit types.Hit
+}
+
+// Nearby 创建一个附近搜索构建器，distance 为过滤半径，例如 "5km"。
+//
+// 示例：
+//   nearby := esb.Nearby("location", esb.Point{Lat: 40.7128, Lon: -74.0060}, "5km").Unit(distanceunit.Kilometers)
+//   response, err := client.Search().Index("restaurants").
+//       Query(esb.NewQuery(esb.Bool(esb.Must(esb.Match("type", "restaurant")), esb.Filter(nearby.Filter())))).
+//       Sort(nearby.Sort()).
+//       Do(ctx)
+//   docs, err := esb.FormatNearby[Restaurant](response.Hits, nearby, 0)
+func Nearby(field string, center Point, distance string) *NearbyBuilder {
+	return &NearbyBuilder{
+		field:    field,
+		center:   center,
+		distance: distance,
+		unit:     distanceunit.Meters,
+	}
+}
+
+// Unit 设置排序值（即解析出的距离）的单位，默认为米。
+func (b *NearbyBuilder) Unit(unit distanceunit.DistanceUnit) *NearbyBuilder {
+	b.unit = unit
+	return b
+}
+
+// DistanceType 设置距离的计算方式，同时作用于过滤和排序。plane 更快，但在远距离和两极附近不准确。
+func (b *NearbyBuilder) DistanceType(distanceType geodistancetype.GeoDistanceType) *NearbyBuilder {
+	b.distanceType = &distanceType
+	return b
+}
+
+// Filter 返回距离范围内的 geo_distance 查询。
+func (b *NearbyBuilder) Filter() QueryOption {
+	return func(q *types.Query) {
+		query := types.NewGeoDistanceQuery()
+		query.Distance = b.distance
+		query.DistanceType = b.distanceType
+		query.GeoDistanceQuery[b.field] = b.center.GeoLocation()
+		q.GeoDistance = query
+	}
+}
+
+// Sort 返回按距离升序的 _geo_distance 排序，排序值即为距离。
+func (b *NearbyBuilder) Sort() *types.SortOptions {
+	return SortGeoDistanceWithOptions(b.field, b.center.Lat, b.center.Lon, sortorder.Asc, func(opts *types.GeoDistanceSort) {
+		unit := b.unit
+		opts.Unit = &unit
+		opts.DistanceType = b.distanceType
+	})
+}
+
+// FormatNearby 解析使用 NearbyBuilder.Sort 排序的搜索结果，sortIndex 为距离排序在 sort 中的位置。
+// 距离从每个命中的 sort 值中读取，因此不需要在客户端重新计算。
+//
+// 示例：
+//   docs, err := esb.FormatNearby[Restaurant](response.Hits, nearby, 0)
+//   for _, doc := range docs {
+//       fmt.Printf("%s %.1f%s\n", doc.Source.Name, doc.Distance, doc.Unit)
+//   }
+func FormatNearby[T any](response types.HitsMetadata, nearby *NearbyBuilder, sortIndex int) ([]NearbyDocument[T], error) {
+	docs := make([]NearbyDocument[T], 0, len(response.Hits))
+	for _, hit := range response.Hits {
+		doc := NearbyDocument[T]{Unit: nearby.unit, Hit: hit}
+		if sortIndex < 0 || sortIndex >= len(hit.Sort) {
+			return nil, fmt.Errorf("%w: hit %s has %d sort values", ErrMissingSortDistance, hitID(hit), len(hit.Sort))
+		}
+		distance, err := sortDistance(hit.Sort[sortIndex])
+		if err != nil {
+			return nil, fmt.Errorf("hit %s: %w", hitID(hit), err)
+		}
+		doc.Distance = distance
+		if len(hit.Source_) > 0 {
+			if err := json.Unmarshal(hit.Source_, &doc.Source); err != nil {
+				return nil, err
+			}
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// Meters 将距离转换为米。
+func (d NearbyDocument[T]) Meters() float64 {
+	meters, err := ParseDistance("1" + d.Unit.String())
+	if err != nil {
+		return d.Distance
+	}
+	return d.Distance * meters
+}
+
+// sortDistance 解析 sort 中的距离，缺少坐标的文档排序值为 Infinity。
+func sortDistance(value types.FieldValue) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case json.Number:
+		return v.Float64()
+	case string:
+		if v == "Infinity" {
+			return math.Inf(1), nil
+		}
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f, nil
+		}
+	case int64:
+		return float64(v), nil
+	}
+	return 0, fmt.Errorf("%w: unexpected sort value %v", ErrMissingSortDistance, value)
+}
+
+func hitID(hit types.Hit) string {
+	if hit.Id_ == nil {
+		return ""
+	}
+	return *hit.Id_
+}
@@ -0,0 +1,61 @@
+package esb
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/distanceunit"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/geodistancetype"
+)
+
+type nearbyShop struct {
+	Name string `json:"name"`
+}
+
+func TestNearby(t *testing.T) {
+	nearby := Nearby("location", Point{Lat: 40, Lon: -70}, "5km").
+		Unit(distanceunit.Kilometers).
+		DistanceType(geodistancetype.Plane)
+
+	t.Run("过滤", func(t *testing.T) {
+		want := `{"geo_distance":{"distance":"5km","distance_type":"plane","location":{"lat":40,"lon":-70}}}`
+		if got := mustJSON(t, NewQuery(nearby.Filter())); got != want {
+			t.Errorf("期望 %s, 实际得到 %s", want, got)
+		}
+	})
+
+	t.Run("排序", func(t *testing.T) {
+		data, err := json.Marshal(nearby.Sort())
+		want := `{"_geo_distance":{"distance_type":"plane","location":[{"lat":40,"lon":-70}],"order":"asc","unit":"km"}}`
+		if err != nil || string(data) != want {
+			t.Errorf("期望 %s, 实际得到 %s, %v", want, data, err)
+		}
+	})
+
+	t.Run("解析距离", func(t *testing.T) {
+		var response search.Response
+		err := json.Unmarshal([]byte(`{"hits":{"hits":[
+			{"_id":"1","_source":{"name":"a"},"sort":[1.25]},
+			{"_id":"2","_source":{"name":"b"},"sort":["Infinity"]}
+		]}}`), &response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs, err := FormatNearby[nearbyShop](response.Hits, nearby, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(docs) != 2 || docs[0].Source.Name != "a" || docs[0].Distance != 1.25 || docs[0].Meters() != 1250 {
+			t.Errorf("期望第一条距离为1.25km, 实际得到 %+v", docs)
+		}
+		if !math.IsInf(docs[1].Distance, 1) {
+			t.Errorf("期望缺少坐标时距离为+Inf, 实际得到 %v", docs[1].Distance)
+		}
+		if _, err := FormatNearby[nearbyShop](response.Hits, nearby, 1); !errors.Is(err, ErrMissingSortDistance) {
+			t.Errorf("期望ErrMissingSortDistance, 实际得到: %v", err)
+		}
+	})
+}
@@ -0,0 +1,287 @@
+package esb
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// GeoFeature 表示 GeoJSON 中的 Feature。
+type GeoFeature struct {
+	ID         any
+	Geometry   Geometry
+	Properties map[string]any
+}
+
+// GeoFeatureCollection 表示 GeoJSON 中的 FeatureCollection。
+type GeoFeatureCollection struct {
+	Features []GeoFeature
+}
+
+// MarshalJSON 输出 GeoJSON Feature，没有 ID 时省略 id。
+func (f GeoFeature) MarshalJSON() ([]byte, error) {
+	properties := f.Properties
+	if properties == nil {
+		properties = map[string]any{}
+	}
+	return json.Marshal(struct {
+		Type       string         `json:"type"`
+		ID         any            `json:"id,omitempty"`
+		Geometry   Geometry       `json:"geometry"`
+		Properties map[string]any `json:"properties"`
+	}{"Feature", f.ID, f.Geometry, properties})
+}
+
+// MarshalJSON 输出 GeoJSON FeatureCollection。
+func (c GeoFeatureCollection) MarshalJSON() ([]byte, error) {
+	features := c.Features
+	if features == nil {
+		features = []GeoFeature{}
+	}
+	return json.Marshal(struct {
+		Type     string       `json:"type"`
+		Features []GeoFeature `json:"features"`
+	}{"FeatureCollection", features})
+}
+
+// UnmarshalJSON 解析 GeoJSON Feature。
+func (f *GeoFeature) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Type       string          `json:"type"`
+		ID         any             `json:"id"`
+		Geometry   json.RawMessage `json:"geometry"`
+		Properties map[string]any  `json:"properties"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw.Type != "Feature" {
+		return fmt.Errorf("%w: expected Feature, got %q", ErrInvalidGeometry, raw.Type)
+	}
+	geometry, err := ParseGeoJSON(raw.Geometry)
+	if err != nil {
+		return err
+	}
+	*f = GeoFeature{ID: raw.ID, Geometry: geometry, Properties: raw.Properties}
+	return nil
+}
+
+// UnmarshalJSON 解析 GeoJSON FeatureCollection。
+func (c *GeoFeatureCollection) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Type     string       `json:"type"`
+		Features []GeoFeature `json:"features"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw.Type != "FeatureCollection" {
+		return fmt.Errorf("%w: expected FeatureCollection, got %q", ErrInvalidGeometry, raw.Type)
+	}
+	c.Features = raw.Features
+	return nil
+}
+
+// ParseGeoJSON 解析 GeoJSON 几何对象或 Feature，支持 Point、LineString、Polygon、MultiPolygon
+// 以及 Elasticsearch 扩展的 envelope、circle。按 RFC 7946 的建议，方向不符合右手规则的环会被自动调整，
+// 未闭合的环等其他问题由 Validate 报告。
+//
+// 示例：
+//   shape, err := esb.ParseGeoJSON([]byte(`{"type":"Point","coordinates":[-74.006,40.7128]}`))
+//   query := esb.NewQuery(esb.GeoShapeOf("location", shape))
+func ParseGeoJSON(data []byte) (Geometry, error) {
+	var raw struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+		Radius      json.RawMessage `json:"radius"`
+		Geometry    json.RawMessage `json:"geometry"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidGeometry, err)
+	}
+	if raw.Type == "Feature" {
+		return ParseGeoJSON(raw.Geometry)
+	}
+	var geometry Geometry
+	var err error
+	switch strings.ToLower(raw.Type) {
+	case "point":
+		var p Point
+		p, err = decodeGeoJSONPoint(raw.Coordinates)
+		geometry = p
+	case "linestring":
+		var points []Point
+		points, err = decodeGeoJSONPoints(raw.Coordinates)
+		geometry = LineString(points)
+	case "polygon":
+		var polygon Polygon
+		polygon, err = decodeGeoJSONPolygon(raw.Coordinates)
+		geometry = orientPolygon(polygon)
+	case "multipolygon":
+		var polygons []json.RawMessage
+		if err = json.Unmarshal(raw.Coordinates, &polygons); err == nil {
+			multi := make(MultiPolygon, 0, len(polygons))
+			for _, data := range polygons {
+				var polygon Polygon
+				if polygon, err = decodeGeoJSONPolygon(data); err != nil {
+					break
+				}
+				multi = append(multi, orientPolygon(polygon))
+			}
+			geometry = multi
+		}
+	case "envelope":
+		var points []Point
+		if points, err = decodeGeoJSONPoints(raw.Coordinates); err == nil {
+			if len(points) != 2 {
+				return nil, fmt.Errorf("%w: envelope needs 2 points, got %d", ErrInvalidGeometry, len(points))
+			}
+			geometry = Envelope{TopLeft: points[0], BottomRight: points[1]}
+		}
+	case "circle":
+		var center Point
+		if center, err = decodeGeoJSONPoint(raw.Coordinates); err == nil {
+			var radius float64
+			radius, err = parseCircleRadius(raw.Radius)
+			geometry = Circle{Center: center, Radius: radius}
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported type %q", ErrInvalidGeometry, raw.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidGeometry, raw.Type, err)
+	}
+	if err := geometry.Validate(); err != nil {
+		return nil, err
+	}
+	return geometry, nil
+}
+
+// LoadGeoJSON 从文件读取一个 GeoJSON 几何对象或 Feature。
+//
+// 示例：
+//   area, err := esb.LoadGeoJSON("testdata/delivery_area.geojson")
+func LoadGeoJSON(path string) (Geometry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGeoJSON(data)
+}
+
+// LoadGeoJSONFeatures 从文件读取 GeoJSON FeatureCollection，文件中只有一个 Feature 或几何对象时返回一个元素。
+//
+// 示例：
+//   features, err := esb.LoadGeoJSONFeatures("districts.geojson")
+//   for _, f := range features {
+//       queries = append(queries, esb.GeoShapeOf("location", f.Geometry))
+//   }
+func LoadGeoJSONFeatures(path string) ([]GeoFeature, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidGeometry, err)
+	}
+	switch head.Type {
+	case "FeatureCollection":
+		var collection GeoFeatureCollection
+		if err := json.Unmarshal(data, &collection); err != nil {
+			return nil, err
+		}
+		return collection.Features, nil
+	case "Feature":
+		var feature GeoFeature
+		if err := json.Unmarshal(data, &feature); err != nil {
+			return nil, err
+		}
+		return []GeoFeature{feature}, nil
+	}
+	geometry, err := ParseGeoJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	return []GeoFeature{{Geometry: geometry}}, nil
+}
+
+func decodeGeoJSONPoint(data json.RawMessage) (Point, error) {
+	var coordinates []float64
+	if err := json.Unmarshal(data, &coordinates); err != nil {
+		return Point{}, err
+	}
+	if len(coordinates) < 2 {
+		return Point{}, fmt.Errorf("position needs 2 coordinates, got %d", len(coordinates))
+	}
+	return Point{Lat: coordinates[1], Lon: coordinates[0]}, nil
+}
+
+func decodeGeoJSONPoints(data json.RawMessage) ([]Point, error) {
+	var positions []json.RawMessage
+	if err := json.Unmarshal(data, &positions); err != nil {
+		return nil, err
+	}
+	points := make([]Point, 0, len(positions))
+	for _, position := range positions {
+		p, err := decodeGeoJSONPoint(position)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+func decodeGeoJSONPolygon(data json.RawMessage) (Polygon, error) {
+	var rings []json.RawMessage
+	if err := json.Unmarshal(data, &rings); err != nil {
+		return Polygon{}, err
+	}
+	if len(rings) == 0 {
+		return Polygon{}, fmt.Errorf("polygon needs a shell")
+	}
+	var polygon Polygon
+	for i, ring := range rings {
+		points, err := decodeGeoJSONPoints(ring)
+		if err != nil {
+			return Polygon{}, err
+		}
+		if i == 0 {
+			polygon.Shell = points
+		} else {
+			polygon.Holes = append(polygon.Holes, points)
+		}
+	}
+	return polygon, nil
+}
+
+// orientPolygon 只调整已闭合的环的方向，未闭合的环保持原样交给 Validate 报告。
+func orientPolygon(polygon Polygon) Polygon {
+	rings := append([][]Point{polygon.Shell}, polygon.Holes...)
+	for _, ring := range rings {
+		if len(ring) == 0 || ring[0] != ring[len(ring)-1] {
+			return polygon
+		}
+	}
+	return polygon.Normalize()
+}
+
+// parseCircleRadius 解析 circle 的 radius，支持数字（米）以及 "100m"、"1.5km" 形式的字符串。
+func parseCircleRadius(data json.RawMessage) (float64, error) {
+	if len(data) == 0 {
+		return 0, fmt.Errorf("missing radius")
+	}
+	var radius float64
+	if err := json.Unmarshal(data, &radius); err == nil {
+		return radius, nil
+	}
+	var distance string
+	if err := json.Unmarshal(data, &distance); err != nil {
+		return 0, err
+	}
+	return ParseDistance(distance)
+}
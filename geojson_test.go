@@ -0,0 +1,107 @@
+package esb
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseGeoJSON(t *testing.T) {
+	t.Run("往返", func(t *testing.T) {
+		for _, geometry := range []Geometry{
+			Point{Lat: 1, Lon: 2},
+			LineString{{Lat: 1, Lon: 2}, {Lat: 3, Lon: 4}},
+			Polygon{Shell: testShell, Holes: [][]Point{testHole}},
+			MultiPolygon{{Shell: testShell}},
+			Envelope{TopLeft: Point{Lat: 10, Lon: -5}, BottomRight: Point{Lat: -10, Lon: 5}},
+			Circle{Center: Point{Lat: 1, Lon: 2}, Radius: 1500},
+		} {
+			data, _ := json.Marshal(geometry)
+			parsed, err := ParseGeoJSON(data)
+			if err != nil {
+				t.Fatalf("%s: %v", data, err)
+			}
+			again, _ := json.Marshal(parsed)
+			if string(again) != string(data) {
+				t.Errorf("期望 %s, 实际得到 %s", data, again)
+			}
+		}
+	})
+
+	t.Run("自动调整方向", func(t *testing.T) {
+		geometry, err := ParseGeoJSON([]byte(`{"type":"Polygon","coordinates":[[[0,0],[0,10],[10,10],[10,0],[0,0]]]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := geometry.Validate(); err != nil {
+			t.Errorf("期望外环调整为逆时针, 实际得到: %v", err)
+		}
+	})
+
+	t.Run("圆的半径带单位", func(t *testing.T) {
+		geometry, err := ParseGeoJSON([]byte(`{"type":"circle","coordinates":[2,1],"radius":"1.5km"}`))
+		if err != nil || geometry.(Circle).Radius != 1500 {
+			t.Errorf("期望半径为1500米, 实际得到: %v, %v", geometry, err)
+		}
+	})
+
+	t.Run("非法输入", func(t *testing.T) {
+		for _, input := range []string{
+			`{"type":"Point","coordinates":[1]}`,
+			`{"type":"Point","coordinates":[0,100]}`,
+			`{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,10],[0,10]]]}`,
+			`{"type":"GeometryCollection","geometries":[]}`,
+			`not json`,
+		} {
+			if _, err := ParseGeoJSON([]byte(input)); !errors.Is(err, ErrInvalidGeometry) {
+				t.Errorf("%s: 期望ErrInvalidGeometry, 实际得到: %v", input, err)
+			}
+		}
+	})
+}
+
+func TestLoadGeoJSON(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Run("读取Feature", func(t *testing.T) {
+		path := write("area.geojson", `{"type":"Feature","properties":{"name":"a"},"geometry":{"type":"Point","coordinates":[13,53]}}`)
+		geometry, err := LoadGeoJSON(path)
+		if err != nil || geometry != (Point{Lat: 53, Lon: 13}) {
+			t.Errorf("期望读取到点, 实际得到: %v, %v", geometry, err)
+		}
+	})
+
+	t.Run("读取FeatureCollection", func(t *testing.T) {
+		path := write("districts.geojson", `{"type":"FeatureCollection","features":[
+			{"type":"Feature","id":1,"properties":{"name":"a"},"geometry":{"type":"Point","coordinates":[13,53]}},
+			{"type":"Feature","properties":{"name":"b"},"geometry":{"type":"LineString","coordinates":[[0,0],[1,1]]}}
+		]}`)
+		features, err := LoadGeoJSONFeatures(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(features) != 2 || features[0].Properties["name"] != "a" || features[1].Geometry.GeoJSONType() != "LineString" {
+			t.Errorf("期望读取到2个Feature, 实际得到: %+v", features)
+		}
+		data, _ := json.Marshal(GeoFeatureCollection{Features: features[:1]})
+		want := `{"type":"FeatureCollection","features":[{"type":"Feature","id":1,"geometry":{"type":"Point","coordinates":[13,53]},"properties":{"name":"a"}}]}`
+		if string(data) != want {
+			t.Errorf("期望 %s, 实际得到 %s", want, data)
+		}
+	})
+
+	t.Run("文件不存在", func(t *testing.T) {
+		if _, err := LoadGeoJSON(filepath.Join(dir, "missing.geojson")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("期望os.ErrNotExist, 实际得到: %v", err)
+		}
+	})
+}
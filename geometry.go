@@ -0,0 +1,469 @@
+package esb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+var (
+	// ErrInvalidGeometry 几何形状不合法，例如坐标越界、多边形的环未闭合或方向错误
+	ErrInvalidGeometry = errors.New("invalid geometry")
+)
+
+// earthRadius 是 Elasticsearch 计算距离时使用的地球平均半径，单位为米。
+const earthRadius = 6371008.7714
+
+// Geometry 表示可用于 GeoShapeOf、ShapeOf 等查询的几何形状。
+// 所有实现都可以序列化为 GeoJSON（json.Marshal）或 WKT，坐标顺序由实现负责转换，调用方始终使用纬度、经度。
+type Geometry interface {
+	// GeoJSONType 返回 GeoJSON 中的 type，Envelope、Circle 为 Elasticsearch 的扩展类型
+	GeoJSONType() string
+	// WKT 返回 Well-Known Text 表示
+	WKT() string
+	// Validate 检查坐标范围、闭合与方向等约束
+	Validate() error
+	json.Marshaler
+}
+
+// Point 表示一个地理点。
+//
+// 示例：
+//   esb.Point{Lat: 40.7128, Lon: -74.0060}
+type Point struct {
+	Lat float64
+	Lon float64
+}
+
+// LineString 表示由至少两个点组成的折线。
+type LineString []Point
+
+// Polygon 表示带洞的多边形。Shell 为外环，Holes 为内环，每个环首尾相同。
+// 按 GeoJSON（RFC 7946）的约定，外环为逆时针，内环为顺时针，可以使用 Normalize 自动闭合并调整方向。
+//
+// 示例：
+//   esb.Polygon{
+//       Shell: []esb.Point{{Lat: 0, Lon: 0}, {Lat: 0, Lon: 10}, {Lat: 10, Lon: 10}, {Lat: 10, Lon: 0}, {Lat: 0, Lon: 0}},
+//   }
+type Polygon struct {
+	Shell []Point
+	Holes [][]Point
+}
+
+// MultiPolygon 表示多个多边形。
+type MultiPolygon []Polygon
+
+// Envelope 表示由左上角和右下角确定的矩形，对应 Elasticsearch 的 envelope 类型和 BBOX。
+type Envelope struct {
+	TopLeft     Point
+	BottomRight Point
+}
+
+// Circle 表示以 Center 为圆心、Radius 米为半径的圆，对应 Elasticsearch 的 circle 类型。
+// geo_shape 查询不支持圆，可以使用 GeoDistanceOf 查询，或使用 Polygon 转换为近似多边形。
+type Circle struct {
+	Center Point
+	Radius float64
+}
+
+// Validate 检查纬度在 [-90, 90]、经度在 [-180, 180] 之间。
+func (p Point) Validate() error {
+	if math.IsNaN(p.Lat) || p.Lat < -90 || p.Lat > 90 {
+		return fmt.Errorf("%w: latitude %v out of range [-90, 90]", ErrInvalidGeometry, p.Lat)
+	}
+	if math.IsNaN(p.Lon) || p.Lon < -180 || p.Lon > 180 {
+		return fmt.Errorf("%w: longitude %v out of range [-180, 180]", ErrInvalidGeometry, p.Lon)
+	}
+	return nil
+}
+
+// GeoLocation 转换为 geo_point 查询、排序使用的坐标。
+func (p Point) GeoLocation() types.GeoLocation {
+	return types.LatLonGeoLocation{
+		Lat: types.Float64(p.Lat),
+		Lon: types.Float64(p.Lon),
+	}
+}
+
+// DistanceTo 使用 haversine 公式计算两点之间的球面距离，单位为米，与 Elasticsearch 的 arc 距离一致。
+func (p Point) DistanceTo(other Point) float64 {
+	lat1, lat2 := radians(p.Lat), radians(other.Lat)
+	dLat := lat2 - lat1
+	dLon := radians(other.Lon - p.Lon)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func (Point) GeoJSONType() string { return "Point" }
+
+func (p Point) WKT() string {
+	return "POINT (" + wktPoint(p) + ")"
+}
+
+func (p Point) MarshalJSON() ([]byte, error) {
+	return geoJSON(p.GeoJSONType(), jsonPoint(p)), nil
+}
+
+func (LineString) GeoJSONType() string { return "LineString" }
+
+// Validate 检查点的数量不少于两个且坐标合法。
+func (l LineString) Validate() error {
+	if len(l) < 2 {
+		return fmt.Errorf("%w: linestring needs at least 2 points, got %d", ErrInvalidGeometry, len(l))
+	}
+	return validatePoints(l)
+}
+
+func (l LineString) WKT() string {
+	return "LINESTRING " + wktPoints(l)
+}
+
+func (l LineString) MarshalJSON() ([]byte, error) {
+	return geoJSON(l.GeoJSONType(), jsonPoints(l)), nil
+}
+
+func (Polygon) GeoJSONType() string { return "Polygon" }
+
+// Validate 检查每个环至少有四个点、首尾闭合，外环为逆时针，内环为顺时针。
+func (p Polygon) Validate() error {
+	if err := validateRing(p.Shell, true); err != nil {
+		return fmt.Errorf("shell: %w", err)
+	}
+	for i, hole := range p.Holes {
+		if err := validateRing(hole, false); err != nil {
+			return fmt.Errorf("hole %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Normalize 返回闭合并调整方向后的多边形：外环逆时针，内环顺时针。不会修改原多边形。
+func (p Polygon) Normalize() Polygon {
+	normalized := Polygon{Shell: normalizeRing(p.Shell, true)}
+	for _, hole := range p.Holes {
+		normalized.Holes = append(normalized.Holes, normalizeRing(hole, false))
+	}
+	return normalized
+}
+
+func (p Polygon) WKT() string {
+	return "POLYGON " + p.wktRings()
+}
+
+func (p Polygon) wktRings() string {
+	rings := make([]string, 0, len(p.Holes)+1)
+	rings = append(rings, wktPoints(p.Shell))
+	for _, hole := range p.Holes {
+		rings = append(rings, wktPoints(hole))
+	}
+	return "(" + strings.Join(rings, ", ") + ")"
+}
+
+func (p Polygon) jsonRings() string {
+	rings := make([]string, 0, len(p.Holes)+1)
+	rings = append(rings, jsonPoints(p.Shell))
+	for _, hole := range p.Holes {
+		rings = append(rings, jsonPoints(hole))
+	}
+	return "[" + strings.Join(rings, ",") + "]"
+}
+
+func (p Polygon) MarshalJSON() ([]byte, error) {
+	return geoJSON(p.GeoJSONType(), p.jsonRings()), nil
+}
+
+func (MultiPolygon) GeoJSONType() string { return "MultiPolygon" }
+
+// Validate 检查至少包含一个多边形，且每个多边形都合法。
+func (m MultiPolygon) Validate() error {
+	if len(m) == 0 {
+		return fmt.Errorf("%w: multipolygon needs at least 1 polygon", ErrInvalidGeometry)
+	}
+	for i, polygon := range m {
+		if err := polygon.Validate(); err != nil {
+			return fmt.Errorf("polygon %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Normalize 对每个多边形调用 Polygon.Normalize。
+func (m MultiPolygon) Normalize() MultiPolygon {
+	normalized := make(MultiPolygon, 0, len(m))
+	for _, polygon := range m {
+		normalized = append(normalized, polygon.Normalize())
+	}
+	return normalized
+}
+
+func (m MultiPolygon) WKT() string {
+	polygons := make([]string, 0, len(m))
+	for _, polygon := range m {
+		polygons = append(polygons, polygon.wktRings())
+	}
+	return "MULTIPOLYGON (" + strings.Join(polygons, ", ") + ")"
+}
+
+func (m MultiPolygon) MarshalJSON() ([]byte, error) {
+	polygons := make([]string, 0, len(m))
+	for _, polygon := range m {
+		polygons = append(polygons, polygon.jsonRings())
+	}
+	return geoJSON(m.GeoJSONType(), "["+strings.Join(polygons, ",")+"]"), nil
+}
+
+func (Envelope) GeoJSONType() string { return "envelope" }
+
+// Validate 检查坐标合法且左上角的纬度不小于右下角。左上角经度大于右下角时表示跨越日期变更线。
+func (e Envelope) Validate() error {
+	if err := validatePoints([]Point{e.TopLeft, e.BottomRight}); err != nil {
+		return err
+	}
+	if e.TopLeft.Lat < e.BottomRight.Lat {
+		return fmt.Errorf("%w: envelope top %v is below bottom %v", ErrInvalidGeometry, e.TopLeft.Lat, e.BottomRight.Lat)
+	}
+	return nil
+}
+
+// Center 返回矩形的中心点，跨越日期变更线时经度按东向计算。
+func (e Envelope) Center() Point {
+	right := e.BottomRight.Lon
+	if e.TopLeft.Lon > right {
+		right += 360
+	}
+	return Point{
+		Lat: (e.TopLeft.Lat + e.BottomRight.Lat) / 2,
+		Lon: normalizeLon((e.TopLeft.Lon + right) / 2),
+	}
+}
+
+// Polygon 将矩形转换为逆时针的多边形，跨越日期变更线时不适用。
+func (e Envelope) Polygon() Polygon {
+	top, left, bottom, right := e.TopLeft.Lat, e.TopLeft.Lon, e.BottomRight.Lat, e.BottomRight.Lon
+	return Polygon{Shell: []Point{
+		{Lat: bottom, Lon: left},
+		{Lat: bottom, Lon: right},
+		{Lat: top, Lon: right},
+		{Lat: top, Lon: left},
+		{Lat: bottom, Lon: left},
+	}}
+}
+
+// WKT 返回 BBOX (minLon, maxLon, maxLat, minLat)。
+func (e Envelope) WKT() string {
+	return "BBOX (" + strings.Join([]string{
+		formatCoordinate(e.TopLeft.Lon),
+		formatCoordinate(e.BottomRight.Lon),
+		formatCoordinate(e.TopLeft.Lat),
+		formatCoordinate(e.BottomRight.Lat),
+	}, ", ") + ")"
+}
+
+func (e Envelope) MarshalJSON() ([]byte, error) {
+	return geoJSON(e.GeoJSONType(), jsonPoints([]Point{e.TopLeft, e.BottomRight})), nil
+}
+
+func (Circle) GeoJSONType() string { return "circle" }
+
+// Validate 检查圆心合法且半径为正数。
+func (c Circle) Validate() error {
+	if err := c.Center.Validate(); err != nil {
+		return err
+	}
+	if math.IsNaN(c.Radius) || c.Radius <= 0 {
+		return fmt.Errorf("%w: circle radius must be positive, got %v", ErrInvalidGeometry, c.Radius)
+	}
+	return nil
+}
+
+// Distance 返回 geo_distance 查询使用的距离字符串，例如 "1500m"。
+func (c Circle) Distance() string {
+	return formatCoordinate(c.Radius) + "m"
+}
+
+// Polygon 将圆转换为 segments 条边的近似多边形（逆时针），segments 小于 3 时使用 64。
+//
+// 示例：
+//   esb.GeoShapeOf("area", esb.Circle{Center: center, Radius: 1000}.Polygon(32))
+func (c Circle) Polygon(segments int) Polygon {
+	if segments < 3 {
+		segments = 64
+	}
+	lat, lon := radians(c.Center.Lat), radians(c.Center.Lon)
+	angular := c.Radius / earthRadius
+	shell := make([]Point, 0, segments+1)
+	for i := 0; i < segments; i++ {
+		// 方位角顺时针递增，取负数得到逆时针的外环
+		bearing := -2 * math.Pi * float64(i) / float64(segments)
+		pLat := math.Asin(math.Sin(lat)*math.Cos(angular) + math.Cos(lat)*math.Sin(angular)*math.Cos(bearing))
+		pLon := lon + math.Atan2(math.Sin(bearing)*math.Sin(angular)*math.Cos(lat), math.Cos(angular)-math.Sin(lat)*math.Sin(pLat))
+		shell = append(shell, Point{Lat: degrees(pLat), Lon: normalizeLon(degrees(pLon))})
+	}
+	return Polygon{Shell: append(shell, shell[0])}
+}
+
+// WKT 返回 Elasticsearch 支持的 CIRCLE (lon lat radius)，半径单位为米。
+func (c Circle) WKT() string {
+	return "CIRCLE (" + wktPoint(c.Center) + " " + formatCoordinate(c.Radius) + ")"
+}
+
+func (c Circle) MarshalJSON() ([]byte, error) {
+	return []byte(`{"type":"circle","coordinates":` + jsonPoint(c.Center) + `,"radius":"` + c.Distance() + `"}`), nil
+}
+
+// distanceUnits 是 Elasticsearch 距离单位对应的米数，按后缀长度从长到短匹配。
+var distanceUnits = []struct {
+	suffix string
+	meters float64
+}{
+	{"nauticalmiles", 1852},
+	{"kilometers", 1000},
+	{"millimeters", 0.001},
+	{"centimeters", 0.01},
+	{"meters", 1},
+	{"miles", 1609.344},
+	{"yards", 0.9144},
+	{"inch", 0.0254},
+	{"feet", 0.3048},
+	{"km", 1000},
+	{"mm", 0.001},
+	{"cm", 0.01},
+	{"nmi", 1852},
+	{"mi", 1609.344},
+	{"yd", 0.9144},
+	{"ft", 0.3048},
+	{"in", 0.0254},
+	{"NM", 1852},
+	{"m", 1},
+}
+
+// ParseDistance 将 Elasticsearch 的距离字符串（例如 "1.5km"、"200m"、"3mi"）转换为米，没有单位时按米处理。
+//
+// 示例：
+//   meters, err := esb.ParseDistance("1.5km") // 1500
+func ParseDistance(distance string) (float64, error) {
+	value := strings.TrimSpace(distance)
+	factor := 1.0
+	for _, unit := range distanceUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value, factor = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix)), unit.meters
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: distance %q", ErrInvalidGeometry, distance)
+	}
+	return n * factor, nil
+}
+
+func validatePoints(points []Point) error {
+	for i, point := range points {
+		if err := point.Validate(); err != nil {
+			return fmt.Errorf("point %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func validateRing(ring []Point, counterClockwise bool) error {
+	if len(ring) < 4 {
+		return fmt.Errorf("%w: ring needs at least 4 points, got %d", ErrInvalidGeometry, len(ring))
+	}
+	if err := validatePoints(ring); err != nil {
+		return err
+	}
+	if ring[0] != ring[len(ring)-1] {
+		return fmt.Errorf("%w: ring is not closed", ErrInvalidGeometry)
+	}
+	area := signedArea(ring)
+	if area == 0 {
+		return fmt.Errorf("%w: ring has zero area", ErrInvalidGeometry)
+	}
+	if counterClockwise && area < 0 {
+		return fmt.Errorf("%w: ring must be counterclockwise", ErrInvalidGeometry)
+	}
+	if !counterClockwise && area > 0 {
+		return fmt.Errorf("%w: ring must be clockwise", ErrInvalidGeometry)
+	}
+	return nil
+}
+
+func normalizeRing(ring []Point, counterClockwise bool) []Point {
+	normalized := make([]Point, len(ring), len(ring)+1)
+	copy(normalized, ring)
+	if len(normalized) > 0 && normalized[0] != normalized[len(normalized)-1] {
+		normalized = append(normalized, normalized[0])
+	}
+	if area := signedArea(normalized); (counterClockwise && area < 0) || (!counterClockwise && area > 0) {
+		for i, j := 0, len(normalized)-1; i < j; i, j = i+1, j-1 {
+			normalized[i], normalized[j] = normalized[j], normalized[i]
+		}
+	}
+	return normalized
+}
+
+// signedArea 以经度为 x、纬度为 y 计算环的有向面积，逆时针为正。
+func signedArea(ring []Point) float64 {
+	var area float64
+	for i := 0; i+1 < len(ring); i++ {
+		area += ring[i].Lon*ring[i+1].Lat - ring[i+1].Lon*ring[i].Lat
+	}
+	return area / 2
+}
+
+func geoJSON(typ, coordinates string) []byte {
+	return []byte(`{"type":"` + typ + `","coordinates":` + coordinates + `}`)
+}
+
+// jsonPoint 按 GeoJSON 的约定输出 [经度, 纬度]。
+func jsonPoint(p Point) string {
+	return "[" + formatCoordinate(p.Lon) + "," + formatCoordinate(p.Lat) + "]"
+}
+
+func jsonPoints(points []Point) string {
+	parts := make([]string, 0, len(points))
+	for _, p := range points {
+		parts = append(parts, jsonPoint(p))
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+func wktPoint(p Point) string {
+	return formatCoordinate(p.Lon) + " " + formatCoordinate(p.Lat)
+}
+
+func wktPoints(points []Point) string {
+	parts := make([]string, 0, len(points))
+	for _, p := range points {
+		parts = append(parts, wktPoint(p))
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+func formatCoordinate(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func degrees(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+func normalizeLon(lon float64) float64 {
+	for lon > 180 {
+		lon -= 360
+	}
+	for lon < -180 {
+		lon += 360
+	}
+	return lon
+}
@@ -0,0 +1,192 @@
+package esb
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/geoshaperelation"
+)
+
+var (
+	testShell = []Point{{Lat: 0, Lon: 0}, {Lat: 0, Lon: 10}, {Lat: 10, Lon: 10}, {Lat: 10, Lon: 0}, {Lat: 0, Lon: 0}}
+	testHole  = []Point{{Lat: 2, Lon: 2}, {Lat: 8, Lon: 2}, {Lat: 8, Lon: 8}, {Lat: 2, Lon: 8}, {Lat: 2, Lon: 2}}
+)
+
+func TestGeometrySerialization(t *testing.T) {
+	tests := []struct {
+		name     string
+		geometry Geometry
+		geoJSON  string
+		wkt      string
+	}{
+		{
+			"点",
+			Point{Lat: 40.7128, Lon: -74.006},
+			`{"type":"Point","coordinates":[-74.006,40.7128]}`,
+			"POINT (-74.006 40.7128)",
+		},
+		{
+			"折线",
+			LineString{{Lat: 1, Lon: 2}, {Lat: 3, Lon: 4}},
+			`{"type":"LineString","coordinates":[[2,1],[4,3]]}`,
+			"LINESTRING (2 1, 4 3)",
+		},
+		{
+			"带洞的多边形",
+			Polygon{Shell: testShell, Holes: [][]Point{testHole}},
+			`{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,10],[0,10],[0,0]],[[2,2],[2,8],[8,8],[8,2],[2,2]]]}`,
+			"POLYGON ((0 0, 10 0, 10 10, 0 10, 0 0), (2 2, 2 8, 8 8, 8 2, 2 2))",
+		},
+		{
+			"多个多边形",
+			MultiPolygon{{Shell: testShell}},
+			`{"type":"MultiPolygon","coordinates":[[[[0,0],[10,0],[10,10],[0,10],[0,0]]]]}`,
+			"MULTIPOLYGON (((0 0, 10 0, 10 10, 0 10, 0 0)))",
+		},
+		{
+			"矩形",
+			Envelope{TopLeft: Point{Lat: 10, Lon: -5}, BottomRight: Point{Lat: -10, Lon: 5}},
+			`{"type":"envelope","coordinates":[[-5,10],[5,-10]]}`,
+			"BBOX (-5, 5, 10, -10)",
+		},
+		{
+			"圆",
+			Circle{Center: Point{Lat: 1, Lon: 2}, Radius: 1500},
+			`{"type":"circle","coordinates":[2,1],"radius":"1500m"}`,
+			"CIRCLE (2 1 1500)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.geometry)
+			if err != nil || string(data) != tt.geoJSON {
+				t.Errorf("期望 %s, 实际得到 %s, %v", tt.geoJSON, data, err)
+			}
+			if got := tt.geometry.WKT(); got != tt.wkt {
+				t.Errorf("期望 %s, 实际得到 %s", tt.wkt, got)
+			}
+			if err := tt.geometry.Validate(); err != nil {
+				t.Errorf("期望校验通过, 实际得到: %v", err)
+			}
+		})
+	}
+}
+
+func TestGeometryValidate(t *testing.T) {
+	clockwise := []Point{{Lat: 0, Lon: 0}, {Lat: 10, Lon: 0}, {Lat: 10, Lon: 10}, {Lat: 0, Lon: 10}, {Lat: 0, Lon: 0}}
+	tests := []struct {
+		name     string
+		geometry Geometry
+	}{
+		{"纬度越界", Point{Lat: 91, Lon: 0}},
+		{"经度越界", Point{Lat: 0, Lon: 181}},
+		{"NaN", Point{Lat: math.NaN(), Lon: 0}},
+		{"折线点数不足", LineString{{Lat: 0, Lon: 0}}},
+		{"环未闭合", Polygon{Shell: testShell[:4]}},
+		{"外环为顺时针", Polygon{Shell: clockwise}},
+		{"内环为逆时针", Polygon{Shell: testShell, Holes: [][]Point{testShell}}},
+		{"空的多个多边形", MultiPolygon{}},
+		{"矩形上下颠倒", Envelope{TopLeft: Point{Lat: -10}, BottomRight: Point{Lat: 10}}},
+		{"圆的半径为0", Circle{Center: Point{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.geometry.Validate(); !errors.Is(err, ErrInvalidGeometry) {
+				t.Errorf("期望ErrInvalidGeometry, 实际得到: %v", err)
+			}
+		})
+	}
+}
+
+func TestPolygonNormalize(t *testing.T) {
+	// 外环顺时针且未闭合，内环逆时针
+	polygon := Polygon{
+		Shell: []Point{{Lat: 0, Lon: 0}, {Lat: 10, Lon: 0}, {Lat: 10, Lon: 10}, {Lat: 0, Lon: 10}},
+		Holes: [][]Point{{{Lat: 2, Lon: 2}, {Lat: 2, Lon: 8}, {Lat: 8, Lon: 8}, {Lat: 8, Lon: 2}}},
+	}
+	normalized := polygon.Normalize()
+	if err := normalized.Validate(); err != nil {
+		t.Fatalf("期望调整后校验通过, 实际得到: %v", err)
+	}
+	if len(polygon.Shell) != 4 {
+		t.Errorf("期望不修改原多边形, 实际得到: %v", polygon.Shell)
+	}
+}
+
+func TestCirclePolygon(t *testing.T) {
+	circle := Circle{Center: Point{Lat: 40, Lon: -70}, Radius: 1000}
+	polygon := circle.Polygon(16)
+	if len(polygon.Shell) != 17 {
+		t.Fatalf("期望17个点, 实际得到: %d", len(polygon.Shell))
+	}
+	if err := polygon.Validate(); err != nil {
+		t.Fatalf("期望近似多边形校验通过, 实际得到: %v", err)
+	}
+	for _, p := range polygon.Shell {
+		if d := circle.Center.DistanceTo(p); math.Abs(d-1000) > 0.01 {
+			t.Errorf("期望每个点到圆心的距离为1000米, 实际得到: %f", d)
+		}
+	}
+}
+
+func TestParseDistance(t *testing.T) {
+	tests := map[string]float64{"1500": 1500, "200m": 200, "1.5km": 1500, "2mi": 3218.688, "1nmi": 1852, "3ft": 0.9144}
+	for input, want := range tests {
+		got, err := ParseDistance(input)
+		if err != nil || math.Abs(got-want) > 1e-9 {
+			t.Errorf("%s: 期望 %f, 实际得到 %f, %v", input, want, got, err)
+		}
+	}
+	if _, err := ParseDistance("far"); !errors.Is(err, ErrInvalidGeometry) {
+		t.Errorf("期望ErrInvalidGeometry, 实际得到: %v", err)
+	}
+}
+
+func TestGeometryQueries(t *testing.T) {
+	envelope := Envelope{TopLeft: Point{Lat: 40.73, Lon: -74.1}, BottomRight: Point{Lat: 40.01, Lon: -71.12}}
+	tests := []struct {
+		name  string
+		query QueryOption
+		want  string
+	}{
+		{
+			"geo_shape",
+			GeoShapeOf("location", Point{Lat: 53, Lon: 13}),
+			`{"geo_shape":{"location":{"shape":{"coordinates":[13,53],"type":"Point"}}}}`,
+		},
+		{
+			"geo_shape带relation",
+			GeoShapeOfWithRelation("area", Point{Lat: 53, Lon: 13}, geoshaperelation.Contains),
+			`{"geo_shape":{"area":{"relation":"contains","shape":{"coordinates":[13,53],"type":"Point"}}}}`,
+		},
+		{
+			"shape",
+			ShapeOfWithRelation("geometry", envelope, geoshaperelation.Within),
+			`{"shape":{"geometry":{"relation":"within","shape":{"coordinates":[[-74.1,40.73],[-71.12,40.01]],"type":"envelope"}}}}`,
+		},
+		{
+			"geo_bounding_box",
+			GeoBoundingBoxOf("location", envelope),
+			`{"geo_bounding_box":{"location":{"bottom_right":{"lat":40.01,"lon":-71.12},"top_left":{"lat":40.73,"lon":-74.1}}}}`,
+		},
+		{
+			"geo_distance",
+			GeoDistanceOf("location", Circle{Center: Point{Lat: 40, Lon: -70}, Radius: 200000}),
+			`{"geo_distance":{"distance":"200000m","location":{"lat":40,"lon":-70}}}`,
+		},
+		{
+			"geo_polygon使用外环",
+			GeoPolygonOf("location", Polygon{Shell: testShell[:3]}),
+			`{"geo_polygon":{"location":{"points":[{"lat":0,"lon":0},{"lat":0,"lon":10},{"lat":10,"lon":10}]}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mustJSON(t, NewQuery(tt.query)); got != tt.want {
+				t.Errorf("期望 %s, 实际得到 %s", tt.want, got)
+			}
+		})
+	}
+}
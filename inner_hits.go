@@ -0,0 +1,188 @@
+package esb
+
+import (
+	"encoding/json"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+// InnerHitsOption 表示一个修改 types.InnerHits 的函数。
+type InnerHitsOption func(*types.InnerHits)
+
+// InnerHits 创建 inner_hits 配置，可用于 Nested、HasChild、HasParent 的 WithOptions 回调以及字段折叠。
+//
+// 示例：
+//   esb.NestedWithOptions("comments", esb.Match("comments.text", "great"),
+//       func(opts *types.NestedQuery) {
+//           opts.InnerHits = esb.InnerHits(
+//               esb.InnerHitsName("top_comments"),
+//               esb.InnerHitsSize(3),
+//               esb.InnerHitsSort(esb.SortFieldDesc("comments.upvotes")),
+//               esb.InnerHitsSourceIncludes("comments.text", "comments.author"),
+//               esb.InnerHitsHighlightFields("comments.text"),
+//           )
+//       },
+//   )
+func InnerHits(opts ...InnerHitsOption) *types.InnerHits {
+	innerHits := &types.InnerHits{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(innerHits)
+		}
+	}
+	return innerHits
+}
+
+// InnerHitsName 设置 inner_hits 在响应中的名称，同一请求中存在多个 inner_hits 时用于区分。
+func InnerHitsName(name string) InnerHitsOption {
+	return func(i *types.InnerHits) {
+		i.Name = &name
+	}
+}
+
+// InnerHitsSize 设置每个文档返回的 inner hits 数量。
+func InnerHitsSize(size int) InnerHitsOption {
+	return func(i *types.InnerHits) {
+		i.Size = &size
+	}
+}
+
+// InnerHitsFrom 设置 inner hits 的起始偏移量。
+func InnerHitsFrom(from int) InnerHitsOption {
+	return func(i *types.InnerHits) {
+		i.From = &from
+	}
+}
+
+// InnerHitsSort 设置 inner hits 的排序，默认按评分排序。
+//
+// 示例：
+//   esb.InnerHitsSort(esb.SortFieldDesc("comments.upvotes"), esb.SortFieldAsc("comments.date"))
+func InnerHitsSort(sorts ...types.SortCombinations) InnerHitsOption {
+	return func(i *types.InnerHits) {
+		i.Sort = append(i.Sort, sorts...)
+	}
+}
+
+// InnerHitsSourceIncludes 设置 inner hits 返回的 _source 字段。
+func InnerHitsSourceIncludes(fields ...string) InnerHitsOption {
+	return func(i *types.InnerHits) {
+		filter := innerHitsSourceFilter(i)
+		filter.Includes = append(filter.Includes, fields...)
+		i.Source_ = filter
+	}
+}
+
+// InnerHitsSourceExcludes 设置 inner hits 不返回的 _source 字段。
+func InnerHitsSourceExcludes(fields ...string) InnerHitsOption {
+	return func(i *types.InnerHits) {
+		filter := innerHitsSourceFilter(i)
+		filter.Excludes = append(filter.Excludes, fields...)
+		i.Source_ = filter
+	}
+}
+
+// InnerHitsNoSource 不返回 inner hits 的 _source，通常配合 docvalue_fields 或只需要命中数量时使用。
+func InnerHitsNoSource() InnerHitsOption {
+	return func(i *types.InnerHits) {
+		i.Source_ = false
+	}
+}
+
+func innerHitsSourceFilter(i *types.InnerHits) types.SourceFilter {
+	if filter, ok := i.Source_.(types.SourceFilter); ok {
+		return filter
+	}
+	return types.SourceFilter{}
+}
+
+// InnerHitsHighlight 设置 inner hits 的高亮配置。
+func InnerHitsHighlight(highlight *types.Highlight) InnerHitsOption {
+	return func(i *types.InnerHits) {
+		i.Highlight = highlight
+	}
+}
+
+// InnerHitsHighlightFields 使用默认配置高亮指定字段。
+//
+// 示例：
+//   esb.InnerHitsHighlightFields("comments.text")
+func InnerHitsHighlightFields(fields ...string) InnerHitsOption {
+	return func(i *types.InnerHits) {
+		if i.Highlight == nil {
+			i.Highlight = &types.Highlight{}
+		}
+		if i.Highlight.Fields == nil {
+			i.Highlight.Fields = map[string]types.HighlightField{}
+		}
+		for _, field := range fields {
+			i.Highlight.Fields[field] = types.HighlightField{}
+		}
+	}
+}
+
+// InnerHitsDocument 表示一个带有 inner hits 的命中文档。
+type InnerHitsDocument[T any, C any] struct {
+	// Source 命中文档的 _source
+	Source T
+	// InnerHits 按 inner_hits 名称分组的内部命中，名称默认为 nested 的 path 或 join 的关系名称
+	InnerHits map[string][]C
+	// Hit 原始命中，可读取 _id、_score、highlight 等信息
+	Hit types.Hit
+}
+
+// FormatSearchWithInnerHits 解析带有 inner hits 的搜索结果，所有 inner hits 使用同一类型 C 解析。
+// 不同名称的 inner hits 类型不同时，使用 FormatInnerHits 逐个解析。没有 _source 的命中解析为零值。
+//
+// 示例：
+//   docs, err := esb.FormatSearchWithInnerHits[Post, Comment](response.Hits)
+//   for _, doc := range docs {
+//       comments := doc.InnerHits["top_comments"]
+//   }
+func FormatSearchWithInnerHits[T any, C any](response types.HitsMetadata) ([]InnerHitsDocument[T, C], error) {
+	docs := make([]InnerHitsDocument[T, C], 0, len(response.Hits))
+	for _, hit := range response.Hits {
+		doc := InnerHitsDocument[T, C]{
+			InnerHits: make(map[string][]C, len(hit.InnerHits)),
+			Hit:       hit,
+		}
+		if len(hit.Source_) > 0 {
+			if err := json.Unmarshal(hit.Source_, &doc.Source); err != nil {
+				return nil, err
+			}
+		}
+		for name := range hit.InnerHits {
+			innerHits, err := FormatInnerHits[C](hit, name)
+			if err != nil {
+				return nil, err
+			}
+			doc.InnerHits[name] = innerHits
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// FormatInnerHits 解析单个命中中指定名称的 inner hits，没有 _source 的内部命中解析为零值。
+//
+// 示例：
+//   for _, hit := range response.Hits.Hits {
+//       answers, err := esb.FormatInnerHits[Answer](hit, "answer")
+//   }
+func FormatInnerHits[C any](hit types.Hit, name string) ([]C, error) {
+	result, ok := hit.InnerHits[name]
+	if !ok {
+		return nil, nil
+	}
+	innerHits := make([]C, 0, len(result.Hits.Hits))
+	for _, innerHit := range result.Hits.Hits {
+		var v C
+		if len(innerHit.Source_) > 0 {
+			if err := json.Unmarshal(innerHit.Source_, &v); err != nil {
+				return nil, err
+			}
+		}
+		innerHits = append(innerHits, v)
+	}
+	return innerHits, nil
+}
@@ -0,0 +1,160 @@
+package esb
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+func TestInnerHits(t *testing.T) {
+	tests := []struct {
+		name      string
+		innerHits *types.InnerHits
+		want      string
+	}{
+		{
+			"空配置",
+			InnerHits(),
+			`{}`,
+		},
+		{
+			"名称与分页",
+			InnerHits(InnerHitsName("top_comments"), InnerHitsFrom(1), InnerHitsSize(3)),
+			`{"from":1,"name":"top_comments","size":3}`,
+		},
+		{
+			"排序",
+			InnerHits(InnerHitsSort(SortFieldDesc("comments.upvotes"), SortFieldAsc("comments.date"))),
+			`{"sort":[{"comments.upvotes":{"order":"desc"}},{"comments.date":{"order":"asc"}}]}`,
+		},
+		{
+			"source过滤",
+			InnerHits(InnerHitsSourceIncludes("comments.text"), InnerHitsSourceExcludes("comments.raw")),
+			`{"_source":{"excludes":["comments.raw"],"includes":["comments.text"]}}`,
+		},
+		{
+			"不返回source",
+			InnerHits(InnerHitsNoSource()),
+			`{"_source":false}`,
+		},
+		{
+			"高亮",
+			InnerHits(InnerHitsHighlightFields("comments.text")),
+			`{"highlight":{"fields":{"comments.text":{}}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.innerHits)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("期望 %s, 实际得到 %s", tt.want, data)
+			}
+		})
+	}
+
+	t.Run("用于Nested查询", func(t *testing.T) {
+		query := NewQuery(NestedWithOptions("comments", Match("comments.text", "great"), func(opts *types.NestedQuery) {
+			opts.InnerHits = InnerHits(InnerHitsSize(2))
+		}))
+		want := `{"nested":{"inner_hits":{"size":2},"path":"comments","query":{"match":{"comments.text":{"query":"great"}}}}}`
+		if got := mustJSON(t, query); got != want {
+			t.Errorf("期望 %s, 实际得到 %s", want, got)
+		}
+	})
+}
+
+type innerHitsPost struct {
+	Title string `json:"title"`
+}
+
+type innerHitsComment struct {
+	Author string `json:"author"`
+}
+
+const innerHitsResponse = `{
+	"hits": [
+		{
+			"_index": "posts", "_id": "1",
+			"_source": {"title": "Go generics"},
+			"inner_hits": {
+				"comments": {"hits": {"hits": [
+					{"_index": "posts", "_id": "1", "_nested": {"field": "comments", "offset": 0}, "_source": {"author": "alice"}},
+					{"_index": "posts", "_id": "1", "_nested": {"field": "comments", "offset": 2}, "_source": {"author": "bob"}}
+				]}},
+				"no_source": {"hits": {"hits": [
+					{"_index": "posts", "_id": "1", "_nested": {"field": "comments", "offset": 1}}
+				]}}
+			}
+		},
+		{
+			"_index": "posts", "_id": "2",
+			"_source": {"title": "Rust"},
+			"inner_hits": {"comments": {"hits": {"hits": []}}}
+		}
+	]
+}`
+
+func TestFormatSearchWithInnerHits(t *testing.T) {
+	var hits types.HitsMetadata
+	if err := json.Unmarshal([]byte(innerHitsResponse), &hits); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("解析父文档与inner hits", func(t *testing.T) {
+		docs, err := FormatSearchWithInnerHits[innerHitsPost, innerHitsComment](hits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(docs) != 2 {
+			t.Fatalf("期望2个文档, 实际得到: %d", len(docs))
+		}
+		if docs[0].Source.Title != "Go generics" || *docs[0].Hit.Id_ != "1" {
+			t.Errorf("期望第一个文档为Go generics, 实际得到: %+v", docs[0].Source)
+		}
+		comments := docs[0].InnerHits["comments"]
+		if len(comments) != 2 || comments[0].Author != "alice" || comments[1].Author != "bob" {
+			t.Errorf("期望评论为alice,bob, 实际得到: %+v", comments)
+		}
+		if got := docs[0].InnerHits["no_source"]; len(got) != 1 || got[0].Author != "" {
+			t.Errorf("期望没有_source的内部命中解析为零值, 实际得到: %+v", got)
+		}
+		if got, ok := docs[1].InnerHits["comments"]; !ok || len(got) != 0 {
+			t.Errorf("期望第二个文档的评论为空, 实际得到: %+v", got)
+		}
+	})
+
+	t.Run("按名称解析", func(t *testing.T) {
+		comments, err := FormatInnerHits[innerHitsComment](hits.Hits[0], "comments")
+		if err != nil || len(comments) != 2 {
+			t.Fatalf("期望2条评论, 实际得到: %+v, %v", comments, err)
+		}
+		missing, err := FormatInnerHits[innerHitsComment](hits.Hits[0], "missing")
+		if err != nil || missing != nil {
+			t.Errorf("期望不存在的名称返回nil, 实际得到: %+v, %v", missing, err)
+		}
+	})
+
+	t.Run("父文档没有_source", func(t *testing.T) {
+		var noSource types.HitsMetadata
+		if err := json.Unmarshal([]byte(`{"hits":[{"_index":"posts","_id":"3","inner_hits":{"comments":{"hits":{"hits":[{"_source":{"author":"carol"}}]}}}}]}`), &noSource); err != nil {
+			t.Fatal(err)
+		}
+		docs, err := FormatSearchWithInnerHits[innerHitsPost, innerHitsComment](noSource)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(docs) != 1 || docs[0].Source.Title != "" || len(docs[0].InnerHits["comments"]) != 1 {
+			t.Errorf("期望父文档解析为零值并保留inner hits, 实际得到: %+v", docs)
+		}
+	})
+
+	t.Run("类型不匹配返回错误", func(t *testing.T) {
+		if _, err := FormatSearchWithInnerHits[innerHitsPost, []string](hits); err == nil {
+			t.Error("期望解析inner hits失败时返回错误")
+		}
+	})
+}
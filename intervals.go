@@ -0,0 +1,352 @@
+package esb
+
+import (
+	"encoding/json"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+// IntervalsRule 表示一个 intervals 规则，例如 match、prefix、all_of。
+type IntervalsRule func(*types.Intervals)
+
+// IntervalsFilterOption 表示 intervals 规则的过滤条件，例如 containing、before。
+type IntervalsFilterOption func(*types.IntervalsFilter)
+
+// Intervals 创建 intervals 查询，按词项的顺序与距离匹配文档。
+//
+// 示例：
+//   esb.Intervals("content", esb.IntervalsAllOfWithOptions(
+//       []esb.IntervalsRule{
+//           esb.IntervalsMatch("my favorite food"),
+//           esb.IntervalsAnyOf(esb.IntervalsMatch("hot water"), esb.IntervalsMatch("cold porridge")),
+//       },
+//       func(opts *types.IntervalsAllOf) {
+//           ordered := true
+//           opts.Ordered = &ordered
+//       },
+//   ))
+func Intervals(field string, rule IntervalsRule) QueryOption {
+	return IntervalsWithOptions(field, rule, nil)
+}
+
+// IntervalsWithOptions 提供回调函数式的 Intervals 查询配置，可以设置 boost、_name。
+func IntervalsWithOptions(field string, rule IntervalsRule, setOpts func(opts *types.IntervalsQuery)) QueryOption {
+	return func(q *types.Query) {
+		intervals := buildIntervals(rule)
+		intervalsQuery := types.IntervalsQuery{
+			AllOf:    intervals.AllOf,
+			AnyOf:    intervals.AnyOf,
+			Fuzzy:    intervals.Fuzzy,
+			Match:    intervals.Match,
+			Prefix:   intervals.Prefix,
+			Range:    intervals.Range,
+			Regexp:   intervals.Regexp,
+			Wildcard: intervals.Wildcard,
+		}
+		if setOpts != nil {
+			setOpts(&intervalsQuery)
+		}
+		q.Intervals = map[string]types.IntervalsQuery{
+			field: intervalsQuery,
+		}
+	}
+}
+
+func buildIntervals(rule IntervalsRule) types.Intervals {
+	intervals := types.Intervals{}
+	if rule != nil {
+		rule(&intervals)
+	}
+	return intervals
+}
+
+func buildIntervalsList(rules []IntervalsRule) []types.Intervals {
+	list := make([]types.Intervals, 0, len(rules))
+	for _, rule := range rules {
+		if rule != nil {
+			list = append(list, buildIntervals(rule))
+		}
+	}
+	return list
+}
+
+// IntervalsMatch 创建 match 规则，匹配经过分析的文本。
+//
+// 示例：
+//   esb.IntervalsMatch("hot water")
+func IntervalsMatch(query string) IntervalsRule {
+	return IntervalsMatchWithOptions(query, nil)
+}
+
+// IntervalsMatchWithOptions 提供回调函数式的 match 规则配置，可以设置 max_gaps、ordered、analyzer 等。
+//
+// 示例：
+//   esb.IntervalsMatchWithOptions("hot water", func(opts *types.IntervalsMatch) {
+//       maxGaps, ordered := 0, true
+//       opts.MaxGaps = &maxGaps
+//       opts.Ordered = &ordered
+//   })
+func IntervalsMatchWithOptions(query string, setOpts func(opts *types.IntervalsMatch)) IntervalsRule {
+	return func(i *types.Intervals) {
+		match := &types.IntervalsMatch{
+			Query: query,
+		}
+		if setOpts != nil {
+			setOpts(match)
+		}
+		i.Match = match
+	}
+}
+
+// IntervalsPrefix 创建 prefix 规则，匹配以指定前缀开头的词项。
+//
+// 示例：
+//   esb.IntervalsPrefix("contr")
+func IntervalsPrefix(prefix string) IntervalsRule {
+	return IntervalsPrefixWithOptions(prefix, nil)
+}
+
+// IntervalsPrefixWithOptions 提供回调函数式的 prefix 规则配置。
+func IntervalsPrefixWithOptions(prefix string, setOpts func(opts *types.IntervalsPrefix)) IntervalsRule {
+	return func(i *types.Intervals) {
+		prefixRule := &types.IntervalsPrefix{
+			Prefix: prefix,
+		}
+		if setOpts != nil {
+			setOpts(prefixRule)
+		}
+		i.Prefix = prefixRule
+	}
+}
+
+// IntervalsWildcard 创建 wildcard 规则，使用 * 与 ? 通配符匹配词项。
+//
+// 示例：
+//   esb.IntervalsWildcard("indemn*")
+func IntervalsWildcard(pattern string) IntervalsRule {
+	return IntervalsWildcardWithOptions(pattern, nil)
+}
+
+// IntervalsWildcardWithOptions 提供回调函数式的 wildcard 规则配置。
+func IntervalsWildcardWithOptions(pattern string, setOpts func(opts *types.IntervalsWildcard)) IntervalsRule {
+	return func(i *types.Intervals) {
+		wildcard := &types.IntervalsWildcard{
+			Pattern: pattern,
+		}
+		if setOpts != nil {
+			setOpts(wildcard)
+		}
+		i.Wildcard = wildcard
+	}
+}
+
+// IntervalsFuzzy 创建 fuzzy 规则，匹配与 term 相似的词项。
+//
+// 示例：
+//   esb.IntervalsFuzzy("contrct")
+func IntervalsFuzzy(term string) IntervalsRule {
+	return IntervalsFuzzyWithOptions(term, nil)
+}
+
+// IntervalsFuzzyWithOptions 提供回调函数式的 fuzzy 规则配置。
+//
+// 示例：
+//   esb.IntervalsFuzzyWithOptions("contrct", func(opts *types.IntervalsFuzzy) {
+//       opts.Fuzziness = "AUTO"
+//   })
+func IntervalsFuzzyWithOptions(term string, setOpts func(opts *types.IntervalsFuzzy)) IntervalsRule {
+	return func(i *types.Intervals) {
+		fuzzy := &types.IntervalsFuzzy{
+			Term: term,
+		}
+		if setOpts != nil {
+			setOpts(fuzzy)
+		}
+		i.Fuzzy = fuzzy
+	}
+}
+
+// IntervalsAllOf 创建 all_of 规则，要求所有子规则都匹配，默认不限制顺序与间隔。
+//
+// 示例：
+//   esb.IntervalsAllOf(esb.IntervalsMatch("breach"), esb.IntervalsMatch("contract"))
+func IntervalsAllOf(rules ...IntervalsRule) IntervalsRule {
+	return IntervalsAllOfWithOptions(rules, nil)
+}
+
+// IntervalsAllOfWithOptions 提供回调函数式的 all_of 规则配置，可以设置 ordered 与 max_gaps。
+//
+// 示例：
+//   esb.IntervalsAllOfWithOptions(rules, func(opts *types.IntervalsAllOf) {
+//       ordered, maxGaps := true, 3
+//       opts.Ordered = &ordered
+//       opts.MaxGaps = &maxGaps
+//   })
+func IntervalsAllOfWithOptions(rules []IntervalsRule, setOpts func(opts *types.IntervalsAllOf)) IntervalsRule {
+	return func(i *types.Intervals) {
+		allOf := &types.IntervalsAllOf{
+			Intervals: buildIntervalsList(rules),
+		}
+		if setOpts != nil {
+			setOpts(allOf)
+		}
+		i.AllOf = allOf
+	}
+}
+
+// IntervalsAnyOf 创建 any_of 规则，匹配任意一个子规则。
+//
+// 示例：
+//   esb.IntervalsAnyOf(esb.IntervalsMatch("terminate"), esb.IntervalsMatch("cancel"))
+func IntervalsAnyOf(rules ...IntervalsRule) IntervalsRule {
+	return IntervalsAnyOfWithOptions(rules, nil)
+}
+
+// IntervalsAnyOfWithOptions 提供回调函数式的 any_of 规则配置。
+func IntervalsAnyOfWithOptions(rules []IntervalsRule, setOpts func(opts *types.IntervalsAnyOf)) IntervalsRule {
+	return func(i *types.Intervals) {
+		anyOf := &types.IntervalsAnyOf{
+			Intervals: buildIntervalsList(rules),
+		}
+		if setOpts != nil {
+			setOpts(anyOf)
+		}
+		i.AnyOf = anyOf
+	}
+}
+
+// IntervalsFiltered 为规则添加过滤条件。
+// Elasticsearch 只允许 match、all_of、any_of 携带一个 filter，
+// 其他规则或已有 filter 的规则会被包装在只有一个子规则的 any_of 中，多个过滤条件依次生效。
+//
+// 示例：
+//   esb.IntervalsFiltered(
+//       esb.IntervalsMatch("hot porridge"),
+//       esb.IntervalsNotContaining(esb.IntervalsMatch("salty")),
+//   )
+func IntervalsFiltered(rule IntervalsRule, filters ...IntervalsFilterOption) IntervalsRule {
+	return func(i *types.Intervals) {
+		current := buildIntervals(rule)
+		for _, filter := range filters {
+			if filter == nil {
+				continue
+			}
+			intervalsFilter := &types.IntervalsFilter{}
+			filter(intervalsFilter)
+			switch {
+			case current.Match != nil && current.Match.Filter == nil:
+				current.Match.Filter = intervalsFilter
+			case current.AllOf != nil && current.AllOf.Filter == nil:
+				current.AllOf.Filter = intervalsFilter
+			case current.AnyOf != nil && current.AnyOf.Filter == nil:
+				current.AnyOf.Filter = intervalsFilter
+			default:
+				current = types.Intervals{
+					AnyOf: &types.IntervalsAnyOf{
+						Intervals: []types.Intervals{current},
+						Filter:    intervalsFilter,
+					},
+				}
+			}
+		}
+		*i = current
+	}
+}
+
+func intervalsFilterRule(rule IntervalsRule) *types.Intervals {
+	intervals := buildIntervals(rule)
+	return &intervals
+}
+
+// IntervalsContaining 过滤出包含 rule 匹配区间的区间。
+func IntervalsContaining(rule IntervalsRule) IntervalsFilterOption {
+	return func(f *types.IntervalsFilter) {
+		f.Containing = intervalsFilterRule(rule)
+	}
+}
+
+// IntervalsNotContaining 过滤出不包含 rule 匹配区间的区间。
+func IntervalsNotContaining(rule IntervalsRule) IntervalsFilterOption {
+	return func(f *types.IntervalsFilter) {
+		f.NotContaining = intervalsFilterRule(rule)
+	}
+}
+
+// IntervalsContainedBy 过滤出被 rule 匹配区间包含的区间。
+func IntervalsContainedBy(rule IntervalsRule) IntervalsFilterOption {
+	return func(f *types.IntervalsFilter) {
+		f.ContainedBy = intervalsFilterRule(rule)
+	}
+}
+
+// IntervalsNotContainedBy 过滤出不被 rule 匹配区间包含的区间。
+//
+// 示例：
+//   // 不在 "limited liability" 中出现的 "liability"
+//   esb.IntervalsFiltered(
+//       esb.IntervalsMatch("liability"),
+//       esb.IntervalsNotContainedBy(esb.IntervalsMatch("limited liability")),
+//   )
+func IntervalsNotContainedBy(rule IntervalsRule) IntervalsFilterOption {
+	return func(f *types.IntervalsFilter) {
+		f.NotContainedBy = intervalsFilterRule(rule)
+	}
+}
+
+// IntervalsOverlapping 过滤出与 rule 匹配区间重叠的区间。
+func IntervalsOverlapping(rule IntervalsRule) IntervalsFilterOption {
+	return func(f *types.IntervalsFilter) {
+		f.Overlapping = intervalsFilterRule(rule)
+	}
+}
+
+// IntervalsNotOverlapping 过滤出不与 rule 匹配区间重叠的区间。
+func IntervalsNotOverlapping(rule IntervalsRule) IntervalsFilterOption {
+	return func(f *types.IntervalsFilter) {
+		f.NotOverlapping = intervalsFilterRule(rule)
+	}
+}
+
+// IntervalsBefore 过滤出出现在 rule 匹配区间之前的区间。
+func IntervalsBefore(rule IntervalsRule) IntervalsFilterOption {
+	return func(f *types.IntervalsFilter) {
+		f.Before = intervalsFilterRule(rule)
+	}
+}
+
+// IntervalsAfter 过滤出出现在 rule 匹配区间之后的区间。
+func IntervalsAfter(rule IntervalsRule) IntervalsFilterOption {
+	return func(f *types.IntervalsFilter) {
+		f.After = intervalsFilterRule(rule)
+	}
+}
+
+// IntervalsScript 使用脚本过滤区间，脚本中可以访问 interval.start、interval.end 与 interval.gaps。
+//
+// 示例：
+//   esb.IntervalsScript("interval.start > 10 && interval.end < 20 && interval.gaps == 0")
+func IntervalsScript(source string) IntervalsFilterOption {
+	return func(f *types.IntervalsFilter) {
+		f.Script = &types.Script{
+			Source: &source,
+		}
+	}
+}
+
+// IntervalsScriptWithParams 使用带参数的脚本过滤区间。
+//
+// 示例：
+//   esb.IntervalsScriptWithParams("interval.gaps == params.gaps", map[string]any{"gaps": 2})
+func IntervalsScriptWithParams(source string, params map[string]any) IntervalsFilterOption {
+	return func(f *types.IntervalsFilter) {
+		jsonParams := make(map[string]json.RawMessage)
+		for k, v := range params {
+			jsonBytes, _ := json.Marshal(v)
+			jsonParams[k] = json.RawMessage(jsonBytes)
+		}
+		f.Script = &types.Script{
+			Source: &source,
+			Params: jsonParams,
+		}
+	}
+}
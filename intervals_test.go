@@ -0,0 +1,123 @@
+package esb
+
+import (
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+func TestIntervals(t *testing.T) {
+	tests := []struct {
+		name  string
+		query QueryOption
+		want  string
+	}{
+		{
+			"match",
+			Intervals("content", IntervalsMatch("hot water")),
+			`{"intervals":{"content":{"match":{"query":"hot water"}}}}`,
+		},
+		{
+			"prefix",
+			Intervals("content", IntervalsPrefix("contr")),
+			`{"intervals":{"content":{"prefix":{"prefix":"contr"}}}}`,
+		},
+		{
+			"wildcard",
+			Intervals("content", IntervalsWildcard("indemn*")),
+			`{"intervals":{"content":{"wildcard":{"pattern":"indemn*"}}}}`,
+		},
+		{
+			"fuzzy",
+			Intervals("content", IntervalsFuzzyWithOptions("contrct", func(opts *types.IntervalsFuzzy) {
+				opts.Fuzziness = "AUTO"
+			})),
+			`{"intervals":{"content":{"fuzzy":{"fuzziness":"AUTO","term":"contrct"}}}}`,
+		},
+		{
+			"有序的all_of",
+			Intervals("content", IntervalsAllOfWithOptions(
+				[]IntervalsRule{
+					IntervalsMatchWithOptions("my favorite food", func(opts *types.IntervalsMatch) {
+						maxGaps, ordered := 0, true
+						opts.MaxGaps = &maxGaps
+						opts.Ordered = &ordered
+					}),
+					IntervalsAnyOf(IntervalsMatch("hot water"), IntervalsMatch("cold porridge")),
+				},
+				func(opts *types.IntervalsAllOf) {
+					ordered := true
+					opts.Ordered = &ordered
+				},
+			)),
+			`{"intervals":{"content":{"all_of":{"intervals":[{"match":{"max_gaps":0,"ordered":true,"query":"my favorite food"}},{"any_of":{"intervals":[{"match":{"query":"hot water"}},{"match":{"query":"cold porridge"}}]}}],"ordered":true}}}}`,
+		},
+		{
+			"match的过滤条件",
+			Intervals("content", IntervalsFiltered(
+				IntervalsMatch("liability"),
+				IntervalsNotContainedBy(IntervalsMatch("limited liability")),
+			)),
+			`{"intervals":{"content":{"match":{"filter":{"not_contained_by":{"match":{"query":"limited liability"}}},"query":"liability"}}}}`,
+		},
+		{
+			"prefix的过滤条件包装为any_of",
+			Intervals("content", IntervalsFiltered(
+				IntervalsPrefix("indemn"),
+				IntervalsBefore(IntervalsMatch("clause")),
+			)),
+			`{"intervals":{"content":{"any_of":{"filter":{"before":{"match":{"query":"clause"}}},"intervals":[{"prefix":{"prefix":"indemn"}}]}}}}`,
+		},
+		{
+			"多个过滤条件依次生效",
+			Intervals("content", IntervalsFiltered(
+				IntervalsAllOf(IntervalsMatch("a"), IntervalsMatch("b")),
+				IntervalsContaining(IntervalsMatch("c")),
+				IntervalsAfter(IntervalsMatch("d")),
+			)),
+			`{"intervals":{"content":{"any_of":{"filter":{"after":{"match":{"query":"d"}}},"intervals":[{"all_of":{"filter":{"containing":{"match":{"query":"c"}}},"intervals":[{"match":{"query":"a"}},{"match":{"query":"b"}}]}}]}}}}`,
+		},
+		{
+			"脚本过滤",
+			Intervals("content", IntervalsFiltered(
+				IntervalsMatch("hot porridge"),
+				IntervalsScript("interval.gaps == 0"),
+			)),
+			`{"intervals":{"content":{"match":{"filter":{"script":{"source":"interval.gaps == 0"}},"query":"hot porridge"}}}}`,
+		},
+		{
+			"带参数的脚本过滤",
+			Intervals("content", IntervalsFiltered(
+				IntervalsMatch("hot porridge"),
+				IntervalsScriptWithParams("interval.gaps == params.gaps", map[string]any{"gaps": 2}),
+			)),
+			`{"intervals":{"content":{"match":{"filter":{"script":{"params":{"gaps":2},"source":"interval.gaps == params.gaps"}},"query":"hot porridge"}}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mustJSON(t, NewQuery(tt.query)); got != tt.want {
+				t.Errorf("期望 %s, 实际得到 %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestIntervalsWithOptions(t *testing.T) {
+	query := NewQuery(IntervalsWithOptions("content", IntervalsMatch("hot water"), func(opts *types.IntervalsQuery) {
+		boost := float32(2)
+		name := "proximity"
+		opts.Boost = &boost
+		opts.QueryName_ = &name
+	}))
+	intervals := query.Intervals["content"]
+	if intervals.Boost == nil || *intervals.Boost != 2 {
+		t.Errorf("期望Boost为2, 实际得到: %v", intervals.Boost)
+	}
+	if intervals.QueryName_ == nil || *intervals.QueryName_ != "proximity" {
+		t.Errorf("期望_name为proximity, 实际得到: %v", intervals.QueryName_)
+	}
+	if intervals.Match == nil || intervals.Match.Query != "hot water" {
+		t.Errorf("期望包含match规则, 实际得到: %+v", intervals.Match)
+	}
+}
@@ -0,0 +1,106 @@
+package esb
+
+import (
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+// HasChild 创建 has_child 查询，返回子文档满足查询条件的父文档。
+// childType 为 join 字段中定义的子关系名称。
+//
+// 示例：
+//   query := esb.NewQuery(
+//       esb.HasChild("answer", esb.Match("body", "elasticsearch")),
+//   )
+func HasChild(childType string, query QueryOption) QueryOption {
+	return HasChildWithOptions(childType, query, nil)
+}
+
+// HasChildWithOptions 提供回调函数式的 HasChild 查询配置，可以设置 score_mode、min_children、max_children、inner_hits 等。
+//
+// 示例：
+//   esb.HasChildWithOptions("answer", esb.Match("body", "elasticsearch"),
+//       func(opts *types.HasChildQuery) {
+//           scoreMode := childscoremode.Max
+//           minChildren, maxChildren := 2, 10
+//           opts.ScoreMode = &scoreMode
+//           opts.MinChildren = &minChildren
+//           opts.MaxChildren = &maxChildren
+//           opts.InnerHits = &types.InnerHits{}
+//       },
+//   )
+func HasChildWithOptions(childType string, query QueryOption, setOpts func(opts *types.HasChildQuery)) QueryOption {
+	return func(q *types.Query) {
+		childQuery := &types.Query{}
+		if query != nil {
+			query(childQuery)
+		}
+		hasChild := &types.HasChildQuery{
+			Type:  childType,
+			Query: *childQuery,
+		}
+		if setOpts != nil {
+			setOpts(hasChild)
+		}
+		q.HasChild = hasChild
+	}
+}
+
+// HasParent 创建 has_parent 查询，返回父文档满足查询条件的子文档。
+// parentType 为 join 字段中定义的父关系名称。
+//
+// 示例：
+//   query := esb.NewQuery(
+//       esb.HasParent("question", esb.Term("tags", "go")),
+//   )
+func HasParent(parentType string, query QueryOption) QueryOption {
+	return HasParentWithOptions(parentType, query, nil)
+}
+
+// HasParentWithOptions 提供回调函数式的 HasParent 查询配置，可以设置 score、inner_hits 等。
+//
+// 示例：
+//   esb.HasParentWithOptions("question", esb.Term("tags", "go"),
+//       func(opts *types.HasParentQuery) {
+//           score := true
+//           opts.Score = &score
+//           opts.InnerHits = &types.InnerHits{}
+//       },
+//   )
+func HasParentWithOptions(parentType string, query QueryOption, setOpts func(opts *types.HasParentQuery)) QueryOption {
+	return func(q *types.Query) {
+		parentQuery := &types.Query{}
+		if query != nil {
+			query(parentQuery)
+		}
+		hasParent := &types.HasParentQuery{
+			ParentType: parentType,
+			Query:      *parentQuery,
+		}
+		if setOpts != nil {
+			setOpts(hasParent)
+		}
+		q.HasParent = hasParent
+	}
+}
+
+// ParentID 创建 parent_id 查询，返回属于指定父文档的子文档。
+//
+// 示例：
+//   esb.ParentID("answer", "question-1")
+func ParentID(childType, id string) QueryOption {
+	return ParentIDWithOptions(childType, id, nil)
+}
+
+// ParentIDWithOptions 提供回调函数式的 ParentID 查询配置。
+func ParentIDWithOptions(childType, id string, setOpts func(opts *types.ParentIdQuery)) QueryOption {
+	return func(q *types.Query) {
+		parentID := &types.ParentIdQuery{
+			Type: &childType,
+			Id:   &id,
+		}
+		if setOpts != nil {
+			setOpts(parentID)
+		}
+		q.ParentId = parentID
+	}
+}
@@ -0,0 +1,61 @@
+package esb
+
+import (
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/childscoremode"
+)
+
+func TestJoinQueries(t *testing.T) {
+	tests := []struct {
+		name  string
+		query QueryOption
+		want  string
+	}{
+		{
+			"has_child",
+			HasChild("answer", Match("body", "elasticsearch")),
+			`{"has_child":{"query":{"match":{"body":{"query":"elasticsearch"}}},"type":"answer"}}`,
+		},
+		{
+			"has_child的选项",
+			HasChildWithOptions("answer", Term("accepted", "true"), func(opts *types.HasChildQuery) {
+				scoreMode := childscoremode.Max
+				minChildren, maxChildren := 2, 10
+				size := 3
+				opts.ScoreMode = &scoreMode
+				opts.MinChildren = &minChildren
+				opts.MaxChildren = &maxChildren
+				opts.InnerHits = &types.InnerHits{Size: &size}
+			}),
+			`{"has_child":{"inner_hits":{"size":3},"max_children":10,"min_children":2,"query":{"term":{"accepted":{"value":"true"}}},"score_mode":"max","type":"answer"}}`,
+		},
+		{
+			"has_parent",
+			HasParent("question", Term("tags", "go")),
+			`{"has_parent":{"parent_type":"question","query":{"term":{"tags":{"value":"go"}}}}}`,
+		},
+		{
+			"has_parent的选项",
+			HasParentWithOptions("question", Term("tags", "go"), func(opts *types.HasParentQuery) {
+				score := true
+				opts.Score = &score
+				opts.InnerHits = &types.InnerHits{}
+			}),
+			`{"has_parent":{"inner_hits":{},"parent_type":"question","query":{"term":{"tags":{"value":"go"}}},"score":true}}`,
+		},
+		{
+			"parent_id",
+			ParentID("answer", "q1"),
+			`{"parent_id":{"id":"q1","type":"answer"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mustJSON(t, NewQuery(tt.query)); got != tt.want {
+				t.Errorf("期望 %s, 实际得到 %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,363 @@
+package esb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/calendarinterval"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
+)
+
+var (
+	// ErrAggregateNotFound 响应中没有指定名称的聚合结果
+	ErrAggregateNotFound = errors.New("aggregate not found")
+	// ErrAggregateType 聚合结果的类型与期望不符，通常是请求时没有开启 typed_keys
+	ErrAggregateType = errors.New("unexpected aggregate type")
+)
+
+// TopMetricsAgg 创建 top_metrics 聚合，按 sortField 排序后返回第一个文档的 metrics 字段值，常用于获取每个分组的最新值。
+//
+// 示例：
+//   esb.TermsAgg("hosts", "host",
+//       esb.TopMetricsAgg("latest", "@timestamp", sortorder.Desc, "cpu", "memory"),
+//   )
+func TopMetricsAgg(name, sortField string, order sortorder.SortOrder, metrics ...string) AggregationOption {
+	return TopMetricsAggWithOptions(name, sortField, order, metrics, nil)
+}
+
+// TopMetricsAggWithOptions 提供回调函数式的 top_metrics 聚合配置，可以设置 size、missing。
+//
+// 示例：
+//   esb.TopMetricsAggWithOptions("latest", "@timestamp", sortorder.Desc, []string{"cpu"}, func(opts *types.TopMetricsAggregation) {
+//       size := 3
+//       opts.Size = &size
+//   })
+func TopMetricsAggWithOptions(name, sortField string, order sortorder.SortOrder, metrics []string, setOpts func(opts *types.TopMetricsAggregation)) AggregationOption {
+	return func(aggs *types.Aggregations) {
+		agg := &types.TopMetricsAggregation{
+			Sort: []types.SortCombinations{
+				&types.SortOptions{SortOptions: map[string]types.FieldSort{sortField: {Order: &order}}},
+			},
+		}
+		for _, metric := range metrics {
+			agg.Metrics = append(agg.Metrics, types.TopMetricsValue{Field: metric})
+		}
+		if setOpts != nil {
+			setOpts(agg)
+		}
+		aggs.Aggregations[name] = types.Aggregations{TopMetrics: agg}
+	}
+}
+
+// ScriptedMetricAgg 创建脚本度量聚合，使用 init、map、combine、reduce 四个阶段的脚本计算自定义指标，
+// 为空的脚本不会设置。
+//
+// 示例：
+//   esb.ScriptedMetricAgg("profit",
+//       "state.transactions = []",
+//       "state.transactions.add(doc.type.value == 'sale' ? doc.amount.value : -1 * doc.amount.value)",
+//       "double profit = 0; for (t in state.transactions) { profit += t } return profit",
+//       "double profit = 0; for (a in states) { profit += a } return profit",
+//   )
+func ScriptedMetricAgg(name, initScript, mapScript, combineScript, reduceScript string) AggregationOption {
+	return ScriptedMetricAggWithOptions(name, initScript, mapScript, combineScript, reduceScript, nil)
+}
+
+// ScriptedMetricAggWithOptions 提供回调函数式的脚本度量聚合配置，可以设置脚本共享的 params。
+//
+// 示例：
+//   esb.ScriptedMetricAggWithOptions("profit", init, mapScript, combine, reduce, func(opts *types.ScriptedMetricAggregation) {
+//       opts.Params = map[string]json.RawMessage{"rate": json.RawMessage(`0.2`)}
+//   })
+func ScriptedMetricAggWithOptions(name, initScript, mapScript, combineScript, reduceScript string, setOpts func(opts *types.ScriptedMetricAggregation)) AggregationOption {
+	return func(aggs *types.Aggregations) {
+		agg := &types.ScriptedMetricAggregation{
+			InitScript:    scriptSource(initScript),
+			MapScript:     scriptSource(mapScript),
+			CombineScript: scriptSource(combineScript),
+			ReduceScript:  scriptSource(reduceScript),
+		}
+		if setOpts != nil {
+			setOpts(agg)
+		}
+		aggs.Aggregations[name] = types.Aggregations{ScriptedMetric: agg}
+	}
+}
+
+// BoxplotAgg 创建箱线图聚合，返回最小值、最大值、四分位数以及上下须。
+//
+// 示例：
+//   esb.BoxplotAgg("load_time_boxplot", "load_time")
+func BoxplotAgg(name, field string) AggregationOption {
+	return BoxplotAggWithOptions(name, field, nil)
+}
+
+// BoxplotAggWithOptions 提供回调函数式的箱线图聚合配置，可以设置 compression、execution_hint。
+//
+// 示例：
+//   esb.BoxplotAggWithOptions("load_time_boxplot", "load_time", func(opts *types.BoxplotAggregation) {
+//       compression := types.Float64(200)
+//       opts.Compression = &compression
+//   })
+func BoxplotAggWithOptions(name, field string, setOpts func(opts *types.BoxplotAggregation)) AggregationOption {
+	return func(aggs *types.Aggregations) {
+		agg := &types.BoxplotAggregation{
+			Field: &field,
+		}
+		if setOpts != nil {
+			setOpts(agg)
+		}
+		aggs.Aggregations[name] = types.Aggregations{Boxplot: agg}
+	}
+}
+
+// RateAgg 创建速率聚合，必须放在 date_histogram 或 composite 的子聚合中。
+// field 为空时计算每个 unit 的文档数量，否则计算字段值之和；unit 为空时使用 date_histogram 的间隔。
+//
+// 示例：
+//   esb.DateHistogramAgg("by_date", "date", "month",
+//       esb.RateAgg("sales_per_day", "price", "day"),
+//   )
+func RateAgg(name, field, unit string) AggregationOption {
+	return RateAggWithOptions(name, field, unit, nil)
+}
+
+// RateAggWithOptions 提供回调函数式的速率聚合配置，可以设置 mode、format。
+//
+// 示例：
+//   esb.RateAggWithOptions("visits_per_day", "visits", "day", func(opts *types.RateAggregation) {
+//       mode := ratemode.ValueCount
+//       opts.Mode = &mode
+//   })
+func RateAggWithOptions(name, field, unit string, setOpts func(opts *types.RateAggregation)) AggregationOption {
+	return func(aggs *types.Aggregations) {
+		agg := &types.RateAggregation{}
+		if field != "" {
+			agg.Field = &field
+		}
+		if unit != "" {
+			agg.Unit = &calendarinterval.CalendarInterval{Name: unit}
+		}
+		if setOpts != nil {
+			setOpts(agg)
+		}
+		aggs.Aggregations[name] = types.Aggregations{Rate: agg}
+	}
+}
+
+// MatrixStatsAgg 创建矩阵统计聚合，计算多个数值字段的均值、方差、偏度、峰度以及两两之间的协方差和相关系数。
+//
+// 示例：
+//   esb.MatrixStatsAgg("statistics", "poverty", "income")
+func MatrixStatsAgg(name string, fields ...string) AggregationOption {
+	return MatrixStatsAggWithOptions(name, fields, nil)
+}
+
+// MatrixStatsAggWithOptions 提供回调函数式的矩阵统计聚合配置，可以设置 missing、mode。
+//
+// 示例：
+//   esb.MatrixStatsAggWithOptions("statistics", []string{"poverty", "income"}, func(opts *types.MatrixStatsAggregation) {
+//       opts.Missing = map[string]types.Float64{"income": 50000}
+//   })
+func MatrixStatsAggWithOptions(name string, fields []string, setOpts func(opts *types.MatrixStatsAggregation)) AggregationOption {
+	return func(aggs *types.Aggregations) {
+		agg := &types.MatrixStatsAggregation{
+			Fields: fields,
+		}
+		if setOpts != nil {
+			setOpts(agg)
+		}
+		aggs.Aggregations[name] = types.Aggregations{MatrixStats: agg}
+	}
+}
+
+// GeoLineAgg 创建 geo_line 聚合，将桶内文档的 pointField 按 sortField 升序连接成轨迹线。
+//
+// 示例：
+//   esb.TermsAgg("vehicles", "vehicle_id",
+//       esb.GeoLineAgg("track", "location", "@timestamp"),
+//   )
+func GeoLineAgg(name, pointField, sortField string) AggregationOption {
+	return GeoLineAggWithOptions(name, pointField, sortField, nil)
+}
+
+// GeoLineAggWithOptions 提供回调函数式的 geo_line 聚合配置，可以设置 size、sort_order、include_sort。
+//
+// 示例：
+//   esb.GeoLineAggWithOptions("track", "location", "@timestamp", func(opts *types.GeoLineAggregation) {
+//       size := 1000
+//       opts.Size = &size
+//   })
+func GeoLineAggWithOptions(name, pointField, sortField string, setOpts func(opts *types.GeoLineAggregation)) AggregationOption {
+	return func(aggs *types.Aggregations) {
+		agg := &types.GeoLineAggregation{
+			Point: types.GeoLinePoint{Field: pointField},
+			Sort:  types.GeoLineSort{Field: sortField},
+		}
+		if setOpts != nil {
+			setOpts(agg)
+		}
+		aggs.Aggregations[name] = types.Aggregations{GeoLine: agg}
+	}
+}
+
+// AggregateAs 从聚合结果中读取名为 name 的聚合并断言为 T，T 为 go-elasticsearch 的聚合结果指针类型。
+// 搜索请求需要开启 typed_keys（typedapi 默认开启）。
+//
+// 示例：
+//   terms, err := esb.AggregateAs[*types.StringTermsAggregate](response.Aggregations, "categories")
+func AggregateAs[T types.Aggregate](aggs map[string]types.Aggregate, name string) (T, error) {
+	var zero T
+	aggregate, ok := aggs[name]
+	if !ok {
+		return zero, fmt.Errorf("%w: %s", ErrAggregateNotFound, name)
+	}
+	v, ok := aggregate.(T)
+	if !ok {
+		return zero, fmt.Errorf("%w: %s is %T, want %T", ErrAggregateType, name, aggregate, zero)
+	}
+	return v, nil
+}
+
+// TopMetricsResult 将 top_metrics 聚合的每个结果解析为 T，字段名为 metrics 中的字段名（包括其中的点号）。
+//
+// 示例：
+//   type Latest struct {
+//       CPU float64 `json:"cpu"`
+//   }
+//   latest, err := esb.TopMetricsResult[Latest](bucket.Aggregations, "latest")
+func TopMetricsResult[T any](aggs map[string]types.Aggregate, name string) ([]T, error) {
+	aggregate, err := AggregateAs[*types.TopMetricsAggregate](aggs, name)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]T, 0, len(aggregate.Top))
+	for _, top := range aggregate.Top {
+		data, err := json.Marshal(top.Metrics)
+		if err != nil {
+			return nil, err
+		}
+		var v T
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		results = append(results, v)
+	}
+	return results, nil
+}
+
+// ScriptedMetricResult 将脚本度量聚合 reduce 脚本的返回值解析为 T。
+//
+// 示例：
+//   profit, err := esb.ScriptedMetricResult[float64](response.Aggregations, "profit")
+func ScriptedMetricResult[T any](aggs map[string]types.Aggregate, name string) (T, error) {
+	var v T
+	aggregate, err := AggregateAs[*types.ScriptedMetricAggregate](aggs, name)
+	if err != nil {
+		return v, err
+	}
+	if len(aggregate.Value) == 0 {
+		return v, ErrNoData
+	}
+	err = json.Unmarshal(aggregate.Value, &v)
+	return v, err
+}
+
+// Boxplot 箱线图聚合的结果。
+type Boxplot struct {
+	Min   float64
+	Max   float64
+	Q1    float64
+	Q2    float64
+	Q3    float64
+	Lower float64
+	Upper float64
+}
+
+// BoxplotResult 读取箱线图聚合的结果。
+//
+// 示例：
+//   boxplot, err := esb.BoxplotResult(response.Aggregations, "load_time_boxplot")
+//   fmt.Println(boxplot.Q2) // 中位数
+func BoxplotResult(aggs map[string]types.Aggregate, name string) (Boxplot, error) {
+	aggregate, err := AggregateAs[*types.BoxPlotAggregate](aggs, name)
+	if err != nil {
+		return Boxplot{}, err
+	}
+	return Boxplot{
+		Min:   float64(aggregate.Min),
+		Max:   float64(aggregate.Max),
+		Q1:    float64(aggregate.Q1),
+		Q2:    float64(aggregate.Q2),
+		Q3:    float64(aggregate.Q3),
+		Lower: float64(aggregate.Lower),
+		Upper: float64(aggregate.Upper),
+	}, nil
+}
+
+// RateResult 读取速率聚合的结果。
+//
+// 示例：
+//   for _, bucket := range histogram.Buckets.([]types.DateHistogramBucket) {
+//       rate, err := esb.RateResult(bucket.Aggregations, "sales_per_day")
+//   }
+func RateResult(aggs map[string]types.Aggregate, name string) (float64, error) {
+	aggregate, err := AggregateAs[*types.RateAggregate](aggs, name)
+	if err != nil {
+		return 0, err
+	}
+	return float64(aggregate.Value), nil
+}
+
+// MatrixStatsResult 读取矩阵统计聚合的结果，返回参与统计的文档数量以及按字段名索引的统计值。
+//
+// 示例：
+//   docCount, fields, err := esb.MatrixStatsResult(response.Aggregations, "statistics")
+//   fmt.Println(fields["income"].Correlation["poverty"])
+func MatrixStatsResult(aggs map[string]types.Aggregate, name string) (int64, map[string]types.MatrixStatsFields, error) {
+	aggregate, err := AggregateAs[*types.MatrixStatsAggregate](aggs, name)
+	if err != nil {
+		return 0, nil, err
+	}
+	fields := make(map[string]types.MatrixStatsFields, len(aggregate.Fields))
+	for _, field := range aggregate.Fields {
+		fields[field.Name] = field
+	}
+	return aggregate.DocCount, fields, nil
+}
+
+// GeoLineResult 将 geo_line 聚合的结果转换为 GeoFeature，几何形状为 LineString，
+// 属性包含 complete 以及开启 include_sort 时的 sort_values。
+//
+// 示例：
+//   feature, err := esb.GeoLineResult(bucket.Aggregations, "track")
+//   line := feature.Geometry.(esb.LineString)
+func GeoLineResult(aggs map[string]types.Aggregate, name string) (GeoFeature, error) {
+	aggregate, err := AggregateAs[*types.GeoLineAggregate](aggs, name)
+	if err != nil {
+		return GeoFeature{}, err
+	}
+	line := make(LineString, 0, len(aggregate.Geometry.Coordinates))
+	for _, coordinate := range aggregate.Geometry.Coordinates {
+		if len(coordinate) < 2 {
+			return GeoFeature{}, fmt.Errorf("%w: %s: invalid coordinate %v", ErrInvalidGeometry, name, coordinate)
+		}
+		line = append(line, Point{Lat: float64(coordinate[1]), Lon: float64(coordinate[0])})
+	}
+	feature := GeoFeature{Geometry: line}
+	if len(aggregate.Properties) > 0 {
+		if err := json.Unmarshal(aggregate.Properties, &feature.Properties); err != nil {
+			return GeoFeature{}, err
+		}
+	}
+	return feature, nil
+}
+
+func scriptSource(source string) *types.Script {
+	if source == "" {
+		return nil
+	}
+	return &types.Script{Source: &source}
+}
@@ -0,0 +1,89 @@
+package esb
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
+)
+
+func TestMetricAggs(t *testing.T) {
+	aggs := NewAggregations(
+		TopMetricsAgg("latest", "@timestamp", sortorder.Desc, "cpu", "memory"),
+		ScriptedMetricAgg("profit", "state.t = []", "state.t.add(doc.amount.value)", "", "return states"),
+		BoxplotAgg("load", "load_time"),
+		RateAggWithOptions("per_day", "", "day", func(opts *types.RateAggregation) {
+			format := "0.0"
+			opts.Format = &format
+		}),
+		MatrixStatsAgg("statistics", "poverty", "income"),
+		GeoLineAgg("track", "location", "@timestamp"),
+	)
+	data, err := json.Marshal(aggs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"latest":{"top_metrics":{"metrics":[{"field":"cpu"},{"field":"memory"}],"sort":[{"@timestamp":{"order":"desc"}}]}}`,
+		`"profit":{"scripted_metric":{"init_script":{"source":"state.t = []"},"map_script":{"source":"state.t.add(doc.amount.value)"},"reduce_script":{"source":"return states"}}}`,
+		`"load":{"boxplot":{"field":"load_time"}}`,
+		`"per_day":{"rate":{"format":"0.0","unit":"day"}}`,
+		`"statistics":{"matrix_stats":{"fields":["poverty","income"]}}`,
+		`"track":{"geo_line":{"point":{"field":"location"},"sort":{"field":"@timestamp"}}}`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("期望包含 %s, 实际得到 %s", want, data)
+		}
+	}
+}
+
+func TestMetricAggResults(t *testing.T) {
+	response := decodeTestAggregations(t, `{"aggregations":{
+		"top_metrics#latest":{"top":[{"sort":["2024-01-02"],"metrics":{"cpu":0.5,"host.name":"a"}}]},
+		"scripted_metric#profit":{"value":240.5},
+		"boxplot#load":{"min":1,"max":9,"q1":2,"q2":5,"q3":7,"lower":1,"upper":9},
+		"rate#per_day":{"value":3.5},
+		"matrix_stats#statistics":{"doc_count":50,"fields":[{"name":"income","count":50,"mean":51985.1,"variance":7.4e7,"skewness":0.4,"kurtosis":2.1,"covariance":{"income":7.4e7,"poverty":-21093.6},"correlation":{"income":1,"poverty":-0.8}}]},
+		"geo_line#track":{"type":"Feature","geometry":{"type":"LineString","coordinates":[[4.9,52.3],[4.8,52.4]]},"properties":{"complete":true}}
+	}}`)
+	aggs := response.Aggregations
+
+	type latest struct {
+		CPU  float64 `json:"cpu"`
+		Host string  `json:"host.name"`
+	}
+	tops, err := TopMetricsResult[latest](aggs, "latest")
+	if err != nil || len(tops) != 1 || tops[0] != (latest{CPU: 0.5, Host: "a"}) {
+		t.Errorf("top_metrics 解析错误: %+v, %v", tops, err)
+	}
+	if profit, err := ScriptedMetricResult[float64](aggs, "profit"); err != nil || profit != 240.5 {
+		t.Errorf("scripted_metric 解析错误: %v, %v", profit, err)
+	}
+	if boxplot, err := BoxplotResult(aggs, "load"); err != nil || boxplot != (Boxplot{Min: 1, Max: 9, Q1: 2, Q2: 5, Q3: 7, Lower: 1, Upper: 9}) {
+		t.Errorf("boxplot 解析错误: %+v, %v", boxplot, err)
+	}
+	if rate, err := RateResult(aggs, "per_day"); err != nil || rate != 3.5 {
+		t.Errorf("rate 解析错误: %v, %v", rate, err)
+	}
+	docCount, fields, err := MatrixStatsResult(aggs, "statistics")
+	if err != nil || docCount != 50 || fields["income"].Correlation["poverty"] != -0.8 {
+		t.Errorf("matrix_stats 解析错误: %d, %+v, %v", docCount, fields, err)
+	}
+	feature, err := GeoLineResult(aggs, "track")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line, ok := feature.Geometry.(LineString); !ok || len(line) != 2 || line[0] != (Point{Lat: 52.3, Lon: 4.9}) || feature.Properties["complete"] != true {
+		t.Errorf("geo_line 解析错误: %+v", feature)
+	}
+
+	if _, err := RateResult(aggs, "missing"); !errors.Is(err, ErrAggregateNotFound) {
+		t.Errorf("期望ErrAggregateNotFound, 实际得到: %v", err)
+	}
+	if _, err := RateResult(aggs, "load"); !errors.Is(err, ErrAggregateType) {
+		t.Errorf("期望ErrAggregateType, 实际得到: %v", err)
+	}
+}
@@ -38,6 +38,12 @@ func WithSort(options ...types.SortCombinations) PreProcessor {
         body.Sort = options
     }
 }
+// 字段折叠,配合 esb.Collapse 使用 20261018
+func WithCollapse(collapse *types.FieldCollapse) PreProcessor {
+    return func(header *types.MultisearchHeader, body *types.MultisearchBody) {
+        body.Collapse = collapse
+    }
+}
 func WithSize10000() PreProcessor {
     return WithSize(10000, 0)
 }
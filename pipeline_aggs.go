@@ -0,0 +1,456 @@
+package esb
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/normalizemethod"
+)
+
+var (
+	// ErrInvalidBucketsPath buckets_path 引用的聚合不存在
+	ErrInvalidBucketsPath = errors.New("invalid buckets_path")
+)
+
+// BucketsPath 表示管道聚合的 buckets_path，字符串字面量可以直接作为 BucketsPath 使用。
+// 语法为 AGG_NAME[>AGG_NAME]*[.METRIC]，例如 "sales_per_month>sales"、"price_stats.avg"。
+type BucketsPath string
+
+const (
+	// DocCountPath 引用桶的文档数量
+	DocCountPath BucketsPath = "_count"
+	// KeyPath 引用桶的 key
+	KeyPath BucketsPath = "_key"
+)
+
+// AggPath 使用聚合名称创建 buckets_path，多个名称之间使用 > 连接，表示逐层进入子聚合。
+//
+// 示例：
+//   esb.AggPath("sales_per_month", "sales")              // sales_per_month>sales
+//   esb.AggPath("price_stats").Metric("avg")             // price_stats.avg
+//   esb.AggPath("load_time").Percentile(99)              // load_time[99]
+//   esb.AggPath("sale_type").Key("hat").Then("sales")    // sale_type['hat']>sales
+func AggPath(aggs ...string) BucketsPath {
+	return BucketsPath(strings.Join(aggs, ">"))
+}
+
+// Then 进入名为 agg 的子聚合。
+func (p BucketsPath) Then(agg string) BucketsPath {
+	if p == "" {
+		return BucketsPath(agg)
+	}
+	return p + ">" + BucketsPath(agg)
+}
+
+// Metric 引用多值度量聚合中的某个值，例如 stats 的 avg、extended_stats 的 std_deviation，
+// 或者桶聚合的 _bucket_count。
+func (p BucketsPath) Metric(metric string) BucketsPath {
+	return p + "." + BucketsPath(metric)
+}
+
+// Percentile 引用 percentiles 聚合中的某个百分位。
+func (p BucketsPath) Percentile(percent float64) BucketsPath {
+	return p + BucketsPath("["+strconv.FormatFloat(percent, 'f', -1, 64)+"]")
+}
+
+// Key 选择多桶聚合中 key 为 key 的桶。
+func (p BucketsPath) Key(key string) BucketsPath {
+	return p + BucketsPath("['"+key+"']")
+}
+
+// BucketCount 引用多桶聚合的桶数量。
+func (p BucketsPath) BucketCount() BucketsPath {
+	return p.Metric("_bucket_count")
+}
+
+// String 返回 buckets_path 字符串。
+func (p BucketsPath) String() string {
+	return string(p)
+}
+
+// BucketsPathVars 表示脚本中变量名到 buckets_path 的映射，用于 bucket_script、bucket_selector、inference。
+type BucketsPathVars map[string]BucketsPath
+
+func (v BucketsPathVars) toBucketsPath() types.BucketsPath {
+	paths := make(map[string]string, len(v))
+	for name, path := range v {
+		paths[name] = string(path)
+	}
+	return paths
+}
+
+// BucketScriptAgg 创建桶脚本聚合，对父多桶聚合的每个桶执行脚本，脚本中通过 params.变量名 读取 paths 引用的值。
+//
+// 示例：
+//   esb.DateHistogramAgg("sales_per_month", "date", "1M",
+//       esb.SumAgg("total_sales", "price"),
+//       esb.FilterAgg("t_shirts", esb.Term("type", "t-shirt"), esb.SumAgg("sales", "price")),
+//       esb.BucketScriptAgg("t_shirt_percentage", esb.BucketsPathVars{
+//           "tShirtSales": esb.AggPath("t_shirts", "sales"),
+//           "totalSales":  "total_sales",
+//       }, "params.tShirtSales / params.totalSales * 100"),
+//   )
+func BucketScriptAgg(name string, paths BucketsPathVars, script string) AggregationOption {
+	return BucketScriptAggWithOptions(name, paths, script, nil)
+}
+
+// BucketScriptAggWithOptions 提供回调函数式的桶脚本聚合配置，可以设置 gap_policy、format、脚本参数。
+//
+// 示例：
+//   esb.BucketScriptAggWithOptions("ratio", paths, "params.a / params.b", func(opts *types.BucketScriptAggregation) {
+//       policy := gappolicy.InsertZeros
+//       opts.GapPolicy = &policy
+//   })
+func BucketScriptAggWithOptions(name string, paths BucketsPathVars, script string, setOpts func(opts *types.BucketScriptAggregation)) AggregationOption {
+	return func(aggs *types.Aggregations) {
+		agg := &types.BucketScriptAggregation{
+			BucketsPath: paths.toBucketsPath(),
+			Script:      &types.Script{Source: &script},
+		}
+		if setOpts != nil {
+			setOpts(agg)
+		}
+		aggs.Aggregations[name] = types.Aggregations{BucketScript: agg}
+	}
+}
+
+// BucketSelectorAgg 创建桶选择器聚合，只保留脚本返回 true 的父聚合桶。
+//
+// 示例：
+//   esb.BucketSelectorAgg("sales_bucket_filter", esb.BucketsPathVars{"totalSales": "total_sales"}, "params.totalSales > 200")
+func BucketSelectorAgg(name string, paths BucketsPathVars, script string) AggregationOption {
+	return BucketSelectorAggWithOptions(name, paths, script, nil)
+}
+
+// BucketSelectorAggWithOptions 提供回调函数式的桶选择器聚合配置。
+//
+// 示例：
+//   esb.BucketSelectorAggWithOptions("filter", paths, "params.count > 10", func(opts *types.BucketSelectorAggregation) {
+//       policy := gappolicy.Skip
+//       opts.GapPolicy = &policy
+//   })
+func BucketSelectorAggWithOptions(name string, paths BucketsPathVars, script string, setOpts func(opts *types.BucketSelectorAggregation)) AggregationOption {
+	return func(aggs *types.Aggregations) {
+		agg := &types.BucketSelectorAggregation{
+			BucketsPath: paths.toBucketsPath(),
+			Script:      &types.Script{Source: &script},
+		}
+		if setOpts != nil {
+			setOpts(agg)
+		}
+		aggs.Aggregations[name] = types.Aggregations{BucketSelector: agg}
+	}
+}
+
+// BucketSortAgg 创建桶排序聚合，对父多桶聚合的桶排序并截取前 size 个，size 小于等于 0 时只排序不截取。
+// 排序字段为兄弟聚合的 buckets_path，也可以使用 _key、_count。
+//
+// 示例：
+//   esb.BucketSortAgg("top_months", 3, esb.SortFieldDesc("total_sales"))
+func BucketSortAgg(name string, size int, sorts ...types.SortCombinations) AggregationOption {
+	return BucketSortAggWithOptions(name, size, sorts, nil)
+}
+
+// BucketSortAggWithOptions 提供回调函数式的桶排序聚合配置，可以设置 from、gap_policy。
+//
+// 示例：
+//   esb.BucketSortAggWithOptions("page", 10, nil, func(opts *types.BucketSortAggregation) {
+//       from := 10
+//       opts.From = &from
+//   })
+func BucketSortAggWithOptions(name string, size int, sorts []types.SortCombinations, setOpts func(opts *types.BucketSortAggregation)) AggregationOption {
+	return func(aggs *types.Aggregations) {
+		agg := &types.BucketSortAggregation{
+			Sort: sorts,
+		}
+		if size > 0 {
+			agg.Size = &size
+		}
+		if setOpts != nil {
+			setOpts(agg)
+		}
+		aggs.Aggregations[name] = types.Aggregations{BucketSort: agg}
+	}
+}
+
+// MovingFnAgg 创建移动函数聚合，在滑动窗口上执行脚本，脚本可以使用 MovingFunctions 中的内置函数。
+//
+// 示例：
+//   esb.MovingFnAgg("the_movavg", "the_sum", 10, "MovingFunctions.unweightedAvg(values)")
+func MovingFnAgg(name string, path BucketsPath, window int, script string) AggregationOption {
+	return MovingFnAggWithOptions(name, path, window, script, nil)
+}
+
+// MovingFnAggWithOptions 提供回调函数式的移动函数聚合配置，可以设置 shift、gap_policy。
+//
+// 示例：
+//   esb.MovingFnAggWithOptions("the_movavg", "the_sum", 10, "MovingFunctions.unweightedAvg(values)", func(opts *types.MovingFunctionAggregation) {
+//       shift := 1
+//       opts.Shift = &shift
+//   })
+func MovingFnAggWithOptions(name string, path BucketsPath, window int, script string, setOpts func(opts *types.MovingFunctionAggregation)) AggregationOption {
+	return func(aggs *types.Aggregations) {
+		agg := &types.MovingFunctionAggregation{
+			BucketsPath: string(path),
+			Script:      &script,
+			Window:      &window,
+		}
+		if setOpts != nil {
+			setOpts(agg)
+		}
+		aggs.Aggregations[name] = types.Aggregations{MovingFn: agg}
+	}
+}
+
+// SerialDiffAgg 创建序列差分聚合，计算当前桶与 lag 个桶之前的值的差。
+//
+// 示例：
+//   esb.SerialDiffAgg("weekly_diff", "the_sum", 7)
+func SerialDiffAgg(name string, path BucketsPath, lag int) AggregationOption {
+	return SerialDiffAggWithOptions(name, path, lag, nil)
+}
+
+// SerialDiffAggWithOptions 提供回调函数式的序列差分聚合配置。
+//
+// 示例：
+//   esb.SerialDiffAggWithOptions("weekly_diff", "the_sum", 7, func(opts *types.SerialDifferencingAggregation) {
+//       format := "0.00"
+//       opts.Format = &format
+//   })
+func SerialDiffAggWithOptions(name string, path BucketsPath, lag int, setOpts func(opts *types.SerialDifferencingAggregation)) AggregationOption {
+	return func(aggs *types.Aggregations) {
+		agg := &types.SerialDifferencingAggregation{
+			BucketsPath: string(path),
+			Lag:         &lag,
+		}
+		if setOpts != nil {
+			setOpts(agg)
+		}
+		aggs.Aggregations[name] = types.Aggregations{SerialDiff: agg}
+	}
+}
+
+// NormalizeAgg 创建归一化聚合，按 method 对每个桶的值做归一化，例如 percent_of_sum、rescale_0_1。
+//
+// 示例：
+//   esb.NormalizeAgg("percent_of_total_sales", "sales", normalizemethod.Percentofsum)
+func NormalizeAgg(name string, path BucketsPath, method normalizemethod.NormalizeMethod) AggregationOption {
+	return NormalizeAggWithOptions(name, path, method, nil)
+}
+
+// NormalizeAggWithOptions 提供回调函数式的归一化聚合配置。
+//
+// 示例：
+//   esb.NormalizeAggWithOptions("percent", "sales", normalizemethod.Percentofsum, func(opts *types.NormalizeAggregation) {
+//       format := "00.00%"
+//       opts.Format = &format
+//   })
+func NormalizeAggWithOptions(name string, path BucketsPath, method normalizemethod.NormalizeMethod, setOpts func(opts *types.NormalizeAggregation)) AggregationOption {
+	return func(aggs *types.Aggregations) {
+		agg := &types.NormalizeAggregation{
+			BucketsPath: string(path),
+			Method:      &method,
+		}
+		if setOpts != nil {
+			setOpts(agg)
+		}
+		aggs.Aggregations[name] = types.Aggregations{Normalize: agg}
+	}
+}
+
+// CumulativeCardinalityAgg 创建累积基数聚合，计算截至每个桶的累计去重数量，path 需要引用 cardinality 聚合。
+//
+// 示例：
+//   esb.DateHistogramAgg("users_per_day", "timestamp", "1d",
+//       esb.CardinalityAgg("distinct_users", "user_id"),
+//       esb.CumulativeCardinalityAgg("total_new_users", "distinct_users"),
+//   )
+func CumulativeCardinalityAgg(name string, path BucketsPath) AggregationOption {
+	return CumulativeCardinalityAggWithOptions(name, path, nil)
+}
+
+// CumulativeCardinalityAggWithOptions 提供回调函数式的累积基数聚合配置。
+func CumulativeCardinalityAggWithOptions(name string, path BucketsPath, setOpts func(opts *types.CumulativeCardinalityAggregation)) AggregationOption {
+	return func(aggs *types.Aggregations) {
+		agg := &types.CumulativeCardinalityAggregation{
+			BucketsPath: string(path),
+		}
+		if setOpts != nil {
+			setOpts(agg)
+		}
+		aggs.Aggregations[name] = types.Aggregations{CumulativeCardinality: agg}
+	}
+}
+
+// InferenceAgg 创建推理聚合，使用训练好的模型对每个桶推理，paths 的 key 为模型的输入字段名。
+//
+// 示例：
+//   esb.InferenceAgg("malicious_prediction", "malicious_clients_model", esb.BucketsPathVars{
+//       "response_count": "responses_total",
+//       "url_dc":         "url_dc",
+//   })
+func InferenceAgg(name, modelID string, paths BucketsPathVars) AggregationOption {
+	return InferenceAggWithOptions(name, modelID, paths, nil)
+}
+
+// InferenceAggWithOptions 提供回调函数式的推理聚合配置，可以设置 inference_config。
+//
+// 示例：
+//   esb.InferenceAggWithOptions("prediction", "model", paths, func(opts *types.InferenceAggregation) {
+//       opts.InferenceConfig = &types.InferenceConfigContainer{Classification: &types.ClassificationInferenceOptions{}}
+//   })
+func InferenceAggWithOptions(name, modelID string, paths BucketsPathVars, setOpts func(opts *types.InferenceAggregation)) AggregationOption {
+	return func(aggs *types.Aggregations) {
+		agg := &types.InferenceAggregation{
+			BucketsPath: paths.toBucketsPath(),
+			ModelId:     modelID,
+		}
+		if setOpts != nil {
+			setOpts(agg)
+		}
+		aggs.Aggregations[name] = types.Aggregations{Inference: agg}
+	}
+}
+
+// ValidateAggregations 检查聚合树中所有管道聚合的 buckets_path 以及 bucket_sort 的排序字段，
+// 确认引用的聚合存在于管道聚合所在层级（兄弟聚合）及其子聚合中，
+// 同时检查 SubAgg 因父聚合名称错误而创建的没有类型的空容器（ErrMissingParentAgg），返回所有错误。
+//
+// 示例：
+//   aggs := esb.NewAggregations(...)
+//   if err := esb.ValidateAggregations(aggs); err != nil {
+//       return err // errors.Is(err, esb.ErrInvalidBucketsPath)
+//   }
+func ValidateAggregations(aggs map[string]types.Aggregations) error {
+	var errs []error
+	validateAggregationLevel(aggs, "", &errs)
+	return errors.Join(errs...)
+}
+
+func validateAggregationLevel(aggs map[string]types.Aggregations, parent string, errs *[]error) {
+	names := make([]string, 0, len(aggs))
+	for name := range aggs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		agg := aggs[name]
+		location := name
+		if parent != "" {
+			location = parent + ">" + name
+		}
+		if !hasAggregationType(agg) {
+			*errs = append(*errs, fmt.Errorf("%w: aggregation %q has no type", ErrMissingParentAgg, location))
+		}
+		for _, path := range aggregationPaths(agg) {
+			if err := resolveBucketsPath(aggs, path); err != nil {
+				*errs = append(*errs, fmt.Errorf("%w: aggregation %q: %q: %v", ErrInvalidBucketsPath, location, path, err))
+			}
+		}
+		if len(agg.Aggregations) > 0 {
+			validateAggregationLevel(agg.Aggregations, location, errs)
+		}
+	}
+}
+
+// hasAggregationType 判断聚合是否设置了聚合类型，子聚合与 meta 不算。
+func hasAggregationType(agg types.Aggregations) bool {
+	rv := reflect.ValueOf(agg)
+	rt := rv.Type()
+	for i := 0; i < rv.NumField(); i++ {
+		switch rt.Field(i).Name {
+		case "Aggregations", "Meta":
+			continue
+		}
+		if !rv.Field(i).IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// aggregationPaths 通过反射读取管道聚合的 buckets_path，以及 bucket_sort 的排序字段。
+func aggregationPaths(agg types.Aggregations) []string {
+	var paths []string
+	if agg.BucketSort != nil {
+		for _, s := range agg.BucketSort.Sort {
+			switch s := s.(type) {
+			case string:
+				paths = append(paths, s)
+			case *types.SortOptions:
+				for field := range s.SortOptions {
+					paths = append(paths, field)
+				}
+			case types.SortOptions:
+				for field := range s.SortOptions {
+					paths = append(paths, field)
+				}
+			}
+		}
+	}
+	rv := reflect.ValueOf(agg)
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Field(i)
+		if field.Kind() != reflect.Pointer || field.IsNil() || field.Elem().Kind() != reflect.Struct {
+			continue
+		}
+		bucketsPath := field.Elem().FieldByName("BucketsPath")
+		if !bucketsPath.IsValid() || bucketsPath.IsNil() {
+			continue
+		}
+		switch p := bucketsPath.Interface().(type) {
+		case string:
+			paths = append(paths, p)
+		case BucketsPath:
+			paths = append(paths, string(p))
+		case []string:
+			paths = append(paths, p...)
+		case map[string]string:
+			keys := make([]string, 0, len(p))
+			for key := range p {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				paths = append(paths, p[key])
+			}
+		}
+	}
+	return paths
+}
+
+// resolveBucketsPath 从 aggs 开始逐层解析 buckets_path 中的聚合名称，末尾的 .METRIC 和 [KEY] 不做检查。
+func resolveBucketsPath(aggs map[string]types.Aggregations, path string) error {
+	if path == "" {
+		return errors.New("empty path")
+	}
+	segments := strings.Split(path, ">")
+	current := aggs
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		if last && (segment == string(DocCountPath) || segment == string(KeyPath)) {
+			return nil
+		}
+		name := segment
+		if bracket := strings.IndexByte(name, '['); bracket >= 0 {
+			name = name[:bracket]
+		}
+		agg, ok := current[name]
+		if !ok && last {
+			if dot := strings.LastIndexByte(name, '.'); dot >= 0 {
+				agg, ok = current[name[:dot]]
+				name = name[:dot]
+			}
+		}
+		if !ok {
+			return fmt.Errorf("aggregation %q not found", name)
+		}
+		current = agg.Aggregations
+	}
+	return nil
+}
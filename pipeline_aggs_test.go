@@ -0,0 +1,122 @@
+package esb
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/normalizemethod"
+)
+
+func TestBucketsPath(t *testing.T) {
+	tests := []struct {
+		path BucketsPath
+		want string
+	}{
+		{AggPath("sales_per_month", "sales"), "sales_per_month>sales"},
+		{AggPath("price_stats").Metric("avg"), "price_stats.avg"},
+		{AggPath("load_time").Percentile(99.9), "load_time[99.9]"},
+		{AggPath("sale_type").Key("hat").Then("sales"), "sale_type['hat']>sales"},
+		{AggPath("products").BucketCount(), "products._bucket_count"},
+		{DocCountPath, "_count"},
+	}
+	for _, tt := range tests {
+		if tt.path.String() != tt.want {
+			t.Errorf("期望 %s, 实际得到 %s", tt.want, tt.path)
+		}
+	}
+}
+
+func TestPipelineAggs(t *testing.T) {
+	aggs := NewAggregations(
+		DateHistogramAgg("sales_per_month", "date", "1M",
+			SumAgg("total_sales", "price"),
+			BucketScriptAgg("double", BucketsPathVars{"total": "total_sales"}, "params.total * 2"),
+			BucketSelectorAgg("big", BucketsPathVars{"total": "total_sales"}, "params.total > 200"),
+			BucketSortAgg("top", 3, SortFieldDesc("total_sales")),
+			MovingFnAgg("movavg", "total_sales", 10, "MovingFunctions.unweightedAvg(values)"),
+			SerialDiffAgg("diff", "total_sales", 7),
+			NormalizeAgg("percent", "total_sales", normalizemethod.Percentofsum),
+			CardinalityAgg("users", "user_id"),
+			CumulativeCardinalityAgg("total_users", "users"),
+			InferenceAgg("predict", "model", BucketsPathVars{"sales": "total_sales"}),
+		),
+	)
+	data, err := json.Marshal(aggs["sales_per_month"].Aggregations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"double":{"bucket_script":{"buckets_path":{"total":"total_sales"},"script":{"source":"params.total * 2"}}}`,
+		`"big":{"bucket_selector":{"buckets_path":{"total":"total_sales"},"script":{"source":"params.total \u003e 200"}}}`,
+		`"top":{"bucket_sort":{"size":3,"sort":[{"total_sales":{"order":"desc"}}]}}`,
+		`"movavg":{"moving_fn":{"buckets_path":"total_sales","script":"MovingFunctions.unweightedAvg(values)","window":10}}`,
+		`"diff":{"serial_diff":{"buckets_path":"total_sales","lag":7}}`,
+		`"percent":{"normalize":{"buckets_path":"total_sales","method":"percent_of_sum"}}`,
+		`"total_users":{"cumulative_cardinality":{"buckets_path":"users"}}`,
+		`"predict":{"inference":{"buckets_path":{"sales":"total_sales"},"model_id":"model"}}`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("期望包含 %s, 实际得到 %s", want, data)
+		}
+	}
+	if err := ValidateAggregations(aggs); err != nil {
+		t.Errorf("期望校验通过, 实际得到: %v", err)
+	}
+}
+
+func TestValidateAggregations(t *testing.T) {
+	t.Run("有效路径", func(t *testing.T) {
+		aggs := NewAggregations(
+			TermsAgg("sale_type", "type",
+				StatsAgg("price_stats", "price"),
+				PercentilesAgg("load_time", "load"),
+				FilterAgg("hats", Term("type", "hat")),
+				SubAgg("hats", SumAgg("sales", "price")),
+				BucketScriptAgg("ratio", BucketsPathVars{
+					"avg":   AggPath("price_stats").Metric("avg"),
+					"p99":   AggPath("load_time").Percentile(99),
+					"hats":  AggPath("hats", "sales"),
+					"count": DocCountPath,
+				}, "params.hats / params.count"),
+				BucketSortAgg("sort", 0, SortFieldAsc("_key")),
+			),
+			SumBucketAgg("all_hats", "sale_type>hats>sales"),
+		)
+		if err := ValidateAggregations(aggs); err != nil {
+			t.Errorf("期望校验通过, 实际得到: %v", err)
+		}
+	})
+
+	t.Run("无效路径", func(t *testing.T) {
+		aggs := NewAggregations(
+			DateHistogramAgg("sales_per_month", "date", "1M",
+				SumAgg("total_sales", "price"),
+				BucketScriptAgg("ratio", BucketsPathVars{"a": "total_sale"}, "params.a"),
+				BucketSortAgg("sort", 3, SortFieldDesc("missing")),
+			),
+			AvgBucketAgg("avg_sales", "sales_per_month>sales"),
+		)
+		err := ValidateAggregations(aggs)
+		if !errors.Is(err, ErrInvalidBucketsPath) {
+			t.Fatalf("期望ErrInvalidBucketsPath, 实际得到: %v", err)
+		}
+		for _, want := range []string{`"avg_sales"`, `"sales_per_month>ratio"`, `"sales_per_month>sort"`} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("期望错误包含 %s, 实际得到: %v", want, err)
+			}
+		}
+	})
+
+	t.Run("BucketSortAggWithOptions", func(t *testing.T) {
+		aggs := NewAggregations(BucketSortAggWithOptions("page", 0, nil, func(opts *types.BucketSortAggregation) {
+			from := 10
+			opts.From = &from
+		}))
+		if from := aggs["page"].BucketSort.From; from == nil || *from != 10 || aggs["page"].BucketSort.Size != nil {
+			t.Errorf("期望from为10且未设置size, 实际得到 %+v", aggs["page"].BucketSort)
+		}
+	})
+}
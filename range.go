@@ -1,6 +1,13 @@
 package esb
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
 	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/rangerelation"
 )
@@ -284,4 +291,417 @@ func (b *TermRangeBuilder) Build() QueryOption {
 			b.field: b.query,
 		}
 	}
-} 
\ No newline at end of file
+}
+
+// =============================================================================
+// 类型化的范围查询构建器
+// =============================================================================
+
+// IntRangeBuilder 提供了一个用于构建整数范围查询的流式接口。
+// 与 NumberRangeBuilder 不同，int64 的值不会因转换为 float64 而丢失精度。
+type IntRangeBuilder struct {
+	field string
+	query types.UntypedRangeQuery
+}
+
+// IntRange 创建一个用于整数范围查询的 IntRangeBuilder。
+// 适用于 long 类型的 id、雪花算法 id 以及超过 2^53 的时间戳。
+//
+// 示例：
+//   esb.IntRange("id").Gt(1234567890123456789).Build()
+//   esb.IntRange("timestamp_ns").Gte(start).Lt(end).Build()
+func IntRange(field string) *IntRangeBuilder {
+	return &IntRangeBuilder{
+		field: field,
+		query: types.UntypedRangeQuery{},
+	}
+}
+
+// maxExactInt 是 float64 可以精确表示的最大整数 2^53。
+const maxExactInt = 1 << 53
+
+// intRangeValue 序列化整数端点。端点本身是原样输出的 json.RawMessage，但 types.Query 的 MarshalJSON
+// 会先将查询解码为 map[string]any 再重新编码，其中的 JSON 数字会变为 float64，
+// 因此超过 2^53 的整数使用字符串表示，Elasticsearch 会按 long 精确解析。
+func intRangeValue(value int64) json.RawMessage {
+	if value > maxExactInt || value < -maxExactInt {
+		return json.RawMessage(strconv.Quote(strconv.FormatInt(value, 10)))
+	}
+	return json.RawMessage(strconv.FormatInt(value, 10))
+}
+
+// Gte 设置整数的"大于等于"条件。
+func (b *IntRangeBuilder) Gte(value int64) *IntRangeBuilder {
+	b.query.Gte = intRangeValue(value)
+	return b
+}
+
+// Gt 设置整数的"大于"条件。
+func (b *IntRangeBuilder) Gt(value int64) *IntRangeBuilder {
+	b.query.Gt = intRangeValue(value)
+	return b
+}
+
+// Lte 设置整数的"小于等于"条件。
+func (b *IntRangeBuilder) Lte(value int64) *IntRangeBuilder {
+	b.query.Lte = intRangeValue(value)
+	return b
+}
+
+// Lt 设置整数的"小于"条件。
+func (b *IntRangeBuilder) Lt(value int64) *IntRangeBuilder {
+	b.query.Lt = intRangeValue(value)
+	return b
+}
+
+// From 设置整数的"起始"条件（包含）。
+func (b *IntRangeBuilder) From(value int64) *IntRangeBuilder {
+	raw := intRangeValue(value)
+	b.query.From = &raw
+	return b
+}
+
+// To 设置整数的"结束"条件（包含）。
+func (b *IntRangeBuilder) To(value int64) *IntRangeBuilder {
+	raw := intRangeValue(value)
+	b.query.To = &raw
+	return b
+}
+
+// Boost 设置整数范围查询的权重值。
+func (b *IntRangeBuilder) Boost(boost float32) *IntRangeBuilder {
+	b.query.Boost = &boost
+	return b
+}
+
+// QueryName 设置整数范围查询的查询名称。
+func (b *IntRangeBuilder) QueryName(name string) *IntRangeBuilder {
+	b.query.QueryName_ = &name
+	return b
+}
+
+// Relation 设置整数范围查询的关系。
+func (b *IntRangeBuilder) Relation(relation *rangerelation.RangeRelation) *IntRangeBuilder {
+	b.query.Relation = relation
+	return b
+}
+
+// Build 从配置的整数范围构建器创建 QueryOption。
+func (b *IntRangeBuilder) Build() QueryOption {
+	query := b.query
+	return func(q *types.Query) {
+		q.Range = map[string]types.RangeQuery{
+			b.field: &query,
+		}
+	}
+}
+
+// TimeRangeFormat 是 TimeRangeBuilder 序列化 time.Time 时使用的日期格式。
+const TimeRangeFormat = "strict_date_optional_time"
+
+// TimeRangeBuilder 提供了一个使用 time.Time 构建日期范围查询的流式接口。
+// 时间按 RFC3339 序列化（保留纳秒与时区偏移），format 与 time_zone 自动设置。
+type TimeRangeBuilder struct {
+	field    string
+	query    types.DateRangeQuery
+	location *time.Location
+}
+
+// TimeRange 创建一个使用 time.Time 的 TimeRangeBuilder。
+// 未调用 TimeZone 时，time_zone 取第一个设置的时间所在的时区。
+//
+// 示例：
+//   esb.TimeRange("created_at").Gte(start).Lt(end).Build()
+//   esb.TimeRange("created_at").Gte(time.Now().AddDate(0, 0, -7)).Build()
+func TimeRange(field string) *TimeRangeBuilder {
+	return &TimeRangeBuilder{
+		field: field,
+		query: types.DateRangeQuery{},
+	}
+}
+
+func (b *TimeRangeBuilder) value(t time.Time) *string {
+	if b.location == nil {
+		b.location = t.Location()
+	}
+	value := t.Format(time.RFC3339Nano)
+	return &value
+}
+
+// Gte 设置时间的"大于等于"条件。
+func (b *TimeRangeBuilder) Gte(t time.Time) *TimeRangeBuilder {
+	b.query.Gte = b.value(t)
+	return b
+}
+
+// Gt 设置时间的"大于"条件。
+func (b *TimeRangeBuilder) Gt(t time.Time) *TimeRangeBuilder {
+	b.query.Gt = b.value(t)
+	return b
+}
+
+// Lte 设置时间的"小于等于"条件。
+func (b *TimeRangeBuilder) Lte(t time.Time) *TimeRangeBuilder {
+	b.query.Lte = b.value(t)
+	return b
+}
+
+// Lt 设置时间的"小于"条件。
+func (b *TimeRangeBuilder) Lt(t time.Time) *TimeRangeBuilder {
+	b.query.Lt = b.value(t)
+	return b
+}
+
+// From 设置时间的"起始"条件（包含）。
+func (b *TimeRangeBuilder) From(t time.Time) *TimeRangeBuilder {
+	b.query.From = b.value(t)
+	return b
+}
+
+// To 设置时间的"结束"条件（包含）。
+func (b *TimeRangeBuilder) To(t time.Time) *TimeRangeBuilder {
+	b.query.To = b.value(t)
+	return b
+}
+
+// TimeZone 指定查询的时区，覆盖从时间值推断的时区。
+func (b *TimeRangeBuilder) TimeZone(location *time.Location) *TimeRangeBuilder {
+	b.location = location
+	return b
+}
+
+// Boost 设置时间范围查询的权重值。
+func (b *TimeRangeBuilder) Boost(boost float32) *TimeRangeBuilder {
+	b.query.Boost = &boost
+	return b
+}
+
+// QueryName 设置时间范围查询的查询名称。
+func (b *TimeRangeBuilder) QueryName(name string) *TimeRangeBuilder {
+	b.query.QueryName_ = &name
+	return b
+}
+
+// Relation 设置时间范围查询的关系。
+func (b *TimeRangeBuilder) Relation(relation *rangerelation.RangeRelation) *TimeRangeBuilder {
+	b.query.Relation = relation
+	return b
+}
+
+// Build 从配置的时间范围构建器创建 QueryOption。
+func (b *TimeRangeBuilder) Build() QueryOption {
+	query := b.query
+	format := TimeRangeFormat
+	query.Format = &format
+	if b.location != nil {
+		timeZone := timeZoneName(b.location)
+		query.TimeZone = &timeZone
+	}
+	return func(q *types.Query) {
+		q.Range = map[string]types.RangeQuery{
+			b.field: query,
+		}
+	}
+}
+
+// timeZoneName 返回 Elasticsearch 可以识别的时区：IANA 名称或 "+08:00" 形式的偏移量。
+// 无法确定 IANA 名称时（如 time.FixedZone）使用当前的偏移量代替。
+func timeZoneName(location *time.Location) string {
+	if name, ok := ianaZoneName(location); ok {
+		return name
+	}
+	return time.Now().In(location).Format("-07:00")
+}
+
+// ianaZoneName 返回时区的 IANA 名称。time.Local 的名称是 "Local"，
+// 需要与 time 包一样从 TZ 环境变量或 /etc/localtime 确定系统时区。
+func ianaZoneName(location *time.Location) (string, bool) {
+	name := location.String()
+	if location == time.Local {
+		name = localZoneName()
+	}
+	if name == "" || name == "Local" {
+		return "", false
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return "", false
+	}
+	return name, true
+}
+
+// localZoneName 返回系统时区的 IANA 名称，无法确定时返回空字符串。
+func localZoneName() string {
+	if tz, ok := os.LookupEnv("TZ"); ok {
+		tz = strings.TrimPrefix(tz, ":")
+		if tz == "" {
+			return "UTC"
+		}
+		if filepath.IsAbs(tz) {
+			return zoneNameFromPath(tz)
+		}
+		return tz
+	}
+	return zoneNameFromPath("/etc/localtime")
+}
+
+// zoneNameFromPath 从时区文件的路径（如 /usr/share/zoneinfo/Asia/Shanghai）中取出 IANA 名称。
+func zoneNameFromPath(path string) string {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return ""
+	}
+	_, name, _ := strings.Cut(filepath.ToSlash(target), "zoneinfo/")
+	return name
+}
+
+// RangeValue 是 Range 支持的值类型。
+type RangeValue interface {
+	int | int64 | float64 | time.Time
+}
+
+// RangeBuilder 是根据值类型选择 IntRangeBuilder、NumberRangeBuilder 或 TimeRangeBuilder 的泛型范围查询构建器。
+type RangeBuilder[T RangeValue] struct {
+	field                    string
+	gte, gt, lte, lt, fr, to *T
+	boost                    *float32
+	name                     *string
+	relation                 *rangerelation.RangeRelation
+}
+
+// Range 创建一个泛型范围查询构建器，int、int64 按整数精确序列化，float64 按数值序列化，
+// time.Time 自动设置 format 与 time_zone。
+//
+// 示例：
+//   esb.Range[int64]("id").Gt(lastID).Build()
+//   esb.Range[float64]("price").Gte(10).Lt(100).Build()
+//   esb.Range[time.Time]("created_at").Gte(start).Build()
+func Range[T RangeValue](field string) *RangeBuilder[T] {
+	return &RangeBuilder[T]{
+		field: field,
+	}
+}
+
+// Gte 设置"大于等于"条件。
+func (b *RangeBuilder[T]) Gte(value T) *RangeBuilder[T] {
+	b.gte = &value
+	return b
+}
+
+// Gt 设置"大于"条件。
+func (b *RangeBuilder[T]) Gt(value T) *RangeBuilder[T] {
+	b.gt = &value
+	return b
+}
+
+// Lte 设置"小于等于"条件。
+func (b *RangeBuilder[T]) Lte(value T) *RangeBuilder[T] {
+	b.lte = &value
+	return b
+}
+
+// Lt 设置"小于"条件。
+func (b *RangeBuilder[T]) Lt(value T) *RangeBuilder[T] {
+	b.lt = &value
+	return b
+}
+
+// From 设置"起始"条件（包含）。
+func (b *RangeBuilder[T]) From(value T) *RangeBuilder[T] {
+	b.fr = &value
+	return b
+}
+
+// To 设置"结束"条件（包含）。
+func (b *RangeBuilder[T]) To(value T) *RangeBuilder[T] {
+	b.to = &value
+	return b
+}
+
+// Boost 设置范围查询的权重值。
+func (b *RangeBuilder[T]) Boost(boost float32) *RangeBuilder[T] {
+	b.boost = &boost
+	return b
+}
+
+// QueryName 设置范围查询的查询名称。
+func (b *RangeBuilder[T]) QueryName(name string) *RangeBuilder[T] {
+	b.name = &name
+	return b
+}
+
+// Relation 设置范围查询的关系。
+func (b *RangeBuilder[T]) Relation(relation *rangerelation.RangeRelation) *RangeBuilder[T] {
+	b.relation = relation
+	return b
+}
+
+// rangeSetter 将泛型端点依次应用到具体的构建器上。
+type rangeSetter[T RangeValue] struct {
+	gte, gt, lte, lt, from, to func(T)
+}
+
+func (b *RangeBuilder[T]) apply(s rangeSetter[T]) {
+	for _, bound := range []struct {
+		value *T
+		set   func(T)
+	}{{b.gte, s.gte}, {b.gt, s.gt}, {b.lte, s.lte}, {b.lt, s.lt}, {b.fr, s.from}, {b.to, s.to}} {
+		if bound.value != nil {
+			bound.set(*bound.value)
+		}
+	}
+}
+
+// Build 从配置的范围构建器创建 QueryOption。
+func (b *RangeBuilder[T]) Build() QueryOption {
+	var option QueryOption
+	var zero T
+	switch any(zero).(type) {
+	case time.Time:
+		builder := TimeRange(b.field)
+		b.apply(rangeSetter[T]{
+			gte:  func(v T) { builder.Gte(any(v).(time.Time)) },
+			gt:   func(v T) { builder.Gt(any(v).(time.Time)) },
+			lte:  func(v T) { builder.Lte(any(v).(time.Time)) },
+			lt:   func(v T) { builder.Lt(any(v).(time.Time)) },
+			from: func(v T) { builder.From(any(v).(time.Time)) },
+			to:   func(v T) { builder.To(any(v).(time.Time)) },
+		})
+		builder.query.Boost, builder.query.QueryName_, builder.query.Relation = b.boost, b.name, b.relation
+		option = builder.Build()
+	case float64:
+		builder := NumberRange(b.field)
+		b.apply(rangeSetter[T]{
+			gte:  func(v T) { builder.Gte(any(v).(float64)) },
+			gt:   func(v T) { builder.Gt(any(v).(float64)) },
+			lte:  func(v T) { builder.Lte(any(v).(float64)) },
+			lt:   func(v T) { builder.Lt(any(v).(float64)) },
+			from: func(v T) { builder.From(any(v).(float64)) },
+			to:   func(v T) { builder.To(any(v).(float64)) },
+		})
+		builder.query.Boost, builder.query.QueryName_, builder.query.Relation = b.boost, b.name, b.relation
+		option = builder.Build()
+	default:
+		builder := IntRange(b.field)
+		b.apply(rangeSetter[T]{
+			gte:  func(v T) { builder.Gte(rangeInt(v)) },
+			gt:   func(v T) { builder.Gt(rangeInt(v)) },
+			lte:  func(v T) { builder.Lte(rangeInt(v)) },
+			lt:   func(v T) { builder.Lt(rangeInt(v)) },
+			from: func(v T) { builder.From(rangeInt(v)) },
+			to:   func(v T) { builder.To(rangeInt(v)) },
+		})
+		builder.query.Boost, builder.query.QueryName_, builder.query.Relation = b.boost, b.name, b.relation
+		option = builder.Build()
+	}
+	return option
+}
+
+func rangeInt[T RangeValue](v T) int64 {
+	switch v := any(v).(type) {
+	case int:
+		return int64(v)
+	case int64:
+		return v
+	}
+	return 0
+}
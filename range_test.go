@@ -1,7 +1,9 @@
 package esb
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
 	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/rangerelation"
 )
@@ -1050,4 +1052,132 @@ func TestRangeBuilderCombinations(t *testing.T) {
 			t.Errorf("期望Relation为Intersects, 实际得到: %s", *termRange.Relation)
 		}
 	})
-} 
\ No newline at end of file
+} 
+
+// =============================================================================
+// 类型化范围构建器测试
+// =============================================================================
+
+func TestIntRangeBuilder(t *testing.T) {
+	t.Run("超过2^53的int64使用字符串", func(t *testing.T) {
+		query := NewQuery(IntRange("id").Gt(9007199254740993).Lte(9223372036854775807).Lt(-9007199254740993).Gte(9007199254740992).Build())
+		want := `{"range":{"id":{"gt":"9007199254740993","gte":9007199254740992,"lt":"-9007199254740993","lte":"9223372036854775807"}}}`
+		if got := mustJSON(t, query); got != want {
+			t.Errorf("期望 %s, 实际得到 %s", want, got)
+		}
+	})
+
+	t.Run("types.Query序列化会丢失数字形式的大整数精度", func(t *testing.T) {
+		query := NewQuery(func(q *types.Query) {
+			q.Range = map[string]types.RangeQuery{"id": &types.UntypedRangeQuery{Gt: json.RawMessage("9007199254740993")}}
+		})
+		if got := mustJSON(t, query); got == `{"range":{"id":{"gt":9007199254740993}}}` {
+			t.Errorf("types.Query已经保留数字精度, IntRange可以改为输出数字: %s", got)
+		}
+	})
+
+	t.Run("全部选项", func(t *testing.T) {
+		query := NewQuery(IntRange("id").From(-1).To(1).Gte(-1).Lt(2).Boost(2).QueryName("ids").Relation(&rangerelation.Within).Build())
+		want := `{"range":{"id":{"_name":"ids","boost":2,"from":-1,"gte":-1,"lt":2,"relation":"within","to":1}}}`
+		if got := mustJSON(t, query); got != want {
+			t.Errorf("期望 %s, 实际得到 %s", want, got)
+		}
+	})
+
+	t.Run("构建后修改不影响已构建的查询", func(t *testing.T) {
+		builder := IntRange("id").Gte(1)
+		option := builder.Build()
+		builder.Lt(10)
+		if got := mustJSON(t, NewQuery(option)); got != `{"range":{"id":{"gte":1}}}` {
+			t.Errorf("期望只包含gte, 实际得到 %s", got)
+		}
+	})
+}
+
+func TestTimeRangeBuilder(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip("缺少时区数据")
+	}
+	start := time.Date(2024, 1, 1, 8, 0, 0, 0, shanghai)
+	end := time.Date(2024, 1, 2, 8, 0, 0, 500, shanghai)
+
+	t.Run("自动设置format与time_zone", func(t *testing.T) {
+		query := NewQuery(TimeRange("created_at").Gte(start).Lt(end).Build())
+		want := `{"range":{"created_at":{"format":"strict_date_optional_time","gte":"2024-01-01T08:00:00+08:00","lt":"2024-01-02T08:00:00.0000005+08:00","time_zone":"Asia/Shanghai"}}}`
+		if got := mustJSON(t, query); got != want {
+			t.Errorf("期望 %s, 实际得到 %s", want, got)
+		}
+	})
+
+	t.Run("UTC", func(t *testing.T) {
+		query := NewQuery(TimeRange("created_at").Lte(start.UTC()).Build())
+		want := `{"range":{"created_at":{"format":"strict_date_optional_time","lte":"2024-01-01T00:00:00Z","time_zone":"UTC"}}}`
+		if got := mustJSON(t, query); got != want {
+			t.Errorf("期望 %s, 实际得到 %s", want, got)
+		}
+	})
+
+	t.Run("固定偏移量时区", func(t *testing.T) {
+		query := NewQuery(TimeRange("created_at").Gt(start.In(time.FixedZone("CST", -6*3600))).Build())
+		want := `{"range":{"created_at":{"format":"strict_date_optional_time","gt":"2023-12-31T18:00:00-06:00","time_zone":"-06:00"}}}`
+		if got := mustJSON(t, query); got != want {
+			t.Errorf("期望 %s, 实际得到 %s", want, got)
+		}
+	})
+
+	t.Run("指定时区", func(t *testing.T) {
+		query := NewQuery(TimeRange("created_at").TimeZone(time.UTC).Gte(start).Build())
+		rangeQuery := query.Range["created_at"].(types.DateRangeQuery)
+		if rangeQuery.TimeZone == nil || *rangeQuery.TimeZone != "UTC" {
+			t.Errorf("期望time_zone为UTC, 实际得到: %v", rangeQuery.TimeZone)
+		}
+	})
+
+	t.Run("time.Local使用IANA名称", func(t *testing.T) {
+		// 使用夏令时时区：固定偏移量会让跨越夏令时切换的范围按错误的偏移量解析
+		t.Setenv("TZ", "America/New_York")
+		query := NewQuery(TimeRange("created_at").TimeZone(time.Local).Gte(start).Build())
+		rangeQuery := query.Range["created_at"].(types.DateRangeQuery)
+		if rangeQuery.TimeZone == nil || *rangeQuery.TimeZone != "America/New_York" {
+			t.Errorf("期望time_zone为America/New_York, 实际得到: %v", rangeQuery.TimeZone)
+		}
+	})
+}
+
+func TestRangeGeneric(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		query QueryOption
+		want  string
+	}{
+		{
+			"int",
+			Range[int]("age").Gte(18).Lt(65).Build(),
+			`{"range":{"age":{"gte":18,"lt":65}}}`,
+		},
+		{
+			"int64",
+			Range[int64]("id").Gt(9007199254740993).QueryName("after").Build(),
+			`{"range":{"id":{"_name":"after","gt":"9007199254740993"}}}`,
+		},
+		{
+			"float64",
+			Range[float64]("price").From(9.5).To(100).Boost(2).Build(),
+			`{"range":{"price":{"boost":2,"from":9.5,"to":100}}}`,
+		},
+		{
+			"time.Time",
+			Range[time.Time]("created_at").Gte(start).Lte(start.AddDate(0, 1, 0)).Relation(&rangerelation.Contains).Build(),
+			`{"range":{"created_at":{"format":"strict_date_optional_time","gte":"2024-01-01T00:00:00Z","lte":"2024-02-01T00:00:00Z","relation":"contains","time_zone":"UTC"}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mustJSON(t, NewQuery(tt.query)); got != tt.want {
+				t.Errorf("期望 %s, 实际得到 %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -76,4 +76,34 @@ func ShapeWithOptions(field string, shape string, setOpts func(shapeQuery *types
 		shapeQuery.ShapeQuery[field] = fieldQuery
 		q.Shape = shapeQuery
 	}
-} 
\ No newline at end of file
+}
+
+// ShapeOf 使用结构化的几何形状创建形状查询。shape 字段使用笛卡尔坐标，Point 的 Lon 对应 x、Lat 对应 y。
+// 不会校验 shape，调用方需要先调用 shape.Validate()；Validate 按经纬度范围检查坐标，超出该范围的笛卡尔坐标需要调用方自行检查。
+//
+// 示例：
+//   esb.ShapeOf("location", esb.Point{Lat: 53.0, Lon: 13.0})
+func ShapeOf(field string, shape Geometry) QueryOption {
+	return func(q *types.Query) {
+		query := types.NewShapeQuery()
+		query.ShapeQuery[field] = types.ShapeFieldQuery{
+			Shape: geometryJSON(shape),
+		}
+		q.Shape = query
+	}
+}
+
+// ShapeOfWithRelation 创建一个带有空间关系的形状查询。与 ShapeOf 相同，不会校验 shape，调用方需要先调用 shape.Validate()。
+//
+// 示例：
+//   esb.ShapeOfWithRelation("location", envelope, geoshaperelation.Within)
+func ShapeOfWithRelation(field string, shape Geometry, relation geoshaperelation.GeoShapeRelation) QueryOption {
+	return func(q *types.Query) {
+		query := types.NewShapeQuery()
+		query.ShapeQuery[field] = types.ShapeFieldQuery{
+			Shape:    geometryJSON(shape),
+			Relation: &relation,
+		}
+		q.Shape = query
+	}
+}
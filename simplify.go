@@ -0,0 +1,612 @@
+package esb
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+// Simplify 返回一个与 q 语义等价（匹配结果与得分均不变）但结构更精简的新查询，q 本身不会被修改。
+// 动态拼装的查询经常出现多层只含一个子句的 Bool、重复的过滤条件等，Simplify 会按以下规则进行整理：
+//   - 展开语义兼容的嵌套 Bool：must 中不含 should 的 Bool、filter 中的纯过滤 Bool、should 中的纯 should Bool、must_not 中的纯 should Bool
+//   - 只有一个子句且不影响得分的 Bool 直接替换为该子句
+//   - 去除 filter、must_not 以及非评分上下文中 should 的重复子句
+//   - 将 must_not 以及非评分上下文 should 中同一字段的 Term/Terms 合并为一个 Terms
+//   - 合并同一字段上的 NumberRange/DateRange：filter 中保留更严格的区间，must_not 与非评分 should 中合并重叠区间
+//   - ConstantScore、filter、must_not 等非评分上下文中的 must 子句改写为 filter
+//
+// 设置了 boost、_name 或 minimum_should_match 的 Bool 不会被展开到父查询中。
+//
+// 示例：
+//   query := esb.Simplify(esb.NewQuery(
+//       esb.Bool(
+//           esb.Filter(
+//               esb.Bool(esb.Filter(esb.Term("status", "published"))),
+//               esb.Term("status", "published"),
+//           ),
+//       ),
+//   ))
+//   // 等价于 esb.NewQuery(esb.BoolFilter(esb.Term("status", "published")))
+func Simplify(q *types.Query) *types.Query {
+	if q == nil {
+		return nil
+	}
+	simplified := simplifyQuery(*q, true, true)
+	return &simplified
+}
+
+// simplifyStructure 只进行与字面值无关的化简（展开嵌套 Bool、改写非评分上下文的 must），
+// 不去重也不合并子句，因此形状相同的查询化简后形状仍然相同。
+func simplifyStructure(q *types.Query) *types.Query {
+	if q == nil {
+		return nil
+	}
+	simplified := simplifyQuery(*q, true, false)
+	return &simplified
+}
+
+// simplifyQuery 在给定上下文中化简单个查询，scoring 表示该查询的得分是否会被使用，
+// merge 表示是否根据子句的值去重与合并子句。
+func simplifyQuery(q types.Query, scoring, merge bool) types.Query {
+	if q.Bool != nil && isOnlyKind(q) {
+		return simplifyBool(*q.Bool, scoring, merge)
+	}
+	if q.ConstantScore != nil {
+		constantScore := *q.ConstantScore
+		constantScore.Filter = simplifyQuery(constantScore.Filter, false, merge)
+		q.ConstantScore = &constantScore
+	}
+	if q.Nested != nil {
+		nested := *q.Nested
+		nested.Query = simplifyQuery(nested.Query, scoring, merge)
+		q.Nested = &nested
+	}
+	if q.Boosting != nil {
+		boosting := *q.Boosting
+		boosting.Positive = simplifyQuery(boosting.Positive, scoring, merge)
+		boosting.Negative = simplifyQuery(boosting.Negative, false, merge)
+		q.Boosting = &boosting
+	}
+	if q.DisMax != nil {
+		disMax := *q.DisMax
+		disMax.Queries = make([]types.Query, len(q.DisMax.Queries))
+		for i, sub := range q.DisMax.Queries {
+			disMax.Queries[i] = simplifyQuery(sub, scoring, merge)
+		}
+		q.DisMax = &disMax
+	}
+	return q
+}
+
+// simplifyBool 化简一个布尔查询，返回值可能不再是布尔查询。
+func simplifyBool(b types.BoolQuery, scoring, merge bool) types.Query {
+	out := types.BoolQuery{
+		Boost:              b.Boost,
+		MinimumShouldMatch: b.MinimumShouldMatch,
+		QueryName_:         b.QueryName_,
+	}
+	hasPositive := len(b.Must)+len(b.Filter) > 0
+
+	for _, clause := range b.Must {
+		clause = simplifyQuery(clause, scoring, merge)
+		if !scoring {
+			// 非评分上下文中 must 与 filter 等价
+			appendFilterClause(&out, clause)
+			continue
+		}
+		if child, ok := liftableBool(clause); ok && len(child.Should) == 0 && len(child.Must)+len(child.Filter) > 0 {
+			out.Must = append(out.Must, child.Must...)
+			out.Filter = append(out.Filter, child.Filter...)
+			out.MustNot = append(out.MustNot, child.MustNot...)
+			continue
+		}
+		out.Must = append(out.Must, clause)
+	}
+
+	for _, clause := range b.Filter {
+		appendFilterClause(&out, simplifyQuery(clause, false, merge))
+	}
+
+	for _, clause := range b.Should {
+		clause = simplifyQuery(clause, scoring, merge)
+		if child, ok := liftableBool(clause); ok && b.MinimumShouldMatch == nil && isShouldOnly(child) {
+			out.Should = append(out.Should, child.Should...)
+			continue
+		}
+		out.Should = append(out.Should, clause)
+	}
+
+	for _, clause := range b.MustNot {
+		clause = simplifyQuery(clause, false, merge)
+		// not (a or b) 等价于 (not a) and (not b)
+		if child, ok := liftableBool(clause); ok && isShouldOnly(child) {
+			out.MustNot = append(out.MustNot, child.Should...)
+			continue
+		}
+		out.MustNot = append(out.MustNot, clause)
+	}
+
+	if merge {
+		out.Filter = mergeRangeClauses(dedupeClauses(out.Filter), false)
+		out.MustNot = mergeRangeClauses(mergeTermClauses(dedupeClauses(out.MustNot)), true)
+		if !scoring && out.MinimumShouldMatch == nil {
+			out.Should = mergeRangeClauses(mergeTermClauses(dedupeClauses(out.Should)), true)
+		}
+	}
+
+	// minimum_should_match 超过 should 子句数量时不匹配任何文档，因此只展开未设置该参数的 Bool
+	if out.Boost == nil && out.QueryName_ == nil && out.MinimumShouldMatch == nil {
+		total := len(out.Must) + len(out.Filter) + len(out.Should) + len(out.MustNot)
+		switch {
+		case total != 1:
+		case len(out.Must) == 1:
+			return out.Must[0]
+		case len(out.Filter) == 1 && !scoring:
+			return out.Filter[0]
+		case len(out.Should) == 1 && !hasPositive:
+			return out.Should[0]
+		}
+	}
+	return types.Query{Bool: &out}
+}
+
+// appendFilterClause 将子句加入 filter，纯过滤语义的子 Bool 会被展开。
+func appendFilterClause(out *types.BoolQuery, clause types.Query) {
+	if child, ok := liftableBool(clause); ok && len(child.Should) == 0 && len(child.Must)+len(child.Filter) > 0 {
+		out.Filter = append(out.Filter, child.Must...)
+		out.Filter = append(out.Filter, child.Filter...)
+		out.MustNot = append(out.MustNot, child.MustNot...)
+		return
+	}
+	out.Filter = append(out.Filter, clause)
+}
+
+// liftableBool 判断查询是否为可以被展开到父查询中的布尔查询。
+func liftableBool(q types.Query) (*types.BoolQuery, bool) {
+	if q.Bool == nil || !isOnlyKind(q) {
+		return nil, false
+	}
+	b := q.Bool
+	if b.Boost != nil || b.QueryName_ != nil || b.MinimumShouldMatch != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+// isShouldOnly 判断布尔查询是否只包含 should 子句。
+func isShouldOnly(b *types.BoolQuery) bool {
+	return len(b.Should) > 0 && len(b.Must)+len(b.Filter)+len(b.MustNot) == 0
+}
+
+// isOnlyKind 判断 types.Query 是否只设置了一种查询类型。
+func isOnlyKind(q types.Query) bool {
+	return queryKindCount(q) == 1
+}
+
+// queryKindCount 统计 types.Query 中已设置的查询类型数量。
+func queryKindCount(q types.Query) int {
+	count := 0
+	v := reflect.ValueOf(q)
+	for i := 0; i < v.NumField(); i++ {
+		if !v.Field(i).IsZero() {
+			count++
+		}
+	}
+	return count
+}
+
+// clauseKey 返回子句的规范化 JSON 表示，用于判断两个子句是否相同。
+func clauseKey(q types.Query) (string, bool) {
+	data, err := json.Marshal(q)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// dedupeClauses 去除重复的子句，保留首次出现的顺序。
+func dedupeClauses(clauses []types.Query) []types.Query {
+	if len(clauses) < 2 {
+		return clauses
+	}
+	seen := make(map[string]struct{}, len(clauses))
+	result := make([]types.Query, 0, len(clauses))
+	for _, clause := range clauses {
+		key, ok := clauseKey(clause)
+		if ok {
+			if _, exists := seen[key]; exists {
+				continue
+			}
+			seen[key] = struct{}{}
+		}
+		result = append(result, clause)
+	}
+	return result
+}
+
+// mergeTermClauses 将同一字段上的多个 Term/Terms 子句合并为一个 Terms 子句，
+// 仅适用于“或”语义的子句列表（must_not 或必须匹配其一的 should）。
+func mergeTermClauses(clauses []types.Query) []types.Query {
+	if len(clauses) < 2 {
+		return clauses
+	}
+	type group struct {
+		index  int
+		count  int
+		values []types.FieldValue
+		seen   map[string]struct{}
+	}
+	groups := make(map[string]*group)
+	fields := make([]string, len(clauses))
+	for i, clause := range clauses {
+		field, values, ok := termValues(clause)
+		if !ok {
+			continue
+		}
+		fields[i] = field
+		g, exists := groups[field]
+		if !exists {
+			g = &group{index: i, seen: make(map[string]struct{})}
+			groups[field] = g
+		}
+		g.count++
+		for _, value := range values {
+			data, err := json.Marshal(value)
+			if err == nil {
+				if _, dup := g.seen[string(data)]; dup {
+					continue
+				}
+				g.seen[string(data)] = struct{}{}
+			}
+			g.values = append(g.values, value)
+		}
+	}
+
+	result := make([]types.Query, 0, len(clauses))
+	for i, clause := range clauses {
+		g, ok := groups[fields[i]]
+		if fields[i] == "" || !ok || g.count < 2 {
+			result = append(result, clause)
+			continue
+		}
+		if g.index == i {
+			result = append(result, *NewQuery(TermsSlice(fields[i], g.values)))
+		}
+	}
+	return result
+}
+
+// termValues 提取不带任何附加选项的 Term/Terms 子句的字段和值。
+func termValues(q types.Query) (string, []types.FieldValue, bool) {
+	if !isOnlyKind(q) {
+		return "", nil, false
+	}
+	if len(q.Term) == 1 {
+		for field, term := range q.Term {
+			if term.Boost != nil || term.CaseInsensitive != nil || term.QueryName_ != nil {
+				return "", nil, false
+			}
+			return field, []types.FieldValue{term.Value}, true
+		}
+	}
+	if q.Terms != nil && len(q.Terms.TermsQuery) == 1 && q.Terms.Boost == nil && q.Terms.QueryName_ == nil {
+		for field, raw := range q.Terms.TermsQuery {
+			v := reflect.ValueOf(raw)
+			if v.Kind() != reflect.Slice {
+				// terms lookup 等非值列表形式无法合并
+				return "", nil, false
+			}
+			values := make([]types.FieldValue, v.Len())
+			for i := range values {
+				values[i] = v.Index(i).Interface()
+			}
+			return field, values, true
+		}
+	}
+	return "", nil, false
+}
+
+// rangeBound 表示区间的一个端点。
+type rangeBound struct {
+	present   bool
+	inclusive bool
+	number    float64
+	date      time.Time
+	layout    string
+	raw       string
+}
+
+// rangeInterval 表示一个可比较的 NumberRange/DateRange 子句。
+type rangeInterval struct {
+	field    string
+	isDate   bool
+	format   *string
+	timeZone *string
+	layout   string
+	lower    rangeBound
+	upper    rangeBound
+}
+
+// rangeDateLayouts 是合并 DateRange 时能够识别的日期格式，其它格式（包括日期数学表达式）不参与合并。
+// 不带时区偏移的端点由 Elasticsearch 按 time_zone 解释，日期格式的端点还会按 gt/lte 舍入到一天的结束，
+// 因此只有使用同一格式的端点之间才会比较。
+var rangeDateLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"}
+
+// mergeRangeClauses 合并同一字段上的范围子句。
+// union 为 false 时子句之间是“且”关系，保留被包含的更严格区间；
+// union 为 true 时子句之间是“或”关系，重叠或相接的区间合并为一个。
+func mergeRangeClauses(clauses []types.Query, union bool) []types.Query {
+	if len(clauses) < 2 {
+		return clauses
+	}
+	intervals := make([]*rangeInterval, len(clauses))
+	candidates := 0
+	for i, clause := range clauses {
+		if interval, ok := rangeIntervalOf(clause); ok {
+			intervals[i] = interval
+			candidates++
+		}
+	}
+	if candidates < 2 {
+		return clauses
+	}
+
+	removed := make([]bool, len(clauses))
+	changed := make([]bool, len(clauses))
+	for merged := true; merged; {
+		merged = false
+		for i := range intervals {
+			if intervals[i] == nil || removed[i] {
+				continue
+			}
+			for j := i + 1; j < len(intervals); j++ {
+				if intervals[j] == nil || removed[j] || !intervals[i].sameGroup(intervals[j]) {
+					continue
+				}
+				a, b := intervals[i], intervals[j]
+				switch {
+				case union:
+					combined, ok := a.union(b)
+					if !ok {
+						continue
+					}
+					intervals[i] = combined
+					changed[i] = true
+				case a.within(b):
+				case b.within(a):
+					intervals[i] = b
+					changed[i] = true
+				default:
+					continue
+				}
+				removed[j] = true
+				merged = true
+			}
+		}
+	}
+
+	result := make([]types.Query, 0, len(clauses))
+	for i, clause := range clauses {
+		if removed[i] {
+			continue
+		}
+		if changed[i] {
+			clause = intervals[i].query()
+		}
+		result = append(result, clause)
+	}
+	return result
+}
+
+// rangeIntervalOf 提取不带附加选项的数值或日期范围子句。
+func rangeIntervalOf(q types.Query) (*rangeInterval, bool) {
+	if len(q.Range) != 1 || !isOnlyKind(q) {
+		return nil, false
+	}
+	for field, raw := range q.Range {
+		switch r := raw.(type) {
+		case *types.NumberRangeQuery:
+			if r == nil {
+				return nil, false
+			}
+			return numberInterval(field, *r)
+		case types.NumberRangeQuery:
+			return numberInterval(field, r)
+		case *types.DateRangeQuery:
+			if r == nil {
+				return nil, false
+			}
+			return dateInterval(field, *r)
+		case types.DateRangeQuery:
+			return dateInterval(field, r)
+		}
+	}
+	return nil, false
+}
+
+func numberInterval(field string, r types.NumberRangeQuery) (*rangeInterval, bool) {
+	if r.Boost != nil || r.QueryName_ != nil || r.Relation != nil || r.From != nil || r.To != nil {
+		return nil, false
+	}
+	if (r.Gt != nil && r.Gte != nil) || (r.Lt != nil && r.Lte != nil) {
+		return nil, false
+	}
+	interval := &rangeInterval{field: field}
+	if r.Gte != nil {
+		interval.lower = rangeBound{present: true, inclusive: true, number: float64(*r.Gte)}
+	} else if r.Gt != nil {
+		interval.lower = rangeBound{present: true, number: float64(*r.Gt)}
+	}
+	if r.Lte != nil {
+		interval.upper = rangeBound{present: true, inclusive: true, number: float64(*r.Lte)}
+	} else if r.Lt != nil {
+		interval.upper = rangeBound{present: true, number: float64(*r.Lt)}
+	}
+	return interval, true
+}
+
+func dateInterval(field string, r types.DateRangeQuery) (*rangeInterval, bool) {
+	if r.Boost != nil || r.QueryName_ != nil || r.Relation != nil || r.From != nil || r.To != nil || r.Format != nil {
+		return nil, false
+	}
+	if (r.Gt != nil && r.Gte != nil) || (r.Lt != nil && r.Lte != nil) {
+		return nil, false
+	}
+	interval := &rangeInterval{field: field, isDate: true, timeZone: r.TimeZone}
+	var ok bool
+	if r.Gte != nil {
+		interval.lower, ok = dateBound(*r.Gte, true)
+	} else if r.Gt != nil {
+		interval.lower, ok = dateBound(*r.Gt, false)
+	} else {
+		ok = true
+	}
+	if !ok {
+		return nil, false
+	}
+	if r.Lte != nil {
+		interval.upper, ok = dateBound(*r.Lte, true)
+	} else if r.Lt != nil {
+		interval.upper, ok = dateBound(*r.Lt, false)
+	}
+	if !ok {
+		return nil, false
+	}
+	interval.layout = interval.lower.layout
+	if interval.layout == "" {
+		interval.layout = interval.upper.layout
+	} else if interval.upper.present && interval.upper.layout != interval.layout {
+		return nil, false
+	}
+	return interval, true
+}
+
+func dateBound(value string, inclusive bool) (rangeBound, bool) {
+	for _, layout := range rangeDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return rangeBound{present: true, inclusive: inclusive, date: t, layout: layout, raw: value}, true
+		}
+	}
+	return rangeBound{}, false
+}
+
+func (r *rangeInterval) sameGroup(other *rangeInterval) bool {
+	return r.field == other.field && r.isDate == other.isDate && r.layout == other.layout &&
+		equalStringPtr(r.format, other.format) && equalStringPtr(r.timeZone, other.timeZone)
+}
+
+func (r *rangeInterval) compare(a, b rangeBound) int {
+	if r.isDate {
+		return a.date.Compare(b.date)
+	}
+	switch {
+	case a.number < b.number:
+		return -1
+	case a.number > b.number:
+		return 1
+	}
+	return 0
+}
+
+// tighterLower 判断下界 a 是否不比下界 b 宽松。
+func (r *rangeInterval) tighterLower(a, b rangeBound) bool {
+	if !b.present {
+		return true
+	}
+	if !a.present {
+		return false
+	}
+	if c := r.compare(a, b); c != 0 {
+		return c > 0
+	}
+	return b.inclusive || !a.inclusive
+}
+
+// tighterUpper 判断上界 a 是否不比上界 b 宽松。
+func (r *rangeInterval) tighterUpper(a, b rangeBound) bool {
+	if !b.present {
+		return true
+	}
+	if !a.present {
+		return false
+	}
+	if c := r.compare(a, b); c != 0 {
+		return c < 0
+	}
+	return b.inclusive || !a.inclusive
+}
+
+// within 判断区间 r 是否被 other 完全包含。
+func (r *rangeInterval) within(other *rangeInterval) bool {
+	return r.tighterLower(r.lower, other.lower) && r.tighterUpper(r.upper, other.upper)
+}
+
+// union 在两个区间重叠或相接时返回它们的并集。
+func (r *rangeInterval) union(other *rangeInterval) (*rangeInterval, bool) {
+	first, second := r, other
+	if !r.tighterLower(second.lower, first.lower) {
+		first, second = second, first
+	}
+	if first.upper.present && second.lower.present {
+		c := r.compare(first.upper, second.lower)
+		if c < 0 || (c == 0 && !first.upper.inclusive && !second.lower.inclusive) {
+			return nil, false
+		}
+	}
+	combined := *first
+	if r.tighterUpper(first.upper, second.upper) {
+		combined.upper = second.upper
+	}
+	return &combined, true
+}
+
+// query 将区间还原为范围查询子句。
+func (r *rangeInterval) query() types.Query {
+	if r.isDate {
+		dateRange := types.DateRangeQuery{Format: r.format, TimeZone: r.timeZone}
+		if r.lower.present {
+			lower := r.lower.raw
+			if r.lower.inclusive {
+				dateRange.Gte = &lower
+			} else {
+				dateRange.Gt = &lower
+			}
+		}
+		if r.upper.present {
+			upper := r.upper.raw
+			if r.upper.inclusive {
+				dateRange.Lte = &upper
+			} else {
+				dateRange.Lt = &upper
+			}
+		}
+		return types.Query{Range: map[string]types.RangeQuery{r.field: dateRange}}
+	}
+	numberRange := types.NumberRangeQuery{}
+	if r.lower.present {
+		lower := types.Float64(r.lower.number)
+		if r.lower.inclusive {
+			numberRange.Gte = &lower
+		} else {
+			numberRange.Gt = &lower
+		}
+	}
+	if r.upper.present {
+		upper := types.Float64(r.upper.number)
+		if r.upper.inclusive {
+			numberRange.Lte = &upper
+		} else {
+			numberRange.Lt = &upper
+		}
+	}
+	return types.Query{Range: map[string]types.RangeQuery{r.field: numberRange}}
+}
+
+func equalStringPtr(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,416 @@
+package esb
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+func TestSimplify(t *testing.T) {
+	t.Run("nil查询返回nil", func(t *testing.T) {
+		if Simplify(nil) != nil {
+			t.Error("期望返回nil")
+		}
+	})
+
+	t.Run("展开多层单子句Bool", func(t *testing.T) {
+		query := Simplify(NewQuery(
+			Bool(Must(Bool(Must(Bool(Must(Term("status", "published"))))))),
+		))
+		if query.Bool != nil {
+			t.Fatalf("期望Bool被展开, 实际得到: %s", mustJSON(t, query))
+		}
+		if _, ok := query.Term["status"]; !ok {
+			t.Errorf("期望得到status的Term查询, 实际得到: %s", mustJSON(t, query))
+		}
+	})
+
+	t.Run("评分上下文中保留单个filter子句的Bool", func(t *testing.T) {
+		query := Simplify(NewQuery(BoolFilter(Term("status", "published"))))
+		if query.Bool == nil || len(query.Bool.Filter) != 1 {
+			t.Errorf("期望保留filter以避免改变得分, 实际得到: %s", mustJSON(t, query))
+		}
+	})
+
+	t.Run("filter中的嵌套Bool被展开并去重", func(t *testing.T) {
+		query := Simplify(NewQuery(
+			BoolFilter(
+				Bool(
+					Filter(Term("status", "published")),
+					MustNot(Term("deleted", true)),
+				),
+				Term("status", "published"),
+				Bool(Must(Term("category", "tech"))),
+			),
+		))
+		if query.Bool == nil {
+			t.Fatal("期望结果为Bool查询")
+		}
+		if len(query.Bool.Filter) != 2 {
+			t.Errorf("期望2个filter子句, 实际得到: %s", mustJSON(t, query))
+		}
+		if len(query.Bool.MustNot) != 1 {
+			t.Errorf("期望must_not被提升到父查询, 实际得到: %s", mustJSON(t, query))
+		}
+	})
+
+	t.Run("带boost的Bool不被展开", func(t *testing.T) {
+		query := Simplify(NewQuery(
+			Bool(Must(
+				Term("a", "x"),
+				func(q *types.Query) {
+					boost := float32(2)
+					q.Bool = &types.BoolQuery{Boost: &boost, Must: []types.Query{*NewQuery(Term("b", "y"))}}
+				},
+			)),
+		))
+		if query.Bool == nil || len(query.Bool.Must) != 2 || query.Bool.Must[1].Bool == nil {
+			t.Errorf("期望带boost的子Bool被保留, 实际得到: %s", mustJSON(t, query))
+		}
+	})
+
+	t.Run("must_not中同一字段的Term合并为Terms", func(t *testing.T) {
+		query := Simplify(NewQuery(
+			Bool(
+				Filter(Exists("status")),
+				MustNot(Term("status", "deleted"), Term("status", "hidden"), Terms("status", "hidden", "spam")),
+			),
+		))
+		if len(query.Bool.MustNot) != 1 || query.Bool.MustNot[0].Terms == nil {
+			t.Fatalf("期望合并为一个Terms, 实际得到: %s", mustJSON(t, query))
+		}
+		values := query.Bool.MustNot[0].Terms.TermsQuery["status"].([]types.FieldValue)
+		if len(values) != 3 {
+			t.Errorf("期望3个去重后的值, 实际得到: %v", values)
+		}
+	})
+
+	t.Run("评分上下文中should的Term不合并", func(t *testing.T) {
+		query := Simplify(NewQuery(Bool(Should(Term("tag", "go"), Term("tag", "es")))))
+		if len(query.Bool.Should) != 2 {
+			t.Errorf("期望保留2个should子句, 实际得到: %s", mustJSON(t, query))
+		}
+	})
+
+	t.Run("ConstantScore中should的Term合并且must改写为filter", func(t *testing.T) {
+		query := Simplify(NewQuery(
+			ConstantScore(Bool(
+				Must(Exists("tag"), NumberRange("price").Gte(10).Build()),
+				Filter(Bool(Should(Term("tag", "go"), Term("tag", "es")))),
+			)),
+		))
+		filter := query.ConstantScore.Filter
+		if filter.Bool == nil || len(filter.Bool.Must) != 0 || len(filter.Bool.Filter) != 3 {
+			t.Fatalf("期望must被改写为filter, 实际得到: %s", mustJSON(t, query))
+		}
+		if filter.Bool.Filter[2].Terms == nil {
+			t.Errorf("期望should被合并为Terms, 实际得到: %s", mustJSON(t, query))
+		}
+	})
+
+	t.Run("filter中保留更严格的范围", func(t *testing.T) {
+		query := Simplify(NewQuery(
+			BoolFilter(
+				NumberRange("price").Gte(10).Build(),
+				NumberRange("price").Gt(20).Lte(50).Build(),
+				NumberRange("price").Lt(30).Build(),
+			),
+		))
+		if len(query.Bool.Filter) != 2 {
+			t.Fatalf("期望2个范围子句, 实际得到: %s", mustJSON(t, query))
+		}
+		r := query.Bool.Filter[0].Range["price"].(types.NumberRangeQuery)
+		if r.Gt == nil || *r.Gt != 20 || r.Lte == nil || *r.Lte != 50 {
+			t.Errorf("期望保留(20, 50], 实际得到: %s", mustJSON(t, query))
+		}
+	})
+
+	t.Run("must_not中合并重叠的日期范围", func(t *testing.T) {
+		query := Simplify(NewQuery(
+			Bool(
+				Filter(Exists("created_at")),
+				MustNot(
+					DateRange("created_at").Gte("2025-01-01").Lt("2025-02-01").Build(),
+					DateRange("created_at").Gte("2025-02-01").Lte("2025-03-01").Build(),
+					DateRange("created_at").Gte("now-1d").Build(),
+				),
+			),
+		))
+		if len(query.Bool.MustNot) != 2 {
+			t.Fatalf("期望2个范围子句, 实际得到: %s", mustJSON(t, query))
+		}
+		r := query.Bool.MustNot[0].Range["created_at"].(types.DateRangeQuery)
+		if r.Gte == nil || *r.Gte != "2025-01-01" || r.Lte == nil || *r.Lte != "2025-03-01" {
+			t.Errorf("期望合并为[2025-01-01, 2025-03-01], 实际得到: %s", mustJSON(t, query))
+		}
+	})
+
+	t.Run("不同格式的日期端点不合并", func(t *testing.T) {
+		query := Simplify(NewQuery(
+			Bool(
+				Filter(
+					DateRange("created_at").Gte("2025-01-01").TimeZone("+08:00").Build(),
+					DateRange("created_at").Gte("2024-12-31T20:00:00+00:00").TimeZone("+08:00").Build(),
+				),
+			),
+		))
+		if query.Bool == nil || len(query.Bool.Filter) != 2 {
+			t.Fatalf("期望保留2个范围子句, 实际得到: %s", mustJSON(t, query))
+		}
+	})
+
+	t.Run("不修改原查询", func(t *testing.T) {
+		query := NewQuery(Bool(
+			Filter(BoolFilter(Term("a", "x")), Term("a", "x")),
+			MustNot(Term("b", "y"), Term("b", "z")),
+		))
+		before := mustJSON(t, query)
+		Simplify(query)
+		if after := mustJSON(t, query); after != before {
+			t.Errorf("原查询被修改:\n%s\n%s", before, after)
+		}
+	})
+}
+
+// TestSimplifyPreservesSemantics 随机生成查询与文档，验证化简前后匹配结果与得分一致。
+func TestSimplifyPreservesSemantics(t *testing.T) {
+	rng := rand.New(rand.NewPCG(20250101, 42))
+	docs := make([]simplifyDoc, 40)
+	for i := range docs {
+		docs[i] = randomSimplifyDoc(rng)
+	}
+	for i := 0; i < 5000; i++ {
+		query := randomSimplifyQuery(rng, 3)
+		simplified := Simplify(&query)
+		for _, doc := range docs {
+			wantMatch, wantScore := doc.eval(t, query)
+			gotMatch, gotScore := doc.eval(t, *simplified)
+			if wantMatch != gotMatch || (wantMatch && math.Abs(wantScore-gotScore) > 1e-9) {
+				t.Fatalf("语义不一致\n文档: %v\n原查询: %s => %v %v\n化简后: %s => %v %v",
+					doc, mustJSON(t, &query), wantMatch, wantScore, mustJSON(t, simplified), gotMatch, gotScore)
+			}
+		}
+	}
+}
+
+func mustJSON(t *testing.T, q *types.Query) string {
+	t.Helper()
+	data, err := json.Marshal(q)
+	if err != nil {
+		t.Fatalf("序列化失败: %v", err)
+	}
+	return string(data)
+}
+
+// simplifyDoc 是属性测试使用的文档，每个字段可以有零个或多个值。
+type simplifyDoc map[string][]any
+
+var (
+	simplifyKeywords = []string{"x", "y", "z"}
+	simplifyDayBase  = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func randomSimplifyDoc(rng *rand.Rand) simplifyDoc {
+	doc := simplifyDoc{}
+	for i := rng.IntN(3); i > 0; i-- {
+		doc["a"] = append(doc["a"], simplifyKeywords[rng.IntN(len(simplifyKeywords))])
+	}
+	for i := rng.IntN(3); i > 0; i-- {
+		doc["b"] = append(doc["b"], simplifyKeywords[rng.IntN(len(simplifyKeywords))])
+	}
+	for i := rng.IntN(3); i > 0; i-- {
+		doc["n"] = append(doc["n"], float64(rng.IntN(6)))
+	}
+	for i := rng.IntN(3); i > 0; i-- {
+		doc["d"] = append(doc["d"], simplifyDayBase.AddDate(0, 0, rng.IntN(6)))
+	}
+	return doc
+}
+
+func randomSimplifyQuery(rng *rand.Rand, depth int) types.Query {
+	kind := rng.IntN(10)
+	if depth <= 0 && kind >= 7 {
+		kind = rng.IntN(7)
+	}
+	field := []string{"a", "b"}[rng.IntN(2)]
+	keyword := simplifyKeywords[rng.IntN(len(simplifyKeywords))]
+	switch kind {
+	case 0:
+		return *NewQuery(Term(field, keyword))
+	case 1:
+		return *NewQuery(Terms(field, keyword, simplifyKeywords[rng.IntN(len(simplifyKeywords))]))
+	case 2:
+		builder := NumberRange("n")
+		switch rng.IntN(3) {
+		case 0:
+			builder.Gte(float64(rng.IntN(6)))
+		case 1:
+			builder.Gt(float64(rng.IntN(6)))
+		}
+		switch rng.IntN(3) {
+		case 0:
+			builder.Lte(float64(rng.IntN(6)))
+		case 1:
+			builder.Lt(float64(rng.IntN(6)))
+		}
+		return *NewQuery(builder.Build())
+	case 3:
+		day := func() string { return simplifyDayBase.AddDate(0, 0, rng.IntN(6)).Format("2006-01-02") }
+		builder := DateRange("d")
+		if rng.IntN(2) == 0 {
+			builder.Gte(day())
+		} else {
+			builder.Gt(day())
+		}
+		if rng.IntN(2) == 0 {
+			builder.Lte(day())
+		}
+		return *NewQuery(builder.Build())
+	case 4:
+		return *NewQuery(Exists([]string{"a", "b", "n", "d"}[rng.IntN(4)]))
+	case 5:
+		return *NewQuery(MatchAll())
+	case 6:
+		return *NewQuery(MatchNone())
+	case 7:
+		return *NewQuery(ConstantScore(func(q *types.Query) { *q = randomSimplifyQuery(rng, depth-1) }))
+	}
+
+	b := &types.BoolQuery{}
+	clauses := func() []types.Query {
+		var result []types.Query
+		// 偏向生成稀疏的 Bool，以覆盖只含单一类型子句的情况
+		for i := rng.IntN(5) - 2; i > 0; i-- {
+			clause := randomSimplifyQuery(rng, depth-1)
+			result = append(result, clause)
+			if rng.IntN(4) == 0 {
+				result = append(result, clause)
+			}
+		}
+		return result
+	}
+	b.Must, b.Filter, b.Should, b.MustNot = clauses(), clauses(), clauses(), clauses()
+	switch rng.IntN(8) {
+	case 0:
+		b.MinimumShouldMatch = 1 + rng.IntN(2)
+	case 1:
+		boost := float32(2)
+		b.Boost = &boost
+	}
+	return types.Query{Bool: b}
+}
+
+// eval 是一个简化的查询执行器：叶子查询命中得分为 1，Bool 得分为 must 与命中的 should 之和。
+func (d simplifyDoc) eval(t *testing.T, q types.Query) (bool, float64) {
+	t.Helper()
+	switch {
+	case q.Bool != nil:
+		b := q.Bool
+		score := 0.0
+		for _, clause := range b.Must {
+			ok, s := d.eval(t, clause)
+			if !ok {
+				return false, 0
+			}
+			score += s
+		}
+		for _, clause := range b.Filter {
+			if ok, _ := d.eval(t, clause); !ok {
+				return false, 0
+			}
+		}
+		for _, clause := range b.MustNot {
+			if ok, _ := d.eval(t, clause); ok {
+				return false, 0
+			}
+		}
+		matched := 0
+		for _, clause := range b.Should {
+			if ok, s := d.eval(t, clause); ok {
+				matched++
+				score += s
+			}
+		}
+		minimum := 0
+		if len(b.Should) > 0 && len(b.Must)+len(b.Filter) == 0 {
+			minimum = 1
+		}
+		if b.MinimumShouldMatch != nil {
+			minimum = b.MinimumShouldMatch.(int)
+		}
+		if matched < minimum {
+			return false, 0
+		}
+		if b.Boost != nil {
+			score *= float64(*b.Boost)
+		}
+		return true, score
+	case q.ConstantScore != nil:
+		ok, _ := d.eval(t, q.ConstantScore.Filter)
+		return ok, 1
+	case q.MatchAll != nil:
+		return true, 1
+	case q.MatchNone != nil:
+		return false, 0
+	case q.Exists != nil:
+		return len(d[q.Exists.Field]) > 0, 1
+	case q.Term != nil:
+		for field, term := range q.Term {
+			return d.hasAny(field, []types.FieldValue{term.Value}), 1
+		}
+	case q.Terms != nil:
+		for field, values := range q.Terms.TermsQuery {
+			return d.hasAny(field, values.([]types.FieldValue)), 1
+		}
+	case q.Range != nil:
+		for field, r := range q.Range {
+			for _, value := range d[field] {
+				if simplifyInRange(t, value, r) {
+					return true, 1
+				}
+			}
+			return false, 0
+		}
+	}
+	t.Fatalf("不支持的查询: %s", mustJSON(t, &q))
+	return false, 0
+}
+
+func (d simplifyDoc) hasAny(field string, values []types.FieldValue) bool {
+	for _, have := range d[field] {
+		for _, want := range values {
+			if fmt.Sprint(have) == fmt.Sprint(want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func simplifyInRange(t *testing.T, value any, r types.RangeQuery) bool {
+	t.Helper()
+	switch r := r.(type) {
+	case types.NumberRangeQuery:
+		v := value.(float64)
+		return (r.Gt == nil || v > float64(*r.Gt)) && (r.Gte == nil || v >= float64(*r.Gte)) &&
+			(r.Lt == nil || v < float64(*r.Lt)) && (r.Lte == nil || v <= float64(*r.Lte))
+	case types.DateRangeQuery:
+		v := value.(time.Time)
+		day := func(s *string) time.Time {
+			parsed, err := time.Parse("2006-01-02", *s)
+			if err != nil {
+				t.Fatalf("无法解析日期: %s", *s)
+			}
+			return parsed
+		}
+		return (r.Gt == nil || v.After(day(r.Gt))) && (r.Gte == nil || !v.Before(day(r.Gte))) &&
+			(r.Lt == nil || v.Before(day(r.Lt))) && (r.Lte == nil || !v.After(day(r.Lte)))
+	}
+	t.Fatalf("不支持的范围类型: %T", r)
+	return false
+}
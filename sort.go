@@ -1,30 +1,270 @@
 package esb
 
 import (
+    "errors"
+    "fmt"
+    "strings"
+
     "github.com/elastic/go-elasticsearch/v8/typedapi/types"
+    "github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/fieldsortnumerictype"
+    "github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/fieldtype"
+    "github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/scriptsorttype"
+    "github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortmode"
     "github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
 )
 
+var (
+    // ErrSortFieldNotAllowed 排序字段不在允许列表中
+    ErrSortFieldNotAllowed = errors.New("sort field not allowed")
+)
+
+// SortOption 表示一个修改字段排序 types.FieldSort 的函数。
+type SortOption func(*types.FieldSort)
+
 // 按字段正序
-func SortFieldAsc(field string) *types.SortOptions {
+//
+// 示例：
+//   esb.SortFieldAsc("price", esb.SortMissingLast(), esb.SortMode(sortmode.Min))
+func SortFieldAsc(field string, opts ...SortOption) *types.SortOptions {
+    return sortField(field, sortorder.Asc, opts)
+}
+
+// 按字段倒序
+//
+// 示例：
+//   esb.SortFieldDesc("created_at", esb.SortUnmappedType(fieldtype.Date))
+func SortFieldDesc(field string, opts ...SortOption) *types.SortOptions {
+    return sortField(field, sortorder.Desc, opts)
+}
+
+func sortField(field string, order sortorder.SortOrder, opts []SortOption) *types.SortOptions {
+    fieldSort := types.FieldSort{
+        Order: &order,
+    }
+    for _, opt := range opts {
+        if opt != nil {
+            opt(&fieldSort)
+        }
+    }
     s := &types.SortOptions{
         SortOptions: map[string]types.FieldSort{
-            field: {
-                Order: &sortorder.Asc,
-            },
+            field: fieldSort,
         },
     }
     return s
 }
 
-// 按字段倒序
-func SortFieldDesc(field string) *types.SortOptions {
-    s := &types.SortOptions{
-        SortOptions: map[string]types.FieldSort{
+// SortMissingFirst 缺少该字段的文档排在最前。
+func SortMissingFirst() SortOption {
+    return SortMissing("_first")
+}
+
+// SortMissingLast 缺少该字段的文档排在最后。
+func SortMissingLast() SortOption {
+    return SortMissing("_last")
+}
+
+// SortMissing 缺少该字段的文档使用 value 作为排序值。
+//
+// 示例：
+//   esb.SortFieldAsc("price", esb.SortMissing(0))
+func SortMissing(value any) SortOption {
+    return func(s *types.FieldSort) {
+        s.Missing = value
+    }
+}
+
+// SortMode 设置多值字段的排序取值方式：min、max、sum、avg、median。
+func SortMode(mode sortmode.SortMode) SortOption {
+    return func(s *types.FieldSort) {
+        s.Mode = &mode
+    }
+}
+
+// SortUnmappedType 设置字段未映射时使用的类型，避免跨索引排序时因字段缺失报错。
+func SortUnmappedType(fieldType fieldtype.FieldType) SortOption {
+    return func(s *types.FieldSort) {
+        s.UnmappedType = &fieldType
+    }
+}
+
+// SortNumericType 将不同索引中类型不同的数值字段统一转换为指定类型后排序。
+func SortNumericType(numericType fieldsortnumerictype.FieldSortNumericType) SortOption {
+    return func(s *types.FieldSort) {
+        s.NumericType = &numericType
+    }
+}
+
+// SortFormat 设置日期字段排序值的格式。
+func SortFormat(format string) SortOption {
+    return func(s *types.FieldSort) {
+        s.Format = &format
+    }
+}
+
+// SortNested 按 nested 字段排序，filter 为空时使用所有嵌套文档。
+//
+// 示例：
+//   esb.SortFieldAsc("offers.price",
+//       esb.SortMode(sortmode.Min),
+//       esb.SortNested("offers", esb.Term("offers.color", "blue")),
+//   )
+func SortNested(path string, filter QueryOption) SortOption {
+    return SortNestedWithOptions(path, filter, nil)
+}
+
+// SortNestedWithOptions 提供回调函数式的 nested 排序配置，可以设置 max_children 与多层 nested。
+func SortNestedWithOptions(path string, filter QueryOption, setOpts func(opts *types.NestedSortValue)) SortOption {
+    return func(s *types.FieldSort) {
+        s.Nested = nestedSort(path, filter, setOpts)
+    }
+}
+
+func nestedSort(path string, filter QueryOption, setOpts func(opts *types.NestedSortValue)) *types.NestedSortValue {
+    nested := &types.NestedSortValue{
+        Path: path,
+    }
+    if filter != nil {
+        nested.Filter = NewQuery(filter)
+    }
+    if setOpts != nil {
+        setOpts(nested)
+    }
+    return nested
+}
+
+// SortGeoDistance 按与指定坐标的距离排序。
+//
+// 示例：
+//   esb.SortGeoDistance("location", 40.0, -70.0, sortorder.Asc)
+func SortGeoDistance(field string, lat, lon float64, order sortorder.SortOrder) *types.SortOptions {
+    return SortGeoDistanceWithOptions(field, lat, lon, order, nil)
+}
+
+// SortGeoDistanceWithOptions 提供回调函数式的距离排序配置，可以设置 unit、distance_type、mode 等。
+//
+// 示例：
+//   esb.SortGeoDistanceWithOptions("location", 40.0, -70.0, sortorder.Asc,
+//       func(opts *types.GeoDistanceSort) {
+//           unit := distanceunit.Kilometers
+//           distanceType := geodistancetype.Plane
+//           opts.Unit = &unit
+//           opts.DistanceType = &distanceType
+//       },
+//   )
+func SortGeoDistanceWithOptions(field string, lat, lon float64, order sortorder.SortOrder, setOpts func(opts *types.GeoDistanceSort)) *types.SortOptions {
+    geoSort := &types.GeoDistanceSort{
+        GeoDistanceSort: map[string][]types.GeoLocation{
             field: {
-                Order: &sortorder.Desc,
+                types.LatLonGeoLocation{
+                    Lat: types.Float64(lat),
+                    Lon: types.Float64(lon),
+                },
             },
         },
+        Order: &order,
     }
-    return s
+    if setOpts != nil {
+        setOpts(geoSort)
+    }
+    return &types.SortOptions{
+        GeoDistance_: geoSort,
+    }
+}
+
+// SortScript 使用脚本计算排序值，sortType 为 number、string 或 version。
+//
+// 示例：
+//   esb.SortScript("doc['price'].value * params.factor", scriptsorttype.Number, sortorder.Desc)
+func SortScript(source string, sortType scriptsorttype.ScriptSortType, order sortorder.SortOrder) *types.SortOptions {
+    return SortScriptWithOptions(source, sortType, order, nil)
+}
+
+// SortScriptWithOptions 提供回调函数式的脚本排序配置，可以设置脚本参数、mode、nested。
+//
+// 示例：
+//   esb.SortScriptWithOptions("doc['price'].value * params.factor", scriptsorttype.Number, sortorder.Desc,
+//       func(opts *types.ScriptSort) {
+//           opts.Script.Params = map[string]json.RawMessage{"factor": json.RawMessage("1.2")}
+//       },
+//   )
+func SortScriptWithOptions(source string, sortType scriptsorttype.ScriptSortType, order sortorder.SortOrder, setOpts func(opts *types.ScriptSort)) *types.SortOptions {
+    scriptSort := &types.ScriptSort{
+        Script: types.Script{
+            Source: &source,
+        },
+        Type:  &sortType,
+        Order: &order,
+    }
+    if setOpts != nil {
+        setOpts(scriptSort)
+    }
+    return &types.SortOptions{
+        Script_: scriptSort,
+    }
+}
+
+// SortScore 按相关性评分排序。
+func SortScore(order sortorder.SortOrder) *types.SortOptions {
+    return &types.SortOptions{
+        Score_: &types.ScoreSort{
+            Order: &order,
+        },
+    }
+}
+
+// SortDoc 按索引顺序排序，是效率最高的排序方式，适合滚动遍历。
+func SortDoc() *types.SortOptions {
+    order := sortorder.Asc
+    return &types.SortOptions{
+        Doc_: &types.ScoreSort{
+            Order: &order,
+        },
+    }
+}
+
+// ParseSort 解析接口参数形式的排序字符串，多个字段用逗号分隔，"-" 前缀表示倒序，"+" 或无前缀表示正序。
+// 除 _score（默认倒序）与 _doc（默认正序，"-_doc" 为倒序）外，字段必须在 allowed 中，否则返回 ErrSortFieldNotAllowed。
+//
+// 示例：
+//   sorts, err := esb.ParseSort("-created_at,price,_score", []string{"created_at", "price"})
+//   if err != nil {
+//       return err
+//   }
+//   client.Search().Sort(sorts...)
+func ParseSort(input string, allowed []string) ([]types.SortCombinations, error) {
+    allowedFields := make(map[string]bool, len(allowed))
+    for _, field := range allowed {
+        allowedFields[field] = true
+    }
+    var sorts []types.SortCombinations
+    for _, part := range strings.Split(input, ",") {
+        part = strings.TrimSpace(part)
+        if part == "" {
+            continue
+        }
+        order, explicit := sortorder.Asc, false
+        switch part[0] {
+        case '-':
+            order, explicit = sortorder.Desc, true
+            part = part[1:]
+        case '+':
+            explicit = true
+            part = part[1:]
+        }
+        switch {
+        case part == "_score":
+            if !explicit {
+                order = sortorder.Desc
+            }
+            sorts = append(sorts, SortScore(order))
+        case part == "_doc":
+            sorts = append(sorts, &types.SortOptions{Doc_: &types.ScoreSort{Order: &order}})
+        case allowedFields[part]:
+            sorts = append(sorts, sortField(part, order, nil))
+        default:
+            return nil, fmt.Errorf("%w: %q", ErrSortFieldNotAllowed, part)
+        }
+    }
+    return sorts, nil
 }
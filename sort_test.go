@@ -0,0 +1,156 @@
+package esb
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/distanceunit"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/fieldsortnumerictype"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/fieldtype"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/geodistancetype"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/scriptsorttype"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortmode"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
+)
+
+func sortJSON(t *testing.T, sort any) string {
+	t.Helper()
+	data, err := json.Marshal(sort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSort(t *testing.T) {
+	tests := []struct {
+		name string
+		sort *types.SortOptions
+		want string
+	}{
+		{
+			"正序",
+			SortFieldAsc("price"),
+			`{"price":{"order":"asc"}}`,
+		},
+		{
+			"倒序",
+			SortFieldDesc("price"),
+			`{"price":{"order":"desc"}}`,
+		},
+		{
+			"missing与mode",
+			SortFieldAsc("price", SortMissingLast(), SortMode(sortmode.Min)),
+			`{"price":{"missing":"_last","mode":"min","order":"asc"}}`,
+		},
+		{
+			"自定义missing",
+			SortFieldDesc("rating", SortMissing(0)),
+			`{"rating":{"missing":0,"order":"desc"}}`,
+		},
+		{
+			"unmapped_type与numeric_type",
+			SortFieldDesc("created_at", SortMissingFirst(), SortUnmappedType(fieldtype.Date), SortNumericType(fieldsortnumerictype.Datenanos), SortFormat("strict_date_optional_time_nanos")),
+			`{"created_at":{"format":"strict_date_optional_time_nanos","missing":"_first","numeric_type":"date_nanos","order":"desc","unmapped_type":"date"}}`,
+		},
+		{
+			"nested排序",
+			SortFieldAsc("offers.price", SortMode(sortmode.Min), SortNested("offers", Term("offers.color", "blue"))),
+			`{"offers.price":{"mode":"min","nested":{"filter":{"term":{"offers.color":{"value":"blue"}}},"path":"offers"},"order":"asc"}}`,
+		},
+		{
+			"多层nested排序",
+			SortFieldAsc("offers.variants.price", SortNestedWithOptions("offers", nil, func(opts *types.NestedSortValue) {
+				maxChildren := 10
+				opts.MaxChildren = &maxChildren
+				opts.Nested = &types.NestedSortValue{Path: "offers.variants"}
+			})),
+			`{"offers.variants.price":{"nested":{"max_children":10,"nested":{"path":"offers.variants"},"path":"offers"},"order":"asc"}}`,
+		},
+		{
+			"_geo_distance",
+			SortGeoDistanceWithOptions("location", 40, -70, sortorder.Asc, func(opts *types.GeoDistanceSort) {
+				unit := distanceunit.Kilometers
+				distanceType := geodistancetype.Plane
+				opts.Unit = &unit
+				opts.DistanceType = &distanceType
+			}),
+			`{"_geo_distance":{"distance_type":"plane","location":[{"lat":40,"lon":-70}],"order":"asc","unit":"km"}}`,
+		},
+		{
+			"_script",
+			SortScript("doc['price'].value * 2", scriptsorttype.Number, sortorder.Desc),
+			`{"_script":{"order":"desc","script":{"source":"doc['price'].value * 2"},"type":"number"}}`,
+		},
+		{
+			"_score",
+			SortScore(sortorder.Desc),
+			`{"_score":{"order":"desc"}}`,
+		},
+		{
+			"_doc",
+			SortDoc(),
+			`{"_doc":{"order":"asc"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sortJSON(t, tt.sort); got != tt.want {
+				t.Errorf("期望 %s, 实际得到 %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	allowed := []string{"created_at", "price"}
+
+	t.Run("解析多个字段", func(t *testing.T) {
+		sorts, err := ParseSort("-created_at, +price,_score,_doc", allowed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `[{"created_at":{"order":"desc"}},{"price":{"order":"asc"}},{"_score":{"order":"desc"}},{"_doc":{"order":"asc"}}]`
+		if got := sortJSON(t, sorts); got != want {
+			t.Errorf("期望 %s, 实际得到 %s", want, got)
+		}
+	})
+
+	t.Run("_doc倒序", func(t *testing.T) {
+		sorts, err := ParseSort("-_doc", allowed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `[{"_doc":{"order":"desc"}}]`
+		if got := sortJSON(t, sorts); got != want {
+			t.Errorf("期望 %s, 实际得到 %s", want, got)
+		}
+	})
+
+	t.Run("_score显式正序", func(t *testing.T) {
+		sorts, err := ParseSort("+_score", allowed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := sortJSON(t, sorts); got != `[{"_score":{"order":"asc"}}]` {
+			t.Errorf("期望_score正序, 实际得到 %s", got)
+		}
+	})
+
+	t.Run("空字符串", func(t *testing.T) {
+		sorts, err := ParseSort(" , ", allowed)
+		if err != nil || len(sorts) != 0 {
+			t.Errorf("期望没有排序, 实际得到: %v, %v", sorts, err)
+		}
+	})
+
+	t.Run("不允许的字段", func(t *testing.T) {
+		for _, input := range []string{"-password", "price,secret", "-"} {
+			if _, err := ParseSort(input, allowed); !errors.Is(err, ErrSortFieldNotAllowed) {
+				t.Errorf("%q: 期望ErrSortFieldNotAllowed, 实际得到: %v", input, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,376 @@
+package esb
+
+import (
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+// SpanOption 表示一个修改 types.SpanQuery 的函数。
+// span 查询的子句只能是 span 查询，使用独立的选项类型可以在编译期避免传入 Term、Match 等普通查询。
+// 通过 Span 将其转换为 QueryOption 后即可与其他查询组合。
+type SpanOption func(*types.SpanQuery)
+
+// Span 将 span 查询转换为 QueryOption。
+// span_gap 只能作为 span_near 的子句使用，在顶层会被忽略。
+//
+// 示例：
+//   query := esb.NewQuery(
+//       esb.Span(esb.SpanNear(2, true,
+//           esb.SpanTerm("content", "force"),
+//           esb.SpanTerm("content", "majeure"),
+//       )),
+//   )
+func Span(span SpanOption) QueryOption {
+	return func(q *types.Query) {
+		spanQuery := buildSpan(span)
+		q.SpanContaining = spanQuery.SpanContaining
+		q.SpanFieldMasking = spanQuery.SpanFieldMasking
+		q.SpanFirst = spanQuery.SpanFirst
+		q.SpanMulti = spanQuery.SpanMulti
+		q.SpanNear = spanQuery.SpanNear
+		q.SpanNot = spanQuery.SpanNot
+		q.SpanOr = spanQuery.SpanOr
+		q.SpanTerm = spanQuery.SpanTerm
+		q.SpanWithin = spanQuery.SpanWithin
+	}
+}
+
+func buildSpan(span SpanOption) types.SpanQuery {
+	spanQuery := types.SpanQuery{}
+	if span != nil {
+		span(&spanQuery)
+	}
+	return spanQuery
+}
+
+func buildSpans(spans []SpanOption) []types.SpanQuery {
+	clauses := make([]types.SpanQuery, 0, len(spans))
+	for _, span := range spans {
+		if span != nil {
+			clauses = append(clauses, buildSpan(span))
+		}
+	}
+	return clauses
+}
+
+// SpanTerm 创建 span_term 查询，匹配包含指定词项的跨度。
+//
+// 示例：
+//   esb.SpanTerm("content", "contract")
+func SpanTerm(field, value string) SpanOption {
+	return func(s *types.SpanQuery) {
+		s.SpanTerm = map[string]types.SpanTermQuery{
+			field: {
+				Value: value,
+			},
+		}
+	}
+}
+
+// SpanTermWithOptions 提供回调函数式的 SpanTerm 查询配置。
+func SpanTermWithOptions(field, value string, setOpts func(opts *types.SpanTermQuery)) SpanOption {
+	return func(s *types.SpanQuery) {
+		spanTermQuery := types.SpanTermQuery{
+			Value: value,
+		}
+		if setOpts != nil {
+			setOpts(&spanTermQuery)
+		}
+		s.SpanTerm = map[string]types.SpanTermQuery{
+			field: spanTermQuery,
+		}
+	}
+}
+
+// SpanNear 创建 span_near 查询，匹配彼此相邻的跨度。
+// slop 为子句之间允许间隔的最大位置数，inOrder 表示子句是否必须按顺序出现。
+//
+// 示例：
+//   esb.SpanNear(3, true,
+//       esb.SpanTerm("content", "breach"),
+//       esb.SpanTerm("content", "contract"),
+//   )
+func SpanNear(slop int, inOrder bool, clauses ...SpanOption) SpanOption {
+	return SpanNearWithOptions(slop, inOrder, clauses, nil)
+}
+
+// SpanNearWithOptions 提供回调函数式的 SpanNear 查询配置。
+func SpanNearWithOptions(slop int, inOrder bool, clauses []SpanOption, setOpts func(opts *types.SpanNearQuery)) SpanOption {
+	return func(s *types.SpanQuery) {
+		spanNearQuery := &types.SpanNearQuery{
+			Clauses: buildSpans(clauses),
+			Slop:    &slop,
+			InOrder: &inOrder,
+		}
+		if setOpts != nil {
+			setOpts(spanNearQuery)
+		}
+		s.SpanNear = spanNearQuery
+	}
+}
+
+// SpanGap 创建 span_gap，只能作为 span_near 的子句，表示在该位置留出 width 个词的间隔。
+//
+// 示例：
+//   esb.SpanNear(0, true,
+//       esb.SpanTerm("content", "party"),
+//       esb.SpanGap("content", 2),
+//       esb.SpanTerm("content", "agrees"),
+//   )
+func SpanGap(field string, width int) SpanOption {
+	return func(s *types.SpanQuery) {
+		s.SpanGap = types.SpanGapQuery{
+			field: width,
+		}
+	}
+}
+
+// SpanOr 创建 span_or 查询，匹配任意一个子句的跨度。
+//
+// 示例：
+//   esb.SpanOr(
+//       esb.SpanTerm("content", "terminate"),
+//       esb.SpanTerm("content", "cancel"),
+//   )
+func SpanOr(clauses ...SpanOption) SpanOption {
+	return SpanOrWithOptions(clauses, nil)
+}
+
+// SpanOrWithOptions 提供回调函数式的 SpanOr 查询配置。
+func SpanOrWithOptions(clauses []SpanOption, setOpts func(opts *types.SpanOrQuery)) SpanOption {
+	return func(s *types.SpanQuery) {
+		spanOrQuery := &types.SpanOrQuery{
+			Clauses: buildSpans(clauses),
+		}
+		if setOpts != nil {
+			setOpts(spanOrQuery)
+		}
+		s.SpanOr = spanOrQuery
+	}
+}
+
+// SpanNot 创建 span_not 查询，匹配 include 中不与 exclude 重叠的跨度。
+//
+// 示例：
+//   esb.SpanNot(
+//       esb.SpanTerm("content", "liability"),
+//       esb.SpanNear(1, true, esb.SpanTerm("content", "limited"), esb.SpanTerm("content", "liability")),
+//   )
+func SpanNot(include, exclude SpanOption) SpanOption {
+	return SpanNotWithOptions(include, exclude, nil)
+}
+
+// SpanNotWithOptions 提供回调函数式的 SpanNot 查询配置，可以设置 pre、post、dist。
+//
+// 示例：
+//   esb.SpanNotWithOptions(include, exclude, func(opts *types.SpanNotQuery) {
+//       dist := 2
+//       opts.Dist = &dist
+//   })
+func SpanNotWithOptions(include, exclude SpanOption, setOpts func(opts *types.SpanNotQuery)) SpanOption {
+	return func(s *types.SpanQuery) {
+		spanNotQuery := &types.SpanNotQuery{
+			Include: buildSpan(include),
+			Exclude: buildSpan(exclude),
+		}
+		if setOpts != nil {
+			setOpts(spanNotQuery)
+		}
+		s.SpanNot = spanNotQuery
+	}
+}
+
+// SpanFirst 创建 span_first 查询，匹配结束位置不超过 end 的跨度，常用于匹配文档开头。
+//
+// 示例：
+//   esb.SpanFirst(esb.SpanTerm("content", "whereas"), 5)
+func SpanFirst(match SpanOption, end int) SpanOption {
+	return SpanFirstWithOptions(match, end, nil)
+}
+
+// SpanFirstWithOptions 提供回调函数式的 SpanFirst 查询配置。
+func SpanFirstWithOptions(match SpanOption, end int, setOpts func(opts *types.SpanFirstQuery)) SpanOption {
+	return func(s *types.SpanQuery) {
+		spanFirstQuery := &types.SpanFirstQuery{
+			Match: buildSpan(match),
+			End:   end,
+		}
+		if setOpts != nil {
+			setOpts(spanFirstQuery)
+		}
+		s.SpanFirst = spanFirstQuery
+	}
+}
+
+// SpanContaining 创建 span_containing 查询，返回包含 little 的 big 跨度。
+//
+// 示例：
+//   esb.SpanContaining(
+//       esb.SpanNear(10, false, esb.SpanTerm("content", "section"), esb.SpanTerm("content", "end")),
+//       esb.SpanTerm("content", "indemnify"),
+//   )
+func SpanContaining(big, little SpanOption) SpanOption {
+	return SpanContainingWithOptions(big, little, nil)
+}
+
+// SpanContainingWithOptions 提供回调函数式的 SpanContaining 查询配置。
+func SpanContainingWithOptions(big, little SpanOption, setOpts func(opts *types.SpanContainingQuery)) SpanOption {
+	return func(s *types.SpanQuery) {
+		spanContainingQuery := &types.SpanContainingQuery{
+			Big:    buildSpan(big),
+			Little: buildSpan(little),
+		}
+		if setOpts != nil {
+			setOpts(spanContainingQuery)
+		}
+		s.SpanContaining = spanContainingQuery
+	}
+}
+
+// SpanWithin 创建 span_within 查询，返回位于 big 之内的 little 跨度。
+//
+// 示例：
+//   esb.SpanWithin(
+//       esb.SpanNear(10, false, esb.SpanTerm("content", "section"), esb.SpanTerm("content", "end")),
+//       esb.SpanTerm("content", "indemnify"),
+//   )
+func SpanWithin(big, little SpanOption) SpanOption {
+	return SpanWithinWithOptions(big, little, nil)
+}
+
+// SpanWithinWithOptions 提供回调函数式的 SpanWithin 查询配置。
+func SpanWithinWithOptions(big, little SpanOption, setOpts func(opts *types.SpanWithinQuery)) SpanOption {
+	return func(s *types.SpanQuery) {
+		spanWithinQuery := &types.SpanWithinQuery{
+			Big:    buildSpan(big),
+			Little: buildSpan(little),
+		}
+		if setOpts != nil {
+			setOpts(spanWithinQuery)
+		}
+		s.SpanWithin = spanWithinQuery
+	}
+}
+
+// MultiTermOption 表示可以被 span_multi 包装的多词项查询。
+// 与 QueryOption 使用不同的类型，只能通过 MultiTermPrefix、MultiTermWildcard、MultiTermRegexp、
+// MultiTermFuzzy、MultiTermRange 创建，从而在编译期避免传入 Term、Match 等 span_multi 不支持的查询。
+type MultiTermOption func(*types.SpanMultiTermQuery)
+
+func multiTerm(query QueryOption) MultiTermOption {
+	return func(s *types.SpanMultiTermQuery) {
+		query(&s.Match)
+	}
+}
+
+// MultiTermPrefix 创建用于 span_multi 的前缀查询。
+//
+// 示例：
+//   esb.SpanMulti(esb.MultiTermPrefix("content", "indemn"))
+func MultiTermPrefix(field, value string) MultiTermOption {
+	return multiTerm(Prefix(field, value))
+}
+
+// MultiTermPrefixWithOptions 提供回调函数式的 MultiTermPrefix 查询配置。
+func MultiTermPrefixWithOptions(field, value string, setOpts func(opts *types.PrefixQuery)) MultiTermOption {
+	return multiTerm(PrefixWithOptions(field, value, setOpts))
+}
+
+// MultiTermWildcard 创建用于 span_multi 的通配符查询。
+//
+// 示例：
+//   esb.SpanMulti(esb.MultiTermWildcard("content", "indemn*"))
+func MultiTermWildcard(field, value string) MultiTermOption {
+	return multiTerm(Wildcard(field, value))
+}
+
+// MultiTermWildcardWithOptions 提供回调函数式的 MultiTermWildcard 查询配置。
+func MultiTermWildcardWithOptions(field, value string, setOpts func(opts *types.WildcardQuery)) MultiTermOption {
+	return multiTerm(WildcardWithOptions(field, value, setOpts))
+}
+
+// MultiTermRegexp 创建用于 span_multi 的正则表达式查询。
+//
+// 示例：
+//   esb.SpanMulti(esb.MultiTermRegexp("content", "indemn(ity|ify)"))
+func MultiTermRegexp(field, value string) MultiTermOption {
+	return multiTerm(Regexp(field, value))
+}
+
+// MultiTermRegexpWithOptions 提供回调函数式的 MultiTermRegexp 查询配置。
+func MultiTermRegexpWithOptions(field, value string, setOpts func(opts *types.RegexpQuery)) MultiTermOption {
+	return multiTerm(RegexpWithOptions(field, value, setOpts))
+}
+
+// MultiTermFuzzy 创建用于 span_multi 的模糊查询。
+//
+// 示例：
+//   esb.SpanMulti(esb.MultiTermFuzzy("content", "contrct"))
+func MultiTermFuzzy(field, value string) MultiTermOption {
+	return multiTerm(Fuzzy(field, value))
+}
+
+// MultiTermFuzzyWithOptions 提供回调函数式的 MultiTermFuzzy 查询配置。
+func MultiTermFuzzyWithOptions(field, value string, setOpts func(opts *types.FuzzyQuery)) MultiTermOption {
+	return multiTerm(FuzzyWithOptions(field, value, setOpts))
+}
+
+// MultiTermRange 创建用于 span_multi 的词项范围查询。
+// 数值与日期字段的范围查询不能改写为 span 查询，因此只接受 TermRange。
+//
+// 示例：
+//   esb.SpanMulti(esb.MultiTermRange(esb.TermRange("code").Gte("a").Lt("c")))
+func MultiTermRange(builder *TermRangeBuilder) MultiTermOption {
+	return multiTerm(builder.Build())
+}
+
+// SpanMulti 创建 span_multi 查询，将前缀、通配符、正则、模糊、词项范围等多词项查询包装为 span 查询。
+//
+// 示例：
+//   esb.SpanNear(0, true,
+//       esb.SpanMulti(esb.MultiTermPrefix("content", "indemn")),
+//       esb.SpanTerm("content", "clause"),
+//   )
+func SpanMulti(match MultiTermOption) SpanOption {
+	return SpanMultiWithOptions(match, nil)
+}
+
+// SpanMultiWithOptions 提供回调函数式的 SpanMulti 查询配置。
+func SpanMultiWithOptions(match MultiTermOption, setOpts func(opts *types.SpanMultiTermQuery)) SpanOption {
+	return func(s *types.SpanQuery) {
+		spanMultiQuery := &types.SpanMultiTermQuery{}
+		if match != nil {
+			match(spanMultiQuery)
+		}
+		if setOpts != nil {
+			setOpts(spanMultiQuery)
+		}
+		s.SpanMulti = spanMultiQuery
+	}
+}
+
+// FieldMaskingSpan 创建 field_masking_span 查询，使 query 看起来属于 field 字段，
+// 从而可以在 span_near、span_or 中组合不同字段（例如同一内容的不同分析方式）上的 span 查询。
+// 较新的 Elasticsearch 中该查询的名称为 span_field_masking。
+//
+// 示例：
+//   esb.SpanNear(5, false,
+//       esb.SpanNear(1, true, esb.SpanTerm("text", "quick"), esb.SpanTerm("text", "brown")),
+//       esb.FieldMaskingSpan("text", esb.SpanTerm("text.stems", "fox")),
+//   )
+func FieldMaskingSpan(field string, query SpanOption) SpanOption {
+	return FieldMaskingSpanWithOptions(field, query, nil)
+}
+
+// FieldMaskingSpanWithOptions 提供回调函数式的 FieldMaskingSpan 查询配置。
+func FieldMaskingSpanWithOptions(field string, query SpanOption, setOpts func(opts *types.SpanFieldMaskingQuery)) SpanOption {
+	return func(s *types.SpanQuery) {
+		fieldMaskingQuery := &types.SpanFieldMaskingQuery{
+			Field: field,
+			Query: buildSpan(query),
+		}
+		if setOpts != nil {
+			setOpts(fieldMaskingQuery)
+		}
+		s.SpanFieldMasking = fieldMaskingQuery
+	}
+}
@@ -0,0 +1,146 @@
+package esb
+
+import (
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+func TestSpan(t *testing.T) {
+	tests := []struct {
+		name string
+		span SpanOption
+		want string
+	}{
+		{
+			"span_term",
+			SpanTerm("content", "contract"),
+			`{"span_term":{"content":{"value":"contract"}}}`,
+		},
+		{
+			"span_near",
+			SpanNear(3, true, SpanTerm("content", "breach"), SpanTerm("content", "contract")),
+			`{"span_near":{"clauses":[{"span_term":{"content":{"value":"breach"}}},{"span_term":{"content":{"value":"contract"}}}],"in_order":true,"slop":3}}`,
+		},
+		{
+			"span_near中的span_gap",
+			SpanNear(0, true, SpanTerm("content", "party"), SpanGap("content", 2), SpanTerm("content", "agrees")),
+			`{"span_near":{"clauses":[{"span_term":{"content":{"value":"party"}}},{"span_gap":{"content":2}},{"span_term":{"content":{"value":"agrees"}}}],"in_order":true,"slop":0}}`,
+		},
+		{
+			"span_or",
+			SpanOr(SpanTerm("content", "terminate"), SpanTerm("content", "cancel")),
+			`{"span_or":{"clauses":[{"span_term":{"content":{"value":"terminate"}}},{"span_term":{"content":{"value":"cancel"}}}]}}`,
+		},
+		{
+			"span_not",
+			SpanNot(SpanTerm("content", "liability"), SpanTerm("content", "limited")),
+			`{"span_not":{"exclude":{"span_term":{"content":{"value":"limited"}}},"include":{"span_term":{"content":{"value":"liability"}}}}}`,
+		},
+		{
+			"span_first",
+			SpanFirst(SpanTerm("content", "whereas"), 5),
+			`{"span_first":{"end":5,"match":{"span_term":{"content":{"value":"whereas"}}}}}`,
+		},
+		{
+			"span_containing",
+			SpanContaining(SpanTerm("content", "section"), SpanTerm("content", "indemnify")),
+			`{"span_containing":{"big":{"span_term":{"content":{"value":"section"}}},"little":{"span_term":{"content":{"value":"indemnify"}}}}}`,
+		},
+		{
+			"span_within",
+			SpanWithin(SpanTerm("content", "section"), SpanTerm("content", "indemnify")),
+			`{"span_within":{"big":{"span_term":{"content":{"value":"section"}}},"little":{"span_term":{"content":{"value":"indemnify"}}}}}`,
+		},
+		{
+			"span_multi包装prefix",
+			SpanMulti(MultiTermPrefix("content", "indemn")),
+			`{"span_multi":{"match":{"prefix":{"content":{"value":"indemn"}}}}}`,
+		},
+		{
+			"span_multi包装wildcard",
+			SpanMulti(MultiTermWildcard("content", "indemn*")),
+			`{"span_multi":{"match":{"wildcard":{"content":{"value":"indemn*"}}}}}`,
+		},
+		{
+			"span_multi包装fuzzy",
+			SpanMulti(MultiTermFuzzy("content", "contrct")),
+			`{"span_multi":{"match":{"fuzzy":{"content":{"value":"contrct"}}}}}`,
+		},
+		{
+			"span_multi包装regexp",
+			SpanMulti(MultiTermRegexp("content", "indemn.*")),
+			`{"span_multi":{"match":{"regexp":{"content":{"value":"indemn.*"}}}}}`,
+		},
+		{
+			"span_multi包装词项范围",
+			SpanMulti(MultiTermRange(TermRange("code").Gte("a").Lt("c"))),
+			`{"span_multi":{"match":{"range":{"code":{"gte":"a","lt":"c"}}}}}`,
+		},
+		{
+			"field_masking_span",
+			SpanNear(5, false, SpanTerm("text", "quick"), FieldMaskingSpan("text", SpanTerm("text.stems", "fox"))),
+			`{"span_near":{"clauses":[{"span_term":{"text":{"value":"quick"}}},{"span_field_masking":{"field":"text","query":{"span_term":{"text.stems":{"value":"fox"}}}}}],"in_order":false,"slop":5}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mustJSON(t, NewQuery(Span(tt.span))); got != tt.want {
+				t.Errorf("期望 %s, 实际得到 %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSpanWithOptions(t *testing.T) {
+	t.Run("span_not的dist", func(t *testing.T) {
+		query := NewQuery(Span(SpanNotWithOptions(
+			SpanTerm("content", "liability"),
+			SpanTerm("content", "limited"),
+			func(opts *types.SpanNotQuery) {
+				dist := 2
+				opts.Dist = &dist
+			},
+		)))
+		if query.SpanNot == nil || query.SpanNot.Dist == nil || *query.SpanNot.Dist != 2 {
+			t.Errorf("期望Dist为2, 实际得到: %+v", query.SpanNot)
+		}
+	})
+
+	t.Run("span_term的boost", func(t *testing.T) {
+		query := NewQuery(Span(SpanTermWithOptions("content", "contract", func(opts *types.SpanTermQuery) {
+			boost := float32(2)
+			opts.Boost = &boost
+		})))
+		if got := query.SpanTerm["content"]; got.Boost == nil || *got.Boost != 2 {
+			t.Errorf("期望Boost为2, 实际得到: %+v", got)
+		}
+	})
+
+	t.Run("span_near的_name", func(t *testing.T) {
+		query := NewQuery(Span(SpanNearWithOptions(
+			1, false,
+			[]SpanOption{SpanTerm("content", "a"), nil, SpanTerm("content", "b")},
+			func(opts *types.SpanNearQuery) {
+				name := "near"
+				opts.QueryName_ = &name
+			},
+		)))
+		if len(query.SpanNear.Clauses) != 2 {
+			t.Errorf("期望忽略nil子句, 实际得到: %d", len(query.SpanNear.Clauses))
+		}
+		if query.SpanNear.QueryName_ == nil || *query.SpanNear.QueryName_ != "near" {
+			t.Errorf("期望_name为near, 实际得到: %v", query.SpanNear.QueryName_)
+		}
+	})
+
+	t.Run("与Bool组合", func(t *testing.T) {
+		query := NewQuery(Bool(
+			Must(Span(SpanNear(2, true, SpanTerm("content", "force"), SpanTerm("content", "majeure")))),
+			Filter(Term("type", "contract")),
+		))
+		if len(query.Bool.Must) != 1 || query.Bool.Must[0].SpanNear == nil {
+			t.Errorf("期望must中包含span_near, 实际得到: %s", mustJSON(t, query))
+		}
+	})
+}
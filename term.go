@@ -48,3 +48,39 @@ func TermsSlice(field string, values []types.FieldValue) QueryOption {
         }
     }
 }
+
+// TermsLookupOption 表示 terms lookup 查询的配置项。
+type TermsLookupOption func(*types.TermsLookup)
+
+// TermsLookupRouting 设置读取 lookup 文档时使用的 routing，lookup 文档写入时指定了 routing 时必须设置。
+func TermsLookupRouting(routing string) TermsLookupOption {
+    return func(l *types.TermsLookup) {
+        l.Routing = &routing
+    }
+}
+
+// TermsLookup 创建一个 terms lookup 查询，从 index 索引中 _id 为 id 的文档读取 path 字段的值作为词项列表。
+// 适用于词项列表较大或需要在多个查询之间共享的场景，例如黑名单、关注列表。
+//
+// 示例：
+//   esb.TermsLookup("user_id", "user_lists", "blocked", "ids")
+//   esb.TermsLookup("user_id", "user_lists", "followers-42", "ids", esb.TermsLookupRouting("42"))
+func TermsLookup(field, index, id, path string, opts ...TermsLookupOption) QueryOption {
+    return func(q *types.Query) {
+        lookup := types.TermsLookup{
+            Index: index,
+            Id:    id,
+            Path:  path,
+        }
+        for _, opt := range opts {
+            if opt != nil {
+                opt(&lookup)
+            }
+        }
+        q.Terms = &types.TermsQuery{
+            TermsQuery: map[string]types.TermsQueryField{
+                field: lookup,
+            },
+        }
+    }
+}
@@ -228,3 +228,29 @@ func TestTermsSlice(t *testing.T) {
         }
     })
 }
+
+func TestTermsLookup(t *testing.T) {
+    tests := []struct {
+        name  string
+        query QueryOption
+        want  string
+    }{
+        {
+            "基本terms lookup查询",
+            TermsLookup("user_id", "user_lists", "blocked", "ids"),
+            `{"terms":{"user_id":{"id":"blocked","index":"user_lists","path":"ids"}}}`,
+        },
+        {
+            "带routing",
+            TermsLookup("user_id", "user_lists", "followers-42", "ids", TermsLookupRouting("42")),
+            `{"terms":{"user_id":{"id":"followers-42","index":"user_lists","path":"ids","routing":"42"}}}`,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := mustJSON(t, NewQuery(tt.query)); got != tt.want {
+                t.Errorf("期望 %s, 实际得到 %s", tt.want, got)
+            }
+        })
+    }
+}
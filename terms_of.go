@@ -0,0 +1,214 @@
+package esb
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+// DefaultMaxTermsCount 是 Elasticsearch 索引设置 index.max_terms_count 的默认值。
+const DefaultMaxTermsCount = 65536
+
+// TermsOfOption 表示 TermsOf、IDsOf 的配置项。
+type TermsOfOption func(*termsOfOptions)
+
+type termsOfOptions struct {
+	maxCount int
+	lookup   *termsOfLookup
+}
+
+type termsOfLookup struct {
+	index string
+	path  string
+	id    func(chunk int) string
+}
+
+// TermsMaxCount 设置单个 terms 查询的最大值数量，应与索引的 index.max_terms_count 一致，默认为 DefaultMaxTermsCount。
+func TermsMaxCount(maxCount int) TermsOfOption {
+	return func(o *termsOfOptions) {
+		o.maxCount = maxCount
+	}
+}
+
+// TermsSplitLookup 值超过最大数量时，将每一段改为 terms lookup 查询，第 chunk 段读取 index 中 id(chunk) 文档的 path 字段。
+// 查询前需要先按 TermsChunks 的结果写入这些文档。
+//
+// 示例：
+//   chunks := esb.TermsChunks(userIDs, 10000)
+//   // 将 chunks[i] 写入 user_lists 索引中 _id 为 "blocked-{i}" 的文档的 ids 字段
+//   esb.TermsOf("user_id", userIDs,
+//       esb.TermsMaxCount(10000),
+//       esb.TermsSplitLookup("user_lists", "ids", func(chunk int) string {
+//           return fmt.Sprintf("blocked-%d", chunk)
+//       }),
+//   )
+func TermsSplitLookup(index, path string, id func(chunk int) string) TermsOfOption {
+	return func(o *termsOfOptions) {
+		o.lookup = &termsOfLookup{index: index, path: path, id: id}
+	}
+}
+
+// TermsOf 创建一个多词项查询，接收任意可比较类型的切片，自动去重并保持原有顺序。
+// 超过 2^53 的整数使用字符串表示，避免序列化时丢失精度。
+// 值的数量超过 TermsMaxCount 时，拆分为多个 terms 查询组成的 bool should 查询（或 TermsSplitLookup 指定的 terms lookup）。
+//
+// 示例：
+//   esb.TermsOf("user_id", []int64{1, 2, 2, 3})          // {"terms":{"user_id":[1,2,3]}}
+//   esb.TermsOf("status", []OrderStatus{Paid, Shipped})
+func TermsOf[T comparable](field string, values []T, opts ...TermsOfOption) QueryOption {
+	options := buildTermsOfOptions(opts)
+	chunks := chunkFieldValues(dedupe(values), options.maxCount)
+	return termsOfQuery(chunks, func(chunk int, values []types.FieldValue) types.Query {
+		if options.lookup != nil && len(chunks) > 1 {
+			return options.lookup.query(field, chunk)
+		}
+		return types.Query{Terms: &types.TermsQuery{
+			TermsQuery: map[string]types.TermsQueryField{
+				field: values,
+			},
+		}}
+	})
+}
+
+// IDsOf 创建一个 IDs 查询，接收任意可比较类型的切片，自动去重并转换为字符串。
+// 实现了 fmt.Stringer 的类型使用 String() 的结果。超过最大数量时的拆分规则与 TermsOf 相同，
+// terms lookup 作用于 _id 字段。
+//
+// 示例：
+//   esb.IDsOf([]int64{1, 2, 3})
+//   esb.IDsOf([]uuid.UUID{a, b})
+func IDsOf[T comparable](ids []T, opts ...TermsOfOption) QueryOption {
+	options := buildTermsOfOptions(opts)
+	unique := dedupe(ids)
+	strs := make([]string, 0, len(unique))
+	for _, id := range unique {
+		strs = append(strs, idString(id))
+	}
+	chunks := chunkFieldValues(strs, options.maxCount)
+	return termsOfQuery(chunks, func(chunk int, values []types.FieldValue) types.Query {
+		if options.lookup != nil && len(chunks) > 1 {
+			return options.lookup.query("_id", chunk)
+		}
+		idValues := make([]string, 0, len(values))
+		for _, v := range values {
+			idValues = append(idValues, v.(string))
+		}
+		return types.Query{Ids: &types.IdsQuery{
+			Values: idValues,
+		}}
+	})
+}
+
+// TermsChunks 对值去重后按 size 分段，与 TermsOf、IDsOf 的拆分方式一致，用于提前写入 terms lookup 文档。
+// size 小于等于 0 时使用 DefaultMaxTermsCount。
+func TermsChunks[T comparable](values []T, size int) [][]T {
+	unique := dedupe(values)
+	if size <= 0 {
+		size = DefaultMaxTermsCount
+	}
+	var chunks [][]T
+	for start := 0; start < len(unique); start += size {
+		end := min(start+size, len(unique))
+		chunks = append(chunks, unique[start:end])
+	}
+	return chunks
+}
+
+func (l *termsOfLookup) query(field string, chunk int) types.Query {
+	var q types.Query
+	TermsLookup(field, l.index, l.id(chunk), l.path)(&q)
+	return q
+}
+
+func buildTermsOfOptions(opts []TermsOfOption) termsOfOptions {
+	options := termsOfOptions{maxCount: DefaultMaxTermsCount}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&options)
+		}
+	}
+	if options.maxCount <= 0 {
+		options.maxCount = DefaultMaxTermsCount
+	}
+	return options
+}
+
+// termsOfQuery 只有一段时直接使用该段的查询，多段时组合为 bool should 查询。
+func termsOfQuery(chunks [][]types.FieldValue, build func(chunk int, values []types.FieldValue) types.Query) QueryOption {
+	return func(q *types.Query) {
+		if len(chunks) <= 1 {
+			var values []types.FieldValue
+			if len(chunks) == 1 {
+				values = chunks[0]
+			} else {
+				values = []types.FieldValue{}
+			}
+			query := build(0, values)
+			q.Terms, q.Ids = query.Terms, query.Ids
+			return
+		}
+		should := make([]types.Query, 0, len(chunks))
+		for i, chunk := range chunks {
+			should = append(should, build(i, chunk))
+		}
+		q.Bool = &types.BoolQuery{
+			Should:             should,
+			MinimumShouldMatch: 1,
+		}
+	}
+}
+
+func dedupe[T comparable](values []T) []T {
+	seen := make(map[T]struct{}, len(values))
+	unique := make([]T, 0, len(values))
+	for _, v := range values {
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		unique = append(unique, v)
+	}
+	return unique
+}
+
+func chunkFieldValues[T comparable](values []T, size int) [][]types.FieldValue {
+	var chunks [][]types.FieldValue
+	for start := 0; start < len(values); start += size {
+		end := min(start+size, len(values))
+		chunk := make([]types.FieldValue, 0, end-start)
+		for _, v := range values[start:end] {
+			chunk = append(chunk, termValue(v))
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// termValue 将超过 2^53 的整数转换为字符串。types.FieldValue 会原样保存 int64，
+// 但 types.Query 的 MarshalJSON 重新编码时会将其舍入为 float64，原因见 intRangeValue。
+func termValue(v any) types.FieldValue {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n := rv.Int(); n > maxExactInt || n < -maxExactInt {
+			return strconv.FormatInt(n, 10)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n := rv.Uint(); n > maxExactInt {
+			return strconv.FormatUint(n, 10)
+		}
+	}
+	return v
+}
+
+func idString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(v)
+}
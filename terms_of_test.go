@@ -0,0 +1,130 @@
+package esb
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type termsOfStatus string
+
+type termsOfID int64
+
+func (id termsOfID) String() string {
+	return fmt.Sprintf("u-%d", int64(id))
+}
+
+func TestTermsOf(t *testing.T) {
+	tests := []struct {
+		name  string
+		query QueryOption
+		want  string
+	}{
+		{
+			"int64去重并保持顺序",
+			TermsOf("user_id", []int64{3, 1, 3, 2, 1}),
+			`{"terms":{"user_id":[3,1,2]}}`,
+		},
+		{
+			"字符串",
+			TermsOf("tag", []string{"go", "es", "go"}),
+			`{"terms":{"tag":["go","es"]}}`,
+		},
+		{
+			"自定义类型",
+			TermsOf("status", []termsOfStatus{"paid", "shipped"}),
+			`{"terms":{"status":["paid","shipped"]}}`,
+		},
+		{
+			"超过2^53的整数使用字符串",
+			TermsOf("id", []uint64{1, 18446744073709551615}),
+			`{"terms":{"id":[1,"18446744073709551615"]}}`,
+		},
+		{
+			"2^53+1的int64使用字符串",
+			TermsOf("id", []int64{9007199254740993}),
+			`{"terms":{"id":["9007199254740993"]}}`,
+		},
+		{
+			"空切片",
+			TermsOf("id", []int{}),
+			`{"terms":{"id":[]}}`,
+		},
+		{
+			"超过最大数量拆分为should",
+			TermsOf("id", []int{1, 2, 3, 4, 5}, TermsMaxCount(2)),
+			`{"bool":{"minimum_should_match":1,"should":[{"terms":{"id":[1,2]}},{"terms":{"id":[3,4]}},{"terms":{"id":[5]}}]}}`,
+		},
+		{
+			"去重后不超过最大数量时不拆分",
+			TermsOf("id", []int{1, 1, 2, 2}, TermsMaxCount(2)),
+			`{"terms":{"id":[1,2]}}`,
+		},
+		{
+			"超过最大数量拆分为terms lookup",
+			TermsOf("id", []int{1, 2, 3}, TermsMaxCount(2), TermsSplitLookup("lists", "ids", func(chunk int) string {
+				return fmt.Sprintf("blocked-%d", chunk)
+			})),
+			`{"bool":{"minimum_should_match":1,"should":[{"terms":{"id":{"id":"blocked-0","index":"lists","path":"ids"}}},{"terms":{"id":{"id":"blocked-1","index":"lists","path":"ids"}}}]}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mustJSON(t, NewQuery(tt.query)); got != tt.want {
+				t.Errorf("期望 %s, 实际得到 %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestIDsOf(t *testing.T) {
+	tests := []struct {
+		name  string
+		query QueryOption
+		want  string
+	}{
+		{
+			"整数转换为字符串",
+			IDsOf([]int64{1, 2, 2, 9223372036854775807}),
+			`{"ids":{"values":["1","2","9223372036854775807"]}}`,
+		},
+		{
+			"使用String方法",
+			IDsOf([]termsOfID{7, 8, 7}),
+			`{"ids":{"values":["u-7","u-8"]}}`,
+		},
+		{
+			"超过最大数量拆分为should",
+			IDsOf([]string{"a", "b", "c"}, TermsMaxCount(2)),
+			`{"bool":{"minimum_should_match":1,"should":[{"ids":{"values":["a","b"]}},{"ids":{"values":["c"]}}]}}`,
+		},
+		{
+			"terms lookup作用于_id",
+			IDsOf([]string{"a", "b", "c"}, TermsMaxCount(2), TermsSplitLookup("lists", "ids", func(chunk int) string {
+				return fmt.Sprint(chunk)
+			})),
+			`{"bool":{"minimum_should_match":1,"should":[{"terms":{"_id":{"id":"0","index":"lists","path":"ids"}}},{"terms":{"_id":{"id":"1","index":"lists","path":"ids"}}}]}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mustJSON(t, NewQuery(tt.query)); got != tt.want {
+				t.Errorf("期望 %s, 实际得到 %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTermsChunks(t *testing.T) {
+	got := TermsChunks([]int{1, 2, 2, 3, 4, 5}, 2)
+	want := [][]int{{1, 2}, {3, 4}, {5}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("期望 %v, 实际得到 %v", want, got)
+	}
+	if got := TermsChunks([]int{1, 2}, 0); len(got) != 1 {
+		t.Errorf("期望size为0时使用默认值, 实际得到 %v", got)
+	}
+	if got := TermsChunks([]int(nil), 2); got != nil {
+		t.Errorf("期望空切片返回nil, 实际得到 %v", got)
+	}
+}
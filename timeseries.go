@@ -0,0 +1,356 @@
+package esb
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/calendarinterval"
+)
+
+var (
+	// ErrInvalidInterval 日期直方图的间隔无法识别
+	ErrInvalidInterval = errors.New("invalid date histogram interval")
+)
+
+var fixedIntervalPattern = regexp.MustCompile(`^([1-9][0-9]*)(ms|s|m|h|d)$`)
+
+// TimeWindow 表示时间序列的时间窗口 [From, To)，Location 为分桶使用的时区，为 nil 时使用 UTC。
+type TimeWindow struct {
+	From     time.Time
+	To       time.Time
+	Location *time.Location
+}
+
+// LastTimeWindow 返回截至 now 的最近 d 时间的窗口。
+//
+// 示例：
+//   window := esb.LastTimeWindow(time.Now(), 7*24*time.Hour, shanghai)
+func LastTimeWindow(now time.Time, d time.Duration, location *time.Location) TimeWindow {
+	return TimeWindow{From: now.Add(-d), To: now, Location: location}
+}
+
+func (w TimeWindow) location() *time.Location {
+	if w.Location == nil {
+		return time.UTC
+	}
+	return w.Location
+}
+
+// timeZone 返回 Elasticsearch 可以识别的时区。使用 IANA 名称才能让跨越夏令时的窗口按当地时间分桶，
+// 只有无法确定名称时（如 time.FixedZone）才使用 From 时刻的 UTC 偏移。
+func (w TimeWindow) timeZone() string {
+	if name, ok := ianaZoneName(w.location()); ok {
+		return name
+	}
+	return w.From.In(w.location()).Format("-07:00")
+}
+
+// Keys 返回窗口内按 interval 分桶的所有桶 key（桶的起始时间），与 Elasticsearch 的分桶方式一致。
+// interval 可以是日历间隔（minute、1h、day、1w、month、1q、year 等）或固定间隔（30s、90m、12h、2d 等）。
+func (w TimeWindow) Keys(interval string) ([]time.Time, error) {
+	step, err := parseHistogramInterval(interval)
+	if err != nil {
+		return nil, err
+	}
+	if !w.From.Before(w.To) {
+		return nil, nil
+	}
+	location := w.location()
+	var keys []time.Time
+	for key := step.round(w.From.In(location)); key.Before(w.To); key = step.next(key) {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// histogramInterval 描述日期直方图的间隔，calendar 不为空时为日历间隔，否则为固定间隔 fixed。
+type histogramInterval struct {
+	calendar string
+	fixed    time.Duration
+}
+
+func parseHistogramInterval(interval string) (histogramInterval, error) {
+	switch interval {
+	case "minute", "1m":
+		return histogramInterval{calendar: "minute"}, nil
+	case "hour", "1h":
+		return histogramInterval{calendar: "hour"}, nil
+	case "day", "1d":
+		return histogramInterval{calendar: "day"}, nil
+	case "week", "1w":
+		return histogramInterval{calendar: "week"}, nil
+	case "month", "1M":
+		return histogramInterval{calendar: "month"}, nil
+	case "quarter", "1q":
+		return histogramInterval{calendar: "quarter"}, nil
+	case "year", "1y":
+		return histogramInterval{calendar: "year"}, nil
+	}
+	matches := fixedIntervalPattern.FindStringSubmatch(interval)
+	if matches == nil {
+		return histogramInterval{}, fmt.Errorf("%w: %q", ErrInvalidInterval, interval)
+	}
+	n, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return histogramInterval{}, fmt.Errorf("%w: %q", ErrInvalidInterval, interval)
+	}
+	unit := map[string]time.Duration{
+		"ms": time.Millisecond,
+		"s":  time.Second,
+		"m":  time.Minute,
+		"h":  time.Hour,
+		"d":  24 * time.Hour,
+	}[matches[2]]
+	return histogramInterval{fixed: time.Duration(n) * unit}, nil
+}
+
+// round 返回 t 所在桶的起始时间。
+func (i histogramInterval) round(t time.Time) time.Time {
+	y, m, d := t.Date()
+	location := t.Location()
+	switch i.calendar {
+	case "minute":
+		return time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, location)
+	case "hour":
+		return time.Date(y, m, d, t.Hour(), 0, 0, 0, location)
+	case "day":
+		return time.Date(y, m, d, 0, 0, 0, 0, location)
+	case "week":
+		weekday := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-weekday, 0, 0, 0, 0, location)
+	case "month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, location)
+	case "quarter":
+		return time.Date(y, (m-1)/3*3+1, 1, 0, 0, 0, 0, location)
+	case "year":
+		return time.Date(y, 1, 1, 0, 0, 0, 0, location)
+	}
+	_, offset := t.Zone()
+	local := t.UnixMilli() + int64(offset)*1000
+	size := i.fixed.Milliseconds()
+	rounded := local - ((local%size)+size)%size
+	return time.UnixMilli(rounded - int64(offset)*1000).In(location)
+}
+
+// next 返回下一个桶的起始时间。
+func (i histogramInterval) next(t time.Time) time.Time {
+	switch i.calendar {
+	case "minute":
+		return t.Add(time.Minute)
+	case "hour":
+		return t.Add(time.Hour)
+	case "day":
+		return t.AddDate(0, 0, 1)
+	case "week":
+		return t.AddDate(0, 0, 7)
+	case "month":
+		return t.AddDate(0, 1, 0)
+	case "quarter":
+		return t.AddDate(0, 3, 0)
+	case "year":
+		return t.AddDate(1, 0, 0)
+	}
+	return i.round(t.Add(i.fixed))
+}
+
+// TimeSeriesAgg 创建覆盖整个时间窗口的日期直方图聚合：设置 min_doc_count 为 0 和 extended_bounds，
+// 使窗口内没有文档的桶也会返回，并使用窗口的时区分桶。查询本身仍需要使用 Range 过滤时间窗口。
+// interval 无法识别时 panic，适用于间隔为常量的情况；间隔来自外部输入时使用 NewTimeSeriesAgg。
+//
+// 示例：
+//   window := esb.TimeWindow{From: from, To: to, Location: shanghai}
+//   aggs := esb.NewAggregations(
+//       esb.TimeSeriesAgg("per_day", "timestamp", "day", window,
+//           esb.SumAgg("revenue", "price"),
+//           esb.TermsAgg("category", "category"),
+//       ),
+//   )
+func TimeSeriesAgg(name, field, interval string, window TimeWindow, subAggs ...AggregationOption) AggregationOption {
+	agg, err := NewTimeSeriesAgg(name, field, interval, window, subAggs...)
+	if err != nil {
+		panic(err)
+	}
+	return agg
+}
+
+// NewTimeSeriesAgg 与 TimeSeriesAgg 相同，interval 无法识别时返回 ErrInvalidInterval。
+//
+// 示例：
+//   agg, err := esb.NewTimeSeriesAgg("per_bucket", "timestamp", r.URL.Query().Get("interval"), window)
+//   if errors.Is(err, esb.ErrInvalidInterval) {
+//       // 返回 400
+//   }
+func NewTimeSeriesAgg(name, field, interval string, window TimeWindow, subAggs ...AggregationOption) (AggregationOption, error) {
+	step, err := parseHistogramInterval(interval)
+	if err != nil {
+		return nil, err
+	}
+	return func(aggs *types.Aggregations) {
+		minDocCount := 0
+		timeZone := window.timeZone()
+		agg := &types.DateHistogramAggregation{
+			Field:       &field,
+			MinDocCount: &minDocCount,
+			TimeZone:    &timeZone,
+			ExtendedBounds: &types.ExtendedBoundsFieldDateMath{
+				Min: window.From.UnixMilli(),
+				Max: window.To.UnixMilli() - 1,
+			},
+		}
+		if step.calendar == "" {
+			agg.FixedInterval = interval
+		} else {
+			agg.CalendarInterval = &calendarinterval.CalendarInterval{Name: interval}
+		}
+		aggs.Aggregations[name] = withSubAggs(types.Aggregations{DateHistogram: agg}, subAggs)
+	}, nil
+}
+
+// TimeSeriesTable 是日期直方图转换后的稠密表格，每行对应窗口内的一个桶，缺失的值填充为 0。
+//
+// 列名使用 buckets_path 语法：_count 为桶的文档数量，度量聚合为聚合名称，多值度量聚合为 name.avg、name[99.0]，
+// 子桶聚合为 category['books']>_count、category['books']>revenue。
+type TimeSeriesTable struct {
+	Times   []time.Time
+	Columns []string
+	Values  [][]float64
+}
+
+// DecodeTimeSeries 将名为 name 的日期直方图结果转换为稠密表格，interval 与 window 需要与 TimeSeriesAgg 一致。
+// 窗口外的桶会被忽略。
+//
+// 示例：
+//   table, err := esb.DecodeTimeSeries(response.Aggregations, "per_day", "day", window)
+//   revenue := table.Column("revenue")
+//   books := table.Column("category['books']>_count")
+func DecodeTimeSeries(aggs map[string]types.Aggregate, name, interval string, window TimeWindow) (*TimeSeriesTable, error) {
+	keys, err := window.Keys(interval)
+	if err != nil {
+		return nil, err
+	}
+	aggregate, err := AggregateAs[*types.DateHistogramAggregate](aggs, name)
+	if err != nil {
+		return nil, err
+	}
+	rows := make(map[int64]int, len(keys))
+	for i, key := range keys {
+		rows[key.UnixMilli()] = i
+	}
+	table := &TimeSeriesTable{Times: keys}
+	columns := make(map[string]int)
+	cells := make([]map[int]float64, len(keys))
+	buckets, _, _ := aggregateBuckets(aggregate)
+	for _, bucket := range buckets {
+		millis, ok := bucket.rawKey.(int64)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s: unexpected bucket key %v", ErrAggregateType, name, bucket.rawKey)
+		}
+		row, ok := rows[millis]
+		if !ok {
+			continue
+		}
+		flattenBucketColumns("", bucket, func(column string, value float64) {
+			index, exists := columns[column]
+			if !exists {
+				index = len(table.Columns)
+				columns[column] = index
+				table.Columns = append(table.Columns, column)
+			}
+			if cells[row] == nil {
+				cells[row] = make(map[int]float64)
+			}
+			cells[row][index] = value
+		})
+	}
+	table.Values = make([][]float64, len(keys))
+	for row := range table.Values {
+		table.Values[row] = make([]float64, len(table.Columns))
+		for index, value := range cells[row] {
+			table.Values[row][index] = value
+		}
+	}
+	return table, nil
+}
+
+// flattenBucketColumns 将桶的文档数量、度量子聚合和子桶聚合展开为列，列名使用 buckets_path 语法。
+func flattenBucketColumns(prefix string, bucket aggBucket, add func(column string, value float64)) {
+	add(prefix+string(DocCountPath), float64(bucket.docCount))
+	for _, name := range sortedAggregateNames(bucket.aggs) {
+		aggregate := bucket.aggs[name]
+		if values, ok := metricValues(aggregate); ok {
+			for _, v := range values {
+				add(prefix+metricColumn(name, v.name), v.value)
+			}
+			continue
+		}
+		buckets, multi, ok := aggregateBuckets(aggregate)
+		if !ok {
+			continue
+		}
+		for _, child := range buckets {
+			path := AggPath(name)
+			if multi {
+				path = path.Key(child.key)
+			}
+			flattenBucketColumns(prefix+string(path)+">", child, add)
+		}
+	}
+}
+
+// metricColumn 返回度量值的列名，百分位使用 name[99.0]，其他多值度量使用 name.avg。
+func metricColumn(name, value string) string {
+	if value == "" {
+		return name
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return name + "[" + value + "]"
+	}
+	return name + "." + value
+}
+
+func sortedAggregateNames(aggs map[string]types.Aggregate) []string {
+	names := make([]string, 0, len(aggs))
+	for name := range aggs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Column 返回名为 name 的列，列不存在时返回 nil。
+func (t *TimeSeriesTable) Column(name string) []float64 {
+	for index, column := range t.Columns {
+		if column != name {
+			continue
+		}
+		values := make([]float64, len(t.Values))
+		for row := range t.Values {
+			values[row] = t.Values[row][index]
+		}
+		return values
+	}
+	return nil
+}
+
+// Records 返回包含表头的字符串表格，第一列为按 layout 格式化的时间，可以直接交给 csv.Writer.WriteAll。
+//
+// 示例：
+//   err := csv.NewWriter(w).WriteAll(table.Records(time.DateOnly))
+func (t *TimeSeriesTable) Records(layout string) [][]string {
+	records := make([][]string, 0, len(t.Times)+1)
+	records = append(records, append([]string{"time"}, t.Columns...))
+	for row, key := range t.Times {
+		record := make([]string, 0, len(t.Columns)+1)
+		record = append(record, key.Format(layout))
+		for _, value := range t.Values[row] {
+			record = append(record, strconv.FormatFloat(value, 'f', -1, 64))
+		}
+		records = append(records, record)
+	}
+	return records
+}
@@ -0,0 +1,159 @@
+package esb
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTimeWindowKeys(t *testing.T) {
+	shanghai := time.FixedZone("CST", 8*3600)
+	window := TimeWindow{
+		From:     time.Date(2024, 1, 30, 10, 0, 0, 0, shanghai),
+		To:       time.Date(2024, 4, 2, 0, 0, 0, 0, shanghai),
+		Location: shanghai,
+	}
+	tests := []struct {
+		interval string
+		count    int
+		first    time.Time
+	}{
+		{"month", 4, time.Date(2024, 1, 1, 0, 0, 0, 0, shanghai)},
+		{"1q", 2, time.Date(2024, 1, 1, 0, 0, 0, 0, shanghai)},
+		{"week", 10, time.Date(2024, 1, 29, 0, 0, 0, 0, shanghai)},
+		{"day", 63, time.Date(2024, 1, 30, 0, 0, 0, 0, shanghai)},
+		{"12h", 126, time.Date(2024, 1, 30, 0, 0, 0, 0, shanghai)},
+	}
+	for _, tt := range tests {
+		keys, err := window.Keys(tt.interval)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != tt.count || !keys[0].Equal(tt.first) {
+			t.Errorf("%s: 期望 %d 个桶且从 %v 开始, 实际得到 %d 个, 第一个为 %v", tt.interval, tt.count, tt.first, len(keys), keys[0])
+		}
+	}
+	if _, err := window.Keys("fortnight"); !errors.Is(err, ErrInvalidInterval) {
+		t.Errorf("期望ErrInvalidInterval, 实际得到: %v", err)
+	}
+}
+
+func TestTimeSeriesAgg(t *testing.T) {
+	window := TimeWindow{
+		From:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC),
+		Location: time.UTC,
+	}
+	data, err := json.Marshal(NewAggregations(TimeSeriesAgg("per_day", "timestamp", "day", window, SumAgg("revenue", "price"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"per_day":{"aggregations":{"revenue":{"sum":{"field":"price"}}},"date_histogram":{"calendar_interval":"day","extended_bounds":{"max":1704326399999,"min":1704067200000},"field":"timestamp","min_doc_count":0,"time_zone":"UTC"}}}`
+	if string(data) != want {
+		t.Errorf("期望 %s, 实际得到 %s", want, data)
+	}
+	data, _ = json.Marshal(NewAggregations(TimeSeriesAgg("per_6h", "timestamp", "6h", window)))
+	want = `{"per_6h":{"date_histogram":{"extended_bounds":{"max":1704326399999,"min":1704067200000},"field":"timestamp","fixed_interval":"6h","min_doc_count":0,"time_zone":"UTC"}}}`
+	if string(data) != want {
+		t.Errorf("期望 %s, 实际得到 %s", want, data)
+	}
+
+	if _, err := NewTimeSeriesAgg("per_bucket", "timestamp", "fortnight", window); !errors.Is(err, ErrInvalidInterval) {
+		t.Errorf("期望ErrInvalidInterval, 实际得到: %v", err)
+	}
+	defer func() {
+		if err, _ := recover().(error); !errors.Is(err, ErrInvalidInterval) {
+			t.Errorf("期望无法识别的间隔panic ErrInvalidInterval, 实际得到: %v", err)
+		}
+	}()
+	TimeSeriesAgg("per_bucket", "timestamp", "fortnight", window)
+}
+
+func TestTimeWindowTimeZone(t *testing.T) {
+	dir := t.TempDir()
+	zoneFile := filepath.Join(dir, "zoneinfo", "Europe", "Berlin")
+	if err := os.MkdirAll(filepath.Dir(zoneFile), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(zoneFile, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "localtime")
+	if err := os.Symlink(zoneFile, link); err != nil {
+		t.Fatal(err)
+	}
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip("缺少时区数据")
+	}
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		tz       string
+		location *time.Location
+		want     string
+	}{
+		{"time.Local使用TZ的IANA名称", "America/New_York", time.Local, "America/New_York"},
+		{"TZ以冒号开头", ":Asia/Shanghai", time.Local, "Asia/Shanghai"},
+		{"TZ为空表示UTC", "", time.Local, "UTC"},
+		{"TZ为时区文件路径", link, time.Local, "Europe/Berlin"},
+		{"IANA时区", "", tokyo, "Asia/Tokyo"},
+		{"固定偏移使用From时刻的偏移", "", time.FixedZone("CST", 8*3600), "+08:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TZ", tt.tz)
+			window := TimeWindow{From: from, To: from.AddDate(0, 6, 0), Location: tt.location}
+			if got := window.timeZone(); got != tt.want {
+				t.Errorf("期望 %s, 实际得到 %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDecodeTimeSeries(t *testing.T) {
+	window := TimeWindow{
+		From: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC),
+	}
+	response := decodeTestAggregations(t, `{"aggregations":{"date_histogram#per_day":{"buckets":[
+		{"key":1703980800000,"doc_count":9},
+		{"key":1704067200000,"doc_count":3,"sum#revenue":{"value":30},
+		 "stats#price":{"count":3,"min":5,"max":15,"avg":10,"sum":30},
+		 "sterms#category":{"buckets":[{"key":"books","doc_count":2,"sum#revenue":{"value":20}},{"key":"toys","doc_count":1,"sum#revenue":{"value":10}}]}},
+		{"key":1704240000000,"doc_count":1,"sum#revenue":{"value":7.5},
+		 "stats#price":{"count":1,"min":7.5,"max":7.5,"avg":7.5,"sum":7.5},
+		 "sterms#category":{"buckets":[{"key":"books","doc_count":1,"sum#revenue":{"value":7.5}}]}}
+	]}}}`)
+	table, err := DecodeTimeSeries(response.Aggregations, "per_day", "day", window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(table.Times) != 3 {
+		t.Fatalf("期望窗口内3行, 实际得到 %d", len(table.Times))
+	}
+	columns := []string{
+		"_count",
+		"category['books']>_count", "category['books']>revenue",
+		"category['toys']>_count", "category['toys']>revenue",
+		"price.avg", "price.count", "price.max", "price.min", "price.sum",
+		"revenue",
+	}
+	if !reflect.DeepEqual(table.Columns, columns) {
+		t.Errorf("期望列 %v, 实际得到 %v", columns, table.Columns)
+	}
+	if got := table.Column("revenue"); !reflect.DeepEqual(got, []float64{30, 0, 7.5}) {
+		t.Errorf("期望缺失的桶填充为0, 实际得到 %v", got)
+	}
+	if got := table.Column("category['toys']>_count"); !reflect.DeepEqual(got, []float64{1, 0, 0}) {
+		t.Errorf("期望子桶缺失时填充为0, 实际得到 %v", got)
+	}
+	records := table.Records(time.DateOnly)
+	if len(records) != 4 || records[0][0] != "time" || records[2][0] != "2024-01-02" || records[3][len(columns)] != "7.5" {
+		t.Errorf("表格记录错误: %v", records)
+	}
+}